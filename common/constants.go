@@ -35,6 +35,10 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// TokenHashSecret 令牌哈希存储使用的 HMAC 密钥，TokenKeyHashEnabled 为 false 时令牌仍以明文保存
+var TokenHashSecret = CryptoSecret
+var TokenKeyHashEnabled = false
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
@@ -211,10 +215,14 @@ const (
 	ChannelStatusEnabled          = 1 // don't use 0, 0 is the default value!
 	ChannelStatusManuallyDisabled = 2 // also don't use 0
 	ChannelStatusAutoDisabled     = 3
+	ChannelStatusMaintenance      = 4 // 维护中：不再接收新请求，已在处理的请求正常完成
 )
 
 const (
 	TopUpStatusPending = "pending"
 	TopUpStatusSuccess = "success"
 	TopUpStatusExpired = "expired"
+	// 管理员发起退款后、网关确认前的中间状态，此时额度已经扣回
+	TopUpStatusRefunding = "refunding"
+	TopUpStatusRefunded  = "refunded"
 )
@@ -1,11 +1,18 @@
 package common
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
 )
 
 func GenerateHMACWithKey(key []byte, data string) string {
@@ -20,6 +27,11 @@ func GenerateHMAC(data string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// HashTokenKey 计算令牌的 HMAC 哈希，用于数据库存储与缓存键
+func HashTokenKey(key string) string {
+	return GenerateHMACWithKey([]byte(TokenHashSecret), key)
+}
+
 func Password2Hash(password string) (string, error) {
 	passwordBytes := []byte(password)
 	hashedPassword, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
@@ -30,3 +42,93 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+const (
+	passphraseVersionLegacy = "v1:" // 口令的 SHA-256 作为密钥，仅用于解密旧数据
+	passphraseVersionScrypt = "v2:" // scrypt 派生密钥，每个值使用随机盐
+
+	passphraseSaltSize = 16
+	passphraseScryptN  = 1 << 15
+	passphraseScryptR  = 8
+	passphraseScryptP  = 1
+)
+
+// EncryptWithPassphrase 使用 AES-256-GCM 加密，密钥由口令与随机盐经 scrypt 派生，
+// 返回 "v2:" 前缀加 base64 编码的 盐+nonce+密文
+func EncryptWithPassphrase(passphrase string, plaintext string) (string, error) {
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := newPassphraseGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(append(salt, nonce...), nonce, []byte(plaintext), nil)
+	return passphraseVersionScrypt + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptWithPassphrase 解密 EncryptWithPassphrase 的结果，兼容 "v1:" 前缀的旧数据
+func DecryptWithPassphrase(passphrase string, ciphertext string) (string, error) {
+	switch {
+	case strings.HasPrefix(ciphertext, passphraseVersionScrypt):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, passphraseVersionScrypt))
+		if err != nil {
+			return "", err
+		}
+		if len(data) < passphraseSaltSize {
+			return "", errors.New("ciphertext too short")
+		}
+		return openWithPassphrase(passphrase, data[:passphraseSaltSize], data[passphraseSaltSize:])
+	case strings.HasPrefix(ciphertext, passphraseVersionLegacy):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, passphraseVersionLegacy))
+		if err != nil {
+			return "", err
+		}
+		return openWithPassphrase(passphrase, nil, data)
+	default:
+		return "", errors.New("unsupported ciphertext version")
+	}
+}
+
+func openWithPassphrase(passphrase string, salt []byte, data []byte) (string, error) {
+	gcm, err := newPassphraseGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// newPassphraseGCM 由口令派生 AES-256 密钥，salt 为 nil 时使用旧版的 SHA-256 派生
+func newPassphraseGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+	var key []byte
+	if salt == nil {
+		sum := sha256.Sum256([]byte(passphrase))
+		key = sum[:]
+	} else {
+		var err error
+		key, err = scrypt.Key([]byte(passphrase), salt, passphraseScryptN, passphraseScryptR, passphraseScryptP, 32)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
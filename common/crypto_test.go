@@ -0,0 +1,42 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassphraseEncryption(t *testing.T) {
+	a, err := EncryptWithPassphrase("secret", "sk-test")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(a, "v2:"))
+	b, err := EncryptWithPassphrase("secret", "sk-test")
+	require.NoError(t, err)
+	// 每个值使用随机盐与 nonce
+	require.NotEqual(t, a, b)
+
+	plaintext, err := DecryptWithPassphrase("secret", a)
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", plaintext)
+	_, err = DecryptWithPassphrase("other", a)
+	require.Error(t, err)
+	_, err = DecryptWithPassphrase("secret", strings.TrimPrefix(a, "v2:"))
+	require.Error(t, err)
+
+	// 兼容 SHA-256 派生密钥的旧数据
+	key := sha256.Sum256([]byte("secret"))
+	block, err := aes.NewCipher(key[:])
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := "v1:" + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("sk-old"), nil))
+	plaintext, err = DecryptWithPassphrase("secret", legacy)
+	require.NoError(t, err)
+	require.Equal(t, "sk-old", plaintext)
+}
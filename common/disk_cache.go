@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,8 @@ type DiskCacheType string
 const (
 	DiskCacheTypeBody DiskCacheType = "body" // 请求体缓存
 	DiskCacheTypeFile DiskCacheType = "file" // 文件数据缓存
+	// DiskCacheTypeCapture 请求/响应抓取，生命周期由抓取 TTL 控制，不参与通用清理
+	DiskCacheTypeCapture DiskCacheType = "capture"
 )
 
 // 统一的缓存目录名
@@ -119,7 +122,7 @@ func CleanupOldDiskCacheFiles(maxAge time.Duration) error {
 
 	now := time.Now()
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() || isDiskCacheFileOfType(entry.Name(), DiskCacheTypeCapture) {
 			continue
 		}
 		info, err := entry.Info()
@@ -137,6 +140,41 @@ func CleanupOldDiskCacheFiles(maxAge time.Duration) error {
 	return nil
 }
 
+func isDiskCacheFileOfType(name string, cacheType DiskCacheType) bool {
+	return strings.HasPrefix(name, string(cacheType)+"-")
+}
+
+// CleanupOldDiskCacheFilesByType 清理指定类型的旧缓存文件（不计入磁盘缓存统计的类型使用）
+func CleanupOldDiskCacheFilesByType(cacheType DiskCacheType, maxAge time.Duration) (int, error) {
+	dir := GetDiskCacheDir()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() || !isDiskCacheFileOfType(entry.Name(), cacheType) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > maxAge {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
 // GetDiskCacheInfo 获取磁盘缓存目录信息
 func GetDiskCacheInfo() (fileCount int, totalSize int64, err error) {
 	dir := GetDiskCacheDir()
@@ -26,6 +26,7 @@ func printHelp() {
 	fmt.Println("Original Project: OneAPI by JustSong - https://github.com/songquanpeng/one-api")
 	fmt.Println("Maintainer: QuantumNous - https://github.com/QuantumNous/new-api")
 	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("       newapi config export|import [options]")
 }
 
 func InitEnv() {
@@ -61,6 +62,16 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	if os.Getenv("TOKEN_HASH_SECRET") != "" {
+		TokenHashSecret = os.Getenv("TOKEN_HASH_SECRET")
+	} else {
+		TokenHashSecret = CryptoSecret
+	}
+	// 未配置任何固定密钥时 CryptoSecret 每次启动随机生成，令牌哈希无法跨重启校验，只能继续明文保存
+	TokenKeyHashEnabled = os.Getenv("TOKEN_HASH_SECRET") != "" || os.Getenv("CRYPTO_SECRET") != "" || os.Getenv("SESSION_SECRET") != ""
+	if !TokenKeyHashEnabled {
+		log.Println("WARNING: TOKEN_HASH_SECRET, CRYPTO_SECRET and SESSION_SECRET are not set, API tokens will be stored in plaintext.")
+	}
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -147,6 +158,26 @@ func initConstantEnv() {
 	constant.TaskQueryLimit = GetEnvOrDefault("TASK_QUERY_LIMIT", 1000)
 	// 异步任务超时时间（分钟），超过此时间未完成的任务将被标记为失败并退款。0 表示禁用。
 	constant.TaskTimeoutMinutes = GetEnvOrDefault("TASK_TIMEOUT_MINUTES", 1440)
+	// Prometheus 指标导出
+	constant.MetricsEnabled = GetEnvOrDefaultBool("METRICS_ENABLED", false)
+	constant.MetricsListenAddr = GetEnvOrDefaultString("METRICS_LISTEN_ADDR", "")
+	constant.MetricsToken = GetEnvOrDefaultString("METRICS_TOKEN", "")
+	// OpenTelemetry 链路追踪
+	constant.TracingEnabled = GetEnvOrDefaultBool("TRACING_ENABLED", false)
+	constant.TracingExporter = GetEnvOrDefaultString("TRACING_EXPORTER", "otlp")
+	constant.TracingEndpoint = GetEnvOrDefaultString("TRACING_ENDPOINT", "")
+	constant.TracingServiceName = GetEnvOrDefaultString("TRACING_SERVICE_NAME", "new-api")
+	constant.TracingSampleRatio = 1
+	if ratio, err := strconv.ParseFloat(GetEnvOrDefaultString("TRACING_SAMPLE_RATIO", "1"), 64); err == nil && ratio > 0 && ratio <= 1 {
+		constant.TracingSampleRatio = ratio
+	}
+	constant.TracingPropagateUpstream = GetEnvOrDefaultBool("TRACING_PROPAGATE_UPSTREAM", false)
+	constant.FileStore = GetEnvOrDefaultString("FILE_STORE", constant.FileStoreDB)
+	constant.FileStoreDir = GetEnvOrDefaultString("FILE_STORE_DIR", "")
+	constant.CacheEventsEnabled = GetEnvOrDefaultBool("CACHE_EVENTS_ENABLED", true)
+	constant.ConfigSnapshotSecret = GetEnvOrDefaultString("CONFIG_SNAPSHOT_SECRET", "")
+	constant.EncryptionMasterKeys = GetEnvOrDefaultString("ENCRYPTION_MASTER_KEYS", "")
+	constant.EncryptionMasterKeyFile = GetEnvOrDefaultString("ENCRYPTION_MASTER_KEY_FILE", "")
 
 	soraPatchStr := GetEnvOrDefaultString("TASK_PRICE_PATCH", "")
 	if soraPatchStr != "" {
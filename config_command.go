@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func printConfigCommandUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  newapi config export [--format yaml|json] [--keys redact|encrypt|plain] [--output <file>]")
+	fmt.Fprintln(os.Stderr, "  newapi config import --file <file|-> [--apply] [--prune]")
+}
+
+// runConfigCommand 处理 config 子命令，导出配置快照或导入快照，返回进程退出码
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		printConfigCommandUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "export":
+		format := fs.String("format", service.ConfigFormatYAML, "snapshot format: yaml or json")
+		keys := fs.String("keys", service.ConfigKeyModeRedact, "how to export channel keys and secret options: redact, encrypt or plain")
+		output := fs.String("output", "", "write the snapshot to a file instead of stdout")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		out, err := initConfigCommand()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		data, err := service.ExportConfig(*format, *keys)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export failed: "+err.Error())
+			return 1
+		}
+		if *output != "" {
+			err = os.WriteFile(*output, data, 0600)
+		} else {
+			_, err = out.Write(data)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "write snapshot failed: "+err.Error())
+			return 1
+		}
+		return 0
+	case "import":
+		file := fs.String("file", "", "snapshot file in yaml or json, - for stdin")
+		apply := fs.Bool("apply", false, "apply the changes in one transaction, otherwise only print the plan")
+		prune := fs.Bool("prune", false, "delete vendors, models, prefill groups and channels missing from the snapshot")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *file == "" {
+			printConfigCommandUsage()
+			return 2
+		}
+		var data []byte
+		var err error
+		if *file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*file)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "read snapshot failed: "+err.Error())
+			return 1
+		}
+		out, err := initConfigCommand()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		plan, err := service.ImportConfig(data, *apply, model.ConfigImportOptions{Prune: *prune})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import failed: "+err.Error())
+			return 1
+		}
+		printConfigImportPlan(out, plan)
+		return 0
+	default:
+		printConfigCommandUsage()
+		return 2
+	}
+}
+
+// initConfigCommand 初始化数据库等资源，返回标准输出；初始化期间及之后的日志改写到标准错误，
+// 避免混入导出的快照
+func initConfigCommand() (io.Writer, error) {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	gormlogger.Default = gormlogger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), gormlogger.Config{
+		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:      gormlogger.Warn,
+	})
+	if err := InitResources(); err != nil {
+		return nil, err
+	}
+	// 导入后通知运行中的节点重新加载配置与渠道
+	model.InitCacheEvents()
+	return out, nil
+}
+
+func printConfigImportPlan(w io.Writer, plan *model.ConfigImportPlan) {
+	symbols := map[string]string{
+		model.ConfigChangeCreate: "+",
+		model.ConfigChangeUpdate: "~",
+		model.ConfigChangeDelete: "-",
+	}
+	for _, change := range plan.Changes {
+		fmt.Fprintf(w, "%s %s %s\n", symbols[change.Action], change.Kind, change.Name)
+		for _, field := range change.Fields {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field.Field, formatPlanValue(field.Old), formatPlanValue(field.New))
+		}
+	}
+	switch {
+	case len(plan.Changes) == 0:
+		fmt.Fprintln(w, "no changes")
+	case plan.Applied:
+		fmt.Fprintf(w, "%d change(s) applied\n", len(plan.Changes))
+	default:
+		fmt.Fprintf(w, "%d change(s) planned, re-run with --apply to apply them\n", len(plan.Changes))
+	}
+}
+
+func formatPlanValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	default:
+		data, err := common.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
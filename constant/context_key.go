@@ -19,6 +19,15 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenUsageRateLimit    ContextKey = "token_usage_rate_limit"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenOrgId             ContextKey = "token_org_id"
+	ContextKeyTokenCaptureUntil      ContextKey = "token_capture_until"
+	ContextKeyTokenGuardrailPolicy   ContextKey = "token_guardrail_policy"
+	ContextKeyTokenPIIRedaction      ContextKey = "token_pii_redaction"
+
+	// ContextKeyBatchId 批处理任务内部转发的请求所属的 Batch ID
+	ContextKeyBatchId ContextKey = "batch_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -30,12 +39,15 @@ const (
 	ContextKeyChannelOtherSetting      ContextKey = "channel_other_setting"
 	ContextKeyChannelParamOverride     ContextKey = "param_override"
 	ContextKeyChannelHeaderOverride    ContextKey = "header_override"
+	ContextKeyChannelResponseOverride  ContextKey = "response_override"
 	ContextKeyChannelOrganization      ContextKey = "channel_organization"
 	ContextKeyChannelAutoBan           ContextKey = "auto_ban"
+	ContextKeyChannelCaptureUntil      ContextKey = "channel_capture_until"
 	ContextKeyChannelModelMapping      ContextKey = "model_mapping"
 	ContextKeyChannelStatusCodeMapping ContextKey = "status_code_mapping"
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
+	ContextKeyChannelMultiKeyMode      ContextKey = "channel_multi_key_mode"
 	ContextKeyChannelKey               ContextKey = "channel_key"
 
 	ContextKeyAutoGroup           ContextKey = "auto_group"
@@ -63,6 +75,21 @@ const (
 	// It is not returned to end users, but can be persisted into consume/error logs for debugging.
 	ContextKeyAdminRejectReason ContextKey = "admin_reject_reason"
 
+	// ContextKeyResponseCacheHit marks that the response was served from the response cache without calling upstream.
+	ContextKeyResponseCacheHit ContextKey = "response_cache_hit"
+
+	// ContextKeyModelFallbackPath records the models tried in order when the distributor falls back to another model.
+	ContextKeyModelFallbackPath ContextKey = "model_fallback_path"
+
+	// ContextKeyResponsesStoreResponse holds the raw upstream Responses API response object for the gateway response store.
+	ContextKeyResponsesStoreResponse ContextKey = "responses_store_response"
+
+	// ContextKeyGuardrailState holds the resolved guardrail policy and the decisions made for this request.
+	ContextKeyGuardrailState ContextKey = "guardrail_state"
+
+	// ContextKeyPIIVault holds the in-memory placeholder mapping used to restore redacted PII in the response.
+	ContextKeyPIIVault ContextKey = "pii_vault"
+
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
 )
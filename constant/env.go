@@ -18,6 +18,56 @@ var ErrorLogEnabled bool
 var TaskQueryLimit int
 var TaskTimeoutMinutes int
 
+// MetricsEnabled 是否启用 Prometheus 指标采集与 /metrics 导出
+var MetricsEnabled bool
+
+// MetricsListenAddr 指标独立监听地址（如 :9090），为空时挂载到主服务的 /metrics 并要求管理员鉴权
+var MetricsListenAddr string
+
+// MetricsToken 访问主服务 /metrics 的 Bearer Token，未设置时使用管理员 access token 鉴权
+var MetricsToken string
+
+// TracingEnabled 是否启用 OpenTelemetry 链路追踪
+var TracingEnabled bool
+
+// TracingExporter 链路数据导出方式：otlp（OTLP/HTTP）或 stdout（本地调试）
+var TracingExporter string
+
+// TracingEndpoint OTLP/HTTP 导出地址（如 http://otel-collector:4318），为空时使用 OTEL_EXPORTER_OTLP_* 环境变量
+var TracingEndpoint string
+
+// TracingServiceName 上报的服务名
+var TracingServiceName string
+
+// TracingSampleRatio 根 span 的采样率 (0, 1]，携带 traceparent 的请求沿用上游的采样决定
+var TracingSampleRatio float64
+
+// TracingPropagateUpstream 是否将 traceparent 转发给上游供应商
+var TracingPropagateUpstream bool
+
+// CacheEventsEnabled 是否在修改配置、渠道等数据后发布缓存失效事件，启用 Redis 时其他节点立即重新加载
+var CacheEventsEnabled bool
+
+// ConfigSnapshotSecret 导出配置快照时加密渠道 Key 与敏感配置项使用的口令，导入加密快照的环境需要设置相同的值
+var ConfigSnapshotSecret string
+
+// EncryptionMasterKeys 加密渠道 Key 等敏感数据的主密钥，格式为 "版本:base64 编码的 32 字节密钥"，多个版本用逗号分隔，最大的版本用于加密
+var EncryptionMasterKeys string
+
+// EncryptionMasterKeyFile 主密钥文件路径，每行一个 "版本:base64 密钥"，与 EncryptionMasterKeys 同时设置时优先使用文件
+var EncryptionMasterKeyFile string
+
+const (
+	FileStoreDB    = "db"
+	FileStoreLocal = "local"
+)
+
+// FileStore /v1/files 上传文件的存储后端，db 保存在数据库中（多节点共享），local 保存在 FileStoreDir
+var FileStore string
+
+// FileStoreDir /v1/files 上传文件的本地存储目录，为空时使用磁盘缓存目录下的 files 子目录
+var FileStoreDir string
+
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
 
@@ -3,6 +3,8 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom    MultiKeyMode = "random"     // 随机
+	MultiKeyModePolling   MultiKeyMode = "polling"    // 轮询
+	MultiKeyModeLeastUsed MultiKeyMode = "least_used" // 最久未使用
+	MultiKeyModeRateLimit MultiKeyMode = "rate_limit" // 限流感知，按上游限流响应头冷却 Key
 )
@@ -0,0 +1,736 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	batchCompletionWindow      = "24h"
+	batchCompletionWindowSecs  = 24 * 60 * 60
+	batchTaskInterval          = 10 * time.Second
+	fileCleanupInterval        = time.Hour
+	batchHeartbeatInterval     = 15 * time.Second
+	batchStaleTimeoutSeconds   = 10 * 60
+	batchMaxLineBytes          = 16 << 20
+	batchInterruptedErrorCode  = "batch_interrupted"
+	batchInvalidFileErrorCode  = "invalid_input_file"
+	batchRequestErrorCodeParse = "invalid_request"
+)
+
+// batchEndpointFormats 支持批处理的接口及其对应的转发格式
+var batchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+}
+
+func optionalTimestamp(ts int64) *int64 {
+	if ts == 0 {
+		return nil
+	}
+	return &ts
+}
+
+func optionalFileId(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+func toOpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	result := dto.OpenAIBatch{
+		ID:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileID:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileID:     optionalFileId(batch.OutputFileId),
+		ErrorFileID:      optionalFileId(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(batch.FinalizingAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+	}
+	if batch.Errors != "" {
+		var errs []dto.OpenAIBatchError
+		if err := common.UnmarshalJsonStr(batch.Errors, &errs); err == nil && len(errs) > 0 {
+			result.Errors = &dto.OpenAIBatchErrors{Object: "list", Data: errs}
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &result.Metadata)
+	}
+	return result
+}
+
+// CreateBatch POST /v1/batches
+func CreateBatch(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	var req dto.BatchCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", err.Error())
+		return
+	}
+	if _, ok := batchEndpointFormats[req.Endpoint]; !ok {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_endpoint",
+			fmt.Sprintf("unsupported endpoint: %s", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_completion_window",
+			fmt.Sprintf("completion_window must be %s", batchCompletionWindow))
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileById(userId, req.InputFileID)
+	if err != nil {
+		if model.IsFileNotFound(err) {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "file_not_found",
+				fmt.Sprintf("No such File object: %s", req.InputFileID))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		}
+		return
+	}
+	if inputFile.Purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_input_file",
+			"input file must be uploaded with purpose \"batch\"")
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               model.NewBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         req.Endpoint,
+		InputFileId:      inputFile.Id,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		ExpiresAt:        now + batchCompletionWindowSecs,
+	}
+	if len(req.Metadata) > 0 {
+		metadata, err := common.Marshal(req.Metadata)
+		if err != nil {
+			openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_metadata", err.Error())
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeUpdateDataError), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func getUserBatchOrAbort(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatchById(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if model.IsBatchNotFound(err) {
+			openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", "batch_not_found",
+				fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+// GetBatch GET /v1/batches/:id
+func GetBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+// ListBatches GET /v1/batches
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		return
+	}
+	list := dto.OpenAIList[dto.OpenAIBatch]{Object: "list", Data: make([]dto.OpenAIBatch, 0, len(batches))}
+	if len(batches) > limit {
+		batches = batches[:limit]
+		list.HasMore = true
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, toOpenAIBatch(batch))
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CancelBatch POST /v1/batches/:id/cancel
+// 未开始执行的任务直接取消；执行中的任务进入 cancelling，由执行节点停止派发后写出已完成部分的结果
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	now := common.GetTimestamp()
+	fromStatus := batch.Status
+	switch fromStatus {
+	case model.BatchStatusValidating:
+		batch.Status = model.BatchStatusCancelled
+		batch.CancellingAt = now
+		batch.CancelledAt = now
+	case model.BatchStatusInProgress:
+		batch.Status = model.BatchStatusCancelling
+		batch.CancellingAt = now
+	case model.BatchStatusCancelling, model.BatchStatusCancelled:
+		c.JSON(http.StatusOK, toOpenAIBatch(batch))
+		return
+	default:
+		openAIErrorResponse(c, http.StatusConflict, "invalid_request_error", "batch_not_cancellable",
+			fmt.Sprintf("Cannot cancel a batch with status %s", fromStatus))
+		return
+	}
+	ok, err := batch.UpdateWithStatus(fromStatus)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeUpdateDataError), err.Error())
+		return
+	}
+	if !ok {
+		// 状态已被执行节点更新，返回最新状态
+		if latest, err := model.GetBatchById(batch.Id); err == nil {
+			batch = latest
+		}
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+// validateBatchInput 校验批处理输入文件，返回请求数与校验错误
+func validateBatchInput(r io.Reader, endpoint string, maxRequests int) (int, []dto.OpenAIBatchError) {
+	var errs []dto.OpenAIBatchError
+	addError := func(line int, code string, message string) {
+		if len(errs) < 100 {
+			lineNo := line
+			errs = append(errs, dto.OpenAIBatchError{Code: code, Message: message, Line: &lineNo})
+		}
+	}
+	customIds := make(map[string]struct{})
+	total := 0
+	lineNo := 0
+	err := readBatchLines(r, func(raw []byte) bool {
+		lineNo++
+		if len(bytes.TrimSpace(raw)) == 0 {
+			return true
+		}
+		total++
+		if maxRequests > 0 && total > maxRequests {
+			addError(lineNo, "too_many_requests", fmt.Sprintf("batch exceeds the limit of %d requests", maxRequests))
+			return false
+		}
+		var line dto.BatchRequestLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			addError(lineNo, "invalid_json_line", "line is not a valid JSON object")
+			return true
+		}
+		if line.CustomID == "" {
+			addError(lineNo, "missing_required_parameter", "custom_id is required")
+		} else if _, ok := customIds[line.CustomID]; ok {
+			addError(lineNo, "duplicate_custom_id", fmt.Sprintf("duplicate custom_id: %s", line.CustomID))
+		} else {
+			customIds[line.CustomID] = struct{}{}
+		}
+		if line.Method != http.MethodPost {
+			addError(lineNo, "invalid_method", "method must be POST")
+		}
+		if line.URL != endpoint {
+			addError(lineNo, "mismatched_endpoint", fmt.Sprintf("url %s does not match the batch endpoint %s", line.URL, endpoint))
+		}
+		if len(bytes.TrimSpace(line.Body)) == 0 || bytes.TrimSpace(line.Body)[0] != '{' {
+			addError(lineNo, "invalid_body", "body must be a JSON object")
+		}
+		return true
+	})
+	if err != nil {
+		addError(lineNo, batchInvalidFileErrorCode, err.Error())
+	}
+	if total == 0 && len(errs) == 0 {
+		addError(0, "empty_file", "input file contains no requests")
+	}
+	return total, errs
+}
+
+// readBatchLines 逐行读取 JSONL，fn 返回 false 时停止
+func readBatchLines(r io.Reader, fn func(raw []byte) bool) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > batchMaxLineBytes {
+			return fmt.Errorf("line exceeds %d bytes", batchMaxLineBytes)
+		}
+		if len(raw) > 0 && !fn(raw) {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var (
+	batchTaskOnce    sync.Once
+	batchRunning     atomic.Int32
+	batchEngineOnce  sync.Once
+	batchRelayEngine *gin.Engine
+)
+
+type batchIdContextKey struct{}
+
+// getBatchRelayEngine 批处理请求使用的内部路由，与 /v1 转发共用 Distribute 与 Relay，按任务所属令牌鉴权计费
+func getBatchRelayEngine() *gin.Engine {
+	batchEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(gin.Recovery())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.I18n())
+		engine.Use(func(c *gin.Context) {
+			if batchId, ok := c.Request.Context().Value(batchIdContextKey{}).(string); ok {
+				common.SetContextKey(c, constant.ContextKeyBatchId, batchId)
+			}
+			c.Next()
+		})
+		engine.Use(middleware.InternalTokenAuth())
+		engine.Use(middleware.Distribute())
+		for endpoint, relayFormat := range batchEndpointFormats {
+			format := relayFormat
+			engine.POST(endpoint, func(c *gin.Context) {
+				Relay(c, format)
+			})
+		}
+		batchRelayEngine = engine
+	})
+	return batchRelayEngine
+}
+
+// StartBatchTask 启动批处理任务调度，各节点通过状态 CAS 抢占任务
+func StartBatchTask() {
+	batchTaskOnce.Do(func() {
+		gopool.Go(func() {
+			ticker := time.NewTicker(batchTaskInterval)
+			var lastFileCleanup time.Time
+			defer ticker.Stop()
+			for range ticker.C {
+				// 关闭批处理后仍需清理已保存的过期文件
+				if common.IsMasterNode && time.Since(lastFileCleanup) >= fileCleanupInterval {
+					lastFileCleanup = time.Now()
+					cleanupExpiredFiles()
+				}
+				if !operation_setting.GetBatchSetting().Enabled {
+					continue
+				}
+				recoverStaleBatches()
+				claimPendingBatches()
+			}
+		})
+	})
+}
+
+// recoverStaleBatches 执行节点退出后心跳超时的任务无法恢复执行，标记为失败（取消中的任务标记为已取消）
+func recoverStaleBatches() {
+	now := common.GetTimestamp()
+	batches, err := model.GetStaleBatches(now-batchStaleTimeoutSeconds, 100)
+	if err != nil {
+		common.SysError("failed to get stale batches: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		fromStatus := batch.Status
+		if fromStatus == model.BatchStatusCancelling {
+			batch.Status = model.BatchStatusCancelled
+			batch.CancelledAt = now
+		} else {
+			batch.Status = model.BatchStatusFailed
+			batch.FailedAt = now
+			batch.Errors = marshalBatchErrors([]dto.OpenAIBatchError{{
+				Code:    batchInterruptedErrorCode,
+				Message: "batch execution was interrupted",
+			}})
+		}
+		if _, err := batch.UpdateWithStatus(fromStatus); err != nil {
+			common.SysError(fmt.Sprintf("failed to update stale batch %s: %s", batch.Id, err.Error()))
+		}
+	}
+}
+
+func claimPendingBatches() {
+	setting := operation_setting.GetBatchSetting()
+	available := setting.MaxRunningBatches - int(batchRunning.Load())
+	if available <= 0 {
+		return
+	}
+	batches, err := model.GetBatchesByStatus(model.BatchStatusValidating, available)
+	if err != nil {
+		common.SysError("failed to get pending batches: " + err.Error())
+		return
+	}
+	now := common.GetTimestamp()
+	for _, batch := range batches {
+		if batch.ExpiresAt > 0 && now >= batch.ExpiresAt {
+			batch.Status = model.BatchStatusExpired
+			batch.ExpiredAt = now
+			_, _ = batch.UpdateWithStatus(model.BatchStatusValidating)
+			continue
+		}
+		batch.Status = model.BatchStatusInProgress
+		batch.InProgressAt = now
+		ok, err := batch.UpdateWithStatus(model.BatchStatusValidating)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to claim batch %s: %s", batch.Id, err.Error()))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		batchRunning.Add(1)
+		claimed := batch
+		gopool.Go(func() {
+			defer batchRunning.Add(-1)
+			runBatch(claimed)
+		})
+	}
+}
+
+func marshalBatchErrors(errs []dto.OpenAIBatchError) string {
+	data, err := common.Marshal(errs)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// failBatch 将执行中的任务标记为失败
+func failBatch(batch *model.Batch, errs []dto.OpenAIBatchError) {
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	batch.Errors = marshalBatchErrors(errs)
+	if _, err := batch.UpdateWithStatus(model.BatchStatusInProgress); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+type batchResult struct {
+	line    dto.BatchResponseLine
+	success bool
+}
+
+func runBatch(batch *model.Batch) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("batch %s panic: %v", batch.Id, r))
+			failBatch(batch, []dto.OpenAIBatchError{{Code: batchInterruptedErrorCode, Message: "batch execution panicked"}})
+		}
+	}()
+	setting := operation_setting.GetBatchSetting()
+	store := service.GetFileStore()
+
+	inputFile, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: batchInvalidFileErrorCode, Message: "input file not found"}})
+		return
+	}
+	input, err := store.Open(inputFile.StorageKey)
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: batchInvalidFileErrorCode, Message: "failed to read input file"}})
+		return
+	}
+	total, validationErrs := validateBatchInput(input, batch.Endpoint, setting.MaxRequestsPerBatch)
+	_ = input.Close()
+	if len(validationErrs) > 0 {
+		failBatch(batch, validationErrs)
+		return
+	}
+	batch.RequestTotal = total
+	if _, err := batch.UpdateWithStatus(model.BatchStatusInProgress); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+
+	outputTmp, err := os.CreateTemp("", "batch-output-*.jsonl")
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: batchInterruptedErrorCode, Message: "failed to create output file"}})
+		return
+	}
+	defer os.Remove(outputTmp.Name())
+	defer outputTmp.Close()
+	errorTmp, err := os.CreateTemp("", "batch-error-*.jsonl")
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: batchInterruptedErrorCode, Message: "failed to create error file"}})
+		return
+	}
+	defer os.Remove(errorTmp.Name())
+	defer errorTmp.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var completed, failed atomic.Int64
+	var cancelled, expired atomic.Bool
+
+	// 心跳：刷新进度，检查取消与过期
+	heartbeatDone := make(chan struct{})
+	gopool.Go(func() {
+		ticker := time.NewTicker(batchHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+			}
+			_ = model.UpdateBatchProgress(batch.Id, int(completed.Load()), int(failed.Load()))
+			if latest, err := model.GetBatchById(batch.Id); err == nil && latest.Status == model.BatchStatusCancelling {
+				cancelled.Store(true)
+				cancel()
+			}
+			if batch.ExpiresAt > 0 && common.GetTimestamp() >= batch.ExpiresAt {
+				expired.Store(true)
+				cancel()
+			}
+		}
+	})
+
+	concurrency := setting.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make(chan batchResult, concurrency)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for result := range results {
+			data, err := common.Marshal(result.line)
+			if err != nil {
+				continue
+			}
+			data = append(data, '\n')
+			if result.success {
+				_, _ = outputTmp.Write(data)
+				completed.Add(1)
+			} else {
+				_, _ = errorTmp.Write(data)
+				failed.Add(1)
+			}
+		}
+	}()
+
+	lines := make(chan dto.BatchRequestLine)
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for line := range lines {
+				results <- executeBatchRequest(batch, line)
+			}
+		}()
+	}
+
+	input, err = store.Open(inputFile.StorageKey)
+	if err == nil {
+		_ = readBatchLines(input, func(raw []byte) bool {
+			if len(bytes.TrimSpace(raw)) == 0 {
+				return true
+			}
+			var line dto.BatchRequestLine
+			if err := common.Unmarshal(raw, &line); err != nil {
+				return true
+			}
+			select {
+			case lines <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		_ = input.Close()
+	}
+	close(lines)
+	workers.Wait()
+	close(results)
+	<-writerDone
+	close(heartbeatDone)
+
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: batchInvalidFileErrorCode, Message: "failed to read input file"}})
+		return
+	}
+	finalizeBatch(batch, outputTmp, errorTmp, int(completed.Load()), int(failed.Load()), cancelled.Load(), expired.Load())
+}
+
+// executeBatchRequest 通过内部路由执行单条请求，走与 /v1 相同的渠道选择、重试与计费流程
+func executeBatchRequest(batch *model.Batch, line dto.BatchRequestLine) batchResult {
+	result := dto.BatchResponseLine{
+		ID:       "batch_req_" + common.GetRandomString(24),
+		CustomID: line.CustomID,
+	}
+	var body map[string]any
+	if err := common.Unmarshal(line.Body, &body); err != nil {
+		result.Error = &dto.BatchResponseError{Code: batchRequestErrorCodeParse, Message: "body must be a JSON object"}
+		return batchResult{line: result}
+	}
+	// 批处理不支持流式输出
+	delete(body, "stream")
+	delete(body, "stream_options")
+	payload, err := common.Marshal(body)
+	if err != nil {
+		result.Error = &dto.BatchResponseError{Code: batchRequestErrorCodeParse, Message: err.Error()}
+		return batchResult{line: result}
+	}
+
+	ctx := middleware.WithInternalTokenId(context.Background(), batch.TokenId)
+	ctx = context.WithValue(ctx, batchIdContextKey{}, batch.Id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, line.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = &dto.BatchResponseError{Code: batchRequestErrorCodeParse, Message: err.Error()}
+		return batchResult{line: result}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	getBatchRelayEngine().ServeHTTP(recorder, req)
+
+	respBody := bytes.TrimSpace(recorder.Body.Bytes())
+	if len(respBody) == 0 || !json.Valid(respBody) {
+		respBody, _ = common.Marshal(string(respBody))
+	}
+	result.Response = &dto.BatchResponseBody{
+		StatusCode: recorder.Code,
+		RequestID:  recorder.Header().Get(common.RequestIdKey),
+		Body:       respBody,
+	}
+	return batchResult{line: result, success: recorder.Code >= 200 && recorder.Code < 300}
+}
+
+func saveBatchResultFile(batch *model.Batch, tmp *os.File, name string) (string, error) {
+	info, err := tmp.Stat()
+	if err != nil || info.Size() == 0 {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	file, err := saveUserFile(batch.UserId, name, model.FilePurposeBatchOutput, tmp)
+	if err != nil {
+		return "", err
+	}
+	return file.Id, nil
+}
+
+// finalizeBatch 写出结果文件并设置最终状态
+func finalizeBatch(batch *model.Batch, outputTmp *os.File, errorTmp *os.File, completed int, failed int, cancelled bool, expired bool) {
+	fromStatus := model.BatchStatusInProgress
+	if cancelled {
+		fromStatus = model.BatchStatusCancelling
+		if latest, err := model.GetBatchById(batch.Id); err == nil {
+			batch.CancellingAt = latest.CancellingAt
+		}
+	} else {
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = common.GetTimestamp()
+		ok, err := batch.UpdateWithStatus(model.BatchStatusInProgress)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+			return
+		}
+		if ok {
+			fromStatus = model.BatchStatusFinalizing
+		} else if latest, err := model.GetBatchById(batch.Id); err == nil && latest.Status == model.BatchStatusCancelling {
+			// 最后一批请求完成前用户取消了任务
+			batch.CancellingAt = latest.CancellingAt
+			fromStatus = model.BatchStatusCancelling
+			cancelled = true
+		} else {
+			return
+		}
+	}
+
+	outputFileId, err := saveBatchResultFile(batch, outputTmp, batch.Id+"_output.jsonl")
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save output file of batch %s: %s", batch.Id, err.Error()))
+	}
+	errorFileId, err := saveBatchResultFile(batch, errorTmp, batch.Id+"_error.jsonl")
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save error file of batch %s: %s", batch.Id, err.Error()))
+	}
+
+	now := common.GetTimestamp()
+	batch.OutputFileId = outputFileId
+	batch.ErrorFileId = errorFileId
+	batch.RequestCompleted = completed
+	batch.RequestFailed = failed
+	switch {
+	case cancelled:
+		batch.Status = model.BatchStatusCancelled
+		batch.CancelledAt = now
+	case expired:
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = now
+	default:
+		batch.Status = model.BatchStatusCompleted
+		batch.CompletedAt = now
+	}
+	if _, err := batch.UpdateWithStatus(fromStatus); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
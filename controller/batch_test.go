@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBatchInput(t *testing.T) {
+	input := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+		``,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+	}, "\n")
+	total, errs := validateBatchInput(strings.NewReader(input), "/v1/chat/completions", 10)
+	require.Equal(t, 2, total)
+	require.Empty(t, errs)
+}
+
+func TestValidateBatchInputErrors(t *testing.T) {
+	input := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}`,
+		`not json`,
+	}, "\n")
+	total, errs := validateBatchInput(strings.NewReader(input), "/v1/chat/completions", 10)
+	require.Equal(t, 3, total)
+	codes := make([]string, 0, len(errs))
+	for _, err := range errs {
+		codes = append(codes, err.Code)
+	}
+	require.Equal(t, []string{"duplicate_custom_id", "mismatched_endpoint", "invalid_json_line"}, codes)
+	require.Equal(t, 2, *errs[0].Line)
+
+	_, errs = validateBatchInput(strings.NewReader(input), "/v1/chat/completions", 1)
+	require.Len(t, errs, 1)
+	require.Equal(t, "too_many_requests", errs[0].Code)
+
+	_, errs = validateBatchInput(strings.NewReader("\n"), "/v1/chat/completions", 10)
+	require.Len(t, errs, 1)
+	require.Equal(t, "empty_file", errs[0].Code)
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BudgetUpdateRequest struct {
+	Period string `json:"period"`
+	Quota  int    `json:"quota"`
+}
+
+func respondBudget(c *gin.Context, scope string, targetId int) {
+	budget, err := model.GetBudget(scope, targetId)
+	if err != nil && !errors.Is(err, model.ErrBudgetNotFound) {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+func saveBudget(c *gin.Context, scope string, targetId int, userId int) {
+	var req BudgetUpdateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	budget, err := model.SaveBudget(scope, targetId, userId, req.Period, req.Quota)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, budget)
+}
+
+func deleteBudget(c *gin.Context, scope string, targetId int) {
+	if err := model.DeleteBudget(scope, targetId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// getOwnedTokenId 解析路径中的令牌 ID 并校验归属
+func getOwnedTokenId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	if _, err := model.GetTokenByIds(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetTokenBudget GET /api/token/:id/budget
+func GetTokenBudget(c *gin.Context) {
+	id, ok := getOwnedTokenId(c)
+	if !ok {
+		return
+	}
+	respondBudget(c, model.BudgetScopeToken, id)
+}
+
+// UpdateTokenBudget PUT /api/token/:id/budget
+func UpdateTokenBudget(c *gin.Context) {
+	id, ok := getOwnedTokenId(c)
+	if !ok {
+		return
+	}
+	saveBudget(c, model.BudgetScopeToken, id, c.GetInt("id"))
+}
+
+// DeleteTokenBudget DELETE /api/token/:id/budget
+func DeleteTokenBudget(c *gin.Context) {
+	id, ok := getOwnedTokenId(c)
+	if !ok {
+		return
+	}
+	deleteBudget(c, model.BudgetScopeToken, id)
+}
+
+// GetSelfBudget GET /api/user/self/budget
+func GetSelfBudget(c *gin.Context) {
+	respondBudget(c, model.BudgetScopeUser, c.GetInt("id"))
+}
+
+// getManagedUserId 解析路径中的用户 ID，并校验管理员权限高于目标用户
+func getManagedUserId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetUserBudget GET /api/user/:id/budget
+func GetUserBudget(c *gin.Context) {
+	id, ok := getManagedUserId(c)
+	if !ok {
+		return
+	}
+	respondBudget(c, model.BudgetScopeUser, id)
+}
+
+// UpdateUserBudget PUT /api/user/:id/budget
+func UpdateUserBudget(c *gin.Context) {
+	id, ok := getManagedUserId(c)
+	if !ok {
+		return
+	}
+	saveBudget(c, model.BudgetScopeUser, id, id)
+}
+
+// DeleteUserBudget DELETE /api/user/:id/budget
+func DeleteUserBudget(c *gin.Context) {
+	id, ok := getManagedUserId(c)
+	if !ok {
+		return
+	}
+	deleteBudget(c, model.BudgetScopeUser, id)
+}
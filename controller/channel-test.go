@@ -811,7 +811,7 @@ func testAllChannels(notify bool) error {
 		}()
 
 		for _, channel := range channels {
-			if channel.Status == common.ChannelStatusManuallyDisabled {
+			if channel.Status == common.ChannelStatusManuallyDisabled || channel.Status == common.ChannelStatusMaintenance {
 				continue
 			}
 			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
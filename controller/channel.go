@@ -402,6 +402,12 @@ func GetChannelKey(c *gin.Context) {
 		return
 	}
 
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		common.ApiError(c, fmt.Errorf("渠道密钥解密失败: %v", err))
+		return
+	}
+
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
 
@@ -410,7 +416,7 @@ func GetChannelKey(c *gin.Context) {
 		"success": true,
 		"message": "获取成功",
 		"data": map[string]interface{}{
-			"key": channel.Key,
+			"key": key,
 		},
 	})
 }
@@ -432,12 +438,24 @@ func validateTwoFactorAuth(twoFA *model.TwoFA, code string) bool {
 	return false
 }
 
+// firstChannelKey 返回解密后的第一个 Key，多 Key 渠道按行分隔
+func firstChannelKey(channel *model.Channel) (string, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return "", fmt.Errorf("渠道密钥解密失败: %v", err)
+	}
+	return strings.Split(key, "\n")[0], nil
+}
+
 // validateChannel 通用的渠道校验函数
 func validateChannel(channel *model.Channel, isAdd bool) error {
 	// 校验 channel settings
 	if err := channel.ValidateSettings(); err != nil {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
+	if err := channel.ValidateSchedule(); err != nil {
+		return fmt.Errorf("渠道排期[schedule] 格式错误：%s", err.Error())
+	}
 
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
@@ -695,15 +713,16 @@ func DeleteDisabledChannel(c *gin.Context) {
 }
 
 type ChannelTag struct {
-	Tag            string  `json:"tag"`
-	NewTag         *string `json:"new_tag"`
-	Priority       *int64  `json:"priority"`
-	Weight         *uint   `json:"weight"`
-	ModelMapping   *string `json:"model_mapping"`
-	Models         *string `json:"models"`
-	Groups         *string `json:"groups"`
-	ParamOverride  *string `json:"param_override"`
-	HeaderOverride *string `json:"header_override"`
+	Tag              string  `json:"tag"`
+	NewTag           *string `json:"new_tag"`
+	Priority         *int64  `json:"priority"`
+	Weight           *uint   `json:"weight"`
+	ModelMapping     *string `json:"model_mapping"`
+	Models           *string `json:"models"`
+	Groups           *string `json:"groups"`
+	ParamOverride    *string `json:"param_override"`
+	HeaderOverride   *string `json:"header_override"`
+	ResponseOverride *string `json:"response_override"`
 }
 
 func DisableTagChannels(c *gin.Context) {
@@ -791,7 +810,18 @@ func EditTagChannels(c *gin.Context) {
 		}
 		channelTag.HeaderOverride = common.GetPointer[string](trimmed)
 	}
-	err = model.EditChannelByTag(channelTag.Tag, channelTag.NewTag, channelTag.ModelMapping, channelTag.Models, channelTag.Groups, channelTag.Priority, channelTag.Weight, channelTag.ParamOverride, channelTag.HeaderOverride)
+	if channelTag.ResponseOverride != nil {
+		trimmed := strings.TrimSpace(*channelTag.ResponseOverride)
+		if trimmed != "" && !json.Valid([]byte(trimmed)) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "响应覆盖必须是合法的 JSON 格式",
+			})
+			return
+		}
+		channelTag.ResponseOverride = common.GetPointer[string](trimmed)
+	}
+	err = model.EditChannelByTag(channelTag.Tag, channelTag.NewTag, channelTag.ModelMapping, channelTag.Models, channelTag.Groups, channelTag.Priority, channelTag.Weight, channelTag.ParamOverride, channelTag.HeaderOverride, channelTag.ResponseOverride)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -878,15 +908,20 @@ func UpdateChannel(c *gin.Context) {
 		switch *channel.KeyMode {
 		case "append":
 			// 追加模式：将新密钥添加到现有密钥列表
-			if originChannel.Key != "" {
+			originKey, err := originChannel.GetPlainKey()
+			if err != nil {
+				common.ApiError(c, fmt.Errorf("渠道密钥解密失败: %v", err))
+				return
+			}
+			if originKey != "" {
 				var newKeys []string
 				var existingKeys []string
 
 				// 解析现有密钥
-				if strings.HasPrefix(strings.TrimSpace(originChannel.Key), "[") {
+				if strings.HasPrefix(strings.TrimSpace(originKey), "[") {
 					// JSON数组格式
 					var arr []json.RawMessage
-					if err := json.Unmarshal([]byte(strings.TrimSpace(originChannel.Key)), &arr); err == nil {
+					if err := json.Unmarshal([]byte(strings.TrimSpace(originKey)), &arr); err == nil {
 						existingKeys = make([]string, len(arr))
 						for i, v := range arr {
 							existingKeys[i] = string(v)
@@ -894,7 +929,7 @@ func UpdateChannel(c *gin.Context) {
 					}
 				} else {
 					// 换行分隔格式
-					existingKeys = strings.Split(strings.Trim(originChannel.Key, "\n"), "\n")
+					existingKeys = strings.Split(strings.Trim(originKey, "\n"), "\n")
 				}
 
 				// 处理 Vertex AI 的特殊情况
@@ -1210,7 +1245,7 @@ func CopyChannel(c *gin.Context) {
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
 	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
+	Action    string `json:"action"`              // "disable_key", "enable_key", "enable_all_keys", "disable_all_keys", "delete_key", "delete_disabled_keys", "get_key_status"
 	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
 	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
 	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
@@ -1236,6 +1271,12 @@ type KeyStatus struct {
 	DisabledTime int64  `json:"disabled_time,omitempty"`
 	Reason       string `json:"reason,omitempty"`
 	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	// 冷却与当日用量，仅在最久未使用、限流感知模式或配置了每日上限时记录
+	LastUsedTime   int64  `json:"last_used_time,omitempty"`
+	CooldownUntil  int64  `json:"cooldown_until,omitempty"`
+	CooldownReason string `json:"cooldown_reason,omitempty"`
+	DailyRequests  int64  `json:"daily_requests"`
+	DailyQuota     int64  `json:"daily_quota"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1287,6 +1328,8 @@ func ManageMultiKeys(c *gin.Context) {
 
 		// Build all key status data first
 		var allKeyStatusList []KeyStatus
+		keyStates := model.GetMultiKeyStates(channel.Id)
+		now := time.Now()
 		for i, key := range keys {
 			status := 1 // default enabled
 			var disabledTime int64
@@ -1323,13 +1366,23 @@ func ManageMultiKeys(c *gin.Context) {
 				keyPreview = key[:10] + "..."
 			}
 
-			allKeyStatusList = append(allKeyStatusList, KeyStatus{
-				Index:        i,
-				Status:       status,
-				DisabledTime: disabledTime,
-				Reason:       reason,
-				KeyPreview:   keyPreview,
-			})
+			keyStatus := KeyStatus{
+				Index:         i,
+				Status:        status,
+				DisabledTime:  disabledTime,
+				Reason:        reason,
+				KeyPreview:    keyPreview,
+				DailyRequests: keyStates[i].DailyRequests,
+				DailyQuota:    keyStates[i].DailyQuota,
+			}
+			if keyStates[i].LastUsed > 0 {
+				keyStatus.LastUsedTime = keyStates[i].LastUsed / 1000
+			}
+			if keyStates[i].CoolingDown(now) {
+				keyStatus.CooldownUntil = keyStates[i].CooldownUntil / 1000
+				keyStatus.CooldownReason = keyStates[i].CooldownReason
+			}
+			allKeyStatusList = append(allKeyStatusList, keyStatus)
 		}
 
 		// Apply status filter if specified
@@ -1460,6 +1513,7 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		model.ClearMultiKeyCooldown(channel.Id, keyIndex)
 
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
@@ -1484,6 +1538,11 @@ func ManageMultiKeys(c *gin.Context) {
 			common.ApiError(c, err)
 			return
 		}
+		allKeyIndexes := make([]int, channel.ChannelInfo.MultiKeySize)
+		for i := range allKeyIndexes {
+			allKeyIndexes[i] = i
+		}
+		model.ClearMultiKeyCooldown(channel.Id, allKeyIndexes...)
 
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
@@ -1612,6 +1671,8 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
+		// 删除密钥后索引发生变化，清除旧的冷却与用量记录
+		model.ResetMultiKeyStates(channel.Id)
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -1680,6 +1741,8 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
+		// 删除密钥后索引发生变化，清除旧的冷却与用量记录
+		model.ResetMultiKeyStates(channel.Id)
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -1744,7 +1807,14 @@ func OllamaPullModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key, err := firstChannelKey(channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = ollama.PullOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1807,14 +1877,21 @@ func OllamaPullModelStream(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
+	key, err := firstChannelKey(channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 设置 SSE 头部
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	key := strings.Split(channel.Key, "\n")[0]
-
 	// 创建进度回调函数
 	progressCallback := func(progress ollama.OllamaPullResponse) {
 		data, _ := json.Marshal(progress)
@@ -1889,7 +1966,14 @@ func OllamaDeleteModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key, err := firstChannelKey(channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = ollama.DeleteOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1938,7 +2022,11 @@ func OllamaVersion(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key, err := firstChannelKey(channel)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	version, err := ollama.FetchOllamaVersion(baseURL, key)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type channelKeyHealthResponse struct {
+	KeyIndex       int    `json:"key_index"`
+	Status         int    `json:"status"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	DisabledTime   int64  `json:"disabled_time,omitempty"`
+	model.ChannelHealthStats
+}
+
+type channelHealthSummaryResponse struct {
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	ChannelType int    `json:"channel_type"`
+	Status      int    `json:"status"`
+	model.ChannelHealthStats
+}
+
+// parseChannelHealthWindow 解析 window 参数（如 15m、1h、24h），默认 1h
+func parseChannelHealthWindow(c *gin.Context) (time.Duration, error) {
+	window := time.Hour
+	if raw := c.Query("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid window: %s", raw)
+		}
+		window = parsed
+	}
+	return model.NormalizeChannelHealthWindow(window), nil
+}
+
+// GetChannelHealth 获取单个渠道在窗口内的成功率、错误分类、延迟分位数与各 Key 的状态
+func GetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	window, err := parseChannelHealthWindow(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	report := model.GetChannelHealth(channel.Id, window, c.Query("model"))
+
+	keys := make([]channelKeyHealthResponse, 0)
+	if channel.ChannelInfo.IsMultiKey {
+		stats := make(map[int]model.ChannelHealthStats, len(report.Keys))
+		for _, key := range report.Keys {
+			stats[key.KeyIndex] = key.ChannelHealthStats
+		}
+		for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+			key := channelKeyHealthResponse{
+				KeyIndex:           i,
+				Status:             common.ChannelStatusEnabled,
+				ChannelHealthStats: stats[i],
+			}
+			if _, ok := stats[i]; !ok {
+				key.SuccessRate = 1
+			}
+			if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok {
+				key.Status = status
+				key.DisabledReason = channel.ChannelInfo.MultiKeyDisabledReason[i]
+				key.DisabledTime = channel.ChannelInfo.MultiKeyDisabledTime[i]
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":        operation_setting.GetChannelHealthSetting().Enabled,
+			"channel_id":     channel.Id,
+			"channel_name":   channel.Name,
+			"channel_type":   channel.Type,
+			"status":         channel.Status,
+			"window_seconds": int64(window.Seconds()),
+			"summary":        report.Summary,
+			"models":         report.Models,
+			"keys":           keys,
+			"timeline":       report.Timeline,
+		},
+	})
+}
+
+// GetChannelHealthSummary 获取窗口内有请求的所有渠道的健康汇总，按成功率从低到高排序
+func GetChannelHealthSummary(c *gin.Context) {
+	window, err := parseChannelHealthWindow(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	summaries := model.GetChannelHealthSummaries(window)
+	ids := make([]int, 0, len(summaries))
+	for id := range summaries {
+		ids = append(ids, id)
+	}
+	items := make([]channelHealthSummaryResponse, 0, len(ids))
+	if len(ids) > 0 {
+		channels, err := model.GetChannelsByIds(ids)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		// 已删除的渠道不再展示
+		for _, channel := range channels {
+			items = append(items, channelHealthSummaryResponse{
+				ChannelId:          channel.Id,
+				ChannelName:        channel.Name,
+				ChannelType:        channel.Type,
+				Status:             channel.Status,
+				ChannelHealthStats: summaries[channel.Id],
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].SuccessRate != items[j].SuccessRate {
+			return items[i].SuccessRate < items[j].SuccessRate
+		}
+		return items[i].Requests > items[j].Requests
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":        operation_setting.GetChannelHealthSetting().Enabled,
+			"window_seconds": int64(window.Seconds()),
+			"channels":       items,
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type channelMaintenanceRequest struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+func channelMaintenanceData(channel *model.Channel) gin.H {
+	inFlight := service.GetChannelInFlight(channel.Id)
+	maintenance := channel.Status == common.ChannelStatusMaintenance
+	return gin.H{
+		"channel_id":  channel.Id,
+		"status":      channel.Status,
+		"maintenance": maintenance,
+		// in_flight 为本节点正在处理的请求数，多节点部署时需要分别查询
+		"in_flight": inFlight,
+		"drained":   maintenance && inFlight == 0,
+		"schedule":  channel.GetScheduleState(),
+	}
+}
+
+// GetChannelMaintenance 获取渠道的维护状态、排期结果与正在处理的请求数
+func GetChannelMaintenance(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    channelMaintenanceData(channel),
+	})
+}
+
+// UpdateChannelMaintenance 将渠道切换为维护中或恢复启用。维护中的渠道不再接收新请求，已在处理的请求正常完成
+func UpdateChannelMaintenance(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req channelMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.SetChannelMaintenance(id, req.Maintenance); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.InitChannelCache()
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    channelMaintenanceData(channel),
+	})
+}
@@ -242,8 +242,11 @@ func fetchChannelUpstreamModelIDs(channel *model.Channel) ([]string, error) {
 	}
 
 	if channel.Type == constant.ChannelTypeOllama {
-		key := strings.TrimSpace(strings.Split(channel.Key, "\n")[0])
-		models, err := ollama.FetchOllamaModels(baseURL, key)
+		key, err := firstChannelKey(channel)
+		if err != nil {
+			return nil, err
+		}
+		models, err := ollama.FetchOllamaModels(baseURL, strings.TrimSpace(key))
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配置快照最大 32MB
+const maxConfigSnapshotSize = 32 << 20
+
+// ExportConfigSnapshot GET /api/config/export?format=yaml|json&keys=redact|encrypt。
+// 明文导出需要安全验证，走 POST /api/config/export/plain
+func ExportConfigSnapshot(c *gin.Context) {
+	keyMode := c.DefaultQuery("keys", service.ConfigKeyModeRedact)
+	if keyMode == service.ConfigKeyModePlain {
+		common.ApiErrorMsg(c, "明文导出请使用 POST /api/config/export/plain")
+		return
+	}
+	writeConfigSnapshot(c, c.DefaultQuery("format", service.ConfigFormatYAML), keyMode)
+}
+
+// ExportConfigSnapshotPlain POST /api/config/export/plain?format=yaml|json，导出包含明文渠道 Key 与密钥的快照
+func ExportConfigSnapshotPlain(c *gin.Context) {
+	writeConfigSnapshot(c, c.DefaultQuery("format", service.ConfigFormatYAML), service.ConfigKeyModePlain)
+}
+
+func writeConfigSnapshot(c *gin.Context, format string, keyMode string) {
+	data, err := service.ExportConfig(format, keyMode)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if keyMode == service.ConfigKeyModePlain {
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, "导出包含明文渠道 Key 的配置快照")
+	}
+	contentType := "application/yaml"
+	if format == service.ConfigFormatJSON {
+		contentType = "application/json"
+	}
+	filename := fmt.Sprintf("new-api-config-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConfigSnapshot POST /api/config/import?dry_run=true&prune=false，请求体为 YAML 或 JSON 快照。
+// dry_run 默认为 true，只返回变更计划
+func ImportConfigSnapshot(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxConfigSnapshotSize+1))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(data) > maxConfigSnapshotSize {
+		common.ApiErrorMsg(c, "配置快照过大")
+		return
+	}
+	apply := c.DefaultQuery("dry_run", "true") == "false"
+	opts := model.ConfigImportOptions{
+		Prune: c.Query("prune") == "true",
+		Actor: optionActor(c, model.OptionSourceImport),
+	}
+	plan, err := service.ImportConfig(data, apply, opts)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if apply && len(plan.Changes) > 0 {
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("导入配置快照，应用 %d 项变更", len(plan.Changes)))
+	}
+	common.ApiSuccess(c, plan)
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayGemini Gemini 原生路径 /models/{model}:{action}，:countTokens 单独处理
+func RelayGemini(c *gin.Context) {
+	if strings.HasSuffix(c.Request.URL.Path, ":countTokens") {
+		RelayCountTokens(c, types.RelayFormatGemini)
+		return
+	}
+	Relay(c, types.RelayFormatGemini)
+}
+
+// RelayCountTokens 处理 Claude /v1/messages/count_tokens 与 Gemini :countTokens。
+// 不预扣费，仅在配置了计数价格时按次扣费
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	requestId := c.GetString(common.RequestIdKey)
+	var newAPIError *types.NewAPIError
+
+	defer func() {
+		var relayErr error
+		if newAPIError != nil {
+			relayErr = newAPIError
+		}
+		service.SaveRequestCapture(c, relayErr)
+	}()
+
+	defer func() {
+		if newAPIError == nil {
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+		newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+		if relayFormat == types.RelayFormatClaude {
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"type":  "error",
+				"error": newAPIError.ToClaudeError(),
+			})
+			return
+		}
+		c.JSON(newAPIError.StatusCode, gin.H{
+			"error": newAPIError.ToOpenAIError(),
+		})
+	}()
+
+	request, err := helper.GetAndValidateCountTokensRequest(c, relayFormat)
+	if err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+	relayInfo.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, relayInfo)
+
+	inputTokens, upstream, apiErr := relay.CountTokensHelper(c, relayInfo)
+	if apiErr != nil {
+		newAPIError = apiErr
+		return
+	}
+	if apiErr := service.ChargeCountTokens(c, relayInfo, inputTokens, upstream); apiErr != nil {
+		newAPIError = apiErr
+		return
+	}
+
+	if relayFormat == types.RelayFormatGemini {
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: inputTokens})
+		return
+	}
+	c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: inputTokens})
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var supportedFilePurposes = map[string]bool{
+	model.FilePurposeBatch: true,
+}
+
+func openAIErrorResponse(c *gin.Context, statusCode int, errType string, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
+
+func toOpenAIFile(file *model.File) dto.OpenAIFile {
+	return dto.OpenAIFile{
+		ID:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+	}
+}
+
+var errUserFileQuotaExceeded = errors.New("user file quota exceeded")
+
+// checkUserFileQuota 校验用户保存 size 字节的新文件后是否超出文件数与总大小上限
+func checkUserFileQuota(userId int, size int64) error {
+	setting := operation_setting.GetBatchSetting()
+	if setting.MaxUserFiles <= 0 && setting.MaxUserStorageMB <= 0 {
+		return nil
+	}
+	count, bytes, err := model.GetUserFileUsage(userId)
+	if err != nil {
+		return err
+	}
+	if setting.MaxUserFiles > 0 && count+1 > int64(setting.MaxUserFiles) {
+		return fmt.Errorf("%w: at most %d files are allowed", errUserFileQuotaExceeded, setting.MaxUserFiles)
+	}
+	if setting.MaxUserStorageMB > 0 && bytes+size > int64(setting.MaxUserStorageMB)<<20 {
+		return fmt.Errorf("%w: total file size exceeds the limit of %d MB", errUserFileQuotaExceeded, setting.MaxUserStorageMB)
+	}
+	return nil
+}
+
+// saveUserFile 保存文件内容并写入文件记录。
+// 批处理输出文件是已计费请求的结果，不受用户文件上限限制，但计入用户已用空间
+func saveUserFile(userId int, filename string, purpose string, r io.Reader) (*model.File, error) {
+	enforceQuota := purpose != model.FilePurposeBatchOutput
+	if enforceQuota {
+		if err := checkUserFileQuota(userId, 0); err != nil {
+			return nil, err
+		}
+	}
+	file := &model.File{
+		Id:        model.NewFileId(),
+		UserId:    userId,
+		CreatedAt: common.GetTimestamp(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+	file.StorageKey = file.Id
+	n, err := service.GetFileStore().Save(file.StorageKey, r)
+	if err != nil {
+		return nil, err
+	}
+	file.Bytes = n
+	if enforceQuota {
+		if err := checkUserFileQuota(userId, n); err != nil {
+			_ = service.GetFileStore().Delete(file.StorageKey)
+			return nil, err
+		}
+	}
+	if err := file.Insert(); err != nil {
+		_ = service.GetFileStore().Delete(file.StorageKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+// UploadFile POST /v1/files
+func UploadFile(c *gin.Context) {
+	setting := operation_setting.GetBatchSetting()
+	if !setting.Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if !supportedFilePurposes[purpose] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_purpose",
+			fmt.Sprintf("unsupported purpose: %s, only \"batch\" is supported", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "missing_file", "file is required")
+		return
+	}
+	maxBytes := int64(setting.MaxFileSizeMB) << 20
+	if maxBytes > 0 && header.Size > maxBytes {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "file_too_large",
+			fmt.Sprintf("file size exceeds the limit of %d MB", setting.MaxFileSizeMB))
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid_file", err.Error())
+		return
+	}
+	defer src.Close()
+
+	file, err := saveUserFile(c.GetInt("id"), header.Filename, purpose, src)
+	if errors.Is(err, errUserFileQuotaExceeded) {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "file_quota_exceeded", err.Error())
+		return
+	}
+	if err != nil {
+		logger.LogError(c, "failed to save file: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", "save_file_failed", "failed to save file")
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+// ListFiles GET /v1/files
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 10000 {
+		limit = 100
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		return
+	}
+	list := dto.OpenAIList[dto.OpenAIFile]{Object: "list", Data: make([]dto.OpenAIFile, 0, len(files))}
+	if len(files) > limit {
+		files = files[:limit]
+		list.HasMore = true
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, toOpenAIFile(file))
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func getUserFileOrAbort(c *gin.Context) *model.File {
+	file, err := model.GetUserFileById(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if model.IsFileNotFound(err) {
+			openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", "file_not_found",
+				fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		}
+		return nil
+	}
+	return file
+}
+
+// GetFile GET /v1/files/:id
+func GetFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+// GetFileContent GET /v1/files/:id/content
+func GetFileContent(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.GetFileStore().Open(file.StorageKey)
+	if err != nil {
+		logger.LogError(c, "failed to open file: "+err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", "read_file_failed", "failed to read file")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
+
+// cleanupExpiredFiles 删除超过保存时长的文件记录及其内容，未结束的批处理任务的输入文件会保留到任务结束
+func cleanupExpiredFiles() {
+	retentionHours := operation_setting.GetBatchSetting().FileRetentionHours
+	if retentionHours <= 0 {
+		return
+	}
+	files, err := model.GetExpiredFiles(common.GetTimestamp()-int64(retentionHours)*3600, 500)
+	if err != nil {
+		common.SysError("failed to get expired files: " + err.Error())
+		return
+	}
+	for _, file := range files {
+		if err := model.DeleteFileById(file.Id); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete expired file %s: %s", file.Id, err.Error()))
+			continue
+		}
+		if err := service.GetFileStore().Delete(file.StorageKey); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete expired file content %s: %s", file.Id, err.Error()))
+		}
+	}
+}
+
+// DeleteFile DELETE /v1/files/:id
+func DeleteFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := model.DeleteFileById(file.Id); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeUpdateDataError), err.Error())
+		return
+	}
+	if err := service.GetFileStore().Delete(file.StorageKey); err != nil {
+		logger.LogWarn(c, "failed to delete file content: "+err.Error())
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{ID: file.Id, Object: "file", Deleted: true})
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	guardrailEngineOnce sync.Once
+	guardrailEngine     *gin.Engine
+)
+
+// getGuardrailEngine 审核模型调用使用的内部路由，按发起请求的令牌鉴权计费
+func getGuardrailEngine() *gin.Engine {
+	guardrailEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(gin.Recovery())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.I18n())
+		engine.Use(middleware.InternalTokenAuth())
+		engine.Use(middleware.Distribute())
+		engine.POST("/v1/moderations", func(c *gin.Context) {
+			Relay(c, types.RelayFormatOpenAI)
+		})
+		guardrailEngine = engine
+	})
+	return guardrailEngine
+}
+
+type guardrailModerationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// GuardrailModeration 通过 /v1/moderations 调用审核模型
+func GuardrailModeration(c *gin.Context, modelName string, input string) (*service.GuardrailModerationResult, error) {
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	if tokenId == 0 {
+		return nil, fmt.Errorf("token id not found")
+	}
+	payload, err := common.Marshal(gin.H{"model": modelName, "input": input})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(middleware.WithInternalTokenId(ctx, tokenId), http.MethodPost, "/v1/moderations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	getGuardrailEngine().ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		return nil, fmt.Errorf("moderation status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var resp guardrailModerationResponse
+	if err := common.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		return nil, err
+	}
+	result := &service.GuardrailModerationResult{}
+	for _, r := range resp.Results {
+		if !r.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, hit := range r.Categories {
+			if hit && !common.StringsContains(result.Categories, category) {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	return result, nil
+}
+
+// applyPromptGuardrail 在转发前执行 prompt 阶段的审核，脱敏后替换请求体并重新解析请求
+func applyPromptGuardrail(c *gin.Context, relayFormat types.RelayFormat, request *dto.Request) *types.NewAPIError {
+	if relayFormat == types.RelayFormatOpenAIRealtime {
+		return nil
+	}
+	if !service.GuardrailPolicyHasStage(c, operation_setting.GuardrailStagePrompt) {
+		return nil
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	redacted, apiErr := service.CheckGuardrailPrompt(c, body)
+	if apiErr != nil {
+		recordGuardrailBlockLog(c, apiErr)
+		return apiErr
+	}
+	if redacted == nil {
+		return nil
+	}
+	if err := common.ReplaceBodyStorage(c, redacted); err != nil {
+		return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
+	}
+	newRequest, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	*request = newRequest
+	return nil
+}
+
+// isGuardrailExempt 审核模型本身的调用不再经过审核
+func isGuardrailExempt(c *gin.Context) bool {
+	return relayconstant.Path2RelayMode(c.Request.URL.Path) == relayconstant.RelayModeModerations
+}
+
+// recordGuardrailBlockLog 请求在转发前被拦截，不会产生消费日志，记录一条错误日志
+func recordGuardrailBlockLog(c *gin.Context, apiErr *types.NewAPIError) {
+	if !constant.ErrorLogEnabled {
+		return
+	}
+	other := map[string]interface{}{
+		"error_type":  apiErr.GetErrorType(),
+		"error_code":  apiErr.GetErrorCode(),
+		"status_code": apiErr.StatusCode,
+		"guardrail":   service.GetGuardrailDecisions(c),
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		other["request_path"] = c.Request.URL.Path
+	}
+	model.RecordErrorLog(c, c.GetInt("id"), 0, c.GetString("original_model"), c.GetString("token_name"),
+		apiErr.Error(), c.GetInt("token_id"), 0, false, c.GetString("group"), other)
+}
@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type OrganizationMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type OrganizationQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+type OrganizationStatusRequest struct {
+	Status int `json:"status"`
+}
+
+// getOrgMembership 解析路径中的组织 ID，并校验当前用户在组织中的角色不低于 minRole
+func getOrgMembership(c *gin.Context, minRole string) (*model.Organization, *model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil || orgId <= 0 {
+		common.ApiErrorMsg(c, "无效的组织ID")
+		return nil, nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	member, err := model.GetOrgMember(orgId, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrOrgMemberNotFound) {
+			common.ApiErrorMsg(c, "你不是该组织的成员")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, nil, false
+	}
+	if model.OrgRoleLevel(member.Role) < model.OrgRoleLevel(minRole) {
+		common.ApiErrorMsg(c, "无权执行此操作")
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+func parseOrgTargetUserId(c *gin.Context) (int, bool) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil || userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户ID")
+		return 0, false
+	}
+	return userId, true
+}
+
+// GetSelfOrganizations GET /api/org/self
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+// CreateOrganization POST /api/org
+func CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称过长")
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+// GetOrganization GET /api/org/:id
+func GetOrganization(c *gin.Context) {
+	org, member, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, model.UserOrganization{Organization: *org, Role: member.Role})
+}
+
+// UpdateOrganization PUT /api/org/:id
+func UpdateOrganization(c *gin.Context) {
+	org, _, ok := getOrgMembership(c, model.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称过长")
+		return
+	}
+	if err := model.UpdateOrganizationName(org.Id, req.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// DeleteOrganization DELETE /api/org/:id
+func DeleteOrganization(c *gin.Context) {
+	org, _, ok := getOrgMembership(c, model.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	if org.Quota > 0 {
+		common.ApiErrorMsg(c, "组织钱包仍有余额，无法删除")
+		return
+	}
+	if err := model.DeleteOrganization(org.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationMembers GET /api/org/:id/members
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrgMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+// AddOrganizationMember POST /api/org/:id/members
+func AddOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrgMembership(c, model.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrgRoleMember
+	}
+	// 只有 owner 可以授予 admin 角色
+	if req.Role == model.OrgRoleAdmin && operator.Role != model.OrgRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以添加管理员")
+		return
+	}
+	userId, err := model.GetUserIdByUsername(req.Username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgUserNotExists)
+		} else {
+			common.ApiError(c, err)
+		}
+		return
+	}
+	member, err := model.AddOrgMember(org.Id, userId, req.Role)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	member.Username = req.Username
+	common.ApiSuccess(c, member)
+}
+
+// UpdateOrganizationMember PUT /api/org/:id/members/:user_id
+func UpdateOrganizationMember(c *gin.Context) {
+	org, _, ok := getOrgMembership(c, model.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	userId, ok := parseOrgTargetUserId(c)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.UpdateOrgMemberRole(org.Id, userId, req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RemoveOrganizationMember DELETE /api/org/:id/members/:user_id
+// 成员可以移除自己（退出组织），管理员只能移除普通成员，所有者可以移除任何非所有者成员
+func RemoveOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	userId, ok := parseOrgTargetUserId(c)
+	if !ok {
+		return
+	}
+	if userId != operator.UserId {
+		target, err := model.GetOrgMember(org.Id, userId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if model.OrgRoleLevel(operator.Role) < model.OrgRoleLevel(model.OrgRoleAdmin) ||
+			model.OrgRoleLevel(operator.Role) <= model.OrgRoleLevel(target.Role) {
+			common.ApiErrorMsg(c, "无权移除该成员")
+			return
+		}
+	}
+	if err := model.RemoveOrgMember(org.Id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// DepositOrganizationQuota POST /api/org/:id/deposit
+// 成员从个人钱包向组织钱包划转额度
+func DepositOrganizationQuota(c *gin.Context) {
+	org, member, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	var req OrganizationQuotaRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Quota <= 0 {
+		common.ApiErrorMsg(c, "划转额度必须大于 0")
+		return
+	}
+	if err := model.TransferUserQuotaToOrganization(member.UserId, org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(member.UserId, model.LogTypeManage,
+		fmt.Sprintf("向组织 %s（#%d）划转额度 %s", org.Name, org.Id, logger.LogQuota(req.Quota)))
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationTokens GET /api/org/:id/tokens
+// 管理员可查看全部组织令牌，普通成员只能查看自己创建的令牌
+func GetOrganizationTokens(c *gin.Context) {
+	org, member, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	if model.OrgRoleLevel(member.Role) < model.OrgRoleLevel(model.OrgRoleAdmin) {
+		userId = member.UserId
+	}
+	pageInfo := common.GetPageQuery(c)
+	tokens, total, err := model.GetOrgTokens(org.Id, userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, token := range tokens {
+		token.Clean()
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(tokens)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// DeleteOrganizationToken DELETE /api/org/:id/tokens/:token_id
+func DeleteOrganizationToken(c *gin.Context) {
+	org, _, ok := getOrgMembership(c, model.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	tokenId, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil || tokenId <= 0 {
+		common.ApiErrorMsg(c, "无效的令牌ID")
+		return
+	}
+	if err := model.DeleteOrgToken(org.Id, tokenId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationLogs GET /api/org/:id/logs
+// 管理员可按成员（user_id）筛选全部组织日志，普通成员只能查看自己的日志
+func GetOrganizationLogs(c *gin.Context) {
+	org, member, ok := getOrgMembership(c, model.OrgRoleMember)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	if model.OrgRoleLevel(member.Role) < model.OrgRoleLevel(model.OrgRoleAdmin) {
+		userId = member.UserId
+	}
+	pageInfo := common.GetPageQuery(c)
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	requestId := c.Query("request_id")
+	logs, total, err := model.GetOrgLogs(org.Id, userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), requestId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminListOrganizations GET /api/org/admin/list
+func AdminListOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func parseAdminOrgId(c *gin.Context) (*model.Organization, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil || orgId <= 0 {
+		common.ApiErrorMsg(c, "无效的组织ID")
+		return nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return org, true
+}
+
+// AdminAdjustOrganizationQuota POST /api/org/admin/:id/quota
+// quota 为正数表示增加，负数表示扣减
+func AdminAdjustOrganizationQuota(c *gin.Context) {
+	org, ok := parseAdminOrgId(c)
+	if !ok {
+		return
+	}
+	var req OrganizationQuotaRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.AdjustOrganizationQuota(org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(org.OwnerId, model.LogTypeManage,
+		fmt.Sprintf("管理员调整组织 %s（#%d）额度 %s", org.Name, org.Id, logger.LogQuota(req.Quota)))
+	common.ApiSuccess(c, nil)
+}
+
+// AdminUpdateOrganizationStatus PUT /api/org/admin/:id/status
+func AdminUpdateOrganizationStatus(c *gin.Context) {
+	org, ok := parseAdminOrgId(c)
+	if !ok {
+		return
+	}
+	var req OrganizationStatusRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.UpdateOrganizationStatus(org.Id, req.Status); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -52,7 +52,7 @@ func GetPricing(c *gin.Context) {
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := ratio_setting.DefaultModelRatio2JSONString()
-	err := model.UpdateOption("ModelRatio", defaultStr)
+	err := model.UpdateOptionBy("ModelRatio", defaultStr, optionActor(c, model.OptionSourceAdmin))
 	if err != nil {
 		c.JSON(200, gin.H{
 			"success": false,
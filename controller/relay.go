@@ -15,6 +15,8 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -29,6 +31,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -75,6 +79,15 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		ws          *websocket.Conn
 	)
 
+	// 最先注册、最后执行，确保抓取到最终写给客户端的错误
+	defer func() {
+		var relayErr error
+		if newAPIError != nil {
+			relayErr = newAPIError
+		}
+		service.SaveRequestCapture(c, relayErr)
+	}()
+
 	if relayFormat == types.RelayFormatOpenAIRealtime {
 		var err error
 		ws, err = upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -116,12 +129,29 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	guardrailEnabled := !isGuardrailExempt(c)
+	if guardrailEnabled {
+		if newAPIError = applyPromptGuardrail(c, relayFormat, &request); newAPIError != nil {
+			return
+		}
+	}
+
 	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
 	}
 
+	if newAPIError = service.CheckPIIRedactionSupported(c, relayInfo); newAPIError != nil {
+		return
+	}
+
+	if guardrailEnabled {
+		service.InstallGuardrailWriter(c, relayInfo)
+		// 晚于错误输出注册、先执行，错误响应直接写给客户端
+		defer service.FinishGuardrail(c)
+	}
+
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
@@ -155,6 +185,17 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	// 用量限流（TPM / RPD / 每小时消费），按预估 token 与预扣额度预占
+	newAPIError = service.ReserveUsageRateLimit(c, relayInfo, tokens, priceData.QuotaToPreConsume)
+	if newAPIError != nil {
+		return
+	}
+	defer func() {
+		if newAPIError != nil {
+			service.ReleaseUsageRateLimit(c)
+		}
+	}()
+
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
 	if priceData.FreeModel {
@@ -186,16 +227,57 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
 
+	triedModels := relayInfo.ModelFallbackPath
+	if len(triedModels) == 0 {
+		triedModels = []string{relayInfo.OriginModelName}
+	}
+	fallbackModels := service.GetModelFallbackCandidates(c, relayInfo.UsingGroup, triedModels)
+
+	for {
+		newAPIError = relayWithChannelRetry(c, relayFormat, relayInfo, retryParam)
+		if newAPIError == nil {
+			return
+		}
+		if len(fallbackModels) == 0 || !service.ShouldFallbackModel(c, newAPIError) {
+			break
+		}
+		if !switchToFallbackModel(c, relayInfo, retryParam, &fallbackModels, tokens, meta) {
+			break
+		}
+	}
+
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		logger.LogInfo(c, retryLogStr)
+	}
+}
+
+// relayWithChannelRetry 在当前模型的可用渠道间重试，返回最后一次尝试的错误
+func relayWithChannelRetry(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam) (newAPIError *types.NewAPIError) {
+	requestCtx := c.Request.Context()
+	defer func() {
+		c.Request = c.Request.WithContext(requestCtx)
+	}()
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
+		attemptCtx, attemptSpan := tracing.Start(requestCtx, "relay.attempt",
+			tracing.AttrRetryIndex.Int(relayInfo.RetryIndex),
+			tracing.AttrModel.String(relayInfo.OriginModelName),
+			tracing.AttrGroup.String(relayInfo.UsingGroup),
+			tracing.AttrStream.Bool(relayInfo.IsStream),
+		)
+		c.Request = c.Request.WithContext(attemptCtx)
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
 		if channelErr != nil {
 			logger.LogError(c, channelErr.Error())
-			newAPIError = channelErr
-			break
+			endRelayAttemptSpan(attemptSpan, relayInfo, channelErr)
+			return channelErr
 		}
+		attemptSpan.SetAttributes(tracing.AttrChannelId.Int(channel.Id), tracing.AttrChannelType.Int(channel.Type))
 
 		addUsedChannel(c, channel.Id)
+		releaseInFlight := service.AcquireChannelInFlight(channel.Id)
 		bodyStorage, bodyErr := common.GetBodyStorage(c)
 		if bodyErr != nil {
 			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
@@ -204,10 +286,13 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			} else {
 				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
 			}
-			break
+			releaseInFlight()
+			endRelayAttemptSpan(attemptSpan, relayInfo, newAPIError)
+			return newAPIError
 		}
 		c.Request.Body = io.NopCloser(bodyStorage)
 
+		attemptStart := time.Now()
 		switch relayFormat {
 		case types.RelayFormatOpenAIRealtime:
 			newAPIError = relay.WssHelper(c, relayInfo)
@@ -218,10 +303,24 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		default:
 			newAPIError = relayHandler(c, relayInfo)
 		}
+		releaseInFlight()
+		// 命中响应缓存时未请求上游，不计入渠道的健康与延迟统计
+		if !common.GetContextKeyBool(c, constant.ContextKeyResponseCacheHit) {
+			observeRelayAttempt(relayInfo, channel, attemptStart, newAPIError)
+			service.RecordChannelBreakerResult(channel.Id, relayInfo.OriginModelName, newAPIError, relayAttemptLatency(relayInfo, attemptStart))
+			service.RecordChannelSelectionSample(channel.Id, relayInfo.OriginModelName, newAPIError, time.Since(attemptStart), relayAttemptFirstToken(relayInfo, attemptStart))
+			service.RecordChannelHealth(channel.Id, relayInfo.OriginModelName, relayAttemptKeyIndex(c), newAPIError, time.Since(attemptStart), relayAttemptFirstToken(relayInfo, attemptStart))
+		}
+		if relayInfo.IsStream && relayAttemptFirstToken(relayInfo, attemptStart) > 0 {
+			_, streamSpan := tracing.Tracer().Start(attemptCtx, "relay.stream", trace.WithTimestamp(relayInfo.FirstResponseTime))
+			streamSpan.End()
+		}
+		endRelayAttemptSpan(attemptSpan, relayInfo, newAPIError)
+		c.Request = c.Request.WithContext(requestCtx)
 
 		if newAPIError == nil {
 			relayInfo.LastError = nil
-			return
+			return nil
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
@@ -232,13 +331,124 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
 			break
 		}
+		metrics.IncRelayRetry(relayInfo.OriginModelName, relayInfo.UsingGroup)
 	}
+	return newAPIError
+}
 
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		logger.LogInfo(c, retryLogStr)
+// switchToFallbackModel 切换到降级链中下一个可计价的模型，按新模型重新计算价格并重置渠道重试状态。
+// 计费按实际服务的模型结算，与预扣费的差额在结算时补扣或返还
+func switchToFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, fallbackModels *[]string, tokens int, meta *types.TokenCountMeta) bool {
+	for len(*fallbackModels) > 0 {
+		nextModel := (*fallbackModels)[0]
+		*fallbackModels = (*fallbackModels)[1:]
+
+		// 计价会改写模型、分组与价格，候选模型被跳过时需还原，避免后续按被拒绝的模型计费
+		previousModel := relayInfo.OriginModelName
+		previousGroup := relayInfo.UsingGroup
+		previousPriceData := relayInfo.PriceData
+		restore := func() {
+			relayInfo.OriginModelName = previousModel
+			relayInfo.UsingGroup = previousGroup
+			relayInfo.PriceData = previousPriceData
+		}
+		relayInfo.OriginModelName = nextModel
+		priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+		if err != nil {
+			logger.LogWarn(c, fmt.Sprintf("降级模型 %s 计价失败，跳过：%s", nextModel, err.Error()))
+			restore()
+			continue
+		}
+		// 降级模型有独立的用量限流，已用尽时跳过，不能借原模型的额度绕过
+		if apiErr := service.ReserveFallbackUsageRateLimit(c, relayInfo, tokens, priceData.QuotaToPreConsume); apiErr != nil {
+			logger.LogWarn(c, fmt.Sprintf("降级模型 %s 已达用量限制，跳过：%s", nextModel, apiErr.Error()))
+			restore()
+			continue
+		}
+		// 原模型免费未预扣费时，降级到收费模型需要补充预扣
+		if relayInfo.Billing == nil && !priceData.FreeModel {
+			if apiErr := service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo); apiErr != nil {
+				logger.LogWarn(c, fmt.Sprintf("降级模型 %s 预扣费失败，跳过：%s", nextModel, apiErr.Error()))
+				service.ReleaseUsageRateLimit(c)
+				restore()
+				continue
+			}
+		}
+
+		if len(relayInfo.ModelFallbackPath) == 0 {
+			relayInfo.ModelFallbackPath = []string{previousModel}
+		}
+		relayInfo.ModelFallbackPath = append(relayInfo.ModelFallbackPath, nextModel)
+		relayInfo.LastError = nil
+		common.SetContextKey(c, constant.ContextKeyOriginalModel, nextModel)
+		common.SetContextKey(c, constant.ContextKeyModelFallbackPath, relayInfo.ModelFallbackPath)
+		// auto 分组会记录已搜索到的分组位置，换模型后需从第一个分组重新开始
+		common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+		common.SetContextKey(c, constant.ContextKeyAutoGroupRetryIndex, 0)
+		retryParam.ModelName = nextModel
+		retryParam.SetRetry(0)
+
+		logger.LogInfo(c, fmt.Sprintf("模型降级：%s", strings.Join(relayInfo.ModelFallbackPath, " -> ")))
+		return true
 	}
+	return false
+}
+
+// observeRelayAttempt 记录单次上游尝试的结果与耗时指标
+func observeRelayAttempt(info *relaycommon.RelayInfo, channel *model.Channel, attemptStart time.Time, apiErr *types.NewAPIError) {
+	if !metrics.Enabled() || channel == nil {
+		return
+	}
+	attempt := metrics.RelayAttempt{
+		ChannelId:   channel.Id,
+		ChannelType: channel.Type,
+		Model:       info.OriginModelName,
+		Group:       info.UsingGroup,
+		StatusCode:  http.StatusOK,
+		Success:     apiErr == nil,
+		Duration:    time.Since(attemptStart),
+	}
+	if apiErr != nil {
+		attempt.StatusCode = apiErr.StatusCode
+	}
+	attempt.FirstToken = relayAttemptFirstToken(info, attemptStart)
+	metrics.ObserveRelayAttempt(attempt)
+}
+
+// endRelayAttemptSpan 结束单次尝试的 span，失败时记录错误码
+func endRelayAttemptSpan(span trace.Span, info *relaycommon.RelayInfo, apiErr *types.NewAPIError) {
+	if info.UpstreamModelName != "" {
+		span.SetAttributes(tracing.AttrUpstreamModel.String(info.UpstreamModelName))
+	}
+	if apiErr != nil {
+		span.SetAttributes(tracing.AttrErrorCode.String(string(apiErr.GetErrorCode())), semconv.HTTPResponseStatusCode(apiErr.StatusCode))
+		tracing.SetError(span, apiErr)
+	}
+	span.End()
+}
+
+// relayAttemptFirstToken 返回单次尝试的首字耗时，未向客户端发送响应时返回 0
+func relayAttemptFirstToken(info *relaycommon.RelayInfo, attemptStart time.Time) time.Duration {
+	if info.HasSendResponse() && info.FirstResponseTime.After(attemptStart) {
+		return info.FirstResponseTime.Sub(attemptStart)
+	}
+	return 0
+}
+
+// relayAttemptKeyIndex 返回本次尝试使用的多 Key 序号，非多 Key 渠道返回 -1
+func relayAttemptKeyIndex(c *gin.Context) int {
+	if !common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		return model.ChannelHealthNoKeyIndex
+	}
+	return common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+}
+
+// relayAttemptLatency 返回单次尝试的首字耗时，未收到上游响应时返回总耗时
+func relayAttemptLatency(info *relaycommon.RelayInfo, attemptStart time.Time) time.Duration {
+	if ttft := relayAttemptFirstToken(info, attemptStart); ttft > 0 {
+		return ttft
+	}
+	return time.Since(attemptStart)
 }
 
 var upgrader = websocket.Upgrader{
@@ -297,7 +507,13 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 			AutoBan: &autoBanInt,
 		}, nil
 	}
+	_, selectSpan := tracing.Start(c.Request.Context(), "channel.select")
 	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(retryParam)
+	tracing.SetError(selectSpan, err)
+	if channel != nil {
+		selectSpan.SetAttributes(tracing.AttrChannelId.Int(channel.Id), tracing.AttrChannelType.Int(channel.Type))
+	}
+	selectSpan.End()
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
@@ -348,7 +564,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
-	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
+	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan && !service.IsMultiKeyRateLimited(c, err) {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.ErrorWithStatusCode())
 		})
@@ -379,6 +595,9 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["is_multi_key"] = true
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
+		if service.IsRequestCaptured(c) {
+			adminInfo["request_capture"] = true
+		}
 		service.AppendChannelAffinityAdminInfo(c, adminInfo)
 		other["admin_info"] = adminInfo
 		startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
@@ -414,7 +633,11 @@ func RelayMidjourney(c *gin.Context) {
 	case relayconstant.RelayModeSwapFace:
 		mjErr = relay.RelaySwapFace(c, relayInfo)
 	default:
-		mjErr = relay.RelayMidjourneySubmit(c, relayInfo)
+		if apiErr := service.CheckPIIRedactionSupported(c, relayInfo); apiErr != nil {
+			mjErr = &dto.MidjourneyResponse{Code: 4, Description: apiErr.Error()}
+		} else {
+			mjErr = relay.RelayMidjourneySubmit(c, relayInfo)
+		}
 	}
 	//err = relayMidjourneySubmit(c, relayMode)
 	log.Println(mjErr)
@@ -484,6 +707,11 @@ func RelayTask(c *gin.Context) {
 		return
 	}
 
+	if apiErr := service.CheckPIIRedactionSupported(c, relayInfo); apiErr != nil {
+		respondTaskError(c, service.TaskErrorWrapperLocal(apiErr, string(apiErr.GetErrorCode()), apiErr.StatusCode))
+		return
+	}
+
 	if taskErr := relay.ResolveOriginTask(c, relayInfo); taskErr != nil {
 		respondTaskError(c, taskErr)
 		return
@@ -496,6 +724,13 @@ func RelayTask(c *gin.Context) {
 			relayInfo.Billing.Refund(c)
 		}
 	}()
+	defer func() {
+		var relayErr error
+		if taskErr != nil {
+			relayErr = errors.New(taskErr.Message)
+		}
+		service.SaveRequestCapture(c, relayErr)
+	}()
 
 	retryParam := &service.RetryParam{
 		Ctx:        c,
@@ -562,7 +797,7 @@ func RelayTask(c *gin.Context) {
 
 	// ── 成功：结算 + 日志 + 插入任务 ──
 	if taskErr == nil {
-		if settleErr := service.SettleBilling(c, relayInfo, result.Quota); settleErr != nil {
+		if settleErr := service.SettleBilling(c, relayInfo, result.Quota, -1); settleErr != nil {
 			common.SysError("settle task billing error: " + settleErr.Error())
 		}
 		service.LogTaskConsumption(c, relayInfo)
@@ -572,6 +807,7 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
 		task.PrivateData.TokenId = relayInfo.TokenId
+		task.PrivateData.OrgId = relayInfo.OrgId
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
 			ModelPrice:      relayInfo.PriceData.ModelPrice,
 			GroupRatio:      relayInfo.PriceData.GroupRatioInfo.GroupRatio,
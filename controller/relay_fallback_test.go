@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchToFallbackModelRestoresRejectedCandidate(t *testing.T) {
+	ratio_setting.InitRatioSettings()
+	setting := operation_setting.GetUsageRateLimitSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.Models = map[string]operation_setting.UsageRateLimit{"gpt-4o-mini": {TPM: 1}}
+	t.Cleanup(func() { *setting = prev })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Set("auto_group", "fallback-group")
+	priceData := types.PriceData{ModelRatio: 7, QuotaToPreConsume: 42}
+	info := &relaycommon.RelayInfo{
+		TokenId:         920001,
+		UserId:          920001,
+		UsingGroup:      "default",
+		OriginModelName: "gpt-4o",
+		PriceData:       priceData,
+	}
+	retry := 1
+	retryParam := &service.RetryParam{Ctx: c, ModelName: "gpt-4o", Retry: &retry}
+	fallbackModels := []string{"gpt-4o-mini"}
+
+	// 降级模型的 TPM 不足以容纳本次请求，候选被跳过，计价结果不能残留
+	require.False(t, switchToFallbackModel(c, info, retryParam, &fallbackModels, 100, &types.TokenCountMeta{}))
+	require.Empty(t, fallbackModels)
+	require.Equal(t, "gpt-4o", info.OriginModelName)
+	require.Equal(t, "default", info.UsingGroup)
+	require.Equal(t, priceData, info.PriceData)
+	require.Empty(t, info.ModelFallbackPath)
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayClaudeRejectedWhenPIIRedactionEnabled(t *testing.T) {
+	setting := operation_setting.GetPIIRedactionSetting()
+	prev := *setting
+	setting.Enabled = true
+	t.Cleanup(func() { *setting = prev })
+	quotaSetting := operation_setting.GetQuotaSetting()
+	prevFreePreConsume := quotaSetting.EnableFreeModelPreConsume
+	quotaSetting.EnableFreeModelPreConsume = false
+	t.Cleanup(func() { quotaSetting.EnableFreeModelPreConsume = prevFreePreConsume })
+	ratio_setting.InitRatioSettings()
+	service.InitHttpClient()
+	prevPrices := ratio_setting.ModelPrice2JSONString()
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"claude-pii-test":0}`))
+	t.Cleanup(func() { _ = ratio_setting.UpdateModelPriceByJSONString(prevPrices) })
+
+	var mu sync.Mutex
+	var upstreamBodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		upstreamBodies = append(upstreamBodies, string(body))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		c.Set(common.RequestIdKey, "pii-test")
+		common.SetContextKey(c, constant.ContextKeyOriginalModel, "claude-pii-test")
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+		common.SetContextKey(c, constant.ContextKeyTokenPIIRedaction, true)
+		baseURL := upstream.URL
+		channel := &model.Channel{Id: 1, Type: constant.ChannelTypeAnthropic, Key: "sk-upstream", BaseURL: &baseURL}
+		require.Nil(t, middleware.SetupContextForSelectedChannel(c, channel, "claude-pii-test"))
+		Relay(c, types.RelayFormatClaude)
+	})
+
+	body := `{"model":"claude-pii-test","max_tokens":16,"messages":[{"role":"user","content":"mail alice@example.com"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "PII redaction is enabled")
+	mu.Lock()
+	defer mu.Unlock()
+	for _, sent := range upstreamBodies {
+		require.NotContains(t, sent, "alice@example.com")
+	}
+	require.Empty(t, upstreamBodies)
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RequestCaptureWindowRequest struct {
+	// Minutes 抓取窗口时长，0 表示立即关闭
+	Minutes int `json:"minutes"`
+}
+
+// GetRequestCaptures GET /api/capture/
+func GetRequestCaptures(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	failedOnly := c.Query("failed") == "true"
+	captures, total, err := model.GetRequestCaptures(tokenId, channelId, failedOnly, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(captures)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetRequestCapture GET /api/capture/:request_id
+func GetRequestCapture(c *gin.Context) {
+	capture, err := model.GetRequestCaptureByRequestId(c.Param("request_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	record, err := service.ReadRequestCapture(capture)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			common.ApiErrorMsg(c, "抓取文件不在当前节点或已被清理")
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"capture": capture,
+		"record":  record,
+	})
+}
+
+// DeleteRequestCapture DELETE /api/capture/:request_id
+func DeleteRequestCapture(c *gin.Context) {
+	capture, err := model.GetRequestCaptureByRequestId(c.Param("request_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := service.DeleteRequestCapture(capture); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// parseCaptureWindow 解析抓取窗口时长并返回截止时间，超过配置的最长窗口时截断
+func parseCaptureWindow(c *gin.Context) (int64, bool) {
+	var req RequestCaptureWindowRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.Minutes < 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return 0, false
+	}
+	if req.Minutes == 0 {
+		return 0, true
+	}
+	window := time.Duration(req.Minutes) * time.Minute
+	if maxWindow := operation_setting.GetRequestCaptureMaxWindow(); window > maxWindow {
+		window = maxWindow
+	}
+	return time.Now().Add(window).Unix(), true
+}
+
+// UpdateTokenCaptureWindow PUT /api/capture/token/:id
+func UpdateTokenCaptureWindow(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	until, ok := parseCaptureWindow(c)
+	if !ok {
+		return
+	}
+	if err := model.SetTokenCaptureUntil(id, until); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"capture_until": until})
+}
+
+// UpdateChannelCaptureWindow PUT /api/capture/channel/:id
+func UpdateChannelCaptureWindow(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	until, ok := parseCaptureWindow(c)
+	if !ok {
+		return
+	}
+	if err := model.SetChannelCaptureUntil(id, until); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"capture_until": until})
+}
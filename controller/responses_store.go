@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getUserResponseStateOrAbort(c *gin.Context) *model.ResponseState {
+	state, err := model.GetResponseState(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrResponseStateNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", "response_not_found",
+				fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		}
+		return nil
+	}
+	return state
+}
+
+// GetResponse GET /v1/responses/:id
+// 返回网关响应存储中保存的响应对象
+func GetResponse(c *gin.Context) {
+	state := getUserResponseStateOrAbort(c)
+	if state == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", state.Response)
+}
+
+// DeleteResponse DELETE /v1/responses/:id
+func DeleteResponse(c *gin.Context) {
+	err := model.DeleteResponseState(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, model.ErrResponseStateNotFound) {
+			openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", "response_not_found",
+				fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeUpdateDataError), err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIResponsesDeleted{ID: c.Param("id"), Object: "response", Deleted: true})
+}
+
+// ListResponseInputItems GET /v1/responses/:id/input_items
+// 仅返回该轮请求新增的输入项，默认按时间倒序
+func ListResponseInputItems(c *gin.Context) {
+	state := getUserResponseStateOrAbort(c)
+	if state == nil {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	items := make([]json.RawMessage, 0)
+	if err := common.Unmarshal(state.InputItems, &items); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", string(types.ErrorCodeQueryDataError), err.Error())
+		return
+	}
+	if c.DefaultQuery("order", "desc") != "asc" {
+		slices.Reverse(items)
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		var meta struct {
+			Id string `json:"id"`
+		}
+		_ = common.Unmarshal(item, &meta)
+		ids[i] = meta.Id
+	}
+	if after := c.Query("after"); after != "" {
+		if idx := slices.Index(ids, after); idx >= 0 {
+			items = items[idx+1:]
+			ids = ids[idx+1:]
+		}
+	}
+
+	list := dto.OpenAIList[json.RawMessage]{Object: "list", Data: items}
+	if len(items) > limit {
+		list.Data = items[:limit]
+		list.HasMore = true
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = ids[0]
+		list.LastID = ids[len(list.Data)-1]
+	}
+	c.JSON(http.StatusOK, list)
+}
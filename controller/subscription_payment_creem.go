@@ -8,6 +8,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/payment"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/gin-gonic/gin"
@@ -85,7 +86,7 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		PlanId:        plan.Id,
 		Money:         plan.PriceAmount,
 		TradeNo:       referenceId,
-		PaymentMethod: PaymentMethodCreem,
+		PaymentMethod: payment.ProviderCreem,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
@@ -112,7 +113,7 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		Quota:     0,
 	}
 
-	checkoutUrl, err := genCreemLink(referenceId, product, user.Email, user.Username)
+	checkout, err := payment.Get(payment.ProviderCreem).CreateCheckout(c.Request.Context(), creemCheckoutRequest(referenceId, product, user))
 	if err != nil {
 		log.Printf("获取Creem支付链接失败: %v", err)
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
@@ -122,7 +123,7 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"checkout_url": checkoutUrl,
+			"checkout_url": checkout.URL,
 			"order_id":     referenceId,
 		},
 	})
@@ -160,6 +160,22 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.TpmLimit < 0 || token.RpdLimit < 0 || token.QuotaPerHourLimit < 0 {
+		common.ApiErrorMsg(c, "令牌限流值不能为负数")
+		return
+	}
+	// 组织令牌要求创建者是组织成员，消耗从组织钱包扣除
+	if token.OrgId > 0 {
+		role, err := model.GetOrgMemberRoleWithCache(token.OrgId, c.GetInt("id"))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if role == "" {
+			common.ApiErrorMsg(c, "无权在该组织下创建令牌")
+			return
+		}
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -194,15 +210,24 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		TpmLimit:           token.TpmLimit,
+		RpdLimit:           token.RpdLimit,
+		QuotaPerHourLimit:  token.QuotaPerHourLimit,
+		ResponseCache:      token.ResponseCache,
+		OrgId:              token.OrgId,
+		GuardrailPolicy:    token.GuardrailPolicy,
+		PIIRedaction:       token.PIIRedaction,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 令牌以哈希存储时完整密钥仅在此返回一次
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    cleanToken,
 	})
 	return
 }
@@ -246,6 +271,10 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if token.TpmLimit < 0 || token.RpdLimit < 0 || token.QuotaPerHourLimit < 0 {
+		common.ApiErrorMsg(c, "令牌限流值不能为负数")
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -274,6 +303,12 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.TpmLimit = token.TpmLimit
+		cleanToken.RpdLimit = token.RpdLimit
+		cleanToken.QuotaPerHourLimit = token.QuotaPerHourLimit
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.GuardrailPolicy = token.GuardrailPolicy
+		cleanToken.PIIRedaction = token.PIIRedaction
 	}
 	err = cleanToken.Update()
 	if err != nil {
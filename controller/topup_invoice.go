@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTopUpInvoice 下载充值订单的收据。用户只能下载自己的订单，管理员可以下载任意订单
+func GetTopUpInvoice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	topUp := model.GetTopUpById(id)
+	if topUp == nil || (topUp.UserId != c.GetInt("id") && c.GetInt("role") < common.RoleAdminUser) {
+		common.ApiErrorMsg(c, "充值订单不存在")
+		return
+	}
+	user, err := model.GetUserById(topUp.UserId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	invoice, err := service.NewTopUpInvoice(topUp, user)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	content, err := service.RenderTopUpInvoice(invoice)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "receipt-"+invoice.Number+".html"))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", content)
+}
+
+type UpdateInvoiceSettingRequest struct {
+	CompanyName string `json:"invoice_company_name"`
+	TaxId       string `json:"invoice_tax_id"`
+	Address     string `json:"invoice_address"`
+}
+
+// UpdateUserInvoiceSetting 更新收据抬头，下载收据时使用
+func UpdateUserInvoiceSetting(c *gin.Context) {
+	var req UpdateInvoiceSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	req.CompanyName = strings.TrimSpace(req.CompanyName)
+	req.TaxId = strings.TrimSpace(req.TaxId)
+	req.Address = strings.TrimSpace(req.Address)
+	if len(req.CompanyName) > 200 || len(req.TaxId) > 64 || len(req.Address) > 500 {
+		common.ApiErrorMsg(c, "收据信息过长")
+		return
+	}
+
+	user, err := model.GetUserById(c.GetInt("id"), true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setting := user.GetSetting()
+	setting.InvoiceCompanyName = req.CompanyName
+	setting.InvoiceTaxId = req.TaxId
+	setting.InvoiceAddress = req.Address
+	user.SetSetting(setting)
+	if err := user.Update(false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -1146,6 +1146,9 @@ func UpdateUserSetting(c *gin.Context) {
 		UpstreamModelUpdateNotifyEnabled: upstreamModelUpdateNotifyEnabled,
 		AcceptUnsetRatioModel:            req.AcceptUnsetModelRatioModel,
 		RecordIpLog:                      req.RecordIpLog,
+		InvoiceCompanyName:               existingSettings.InvoiceCompanyName,
+		InvoiceTaxId:                     existingSettings.InvoiceTaxId,
+		InvoiceAddress:                   existingSettings.InvoiceAddress,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
@@ -221,7 +221,8 @@ func getVertexTaskKey(channel *model.Channel, task *model.Task) string {
 			return key
 		}
 	}
-	return strings.TrimSpace(channel.Key)
+	key, _ := channel.GetPlainKey()
+	return strings.TrimSpace(key)
 }
 
 func extractVertexVideoURLFromTaskData(task *model.Task) string {
@@ -40,6 +40,9 @@ type ChannelOtherSettings struct {
 	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
 	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
 	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	MultiKeyDailyRequestLimit             int           `json:"multi_key_daily_request_limit,omitempty"`              // 多Key模式下单个Key每日请求数上限，0 为不限制
+	MultiKeyDailyQuotaLimit               int           `json:"multi_key_daily_quota_limit,omitempty"`                // 多Key模式下单个Key每日消耗额度上限，0 为不限制
+	MultiKeyCooldownSeconds               int           `json:"multi_key_cooldown_seconds,omitempty"`                 // 限流感知模式下上游未返回重置时间时的默认冷却秒数
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
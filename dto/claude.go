@@ -595,3 +595,31 @@ func (u *ClaudeUsage) GetCacheCreationTotalTokens() int {
 type ClaudeServerToolUse struct {
 	WebSearchRequests int `json:"web_search_requests"`
 }
+
+// ClaudeCountTokensRequest /v1/messages/count_tokens 的上游请求体，仅包含计数接口接受的字段
+type ClaudeCountTokensRequest struct {
+	Model      string          `json:"model"`
+	System     any             `json:"system,omitempty"`
+	Messages   []ClaudeMessage `json:"messages"`
+	Tools      any             `json:"tools,omitempty"`
+	ToolChoice any             `json:"tool_choice,omitempty"`
+	Thinking   *Thinking       `json:"thinking,omitempty"`
+	McpServers json.RawMessage `json:"mcp_servers,omitempty"`
+}
+
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// ToCountTokensRequest 生成发往上游计数接口的请求体
+func (c *ClaudeRequest) ToCountTokensRequest(model string) *ClaudeCountTokensRequest {
+	return &ClaudeCountTokensRequest{
+		Model:      model,
+		System:     c.System,
+		Messages:   c.Messages,
+		Tools:      c.Tools,
+		ToolChoice: c.ToolChoice,
+		Thinking:   c.Thinking,
+		McpServers: c.McpServers,
+	}
+}
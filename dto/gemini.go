@@ -576,3 +576,48 @@ type GeminiBatchEmbeddingResponse struct {
 type ContentEmbedding struct {
 	Values []float64 `json:"values"`
 }
+
+// GeminiCountTokensRequest 客户端 models/{model}:countTokens 请求体，
+// contents 与 generateContentRequest 二选一
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+// ToGeminiChatRequest 将计数请求统一为 GeminiChatRequest，便于本地估算与上游转发
+func (r *GeminiCountTokensRequest) ToGeminiChatRequest() *GeminiChatRequest {
+	if r.GenerateContentRequest != nil {
+		return r.GenerateContentRequest
+	}
+	return &GeminiChatRequest{Contents: r.Contents}
+}
+
+// GeminiCountTokensGenerateContent 发往上游计数接口的生成请求，仅保留影响输入 token 的字段
+type GeminiCountTokensGenerateContent struct {
+	Model              string              `json:"model,omitempty"`
+	Contents           []GeminiChatContent `json:"contents"`
+	Tools              json.RawMessage     `json:"tools,omitempty"`
+	ToolConfig         *ToolConfig         `json:"toolConfig,omitempty"`
+	SystemInstructions *GeminiChatContent  `json:"systemInstruction,omitempty"`
+}
+
+// GeminiCountTokensUpstreamRequest 发往 Gemini API 计数接口的请求体
+type GeminiCountTokensUpstreamRequest struct {
+	GenerateContentRequest *GeminiCountTokensGenerateContent `json:"generateContentRequest"`
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens             int `json:"totalTokens"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+// ToCountTokensContent 生成发往上游计数接口的请求内容
+func (r *GeminiChatRequest) ToCountTokensContent(model string) *GeminiCountTokensGenerateContent {
+	return &GeminiCountTokensGenerateContent{
+		Model:              model,
+		Contents:           r.Contents,
+		Tools:              r.Tools,
+		ToolConfig:         r.ToolConfig,
+		SystemInstructions: r.SystemInstructions,
+	}
+}
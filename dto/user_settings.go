@@ -16,6 +16,9 @@ type UserSetting struct {
 	SidebarModules                   string  `json:"sidebar_modules,omitempty"`                      // SidebarModules 左侧边栏模块配置
 	BillingPreference                string  `json:"billing_preference,omitempty"`                   // BillingPreference 扣费策略（订阅/钱包）
 	Language                         string  `json:"language,omitempty"`                             // Language 用户语言偏好 (zh, en)
+	InvoiceCompanyName               string  `json:"invoice_company_name,omitempty"`                 // InvoiceCompanyName 收据抬头（公司名称）
+	InvoiceTaxId                     string  `json:"invoice_tax_id,omitempty"`                       // InvoiceTaxId 纳税人识别号 / VAT ID
+	InvoiceAddress                   string  `json:"invoice_address,omitempty"`                      // InvoiceAddress 收据上的公司地址
 }
 
 var (
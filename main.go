@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -19,6 +20,8 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
@@ -41,6 +44,11 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	// 配置快照子命令：newapi config export|import
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+
 	startTime := time.Now()
 
 	err := InitResources()
@@ -90,6 +98,9 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
+	// 缓存失效事件，周期同步作为兜底
+	model.InitCacheEvents()
+
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
@@ -112,6 +123,18 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// User/token budget window reset task (daily/weekly/monthly)
+	service.StartBudgetResetTask()
+
+	// Expired request capture cleanup (runs on every node, capture files are node-local)
+	service.StartRequestCaptureCleanupTask()
+
+	// Expired gateway-stored Responses API response cleanup
+	service.StartResponsesStoreCleanupTask()
+
+	// Re-wrap secrets encrypted with an old master key version after rotation
+	service.StartSecretReencryptTask()
+
 	// Wire task polling adaptor factory (breaks service -> relay import cycle)
 	service.GetTaskAdaptorFunc = func(platform constant.TaskPlatform) service.TaskPollingAdaptor {
 		a := relay.GetTaskAdaptor(platform)
@@ -121,9 +144,15 @@ func main() {
 		return a
 	}
 
+	// Guardrail moderation calls go through the gateway's own /v1/moderations relay
+	service.GuardrailModerationFunc = controller.GuardrailModeration
+
 	// Channel upstream model update check task
 	controller.StartChannelUpstreamModelUpdateTask()
 
+	// Batch API task
+	controller.StartBatchTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -146,6 +175,37 @@ func main() {
 		common.SysLog("pprof enabled")
 	}
 
+	if constant.MetricsEnabled {
+		metrics.SetEnabled(true)
+		if constant.MetricsListenAddr != "" {
+			gopool.Go(func() {
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metrics.Handler())
+				common.SysLog("metrics server listening on " + constant.MetricsListenAddr)
+				if err := http.ListenAndServe(constant.MetricsListenAddr, mux); err != nil {
+					common.SysError("metrics server error: " + err.Error())
+				}
+			})
+		}
+		common.SysLog("prometheus metrics enabled")
+	}
+
+	if constant.TracingEnabled {
+		shutdown, err := tracing.Init(context.Background(), tracing.Config{
+			Exporter:          constant.TracingExporter,
+			Endpoint:          constant.TracingEndpoint,
+			ServiceName:       constant.TracingServiceName,
+			SampleRatio:       constant.TracingSampleRatio,
+			PropagateUpstream: constant.TracingPropagateUpstream,
+		})
+		if err != nil {
+			common.SysError("failed to initialize tracing: " + err.Error())
+		} else {
+			defer shutdown(context.Background())
+			common.SysLog("opentelemetry tracing enabled, exporter: " + constant.TracingExporter)
+		}
+	}
+
 	err = common.StartPyroScope()
 	if err != nil {
 		common.SysError(fmt.Sprintf("start pyroscope error : %v", err))
@@ -165,6 +225,9 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	if tracing.Enabled() {
+		server.Use(middleware.Tracing())
+	}
 	server.Use(middleware.PoweredBy())
 	server.Use(middleware.I18n())
 	middleware.SetUpLogger(server)
@@ -261,6 +324,13 @@ func InitResources() error {
 
 	service.InitTokenEncoders()
 
+	// 加载加密敏感数据的主密钥，数据库迁移时会加密仍为明文的数据
+	err = model.InitSecretEncryption()
+	if err != nil {
+		common.FatalLog(err.Error())
+		return err
+	}
+
 	// Initialize SQL Database
 	err = model.InitDB()
 	if err != nil {
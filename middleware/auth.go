@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -11,12 +12,14 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func validUserInfo(username string, role int) bool {
@@ -240,13 +243,15 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
-		c.Set("token_key", token.Key)
+		c.Set("token_key", token.CacheKey())
 		c.Next()
 	}
 }
 
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := startTraceSpan(c, "token_auth")
+		defer endSpan()
 		// 先检测是否为ws
 		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
 			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
@@ -329,40 +334,90 @@ func TokenAuth() func(c *gin.Context) {
 			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
 		}
 
-		userCache, err := model.GetUserCache(token.UserId)
-		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		if !setupTokenUserContext(c, token, parts...) {
 			return
 		}
-		userEnabled := userCache.Status == common.UserStatusEnabled
-		if !userEnabled {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
-			return
+		attrs := []attribute.KeyValue{
+			tracing.AttrTokenId.Int(token.Id),
+			tracing.AttrUserId.Int(token.UserId),
+			tracing.AttrGroup.String(common.GetContextKeyString(c, constant.ContextKeyUsingGroup)),
 		}
+		span.SetAttributes(attrs...)
+		tracing.SetAttributes(c.Request.Context(), attrs...)
+		endSpan()
+		c.Next()
+	}
+}
 
-		userCache.WriteContext(c)
+// setupTokenUserContext 校验令牌所属用户与分组并写入上下文，失败时已中止请求并返回 false
+func setupTokenUserContext(c *gin.Context, token *model.Token, parts ...string) bool {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	userEnabled := userCache.Status == common.UserStatusEnabled
+	if !userEnabled {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+		return false
+	}
 
-		userGroup := userCache.Group
-		tokenGroup := token.Group
-		if tokenGroup != "" {
-			// check common.UserUsableGroups[userGroup]
-			if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
-				return
-			}
-			// check group in common.GroupRatio
-			if !ratio_setting.ContainsGroupRatio(tokenGroup) {
-				if tokenGroup != "auto" {
-					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
-					return
-				}
+	if token.OrgId > 0 {
+		if err := model.CheckOrgTokenAccess(token.OrgId, token.UserId); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return false
+		}
+	}
+
+	userCache.WriteContext(c)
+
+	userGroup := userCache.Group
+	tokenGroup := token.Group
+	if tokenGroup != "" {
+		// check common.UserUsableGroups[userGroup]
+		if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
+			return false
+		}
+		// check group in common.GroupRatio
+		if !ratio_setting.ContainsGroupRatio(tokenGroup) {
+			if tokenGroup != "auto" {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+				return false
 			}
-			userGroup = tokenGroup
 		}
-		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+		userGroup = tokenGroup
+	}
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+
+	return SetupContextForToken(c, token, parts...) == nil
+}
+
+type internalTokenIdKey struct{}
+
+// WithInternalTokenId 将令牌 ID 写入请求上下文，供 InternalTokenAuth 使用
+func WithInternalTokenId(ctx context.Context, tokenId int) context.Context {
+	return context.WithValue(ctx, internalTokenIdKey{}, tokenId)
+}
 
-		err = SetupContextForToken(c, token, parts...)
+// InternalTokenAuth 网关内部发起的请求（如批处理任务）按令牌 ID 鉴权，
+// 令牌 ID 只能通过 WithInternalTokenId 写入，不会从请求头读取，因此不能挂载到对外路由上
+func InternalTokenAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		tokenId, ok := c.Request.Context().Value(internalTokenIdKey{}).(int)
+		if !ok || tokenId == 0 {
+			abortWithOpenAiMessage(c, http.StatusUnauthorized, "无效的令牌")
+			return
+		}
+		token, err := model.ValidateUserTokenById(tokenId)
+		if token != nil {
+			c.Set("id", token.UserId)
+		}
 		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !setupTokenUserContext(c, token) {
 			return
 		}
 		c.Next()
@@ -375,7 +430,7 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	c.Set("id", token.UserId)
 	c.Set("token_id", token.Id)
-	c.Set("token_key", token.Key)
+	c.Set("token_key", token.CacheKey())
 	c.Set("token_name", token.Name)
 	c.Set("token_unlimited_quota", token.UnlimitedQuota)
 	if !token.UnlimitedQuota {
@@ -389,6 +444,12 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenUsageRateLimit, token.GetUsageRateLimit())
+	common.SetContextKey(c, constant.ContextKeyTokenResponseCache, token.ResponseCache)
+	common.SetContextKey(c, constant.ContextKeyTokenOrgId, token.OrgId)
+	common.SetContextKey(c, constant.ContextKeyTokenCaptureUntil, token.CaptureUntil)
+	common.SetContextKey(c, constant.ContextKeyTokenGuardrailPolicy, token.GuardrailPolicy)
+	common.SetContextKey(c, constant.ContextKeyTokenPIIRedaction, token.PIIRedaction)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
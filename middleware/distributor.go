@@ -13,13 +13,17 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ModelRequest struct {
@@ -29,6 +33,8 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		span, endSpan := startTraceSpan(c, "distribute")
+		defer endSpan()
 		var channel *model.Channel
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
@@ -129,6 +135,14 @@ func Distribute() func(c *gin.Context) {
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
 					})
+					if err != nil || channel == nil {
+						if fallbackChannel, fallbackGroup, fallbackModel := selectModelFallbackChannel(c, usingGroup, modelRequest.Model); fallbackChannel != nil {
+							logger.LogInfo(c, fmt.Sprintf("模型 %s 无可用渠道，降级到模型 %s", modelRequest.Model, fallbackModel))
+							common.SetContextKey(c, constant.ContextKeyModelFallbackPath, []string{modelRequest.Model, fallbackModel})
+							channel, selectGroup, err = fallbackChannel, fallbackGroup, nil
+							modelRequest.Model = fallbackModel
+						}
+					}
 					if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
@@ -152,6 +166,16 @@ func Distribute() func(c *gin.Context) {
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		attrs := []attribute.KeyValue{
+			tracing.AttrModel.String(modelRequest.Model),
+			tracing.AttrGroup.String(common.GetContextKeyString(c, constant.ContextKeyUsingGroup)),
+		}
+		if channel != nil {
+			attrs = append(attrs, tracing.AttrChannelId.Int(channel.Id), tracing.AttrChannelType.Int(channel.Type))
+		}
+		span.SetAttributes(attrs...)
+		tracing.SetAttributes(c.Request.Context(), attrs...)
+		endSpan()
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -159,6 +183,38 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// selectModelFallbackChannel 请求模型无可用渠道时，按降级链选择第一个有可用渠道的模型。
+// 仅对由 Relay 处理的同步中转请求生效，异步任务按提交的模型计费，不做降级
+func selectModelFallbackChannel(c *gin.Context, usingGroup string, modelName string) (*model.Channel, string, string) {
+	if strings.HasPrefix(c.Request.URL.Path, "/mj") || relayconstant.Path2RelayMode(c.Request.URL.Path) == relayconstant.RelayModeUnknown {
+		return nil, "", ""
+	}
+	for _, fallbackModel := range service.GetModelFallbackCandidates(c, usingGroup, []string{modelName}) {
+		// 降级模型的用量限流已用尽时跳过，实际预占在 Relay 计价后进行
+		if apiErr := service.CheckUsageRateLimit(c, &relaycommon.RelayInfo{
+			UserId:          common.GetContextKeyInt(c, constant.ContextKeyUserId),
+			TokenId:         common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+			UsingGroup:      usingGroup,
+			OriginModelName: fallbackModel,
+		}); apiErr != nil {
+			logger.LogWarn(c, fmt.Sprintf("降级模型 %s 已达用量限制，跳过：%s", fallbackModel, apiErr.Error()))
+			continue
+		}
+		// auto 分组会记录已搜索到的分组位置，换模型后需从第一个分组重新开始
+		common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+		channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:        c,
+			ModelName:  fallbackModel,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err == nil && channel != nil {
+			return channel, selectGroup, fallbackModel
+		}
+	}
+	return nil, "", ""
+}
+
 // getModelFromRequest 从请求中读取模型信息
 // 根据 Content-Type 自动处理：
 // - application/json
@@ -355,10 +411,12 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	common.SetContextKey(c, constant.ContextKeyChannelParamOverride, paramOverride)
 	common.SetContextKey(c, constant.ContextKeyChannelHeaderOverride, headerOverride)
+	common.SetContextKey(c, constant.ContextKeyChannelResponseOverride, channel.GetResponseOverride())
 	if nil != channel.OpenAIOrganization && *channel.OpenAIOrganization != "" {
 		common.SetContextKey(c, constant.ContextKeyChannelOrganization, *channel.OpenAIOrganization)
 	}
 	common.SetContextKey(c, constant.ContextKeyChannelAutoBan, channel.GetAutoBan())
+	common.SetContextKey(c, constant.ContextKeyChannelCaptureUntil, channel.CaptureUntil)
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
@@ -369,6 +427,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	if channel.ChannelInfo.IsMultiKey {
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
 		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
+		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyMode, string(channel.ChannelInfo.MultiKeyMode))
 	} else {
 		// 必须设置为 false，否则在重试到单个 key 的时候会导致日志显示错误
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, false)
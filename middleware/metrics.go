@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 保护主服务上的 /metrics：
+// 配置了 METRICS_TOKEN 时接受 "Authorization: Bearer <token>"，否则回退到管理员鉴权。
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if constant.MetricsToken != "" {
+			auth := strings.TrimSpace(c.Request.Header.Get("Authorization"))
+			token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(constant.MetricsToken)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		authHelper(c, common.RoleAdminUser)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求创建根 span。请求携带 W3C traceparent 时作为其子 span，
+// 链路 ID 通过 X-Trace-Id 响应头返回
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				tracing.AttrRequestId.String(c.GetString(common.RequestIdKey)),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		if traceId := tracing.TraceId(ctx); traceId != "" {
+			c.Header("X-Trace-Id", traceId)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status code %d", status))
+		}
+	}
+}
+
+// startTraceSpan 为中间件创建一个子 span，返回的函数结束该 span，可重复调用。
+// 需要在 c.Next() 之前调用，span 只覆盖中间件自身的耗时
+func startTraceSpan(c *gin.Context, name string) (trace.Span, func()) {
+	_, span := tracing.Start(c.Request.Context(), name)
+	return span, func() {
+		if c.IsAborted() {
+			span.SetStatus(codes.Error, fmt.Sprintf("aborted with status code %d", c.Writer.Status()))
+		}
+		span.End()
+	}
+}
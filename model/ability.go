@@ -120,7 +120,10 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 		return nil, err
 	}
 	channel := Channel{}
-	if len(abilities) > 0 {
+	if len(abilities) == 0 {
+		return nil, nil
+	}
+	for len(abilities) > 0 {
 		// Randomly choose one
 		weightSum := uint(0)
 		for _, ability_ := range abilities {
@@ -128,16 +131,23 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 		}
 		// Randomly choose one
 		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
+		chosen := 0
+		for i, ability_ := range abilities {
 			weight -= int(ability_.Weight) + 10
 			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
 			if weight <= 0 {
-				channel.Id = ability_.ChannelId
+				chosen = i
 				break
 			}
 		}
-	} else {
-		return nil, nil
+		if channelBreakerAllow(abilities[chosen].ChannelId, model) && !isChannelExcludedFromDB(abilities[chosen].ChannelId) {
+			channel.Id = abilities[chosen].ChannelId
+			break
+		}
+		abilities = append(abilities[:chosen], abilities[chosen+1:]...)
+	}
+	if channel.Id == 0 {
+		return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断、处于排期排除时段或 Key 均不可用", group, model)
 	}
 	err = DB.First(&channel, "id = ?", channel.Id).Error
 	return &channel, err
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch OpenAI 兼容的批处理任务，由网关在后台逐条转发执行
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(16);index"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt        int64  `json:"updated_at" gorm:"bigint"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func NewBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+func (b *Batch) Insert() error {
+	return DB.Create(b).Error
+}
+
+// UpdateWithStatus 仅当任务仍处于 fromStatus 时才更新，返回是否更新成功（用于多节点抢占任务与状态流转）
+func (b *Batch) UpdateWithStatus(fromStatus string) (bool, error) {
+	b.UpdatedAt = common.GetTimestamp()
+	result := DB.Model(b).Where("status = ?", fromStatus).Select("*").Updates(b)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateBatchProgress 更新执行进度并刷新心跳时间
+func UpdateBatchProgress(id string, completed int, failed int) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"request_completed": completed,
+		"request_failed":    failed,
+		"updated_at":        common.GetTimestamp(),
+	}).Error
+}
+
+func GetBatchById(id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	if err := DB.Where("id = ?", id).First(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetUserBatchById(userId int, id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	if err := DB.Where("id = ? AND user_id = ?", id, userId).First(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按创建时间倒序列出用户批处理任务，after 为上一页最后一个任务的 ID
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var last Batch
+		if err := DB.Where("id = ? AND user_id = ?", after, userId).First(&last).Error; err == nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", last.CreatedAt, last.CreatedAt, last.Id)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetBatchesByStatus 按创建时间顺序获取指定状态的任务
+func GetBatchesByStatus(status string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ?", status).Order("created_at asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetStaleBatches 获取心跳超时的执行中任务（执行节点已退出）
+func GetStaleBatches(updatedBefore int64, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ? AND updated_at < ?", []string{BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}, updatedBefore).
+		Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func IsBatchNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
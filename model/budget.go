@@ -0,0 +1,242 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetScopeUser  = "user"
+	BudgetScopeToken = "token"
+)
+
+const (
+	budgetCacheNamespace = "new-api:budget:v1"
+	budgetCacheTTL       = time.Minute
+)
+
+var ErrBudgetNotFound = errors.New("budget not found")
+
+// Budget 用户或令牌的周期预算，按 daily/weekly/monthly 窗口自动重置
+type Budget struct {
+	Id              int    `json:"id"`
+	Scope           string `json:"scope" gorm:"type:varchar(16);uniqueIndex:idx_budget_target"`
+	TargetId        int    `json:"target_id" gorm:"uniqueIndex:idx_budget_target"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	Period          string `json:"period" gorm:"type:varchar(16)"`
+	Quota           int    `json:"quota"`
+	UsedQuota       int    `json:"used_quota" gorm:"default:0"`
+	NextResetTime   int64  `json:"next_reset_time" gorm:"bigint;index"`
+	NotifiedPercent int    `json:"notified_percent" gorm:"default:0"` // 当前窗口已发送过的最高提醒百分比
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime     int64  `json:"updated_time" gorm:"bigint"`
+}
+
+var (
+	budgetCacheOnce sync.Once
+	budgetCache     *cachex.HybridCache[Budget]
+)
+
+func getBudgetCache() *cachex.HybridCache[Budget] {
+	budgetCacheOnce.Do(func() {
+		budgetCache = cachex.NewHybridCache[Budget](cachex.HybridCacheConfig[Budget]{
+			Namespace: cachex.Namespace(budgetCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[Budget]{},
+			Memory: func() *hot.HotCache[string, Budget] {
+				return hot.NewHotCache[string, Budget](hot.LRU, 10000).
+					WithTTL(budgetCacheTTL).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return budgetCache
+}
+
+func budgetCacheKey(scope string, targetId int) string {
+	return fmt.Sprintf("%s:%d", scope, targetId)
+}
+
+func invalidateBudgetCache(scope string, targetId int) {
+	_, _ = getBudgetCache().DeleteMany([]string{budgetCacheKey(scope, targetId)})
+}
+
+// IsValidBudgetPeriod 预算仅支持按自然日/周/月重置
+func IsValidBudgetPeriod(period string) bool {
+	switch period {
+	case SubscriptionResetDaily, SubscriptionResetWeekly, SubscriptionResetMonthly:
+		return true
+	}
+	return false
+}
+
+func GetBudget(scope string, targetId int) (*Budget, error) {
+	var budget Budget
+	err := DB.Where("scope = ? AND target_id = ?", scope, targetId).First(&budget).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func GetBudgetById(id int) (*Budget, error) {
+	var budget Budget
+	if err := DB.First(&budget, id).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// GetBudgetWithCache 返回预算配置（已用额度以数据库为准），未配置预算时返回 nil
+func GetBudgetWithCache(scope string, targetId int) (*Budget, error) {
+	key := budgetCacheKey(scope, targetId)
+	if cached, found, err := getBudgetCache().Get(key); err == nil && found {
+		if cached.Id == 0 {
+			return nil, nil
+		}
+		return &cached, nil
+	}
+	budget, err := GetBudget(scope, targetId)
+	if err != nil && !errors.Is(err, ErrBudgetNotFound) {
+		return nil, err
+	}
+	entry := Budget{}
+	if budget != nil {
+		entry = *budget
+	}
+	if err := getBudgetCache().SetWithTTL(key, entry, budgetCacheTTL); err != nil {
+		common.SysLog("failed to set budget cache: " + err.Error())
+	}
+	return budget, nil
+}
+
+// SaveBudget 创建或更新预算；新建或修改周期时开启新的窗口
+func SaveBudget(scope string, targetId int, userId int, period string, quota int) (*Budget, error) {
+	period = strings.TrimSpace(period)
+	if !IsValidBudgetPeriod(period) {
+		return nil, fmt.Errorf("invalid budget period: %s", period)
+	}
+	if quota <= 0 {
+		return nil, errors.New("budget quota must be greater than 0")
+	}
+	now := time.Now()
+	var budget Budget
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("scope = ? AND target_id = ?", scope, targetId).First(&budget).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if budget.Id == 0 || budget.Period != period {
+			budget.UsedQuota = 0
+			budget.NotifiedPercent = 0
+			budget.NextResetTime = calcPeriodNextResetTime(now, period, 0)
+		}
+		if budget.Quota != quota {
+			budget.NotifiedPercent = 0
+		}
+		budget.Scope = scope
+		budget.TargetId = targetId
+		budget.UserId = userId
+		budget.Period = period
+		budget.Quota = quota
+		budget.UpdatedTime = now.Unix()
+		if budget.Id == 0 {
+			budget.CreatedTime = now.Unix()
+			return tx.Create(&budget).Error
+		}
+		return tx.Save(&budget).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateBudgetCache(scope, targetId)
+	return &budget, nil
+}
+
+func DeleteBudget(scope string, targetId int) error {
+	err := DB.Where("scope = ? AND target_id = ?", scope, targetId).Delete(&Budget{}).Error
+	invalidateBudgetCache(scope, targetId)
+	return err
+}
+
+// ReserveBudgetQuota 在预算窗口内占用额度，剩余额度不足时返回 false
+func ReserveBudgetQuota(id int, quota int) (bool, error) {
+	result := DB.Model(&Budget{}).Where("id = ? AND used_quota + ? <= quota", id, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdjustBudgetUsedQuota 调整预算已用额度，delta < 0 表示退还（不低于 0）
+func AdjustBudgetUsedQuota(id int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	expr := gorm.Expr("used_quota + ?", delta)
+	if delta < 0 {
+		expr = gorm.Expr("CASE WHEN used_quota > ? THEN used_quota - ? ELSE 0 END", -delta, -delta)
+	}
+	return DB.Model(&Budget{}).Where("id = ?", id).Update("used_quota", expr).Error
+}
+
+// MarkBudgetNotified 记录当前窗口已提醒的百分比，返回是否由本次调用标记（避免多节点重复提醒）
+func MarkBudgetNotified(id int, percent int) (bool, error) {
+	result := DB.Model(&Budget{}).Where("id = ? AND notified_percent < ?", id, percent).
+		Update("notified_percent", percent)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ResetDueBudgets 重置已到期的预算窗口
+func ResetDueBudgets(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	now := time.Now()
+	var budgets []Budget
+	if err := DB.Where("next_reset_time > 0 AND next_reset_time <= ?", now.Unix()).
+		Order("next_reset_time asc").
+		Limit(limit).
+		Find(&budgets).Error; err != nil {
+		return 0, err
+	}
+	resetCount := 0
+	for _, budget := range budgets {
+		result := DB.Model(&Budget{}).
+			Where("id = ? AND next_reset_time = ?", budget.Id, budget.NextResetTime).
+			Updates(map[string]interface{}{
+				"used_quota":       0,
+				"notified_percent": 0,
+				"next_reset_time":  calcPeriodNextResetTime(now, budget.Period, 0),
+				"updated_time":     now.Unix(),
+			})
+		if result.Error != nil {
+			return resetCount, result.Error
+		}
+		if result.RowsAffected > 0 {
+			resetCount++
+		}
+	}
+	return resetCount, nil
+}
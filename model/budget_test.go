@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetReserveAndAdjust(t *testing.T) {
+	truncateTables(t)
+
+	budget, err := SaveBudget(BudgetScopeToken, 1, 1, SubscriptionResetDaily, 100)
+	require.NoError(t, err)
+	require.Greater(t, budget.NextResetTime, time.Now().Unix())
+
+	ok, err := ReserveBudgetQuota(budget.Id, 60)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = ReserveBudgetQuota(budget.Id, 50)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, AdjustBudgetUsedQuota(budget.Id, -80))
+	budget, err = GetBudgetById(budget.Id)
+	require.NoError(t, err)
+	require.Zero(t, budget.UsedQuota)
+
+	_, err = SaveBudget(BudgetScopeToken, 1, 1, "yearly", 100)
+	require.Error(t, err)
+}
+
+func TestResetDueBudgets(t *testing.T) {
+	truncateTables(t)
+
+	budget, err := SaveBudget(BudgetScopeUser, 2, 2, SubscriptionResetWeekly, 100)
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(&Budget{}).Where("id = ?", budget.Id).Updates(map[string]interface{}{
+		"used_quota":       100,
+		"notified_percent": 100,
+		"next_reset_time":  time.Now().Unix() - 1,
+	}).Error)
+
+	n, err := ResetDueBudgets(10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	budget, err = GetBudgetById(budget.Id)
+	require.NoError(t, err)
+	require.Zero(t, budget.UsedQuota)
+	require.Zero(t, budget.NotifiedPercent)
+	require.Greater(t, budget.NextResetTime, time.Now().Unix())
+}
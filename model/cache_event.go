@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/eventbus"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// 缓存失效事件：修改配置、渠道、令牌、用户与订阅套餐后发布事件，其他节点收到后立即重新加载对应数据，
+// 不必等待 SyncFrequency 的周期同步。启用 Redis 时通过 Redis pub/sub 广播，否则只在进程内分发。
+// 事件只携带 ID，收到后从数据库重新读取；周期性的全量同步仍然保留，用于补齐 Redis 断线期间丢失的事件。
+
+const (
+	CacheEventOption           = "option"
+	CacheEventChannel          = "channel"
+	CacheEventChannels         = "channels"
+	CacheEventToken            = "token"
+	CacheEventUser             = "user"
+	CacheEventSubscriptionPlan = "subscription_plan"
+
+	cacheEventRedisChannel = "new-api:cache_events"
+
+	// 短时间内的多次渠道变更合并为一次全量重新加载
+	channelCacheReloadDelay = 500 * time.Millisecond
+)
+
+var channelCacheReloadPending atomic.Bool
+
+// InitCacheEvents 注册缓存失效事件的处理函数并开始接收事件
+func InitCacheEvents() {
+	if !constant.CacheEventsEnabled {
+		return
+	}
+	eventbus.Subscribe(CacheEventOption, remoteCacheEvent(reloadOption))
+	eventbus.Subscribe(CacheEventChannel, remoteCacheEvent(func(key string) {
+		if id, err := strconv.Atoi(key); err == nil {
+			refreshCachedChannel(id)
+		}
+	}))
+	eventbus.Subscribe(CacheEventChannels, remoteCacheEvent(func(string) {
+		scheduleChannelCacheReload()
+	}))
+	eventbus.Subscribe(CacheEventToken, remoteCacheEvent(func(key string) {
+		_ = deleteTokenCache(key)
+	}))
+	eventbus.Subscribe(CacheEventUser, remoteCacheEvent(func(key string) {
+		if id, err := strconv.Atoi(key); err == nil {
+			_ = deleteUserCache(id)
+		}
+	}))
+	eventbus.Subscribe(CacheEventSubscriptionPlan, remoteCacheEvent(func(key string) {
+		if id, err := strconv.Atoi(key); err == nil {
+			invalidateSubscriptionPlanCache(id)
+		}
+	}))
+
+	var client *redis.Client
+	if common.RedisEnabled && common.RDB != nil {
+		client = common.RDB
+		common.SysLog(fmt.Sprintf("cache events enabled via redis pub/sub, node id: %s", eventbus.NodeId()))
+	}
+	eventbus.Start(context.Background(), client, cacheEventRedisChannel)
+}
+
+// remoteCacheEvent 本节点发布事件时已经更新了本地缓存，只处理其他节点发布的事件
+func remoteCacheEvent(handler func(key string)) eventbus.Handler {
+	return func(event eventbus.Event) {
+		if event.FromSelf() {
+			return
+		}
+		if common.DebugEnabled {
+			common.SysLog(fmt.Sprintf("cache event from %s: %s %s", event.Source, event.Type, event.Key))
+		}
+		handler(event.Key)
+	}
+}
+
+func publishCacheEvent(eventType string, key string) {
+	eventbus.Publish(eventType, key)
+}
+
+// reloadOption 从数据库重新读取单个配置项
+func reloadOption(key string) {
+	var option Option
+	err := DB.Where(&Option{Key: key}).First(&option).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			common.SysLog(fmt.Sprintf("failed to reload option %s: %s", key, err.Error()))
+		}
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		common.SysLog("failed to update option map: " + err.Error())
+	}
+}
+
+// refreshCachedChannel 从数据库重新读取单个渠道并替换缓存。
+// 分组、模型、优先级变化或渠道被重新启用时需要重建索引，改为全量重新加载
+func refreshCachedChannel(id int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channel, err := GetChannelById(id, true)
+	if err != nil {
+		scheduleChannelCacheReload()
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	oldChannel, ok := channelsIDM[id]
+	if !ok || oldChannel.Group != channel.Group || oldChannel.Models != channel.Models ||
+		oldChannel.GetPriority() != channel.GetPriority() ||
+		(oldChannel.Status != common.ChannelStatusEnabled && channel.Status == common.ChannelStatusEnabled) {
+		scheduleChannelCacheReload()
+		return
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		channel.cacheKeys()
+		if channel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling && oldChannel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling {
+			channel.ChannelInfo.MultiKeyPollingIndex = oldChannel.ChannelInfo.MultiKeyPollingIndex
+		}
+	}
+	channelsIDM[id] = channel
+	if oldChannel.Status == common.ChannelStatusEnabled && channel.Status != common.ChannelStatusEnabled {
+		removeChannelFromGroupsLocked(id)
+	}
+}
+
+func scheduleChannelCacheReload() {
+	if !common.MemoryCacheEnabled || !channelCacheReloadPending.CompareAndSwap(false, true) {
+		return
+	}
+	gopool.Go(func() {
+		time.Sleep(channelCacheReloadDelay)
+		channelCacheReloadPending.Store(false)
+		loadChannelCache()
+	})
+}
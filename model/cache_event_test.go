@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshCachedChannel(t *testing.T) {
+	truncateTables(t)
+	memoryCacheEnabled := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = true
+	channelSyncLock.Lock()
+	oldChannels, oldGroups := channelsIDM, group2model2channels
+	channelSyncLock.Unlock()
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled = memoryCacheEnabled
+		channelSyncLock.Lock()
+		channelsIDM, group2model2channels = oldChannels, oldGroups
+		channelSyncLock.Unlock()
+	})
+
+	channel := &Channel{Id: 7, Name: "a", Key: "k", Group: "default", Models: "gpt-4o", Status: common.ChannelStatusEnabled}
+	require.NoError(t, DB.Create(channel).Error)
+	channelSyncLock.Lock()
+	cached := *channel
+	channelsIDM = map[int]*Channel{7: &cached}
+	group2model2channels = map[string]map[string][]int{"default": {"gpt-4o": {7}}}
+	channelSyncLock.Unlock()
+
+	// 其他节点禁用渠道后只替换该渠道并从索引中移除，不触发全量重新加载
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", 7).Updates(map[string]any{"status": common.ChannelStatusAutoDisabled, "name": "b"}).Error)
+	refreshCachedChannel(7)
+	channelSyncLock.RLock()
+	require.Equal(t, "b", channelsIDM[7].Name)
+	require.Equal(t, common.ChannelStatusAutoDisabled, channelsIDM[7].Status)
+	require.Empty(t, group2model2channels["default"]["gpt-4o"])
+	channelSyncLock.RUnlock()
+	require.False(t, channelCacheReloadPending.Load())
+}
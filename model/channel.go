@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -47,7 +50,10 @@ type Channel struct {
 	Setting           *string `json:"setting" gorm:"type:text"` // 渠道额外设置
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
 	HeaderOverride    *string `json:"header_override" gorm:"type:text"`
+	ResponseOverride  *string `json:"response_override" gorm:"type:text"` // 上游响应改写规则，格式同 param_override
 	Remark            *string `json:"remark" gorm:"type:varchar(255)" validate:"max=255"`
+	CaptureUntil      int64   `json:"capture_until" gorm:"bigint;default:0"` // 请求抓取窗口截止时间，0 表示未开启
+	Schedule          *string `json:"schedule" gorm:"type:text"`             // 排期规则，详见 ChannelSchedule
 	// add after v0.8.5
 	ChannelInfo ChannelInfo `json:"channel_info" gorm:"type:json"`
 
@@ -78,6 +84,44 @@ func (c *ChannelInfo) Scan(value interface{}) error {
 	return common.Unmarshal(bytesValue, c)
 }
 
+// GetPlainKey 返回解密后的 Key，多 Key 渠道为全部 Key 的原始文本。
+// 数据库与缓存中只保存密文，需要使用 Key 时再解密，不要保存返回值
+func (channel *Channel) GetPlainKey() (string, error) {
+	return decryptSecret(channel.Key)
+}
+
+// BeforeSave 写入数据库前加密 Key。用另一个 Channel 结构体只更新部分字段时不会写入 key，不做处理
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	switch dest := tx.Statement.Dest.(type) {
+	case map[string]interface{}:
+		if key, ok := dest["key"].(string); ok {
+			encrypted, err := encryptSecret(key)
+			if err != nil {
+				return err
+			}
+			dest["key"] = encrypted
+		}
+		return nil
+	case Channel:
+		return nil
+	}
+	encrypted, err := encryptSecret(channel.Key)
+	if err != nil {
+		return err
+	}
+	channel.Key = encrypted
+	return nil
+}
+
+// cacheKeys 缓存多 Key 渠道拆分后的 Key 列表，加密的 Key 每次使用时再解密，不缓存明文
+func (channel *Channel) cacheKeys() {
+	if IsEncryptedSecret(channel.Key) {
+		channel.Keys = nil
+		return
+	}
+	channel.Keys = channel.GetKeys()
+}
+
 func (channel *Channel) GetKeys() []string {
 	if channel.Key == "" {
 		return []string{}
@@ -85,7 +129,17 @@ func (channel *Channel) GetKeys() []string {
 	if len(channel.Keys) > 0 {
 		return channel.Keys
 	}
-	trimmed := strings.TrimSpace(channel.Key)
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to decrypt channel key: channel_id=%d, error=%v", channel.Id, err))
+		return []string{}
+	}
+	return splitChannelKeys(plainKey)
+}
+
+// splitChannelKeys 拆分多 Key 渠道的 Key，支持 JSON 数组（例如 Vertex AI）与按行分隔
+func splitChannelKeys(key string) []string {
+	trimmed := strings.TrimSpace(key)
 	// If the key starts with '[', try to parse it as a JSON array (e.g., for Vertex AI scenarios)
 	if strings.HasPrefix(trimmed, "[") {
 		var arr []json.RawMessage
@@ -98,14 +152,18 @@ func (channel *Channel) GetKeys() []string {
 		}
 	}
 	// Otherwise, fall back to splitting by newline
-	keys := strings.Split(strings.Trim(channel.Key, "\n"), "\n")
+	keys := strings.Split(strings.Trim(key, "\n"), "\n")
 	return keys
 }
 
-func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
-	// If not in multi-key mode, return the original key string directly.
+func (channel *Channel) GetNextEnabledKey() (key string, index int, apiErr *types.NewAPIError) {
+	// If not in multi-key mode, return the decrypted key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
-		return channel.Key, 0, nil
+		key, err := channel.GetPlainKey()
+		if err != nil {
+			return "", 0, types.NewError(err, types.ErrorCodeChannelInvalidKey)
+		}
+		return key, 0, nil
 	}
 
 	// Obtain all keys (split by \n)
@@ -145,11 +203,42 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 冷却中或已达每日上限的 Key 暂不参与选择
+	limits := channel.getMultiKeyLimits()
+	tracked := channel.multiKeyStateTracked(limits)
+	var states map[int]MultiKeyState
+	now := time.Now()
+	if tracked {
+		states = getMultiKeyStates(channel.Id, now)
+		availableIdx := make([]int, 0, len(enabledIdx))
+		for _, idx := range enabledIdx {
+			if !limits.exceeded(states[idx], now) {
+				availableIdx = append(availableIdx, idx)
+			}
+		}
+		if len(availableIdx) == 0 {
+			return "", 0, types.NewErrorWithStatusCode(errors.New("all enabled keys are cooling down or have reached the daily limit"), types.ErrorCodeMultiKeyCoolingDown, http.StatusTooManyRequests)
+		}
+		enabledIdx = availableIdx
+		defer func() {
+			if apiErr == nil {
+				markMultiKeyUsed(channel.Id, index, now)
+			}
+		}()
+	}
+	isAvailable := func(idx int) bool {
+		return getStatus(idx) == common.ChannelStatusEnabled && (!tracked || !limits.exceeded(states[idx], now))
+	}
+
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
 		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
 		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeLeastUsed, constant.MultiKeyModeRateLimit:
+		// 选择最久未使用的 Key，限流感知模式下被限流的 Key 已在上面因冷却被排除
+		selectedIdx := pickLeastUsedKey(enabledIdx, states)
+		return keys[selectedIdx], selectedIdx, nil
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
@@ -175,7 +264,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isAvailable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -458,31 +547,21 @@ func (channel *Channel) Insert() error {
 func (channel *Channel) Update() error {
 	// If this is a multi-key channel, recalculate MultiKeySize based on the current key list to avoid inconsistency after editing keys
 	if channel.ChannelInfo.IsMultiKey {
-		var keyStr string
-		if channel.Key != "" {
-			keyStr = channel.Key
-		} else {
+		keyStr := channel.Key
+		if keyStr == "" {
 			// If key is not provided, read the existing key from the database
 			if existing, err := GetChannelById(channel.Id, true); err == nil {
 				keyStr = existing.Key
 			}
 		}
+		plainKey, err := decryptSecret(keyStr)
+		if err != nil {
+			return err
+		}
 		// Parse the key list (supports newline separation or JSON array)
 		keys := []string{}
-		if keyStr != "" {
-			trimmed := strings.TrimSpace(keyStr)
-			if strings.HasPrefix(trimmed, "[") {
-				var arr []json.RawMessage
-				if err := common.Unmarshal([]byte(trimmed), &arr); err == nil {
-					keys = make([]string, len(arr))
-					for i, v := range arr {
-						keys[i] = string(v)
-					}
-				}
-			}
-			if len(keys) == 0 { // fallback to newline split
-				keys = strings.Split(strings.Trim(keyStr, "\n"), "\n")
-			}
+		if plainKey != "" {
+			keys = splitChannelKeys(plainKey)
 		}
 		channel.ChannelInfo.MultiKeySize = len(keys)
 		// Clean up status data that exceeds the new key count to prevent index out of range
@@ -617,6 +696,10 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 		if channelCache == nil {
 			return false
 		}
+		// 维护中的渠道只能手动恢复，不参与自动禁用与自动启用
+		if channelCache.Status == common.ChannelStatusMaintenance {
+			return false
+		}
 		if channelCache.ChannelInfo.IsMultiKey {
 			// Use per-channel lock to prevent concurrent map read/write with GetNextEnabledKey
 			pollingLock := GetChannelPollingLock(channelId)
@@ -648,7 +731,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 	if err != nil {
 		return false
 	} else {
-		if channel.Status == status {
+		if channel.Status == status || channel.Status == common.ChannelStatusMaintenance {
 			return false
 		}
 
@@ -676,6 +759,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			return false
 		}
 	}
+	publishCacheEvent(CacheEventChannel, strconv.Itoa(channelId))
 	return true
 }
 
@@ -688,6 +772,36 @@ func EnableChannelByTag(tag string) error {
 	return err
 }
 
+// SetChannelMaintenance 将渠道切换为维护中，或从维护中恢复为启用
+func SetChannelMaintenance(channelId int, maintenance bool) error {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return err
+	}
+	status := common.ChannelStatusMaintenance
+	if !maintenance {
+		if channel.Status != common.ChannelStatusMaintenance {
+			return errors.New("渠道不在维护中")
+		}
+		status = common.ChannelStatusEnabled
+	}
+	if channel.Status == status {
+		return nil
+	}
+	info := channel.GetOtherInfo()
+	info["status_reason"] = ""
+	if maintenance {
+		info["status_reason"] = "maintenance"
+	}
+	info["status_time"] = common.GetTimestamp()
+	channel.SetOtherInfo(info)
+	channel.Status = status
+	if err := channel.SaveWithoutKey(); err != nil {
+		return err
+	}
+	return UpdateAbilityStatus(channelId, status == common.ChannelStatusEnabled)
+}
+
 func DisableChannelByTag(tag string) error {
 	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusManuallyDisabled).Error
 	if err != nil {
@@ -697,7 +811,7 @@ func DisableChannelByTag(tag string) error {
 	return err
 }
 
-func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *string, group *string, priority *int64, weight *uint, paramOverride *string, headerOverride *string) error {
+func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *string, group *string, priority *int64, weight *uint, paramOverride *string, headerOverride *string, responseOverride *string) error {
 	updateData := Channel{}
 	shouldReCreateAbilities := false
 	updatedTag := tag
@@ -729,6 +843,9 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 	if headerOverride != nil {
 		updateData.HeaderOverride = headerOverride
 	}
+	if responseOverride != nil {
+		updateData.ResponseOverride = responseOverride
+	}
 
 	err := DB.Model(&Channel{}).Where("tag = ?", tag).Updates(updateData).Error
 	if err != nil {
@@ -918,6 +1035,17 @@ func (channel *Channel) GetHeaderOverride() map[string]interface{} {
 	return headerOverride
 }
 
+func (channel *Channel) GetResponseOverride() map[string]interface{} {
+	responseOverride := make(map[string]interface{})
+	if channel.ResponseOverride != nil && *channel.ResponseOverride != "" {
+		err := common.Unmarshal([]byte(*channel.ResponseOverride), &responseOverride)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to unmarshal response override: channel_id=%d, error=%v", channel.Id, err))
+		}
+	}
+	return responseOverride
+}
+
 func GetChannelsByIds(ids []int) ([]*Channel, error) {
 	var channels []*Channel
 	err := DB.Where("id in (?)", ids).Find(&channels).Error
@@ -0,0 +1,491 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道熔断器：按 渠道 + 模型 统计滚动窗口内的失败率与慢请求比例，
+// 达到阈值后熔断（open），熔断时间结束后进入半开（half_open）状态放行少量探测请求，
+// 探测全部成功则恢复（closed），任一探测失败则重新熔断。
+// 启用 Redis 时状态保存在 Redis 中供多个节点共享，否则保存在进程内。
+
+const (
+	ChannelBreakerStateClosed   = 0
+	ChannelBreakerStateOpen     = 1
+	ChannelBreakerStateHalfOpen = 2
+
+	channelBreakerBuckets   = 6
+	channelBreakerKeyPrefix = "channelBreaker"
+)
+
+type ChannelBreakerStatus struct {
+	ChannelId      int    `json:"channel_id"`
+	Model          string `json:"model"`
+	State          string `json:"state"`
+	Requests       int64  `json:"requests"`
+	Failures       int64  `json:"failures"`
+	SlowRequests   int64  `json:"slow_requests"`
+	OpenedAt       int64  `json:"opened_at"`
+	ProbesInFlight int64  `json:"probes_in_flight"`
+	ProbeSuccesses int64  `json:"probe_successes"`
+}
+
+type channelBreakerConfig struct {
+	bucketMs       int64
+	minRequests    int64
+	failureRate    float64
+	slowThreshold  time.Duration
+	slowRate       float64
+	openMs         int64
+	halfOpenProbes int64
+	ttl            time.Duration
+}
+
+func getChannelBreakerConfig() (channelBreakerConfig, bool) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	if !setting.Enabled {
+		return channelBreakerConfig{}, false
+	}
+	window := setting.WindowSeconds
+	if window < channelBreakerBuckets {
+		window = channelBreakerBuckets
+	}
+	openSeconds := setting.OpenSeconds
+	if openSeconds <= 0 {
+		openSeconds = 30
+	}
+	probes := setting.HalfOpenProbes
+	if probes <= 0 {
+		probes = 1
+	}
+	minRequests := setting.MinRequests
+	if minRequests <= 0 {
+		minRequests = 1
+	}
+	cfg := channelBreakerConfig{
+		bucketMs:       int64(window) * 1000 / channelBreakerBuckets,
+		minRequests:    int64(minRequests),
+		failureRate:    setting.FailureRateThreshold,
+		slowThreshold:  time.Duration(setting.SlowThresholdSeconds * float64(time.Second)),
+		slowRate:       setting.SlowRateThreshold,
+		openMs:         int64(openSeconds) * 1000,
+		halfOpenProbes: int64(probes),
+	}
+	cfg.ttl = 2 * time.Duration(int64(window)*1000+cfg.openMs) * time.Millisecond
+	return cfg, true
+}
+
+func channelBreakerKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%s:%d:%s", channelBreakerKeyPrefix, channelId, modelName)
+}
+
+// channelBreakerEntry 熔断器状态，字段与 Redis hash 中的字段一一对应
+type channelBreakerEntry struct {
+	state    int
+	openedAt int64
+	probes   int64
+	probeOk  int64
+	ts       [channelBreakerBuckets]int64
+	req      [channelBreakerBuckets]int64
+	fail     [channelBreakerBuckets]int64
+	slow     [channelBreakerBuckets]int64
+	expireAt time.Time
+}
+
+func (e *channelBreakerEntry) reset() {
+	*e = channelBreakerEntry{expireAt: e.expireAt}
+	for i := range e.ts {
+		e.ts[i] = -1
+	}
+}
+
+func (e *channelBreakerEntry) sum(bucket int64) (req, fail, slow int64) {
+	for i := 0; i < channelBreakerBuckets; i++ {
+		if e.ts[i] > bucket-channelBreakerBuckets {
+			req += e.req[i]
+			fail += e.fail[i]
+			slow += e.slow[i]
+		}
+	}
+	return
+}
+
+func (e *channelBreakerEntry) allow(nowMs int64, cfg channelBreakerConfig) bool {
+	switch e.state {
+	case ChannelBreakerStateOpen:
+		if nowMs-e.openedAt < cfg.openMs {
+			return false
+		}
+		e.state = ChannelBreakerStateHalfOpen
+		e.openedAt = nowMs
+		e.probes = 1
+		e.probeOk = 0
+		return true
+	case ChannelBreakerStateHalfOpen:
+		if e.probes < cfg.halfOpenProbes {
+			e.probes++
+			return true
+		}
+		if nowMs-e.openedAt >= cfg.openMs {
+			// 探测请求长时间未回报结果，重新发放探测名额
+			e.openedAt = nowMs
+			e.probes = 1
+			e.probeOk = 0
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (e *channelBreakerEntry) record(nowMs int64, failed bool, slow bool, cfg channelBreakerConfig) {
+	switch e.state {
+	case ChannelBreakerStateOpen:
+		return
+	case ChannelBreakerStateHalfOpen:
+		if failed {
+			e.reset()
+			e.state = ChannelBreakerStateOpen
+			e.openedAt = nowMs
+			return
+		}
+		e.probeOk++
+		if e.probeOk >= cfg.halfOpenProbes {
+			e.reset()
+		}
+		return
+	}
+	bucket := nowMs / cfg.bucketMs
+	idx := bucket % channelBreakerBuckets
+	if e.ts[idx] != bucket {
+		e.ts[idx] = bucket
+		e.req[idx], e.fail[idx], e.slow[idx] = 0, 0, 0
+	}
+	e.req[idx]++
+	if failed {
+		e.fail[idx]++
+	}
+	if slow {
+		e.slow[idx]++
+	}
+	req, fail, slw := e.sum(bucket)
+	if req >= cfg.minRequests && ((cfg.failureRate > 0 && float64(fail)/float64(req) >= cfg.failureRate) ||
+		(cfg.slowRate > 0 && float64(slw)/float64(req) >= cfg.slowRate)) {
+		e.reset()
+		e.state = ChannelBreakerStateOpen
+		e.openedAt = nowMs
+	}
+}
+
+func (e *channelBreakerEntry) toStatus(channelId int, modelName string, nowMs int64, cfg channelBreakerConfig) ChannelBreakerStatus {
+	status := ChannelBreakerStatus{
+		ChannelId: channelId,
+		Model:     modelName,
+		State:     "closed",
+	}
+	switch e.state {
+	case ChannelBreakerStateOpen:
+		status.State = "open"
+		status.OpenedAt = e.openedAt / 1000
+	case ChannelBreakerStateHalfOpen:
+		status.State = "half_open"
+		status.OpenedAt = e.openedAt / 1000
+		status.ProbesInFlight = e.probes - e.probeOk
+		status.ProbeSuccesses = e.probeOk
+	}
+	if cfg.bucketMs > 0 {
+		status.Requests, status.Failures, status.SlowRequests = e.sum(nowMs / cfg.bucketMs)
+	}
+	return status
+}
+
+func parseChannelBreakerEntry(fields map[string]string) *channelBreakerEntry {
+	e := &channelBreakerEntry{}
+	e.reset()
+	parse := func(name string) int64 {
+		v, _ := strconv.ParseInt(fields[name], 10, 64)
+		return v
+	}
+	e.state = int(parse("state"))
+	e.openedAt = parse("opened_at")
+	e.probes = parse("probes")
+	e.probeOk = parse("probe_ok")
+	for i := 0; i < channelBreakerBuckets; i++ {
+		if _, ok := fields["ts"+strconv.Itoa(i)]; ok {
+			e.ts[i] = parse("ts" + strconv.Itoa(i))
+		}
+		e.req[i] = parse("req" + strconv.Itoa(i))
+		e.fail[i] = parse("fail" + strconv.Itoa(i))
+		e.slow[i] = parse("slow" + strconv.Itoa(i))
+	}
+	return e
+}
+
+// Redis 实现，逻辑与 channelBreakerEntry.allow / record 保持一致
+
+var channelBreakerAllowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local openMs = tonumber(ARGV[2])
+local halfOpenProbes = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local state = tonumber(redis.call('HGET', key, 'state') or '0')
+if state == 0 then
+	return 1
+end
+local openedAt = tonumber(redis.call('HGET', key, 'opened_at') or '0')
+if state == 1 then
+	if now - openedAt < openMs then
+		return 0
+	end
+	redis.call('HSET', key, 'state', 2, 'opened_at', now, 'probes', 1, 'probe_ok', 0)
+	redis.call('PEXPIRE', key, ttl)
+	return 1
+end
+local probes = tonumber(redis.call('HGET', key, 'probes') or '0')
+if probes < halfOpenProbes then
+	redis.call('HINCRBY', key, 'probes', 1)
+	return 1
+end
+if now - openedAt >= openMs then
+	redis.call('HSET', key, 'opened_at', now, 'probes', 1, 'probe_ok', 0)
+	redis.call('PEXPIRE', key, ttl)
+	return 1
+end
+return 0
+`)
+
+var channelBreakerRecordScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local failed = tonumber(ARGV[2])
+local slow = tonumber(ARGV[3])
+local bucketMs = tonumber(ARGV[4])
+local buckets = tonumber(ARGV[5])
+local minRequests = tonumber(ARGV[6])
+local failureRate = tonumber(ARGV[7])
+local slowRate = tonumber(ARGV[8])
+local halfOpenProbes = tonumber(ARGV[9])
+local ttl = tonumber(ARGV[10])
+local state = tonumber(redis.call('HGET', key, 'state') or '0')
+if state == 1 then
+	return -1
+end
+if state == 2 then
+	if failed == 1 then
+		redis.call('DEL', key)
+		redis.call('HSET', key, 'state', 1, 'opened_at', now)
+		redis.call('PEXPIRE', key, ttl)
+		return 1
+	end
+	if redis.call('HINCRBY', key, 'probe_ok', 1) >= halfOpenProbes then
+		redis.call('DEL', key)
+		return 0
+	end
+	return -1
+end
+local bucket = math.floor(now / bucketMs)
+local idx = bucket % buckets
+if tonumber(redis.call('HGET', key, 'ts' .. idx) or '-1') ~= bucket then
+	redis.call('HSET', key, 'ts' .. idx, bucket, 'req' .. idx, 0, 'fail' .. idx, 0, 'slow' .. idx, 0)
+end
+redis.call('HINCRBY', key, 'req' .. idx, 1)
+if failed == 1 then
+	redis.call('HINCRBY', key, 'fail' .. idx, 1)
+end
+if slow == 1 then
+	redis.call('HINCRBY', key, 'slow' .. idx, 1)
+end
+local req, fail, slw = 0, 0, 0
+for i = 0, buckets - 1 do
+	local ts = tonumber(redis.call('HGET', key, 'ts' .. i) or '-1')
+	if ts > bucket - buckets then
+		req = req + tonumber(redis.call('HGET', key, 'req' .. i) or '0')
+		fail = fail + tonumber(redis.call('HGET', key, 'fail' .. i) or '0')
+		slw = slw + tonumber(redis.call('HGET', key, 'slow' .. i) or '0')
+	end
+end
+if req >= minRequests and ((failureRate > 0 and fail / req >= failureRate) or (slowRate > 0 and slw / req >= slowRate)) then
+	redis.call('DEL', key)
+	redis.call('HSET', key, 'state', 1, 'opened_at', now)
+	redis.call('PEXPIRE', key, ttl)
+	return 1
+end
+redis.call('PEXPIRE', key, ttl)
+return -1
+`)
+
+// 进程内实现
+
+var channelBreakerMemory = struct {
+	sync.Mutex
+	entries   map[string]*channelBreakerEntry
+	lastSweep time.Time
+}{entries: make(map[string]*channelBreakerEntry)}
+
+func getChannelBreakerMemoryEntry(key string, now time.Time, cfg channelBreakerConfig, create bool) *channelBreakerEntry {
+	if now.Sub(channelBreakerMemory.lastSweep) > time.Minute {
+		for k, e := range channelBreakerMemory.entries {
+			if now.After(e.expireAt) {
+				delete(channelBreakerMemory.entries, k)
+			}
+		}
+		channelBreakerMemory.lastSweep = now
+	}
+	e, ok := channelBreakerMemory.entries[key]
+	if ok && now.After(e.expireAt) {
+		delete(channelBreakerMemory.entries, key)
+		ok = false
+	}
+	if !ok {
+		if !create {
+			return nil
+		}
+		e = &channelBreakerEntry{}
+		e.reset()
+		channelBreakerMemory.entries[key] = e
+	}
+	e.expireAt = now.Add(cfg.ttl)
+	return e
+}
+
+func channelBreakerUseRedis() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+// channelBreakerAllow 判断渠道在该模型上是否可以接收请求，半开状态下会占用一个探测名额
+func channelBreakerAllow(channelId int, modelName string) bool {
+	cfg, ok := getChannelBreakerConfig()
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	key := channelBreakerKey(channelId, modelName)
+	if channelBreakerUseRedis() {
+		result, err := channelBreakerAllowScript.Run(context.Background(), common.RDB, []string{key},
+			now.UnixMilli(), cfg.openMs, cfg.halfOpenProbes, cfg.ttl.Milliseconds()).Int()
+		if err != nil {
+			// 熔断器不可用时放行
+			common.SysError(fmt.Sprintf("channel breaker allow error: %s", err.Error()))
+			return true
+		}
+		return result == 1
+	}
+	channelBreakerMemory.Lock()
+	defer channelBreakerMemory.Unlock()
+	e := getChannelBreakerMemoryEntry(key, now, cfg, false)
+	if e == nil {
+		return true
+	}
+	return e.allow(now.UnixMilli(), cfg)
+}
+
+// RecordChannelBreakerResult 记录一次请求结果，latency 为首字耗时（非流式为总耗时）
+func RecordChannelBreakerResult(channelId int, modelName string, failed bool, latency time.Duration) {
+	cfg, ok := getChannelBreakerConfig()
+	if !ok {
+		return
+	}
+	slow := !failed && cfg.slowThreshold > 0 && latency > cfg.slowThreshold
+	now := time.Now()
+	key := channelBreakerKey(channelId, modelName)
+	// state 为状态发生变化后的新状态，未变化时为 -1
+	var state int
+	if channelBreakerUseRedis() {
+		result, err := channelBreakerRecordScript.Run(context.Background(), common.RDB, []string{key},
+			now.UnixMilli(), boolToInt(failed), boolToInt(slow), cfg.bucketMs, channelBreakerBuckets,
+			cfg.minRequests, cfg.failureRate, cfg.slowRate, cfg.halfOpenProbes, cfg.ttl.Milliseconds()).Int()
+		if err != nil {
+			common.SysError(fmt.Sprintf("channel breaker record error: %s", err.Error()))
+			return
+		}
+		state = result
+	} else {
+		channelBreakerMemory.Lock()
+		e := getChannelBreakerMemoryEntry(key, now, cfg, true)
+		prev := e.state
+		e.record(now.UnixMilli(), failed, slow, cfg)
+		state = e.state
+		if prev == state {
+			state = -1
+		}
+		channelBreakerMemory.Unlock()
+	}
+	switch state {
+	case ChannelBreakerStateOpen:
+		common.SysLog(fmt.Sprintf("渠道熔断器已打开：渠道 #%d，模型 %s", channelId, modelName))
+	case ChannelBreakerStateClosed:
+		common.SysLog(fmt.Sprintf("渠道熔断器已恢复：渠道 #%d，模型 %s", channelId, modelName))
+	}
+}
+
+// GetChannelBreakerStatuses 返回渠道下各模型的熔断器状态
+func GetChannelBreakerStatuses(channel *Channel) ([]ChannelBreakerStatus, error) {
+	cfg, _ := getChannelBreakerConfig()
+	now := time.Now()
+	models := channel.GetModels()
+	statuses := make([]ChannelBreakerStatus, 0, len(models))
+	for _, modelName := range models {
+		key := channelBreakerKey(channel.Id, modelName)
+		var e *channelBreakerEntry
+		if channelBreakerUseRedis() {
+			fields, err := common.RDB.HGetAll(context.Background(), key).Result()
+			if err != nil {
+				return nil, err
+			}
+			e = parseChannelBreakerEntry(fields)
+		} else {
+			channelBreakerMemory.Lock()
+			if existing, ok := channelBreakerMemory.entries[key]; ok && now.Before(existing.expireAt) {
+				copied := *existing
+				e = &copied
+			}
+			channelBreakerMemory.Unlock()
+			if e == nil {
+				e = parseChannelBreakerEntry(nil)
+			}
+		}
+		statuses = append(statuses, e.toStatus(channel.Id, modelName, now.UnixMilli(), cfg))
+	}
+	return statuses, nil
+}
+
+// ResetChannelBreaker 重置渠道的熔断器，modelName 为空时重置该渠道下所有模型
+func ResetChannelBreaker(channel *Channel, modelName string) error {
+	models := []string{modelName}
+	if modelName == "" {
+		models = channel.GetModels()
+	}
+	keys := make([]string, 0, len(models))
+	for _, m := range models {
+		keys = append(keys, channelBreakerKey(channel.Id, m))
+	}
+	if channelBreakerUseRedis() {
+		if len(keys) == 0 {
+			return nil
+		}
+		return common.RDB.Del(context.Background(), keys...).Err()
+	}
+	channelBreakerMemory.Lock()
+	defer channelBreakerMemory.Unlock()
+	for _, key := range keys {
+		delete(channelBreakerMemory.entries, key)
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
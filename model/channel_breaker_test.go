@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func enableChannelBreakerForTest(t *testing.T) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.WindowSeconds = 60
+	setting.MinRequests = 4
+	setting.FailureRateThreshold = 0.5
+	setting.OpenSeconds = 30
+	setting.HalfOpenProbes = 2
+	t.Cleanup(func() { *setting = saved })
+}
+
+func TestChannelBreakerEntry_OpenHalfOpenClose(t *testing.T) {
+	enableChannelBreakerForTest(t)
+	cfg, ok := getChannelBreakerConfig()
+	require.True(t, ok)
+
+	e := &channelBreakerEntry{}
+	e.reset()
+	now := time.Now().UnixMilli()
+
+	e.record(now, false, false, cfg)
+	e.record(now, true, false, cfg)
+	e.record(now, false, false, cfg)
+	require.Equal(t, ChannelBreakerStateClosed, e.state)
+	e.record(now, true, false, cfg)
+	require.Equal(t, ChannelBreakerStateOpen, e.state)
+	require.False(t, e.allow(now+1000, cfg))
+
+	// 熔断时间结束后进入半开状态，只放行 HalfOpenProbes 个探测请求
+	probeAt := now + cfg.openMs
+	require.True(t, e.allow(probeAt, cfg))
+	require.Equal(t, ChannelBreakerStateHalfOpen, e.state)
+	require.True(t, e.allow(probeAt, cfg))
+	require.False(t, e.allow(probeAt, cfg))
+
+	e.record(probeAt, false, false, cfg)
+	require.Equal(t, ChannelBreakerStateHalfOpen, e.state)
+	e.record(probeAt, false, false, cfg)
+	require.Equal(t, ChannelBreakerStateClosed, e.state)
+	require.True(t, e.allow(probeAt, cfg))
+}
+
+func TestChannelBreakerEntry_ProbeFailureReopens(t *testing.T) {
+	enableChannelBreakerForTest(t)
+	cfg, _ := getChannelBreakerConfig()
+
+	e := &channelBreakerEntry{}
+	e.reset()
+	now := time.Now().UnixMilli()
+	for i := 0; i < 4; i++ {
+		e.record(now, true, false, cfg)
+	}
+	require.Equal(t, ChannelBreakerStateOpen, e.state)
+
+	probeAt := now + cfg.openMs
+	require.True(t, e.allow(probeAt, cfg))
+	e.record(probeAt, true, false, cfg)
+	require.Equal(t, ChannelBreakerStateOpen, e.state)
+	require.False(t, e.allow(probeAt+1, cfg))
+}
+
+func TestChannelBreakerAllow_MemoryStore(t *testing.T) {
+	enableChannelBreakerForTest(t)
+
+	channel := &Channel{Id: 990001, Models: "gpt-breaker"}
+	for i := 0; i < 4; i++ {
+		RecordChannelBreakerResult(channel.Id, "gpt-breaker", true, 0)
+	}
+	require.False(t, channelBreakerAllow(channel.Id, "gpt-breaker"))
+	require.True(t, channelBreakerAllow(channel.Id, "other-model"))
+
+	statuses, err := GetChannelBreakerStatuses(channel)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Equal(t, "open", statuses[0].State)
+
+	require.NoError(t, ResetChannelBreaker(channel, ""))
+	require.True(t, channelBreakerAllow(channel.Id, "gpt-breaker"))
+}
@@ -18,10 +18,16 @@ var group2model2channels map[string]map[string][]int // enabled channel
 var channelsIDM map[int]*Channel                     // all channels include disabled
 var channelSyncLock sync.RWMutex
 
+// InitChannelCache 从数据库重新加载渠道缓存，并通知其他节点重新加载
 func InitChannelCache() {
 	if !common.MemoryCacheEnabled {
 		return
 	}
+	loadChannelCache()
+	publishCacheEvent(CacheEventChannels, "")
+}
+
+func loadChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
 	DB.Find(&channels)
@@ -69,7 +75,7 @@ func InitChannelCache() {
 	//channelsIDM = newChannelId2channel
 	for i, channel := range newChannelId2channel {
 		if channel.ChannelInfo.IsMultiKey {
-			channel.Keys = channel.GetKeys()
+			channel.cacheKeys()
 			if channel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling {
 				if oldChannel, ok := channelsIDM[i]; ok {
 					// 存在旧的渠道，如果是多key且轮询，保留轮询索引信息
@@ -89,7 +95,7 @@ func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing channels from database")
-		InitChannelCache()
+		loadChannelCache()
 	}
 }
 
@@ -111,12 +117,19 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
+	channels = filterScheduledChannels(channels)
 	if len(channels) == 0 {
 		return nil, nil
 	}
 
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
+			if !channelBreakerAllow(channel.Id, model) {
+				return nil, fmt.Errorf("渠道 #%d 在模型 %s 上已熔断", channel.Id, model)
+			}
+			if !channel.hasAvailableMultiKey() {
+				return nil, fmt.Errorf("渠道 #%d 的 Key 均在冷却中或已达每日上限", channel.Id)
+			}
 			return channel, nil
 		}
 		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
@@ -125,7 +138,7 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	uniquePriorities := make(map[int]bool)
 	for _, channelId := range channels {
 		if channel, ok := channelsIDM[channelId]; ok {
-			uniquePriorities[int(channel.GetPriority())] = true
+			uniquePriorities[int(channel.GetSelectionPriority())] = true
 		} else {
 			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
 		}
@@ -139,24 +152,55 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if retry >= len(uniquePriorities) {
 		retry = len(uniquePriorities) - 1
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
 
-	// get the priority for the given retry number
-	var sumWeight = 0
-	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
-				targetChannels = append(targetChannels, channel)
+	// 目标优先级的渠道全部熔断时，依次尝试更低的优先级
+	for _, priority := range sortedUniquePriorities[retry:] {
+		targetPriority := int64(priority)
+
+		// get the priority for the given retry number
+		var targetChannels []*Channel
+		for _, channelId := range channels {
+			if channel, ok := channelsIDM[channelId]; ok {
+				if channel.GetSelectionPriority() == targetPriority {
+					targetChannels = append(targetChannels, channel)
+				}
+			} else {
+				return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
 			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+		}
+
+		if len(targetChannels) == 0 {
+			return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+		}
+
+		for len(targetChannels) > 0 {
+			channel := pickChannel(targetChannels, group, model)
+			if channel == nil {
+				// return null if no channel is not found
+				return nil, errors.New("channel not found")
+			}
+			if channelBreakerAllow(channel.Id, model) && channel.hasAvailableMultiKey() {
+				return channel, nil
+			}
+			targetChannels = removeChannelFromList(targetChannels, channel.Id)
 		}
 	}
+	return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断或 Key 均不可用", group, model)
+}
 
-	if len(targetChannels) == 0 {
-		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+// pickChannel 按分组 / 标签配置的选择策略从同一优先级的渠道中选择一个
+func pickChannel(targetChannels []*Channel, group string, model string) *Channel {
+	if weights, ok := adaptiveChannelWeights(targetChannels, group, model); ok {
+		return pickAdaptiveChannel(targetChannels, weights)
+	}
+	return pickWeightedChannel(targetChannels)
+}
+
+// pickWeightedChannel 按权重随机选择一个渠道
+func pickWeightedChannel(targetChannels []*Channel) *Channel {
+	sumWeight := 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetSelectionWeight()
 	}
 
 	// smoothing factor and adjustment
@@ -181,13 +225,22 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 
 	// Find a channel based on its weight
 	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
+		randomWeight -= channel.GetSelectionWeight()*smoothingFactor + smoothingAdjustment
 		if randomWeight < 0 {
-			return channel, nil
+			return channel
+		}
+	}
+	return nil
+}
+
+func removeChannelFromList(channels []*Channel, channelId int) []*Channel {
+	result := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Id != channelId {
+			result = append(result, channel)
 		}
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return result
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
@@ -232,21 +285,36 @@ func CacheUpdateChannelStatus(id int, status int) {
 		channel.Status = status
 	}
 	if status != common.ChannelStatusEnabled {
-		// delete the channel from group2model2channels
-		for group, model2channels := range group2model2channels {
-			for model, channels := range model2channels {
-				for i, channelId := range channels {
-					if channelId == id {
-						// remove the channel from the slice
-						group2model2channels[group][model] = append(channels[:i], channels[i+1:]...)
-						break
-					}
+		removeChannelFromGroupsLocked(id)
+	}
+}
+
+// removeChannelFromGroupsLocked 将渠道从 group2model2channels 中移除，调用方需持有 channelSyncLock
+func removeChannelFromGroupsLocked(id int) {
+	for group, model2channels := range group2model2channels {
+		for model, channels := range model2channels {
+			for i, channelId := range channels {
+				if channelId == id {
+					// remove the channel from the slice
+					group2model2channels[group][model] = append(channels[:i], channels[i+1:]...)
+					break
 				}
 			}
 		}
 	}
 }
 
+func CacheUpdateChannelCaptureUntil(id int, until int64) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	if channel, ok := channelsIDM[id]; ok {
+		channel.CaptureUntil = until
+	}
+}
+
 func CacheUpdateChannel(channel *Channel) {
 	if !common.MemoryCacheEnabled {
 		return
@@ -0,0 +1,372 @@
+package model
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 渠道健康统计：按 渠道 + 模型 + Key 序号 记录每次上游尝试的结果、错误类别、首字耗时与总耗时，
+// 以固定时长的时间桶保存在进程内，供管理端查询渠道的滚动成功率与延迟分位数。
+// 统计只覆盖本节点处理的请求，多节点部署时各节点分别统计。
+
+const (
+	ChannelHealthErrorRateLimit   = "rate_limit"
+	ChannelHealthErrorAuth        = "auth"
+	ChannelHealthErrorTimeout     = "timeout"
+	ChannelHealthErrorNetwork     = "network"
+	ChannelHealthErrorServer      = "server_error"
+	ChannelHealthErrorChannel     = "channel_error"
+	ChannelHealthErrorClient      = "client_error"
+	ChannelHealthErrorOther       = "other"
+	ChannelHealthNoKeyIndex       = -1
+	channelHealthHistogramBuckets = 16
+)
+
+// channelHealthLatencyBoundsMs 延迟直方图的桶上界（毫秒），最后一个桶为 +Inf
+var channelHealthLatencyBoundsMs = [channelHealthHistogramBuckets - 1]int64{
+	100, 250, 500, 750, 1000, 1500, 2000, 3000, 5000, 8000, 13000, 20000, 30000, 60000, 120000,
+}
+
+// ChannelHealthSample 一次上游尝试的结果，ErrorClass 为空表示成功，KeyIndex 为 -1 表示非多 Key 渠道
+type ChannelHealthSample struct {
+	ChannelId  int
+	Model      string
+	KeyIndex   int
+	ErrorClass string
+	Latency    time.Duration
+	TTFT       time.Duration
+}
+
+type channelHealthHistogram [channelHealthHistogramBuckets]int64
+
+func (h *channelHealthHistogram) observe(d time.Duration) {
+	ms := d.Milliseconds()
+	i := sort.Search(len(channelHealthLatencyBoundsMs), func(i int) bool {
+		return ms <= channelHealthLatencyBoundsMs[i]
+	})
+	h[i]++
+}
+
+func (h *channelHealthHistogram) add(other *channelHealthHistogram) {
+	for i := range h {
+		h[i] += other[i]
+	}
+}
+
+// quantile 按桶内线性插值估算分位数，落在 +Inf 桶时返回最后一个桶上界
+func (h *channelHealthHistogram) quantile(q float64) int64 {
+	total := int64(0)
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	seen := int64(0)
+	for i, n := range h {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(channelHealthLatencyBoundsMs) {
+			return channelHealthLatencyBoundsMs[i-1]
+		}
+		lower := int64(0)
+		if i > 0 {
+			lower = channelHealthLatencyBoundsMs[i-1]
+		}
+		upper := channelHealthLatencyBoundsMs[i]
+		return lower + int64(float64(upper-lower)*(rank-float64(seen))/float64(n))
+	}
+	return channelHealthLatencyBoundsMs[len(channelHealthLatencyBoundsMs)-1]
+}
+
+type channelHealthBucket struct {
+	requests  int64
+	successes int64
+	errors    map[string]int64
+	latency   channelHealthHistogram
+	ttft      channelHealthHistogram
+}
+
+func (b *channelHealthBucket) add(other *channelHealthBucket) {
+	b.requests += other.requests
+	b.successes += other.successes
+	for class, n := range other.errors {
+		if b.errors == nil {
+			b.errors = make(map[string]int64)
+		}
+		b.errors[class] += n
+	}
+	b.latency.add(&other.latency)
+	b.ttft.add(&other.ttft)
+}
+
+type channelHealthSeriesKey struct {
+	channelId int
+	model     string
+	keyIndex  int
+}
+
+// channelHealthSeries 时间桶起始时间（Unix 秒）-> 时间桶
+type channelHealthSeries map[int64]*channelHealthBucket
+
+var channelHealthStore = struct {
+	sync.Mutex
+	series map[channelHealthSeriesKey]channelHealthSeries
+}{series: make(map[channelHealthSeriesKey]channelHealthSeries)}
+
+type channelHealthConfig struct {
+	bucketSeconds int64
+	retention     time.Duration
+}
+
+func getChannelHealthConfig() (channelHealthConfig, bool) {
+	setting := operation_setting.GetChannelHealthSetting()
+	bucketSeconds := setting.BucketSeconds
+	if bucketSeconds <= 0 {
+		bucketSeconds = 300
+	}
+	retentionHours := setting.RetentionHours
+	if retentionHours <= 0 {
+		retentionHours = 24
+	}
+	return channelHealthConfig{
+		bucketSeconds: int64(bucketSeconds),
+		retention:     time.Duration(retentionHours) * time.Hour,
+	}, setting.Enabled
+}
+
+// RecordChannelHealthSample 记录一次上游尝试
+func RecordChannelHealthSample(sample ChannelHealthSample) {
+	recordChannelHealthSampleAt(sample, time.Now())
+}
+
+func recordChannelHealthSampleAt(sample ChannelHealthSample, now time.Time) {
+	cfg, ok := getChannelHealthConfig()
+	if !ok || sample.ChannelId <= 0 {
+		return
+	}
+	key := channelHealthSeriesKey{channelId: sample.ChannelId, model: sample.Model, keyIndex: sample.KeyIndex}
+	start := now.Unix() - now.Unix()%cfg.bucketSeconds
+
+	channelHealthStore.Lock()
+	defer channelHealthStore.Unlock()
+	series, ok := channelHealthStore.series[key]
+	if !ok {
+		series = make(channelHealthSeries)
+		channelHealthStore.series[key] = series
+	}
+	bucket, ok := series[start]
+	if !ok {
+		bucket = &channelHealthBucket{}
+		series[start] = bucket
+		// 新建时间桶时顺带清理该序列中过期的时间桶
+		expireBefore := now.Add(-cfg.retention).Unix()
+		for bucketStart := range series {
+			if bucketStart < expireBefore {
+				delete(series, bucketStart)
+			}
+		}
+	}
+	bucket.requests++
+	if sample.ErrorClass == "" {
+		bucket.successes++
+	} else {
+		if bucket.errors == nil {
+			bucket.errors = make(map[string]int64)
+		}
+		bucket.errors[sample.ErrorClass]++
+	}
+	// 失败请求的耗时不代表上游正常响应速度，只统计成功请求的延迟
+	if sample.ErrorClass == "" {
+		bucket.latency.observe(sample.Latency)
+		if sample.TTFT > 0 {
+			bucket.ttft.observe(sample.TTFT)
+		}
+	}
+}
+
+type ChannelHealthPercentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+// ChannelHealthStats 窗口内的汇总统计。成功率不计入客户端错误，没有可统计的请求时为 1
+type ChannelHealthStats struct {
+	Requests    int64                    `json:"requests"`
+	Successes   int64                    `json:"successes"`
+	SuccessRate float64                  `json:"success_rate"`
+	Errors      map[string]int64         `json:"errors"`
+	LatencyMs   ChannelHealthPercentiles `json:"latency_ms"`
+	TTFTMs      ChannelHealthPercentiles `json:"ttft_ms"`
+}
+
+func (b *channelHealthBucket) toStats() ChannelHealthStats {
+	stats := ChannelHealthStats{
+		Requests:    b.requests,
+		Successes:   b.successes,
+		SuccessRate: 1,
+		Errors:      make(map[string]int64, len(b.errors)),
+		LatencyMs: ChannelHealthPercentiles{
+			P50: b.latency.quantile(0.5),
+			P90: b.latency.quantile(0.9),
+			P99: b.latency.quantile(0.99),
+		},
+		TTFTMs: ChannelHealthPercentiles{
+			P50: b.ttft.quantile(0.5),
+			P90: b.ttft.quantile(0.9),
+			P99: b.ttft.quantile(0.99),
+		},
+	}
+	for class, n := range b.errors {
+		stats.Errors[class] = n
+	}
+	if countable := b.requests - b.errors[ChannelHealthErrorClient]; countable > 0 {
+		stats.SuccessRate = float64(b.successes) / float64(countable)
+	}
+	return stats
+}
+
+type ChannelModelHealth struct {
+	Model string `json:"model"`
+	ChannelHealthStats
+}
+
+type ChannelKeyHealth struct {
+	KeyIndex int `json:"key_index"`
+	ChannelHealthStats
+}
+
+type ChannelHealthPoint struct {
+	Time int64 `json:"time"`
+	ChannelHealthStats
+}
+
+// ChannelHealthReport 单个渠道在窗口内的健康统计，Keys 只包含多 Key 渠道中有请求的 Key
+type ChannelHealthReport struct {
+	Summary  ChannelHealthStats   `json:"summary"`
+	Models   []ChannelModelHealth `json:"models"`
+	Keys     []ChannelKeyHealth   `json:"keys"`
+	Timeline []ChannelHealthPoint `json:"timeline"`
+}
+
+// NormalizeChannelHealthWindow 将查询窗口限制在 [一个时间桶, 保留时长] 内
+func NormalizeChannelHealthWindow(window time.Duration) time.Duration {
+	cfg, _ := getChannelHealthConfig()
+	bucket := time.Duration(cfg.bucketSeconds) * time.Second
+	if window < bucket {
+		return bucket
+	}
+	if window > cfg.retention {
+		return cfg.retention
+	}
+	return window
+}
+
+// windowStart 窗口起始时间桶，当前时间桶计入窗口
+func (cfg channelHealthConfig) windowStart(now time.Time, window time.Duration) int64 {
+	return now.Add(-window).Unix() - now.Add(-window).Unix()%cfg.bucketSeconds + cfg.bucketSeconds
+}
+
+// GetChannelHealth 返回渠道在窗口内的健康统计，modelName 不为空时只统计该模型
+func GetChannelHealth(channelId int, window time.Duration, modelName string) ChannelHealthReport {
+	return getChannelHealthAt(channelId, window, modelName, time.Now())
+}
+
+func getChannelHealthAt(channelId int, window time.Duration, modelName string, now time.Time) ChannelHealthReport {
+	cfg, _ := getChannelHealthConfig()
+	from := cfg.windowStart(now, window)
+	summary := &channelHealthBucket{}
+	models := make(map[string]*channelHealthBucket)
+	keys := make(map[int]*channelHealthBucket)
+	timeline := make(map[int64]*channelHealthBucket)
+
+	channelHealthStore.Lock()
+	for key, series := range channelHealthStore.series {
+		if key.channelId != channelId || (modelName != "" && key.model != modelName) {
+			continue
+		}
+		for start, bucket := range series {
+			if start < from {
+				continue
+			}
+			summary.add(bucket)
+			addChannelHealthBucket(models, key.model, bucket)
+			if key.keyIndex != ChannelHealthNoKeyIndex {
+				addChannelHealthBucket(keys, key.keyIndex, bucket)
+			}
+			addChannelHealthBucket(timeline, start, bucket)
+		}
+	}
+	channelHealthStore.Unlock()
+
+	report := ChannelHealthReport{
+		Summary:  summary.toStats(),
+		Models:   make([]ChannelModelHealth, 0, len(models)),
+		Keys:     make([]ChannelKeyHealth, 0, len(keys)),
+		Timeline: make([]ChannelHealthPoint, 0, len(timeline)),
+	}
+	for m, bucket := range models {
+		report.Models = append(report.Models, ChannelModelHealth{Model: m, ChannelHealthStats: bucket.toStats()})
+	}
+	sort.Slice(report.Models, func(i, j int) bool { return report.Models[i].Model < report.Models[j].Model })
+	for idx, bucket := range keys {
+		report.Keys = append(report.Keys, ChannelKeyHealth{KeyIndex: idx, ChannelHealthStats: bucket.toStats()})
+	}
+	sort.Slice(report.Keys, func(i, j int) bool { return report.Keys[i].KeyIndex < report.Keys[j].KeyIndex })
+	for start, bucket := range timeline {
+		report.Timeline = append(report.Timeline, ChannelHealthPoint{Time: start, ChannelHealthStats: bucket.toStats()})
+	}
+	sort.Slice(report.Timeline, func(i, j int) bool { return report.Timeline[i].Time < report.Timeline[j].Time })
+	return report
+}
+
+// GetChannelHealthSummaries 返回窗口内有请求的所有渠道的汇总统计，同时清理已过期的序列
+func GetChannelHealthSummaries(window time.Duration) map[int]ChannelHealthStats {
+	return getChannelHealthSummariesAt(window, time.Now())
+}
+
+func getChannelHealthSummariesAt(window time.Duration, now time.Time) map[int]ChannelHealthStats {
+	cfg, _ := getChannelHealthConfig()
+	from := cfg.windowStart(now, window)
+	expireBefore := now.Add(-cfg.retention).Unix()
+	channels := make(map[int]*channelHealthBucket)
+
+	channelHealthStore.Lock()
+	for key, series := range channelHealthStore.series {
+		for start, bucket := range series {
+			if start < expireBefore {
+				delete(series, start)
+				continue
+			}
+			if start >= from {
+				addChannelHealthBucket(channels, key.channelId, bucket)
+			}
+		}
+		if len(series) == 0 {
+			delete(channelHealthStore.series, key)
+		}
+	}
+	channelHealthStore.Unlock()
+
+	summaries := make(map[int]ChannelHealthStats, len(channels))
+	for channelId, bucket := range channels {
+		summaries[channelId] = bucket.toStats()
+	}
+	return summaries
+}
+
+func addChannelHealthBucket[K comparable](m map[K]*channelHealthBucket, key K, bucket *channelHealthBucket) {
+	agg, ok := m[key]
+	if !ok {
+		agg = &channelHealthBucket{}
+		m[key] = agg
+	}
+	agg.add(bucket)
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelHealthHistogramQuantile(t *testing.T) {
+	var h channelHealthHistogram
+	require.Zero(t, h.quantile(0.5))
+	for i := 0; i < 90; i++ {
+		h.observe(80 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(4 * time.Second)
+	}
+	require.LessOrEqual(t, h.quantile(0.5), int64(100))
+	require.Greater(t, h.quantile(0.99), int64(3000))
+	require.LessOrEqual(t, h.quantile(0.99), int64(5000))
+
+	h.observe(10 * time.Minute)
+	require.Equal(t, int64(120000), h.quantile(1))
+}
+
+func TestChannelHealthWindow(t *testing.T) {
+	setting := operation_setting.GetChannelHealthSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.BucketSeconds = 60
+	setting.RetentionHours = 1
+	t.Cleanup(func() { *setting = saved })
+
+	const channelId = 987654
+	now := time.Unix(1_700_000_000, 0)
+	old := now.Add(-30 * time.Minute)
+	recordChannelHealthSampleAt(ChannelHealthSample{ChannelId: channelId, Model: "gpt-4o", KeyIndex: 0, Latency: time.Second}, old)
+	recordChannelHealthSampleAt(ChannelHealthSample{ChannelId: channelId, Model: "gpt-4o", KeyIndex: 1, ErrorClass: ChannelHealthErrorRateLimit}, now)
+	recordChannelHealthSampleAt(ChannelHealthSample{ChannelId: channelId, Model: "gpt-4o", KeyIndex: 1, ErrorClass: ChannelHealthErrorClient}, now)
+	recordChannelHealthSampleAt(ChannelHealthSample{ChannelId: channelId, Model: "o3", KeyIndex: 0, Latency: 200 * time.Millisecond, TTFT: 50 * time.Millisecond}, now)
+
+	report := getChannelHealthAt(channelId, time.Hour, "", now)
+	require.Equal(t, int64(4), report.Summary.Requests)
+	// 客户端错误不计入成功率
+	require.InDelta(t, 2.0/3.0, report.Summary.SuccessRate, 1e-9)
+	require.Equal(t, int64(1), report.Summary.Errors[ChannelHealthErrorRateLimit])
+	require.Len(t, report.Models, 2)
+	require.Len(t, report.Keys, 2)
+	require.Len(t, report.Timeline, 2)
+	require.Positive(t, report.Summary.TTFTMs.P50)
+
+	recent := getChannelHealthAt(channelId, 10*time.Minute, "gpt-4o", now)
+	require.Equal(t, int64(2), recent.Summary.Requests)
+	require.Zero(t, recent.Summary.Successes)
+
+	summaries := getChannelHealthSummariesAt(time.Hour, now.Add(45*time.Minute))
+	require.Equal(t, int64(3), summaries[channelId].Requests)
+	summaries = getChannelHealthSummariesAt(time.Hour, now.Add(2*time.Hour))
+	require.NotContains(t, summaries, channelId)
+}
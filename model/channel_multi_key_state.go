@@ -0,0 +1,333 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// 多 Key 渠道中各 Key 的运行状态：最近一次被选中的时间、限流冷却截止时间以及当日请求数与消耗额度。
+// Key 冷却中或达到每日上限时只是暂不参与选择，冷却结束或次日后自动恢复，不会修改 Key 的启用状态。
+// 启用 Redis 时状态保存在 Redis 中供多个节点共享，否则保存在进程内。
+
+const (
+	multiKeyStateKeyPrefix = "multiKeyState"
+	multiKeyUsageKeyPrefix = "multiKeyUsage"
+	multiKeyStateTTL       = 48 * time.Hour
+)
+
+// MultiKeyState 多 Key 渠道中单个 Key 的运行状态，时间均为毫秒时间戳
+type MultiKeyState struct {
+	LastUsed       int64  `json:"last_used,omitempty"`
+	CooldownUntil  int64  `json:"cooldown_until,omitempty"`
+	CooldownReason string `json:"cooldown_reason,omitempty"`
+	DailyRequests  int64  `json:"daily_requests"`
+	DailyQuota     int64  `json:"daily_quota"`
+}
+
+func (s MultiKeyState) CoolingDown(now time.Time) bool {
+	return s.CooldownUntil > now.UnixMilli()
+}
+
+type multiKeyLimits struct {
+	dailyRequests int64
+	dailyQuota    int64
+}
+
+// exceeded 判断 Key 是否处于冷却中或已达到每日上限
+func (l multiKeyLimits) exceeded(state MultiKeyState, now time.Time) bool {
+	if state.CoolingDown(now) {
+		return true
+	}
+	if l.dailyRequests > 0 && state.DailyRequests >= l.dailyRequests {
+		return true
+	}
+	return l.dailyQuota > 0 && state.DailyQuota >= l.dailyQuota
+}
+
+func (channel *Channel) getMultiKeyLimits() multiKeyLimits {
+	settings := channel.GetOtherSettings()
+	return multiKeyLimits{
+		dailyRequests: int64(settings.MultiKeyDailyRequestLimit),
+		dailyQuota:    int64(settings.MultiKeyDailyQuotaLimit),
+	}
+}
+
+// multiKeyStateTracked 只有最久未使用、限流感知模式或配置了每日上限时才需要记录 Key 状态
+func (channel *Channel) multiKeyStateTracked(limits multiKeyLimits) bool {
+	switch channel.ChannelInfo.MultiKeyMode {
+	case constant.MultiKeyModeLeastUsed, constant.MultiKeyModeRateLimit:
+		return true
+	}
+	return limits.dailyRequests > 0 || limits.dailyQuota > 0
+}
+
+// hasAvailableMultiKey 判断多 Key 渠道是否还有未冷却且未达每日上限的启用 Key，
+// 渠道选择时跳过 Key 全部暂不可用的渠道
+func (channel *Channel) hasAvailableMultiKey() bool {
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	limits := channel.getMultiKeyLimits()
+	if !channel.multiKeyStateTracked(limits) {
+		return true
+	}
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	enabledIdx := make([]int, 0, channel.ChannelInfo.MultiKeySize)
+	for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; !ok || status == common.ChannelStatusEnabled {
+			enabledIdx = append(enabledIdx, i)
+		}
+	}
+	lock.Unlock()
+	// 没有启用的 Key 时交给原有的禁用逻辑处理
+	if len(enabledIdx) == 0 {
+		return true
+	}
+	now := time.Now()
+	states := getMultiKeyStates(channel.Id, now)
+	for _, idx := range enabledIdx {
+		if !limits.exceeded(states[idx], now) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickLeastUsedKey 选择最久未被使用的 Key，从未使用过的 Key 优先
+func pickLeastUsedKey(candidates []int, states map[int]MultiKeyState) int {
+	selected := candidates[0]
+	for _, idx := range candidates[1:] {
+		if states[idx].LastUsed < states[selected].LastUsed {
+			selected = idx
+		}
+	}
+	return selected
+}
+
+func multiKeyDay(now time.Time) string {
+	return now.Format("20060102")
+}
+
+type multiKeyMemoryEntry struct {
+	MultiKeyState
+	day string
+}
+
+var (
+	multiKeyStateLock sync.Mutex
+	multiKeyStates    = make(map[int]map[int]*multiKeyMemoryEntry)
+)
+
+func multiKeyStateUseRedis() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+func multiKeyStateRedisKey(channelId int) string {
+	return fmt.Sprintf("%s:%d", multiKeyStateKeyPrefix, channelId)
+}
+
+func multiKeyUsageRedisKey(channelId int, day string) string {
+	return fmt.Sprintf("%s:%d:%s", multiKeyUsageKeyPrefix, channelId, day)
+}
+
+// multiKeyMemoryEntryOf 获取进程内的 Key 状态，跨天时清零当日计数，调用方需持有 multiKeyStateLock
+func multiKeyMemoryEntryOf(channelId int, keyIndex int, day string) *multiKeyMemoryEntry {
+	entries := multiKeyStates[channelId]
+	if entries == nil {
+		entries = make(map[int]*multiKeyMemoryEntry)
+		multiKeyStates[channelId] = entries
+	}
+	entry := entries[keyIndex]
+	if entry == nil {
+		entry = &multiKeyMemoryEntry{day: day}
+		entries[keyIndex] = entry
+	}
+	if entry.day != day {
+		entry.day = day
+		entry.DailyRequests = 0
+		entry.DailyQuota = 0
+	}
+	return entry
+}
+
+// GetMultiKeyStates 获取渠道各 Key 的运行状态，没有记录的 Key 不在结果中
+func GetMultiKeyStates(channelId int) map[int]MultiKeyState {
+	return getMultiKeyStates(channelId, time.Now())
+}
+
+func getMultiKeyStates(channelId int, now time.Time) map[int]MultiKeyState {
+	day := multiKeyDay(now)
+	if multiKeyStateUseRedis() {
+		states, err := getMultiKeyStatesRedis(channelId, day)
+		if err != nil {
+			// 状态不可用时不限制 Key 的选择
+			common.SysError(fmt.Sprintf("get multi key states error: %s", err.Error()))
+			return nil
+		}
+		return states
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	states := make(map[int]MultiKeyState, len(multiKeyStates[channelId]))
+	for idx, entry := range multiKeyStates[channelId] {
+		state := entry.MultiKeyState
+		if entry.day != day {
+			state.DailyRequests = 0
+			state.DailyQuota = 0
+		}
+		states[idx] = state
+	}
+	return states
+}
+
+func getMultiKeyStatesRedis(channelId int, day string) (map[int]MultiKeyState, error) {
+	ctx := context.Background()
+	pipe := common.RDB.Pipeline()
+	stateCmd := pipe.HGetAll(ctx, multiKeyStateRedisKey(channelId))
+	usageCmd := pipe.HGetAll(ctx, multiKeyUsageRedisKey(channelId, day))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	states := make(map[int]MultiKeyState)
+	for _, fields := range []map[string]string{stateCmd.Val(), usageCmd.Val()} {
+		for field, value := range fields {
+			name, rawIdx, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			idx, err := strconv.Atoi(rawIdx)
+			if err != nil {
+				continue
+			}
+			state := states[idx]
+			switch name {
+			case "lu":
+				state.LastUsed, _ = strconv.ParseInt(value, 10, 64)
+			case "cd":
+				state.CooldownUntil, _ = strconv.ParseInt(value, 10, 64)
+			case "cr":
+				state.CooldownReason = value
+			case "rq":
+				state.DailyRequests, _ = strconv.ParseInt(value, 10, 64)
+			case "qt":
+				state.DailyQuota, _ = strconv.ParseInt(value, 10, 64)
+			}
+			states[idx] = state
+		}
+	}
+	return states, nil
+}
+
+// markMultiKeyUsed 记录 Key 被选中，更新最近使用时间并累加当日请求数
+func markMultiKeyUsed(channelId int, keyIndex int, now time.Time) {
+	day := multiKeyDay(now)
+	if multiKeyStateUseRedis() {
+		ctx := context.Background()
+		stateKey := multiKeyStateRedisKey(channelId)
+		usageKey := multiKeyUsageRedisKey(channelId, day)
+		pipe := common.RDB.Pipeline()
+		pipe.HSet(ctx, stateKey, fmt.Sprintf("lu:%d", keyIndex), now.UnixMilli())
+		pipe.Expire(ctx, stateKey, multiKeyStateTTL)
+		pipe.HIncrBy(ctx, usageKey, fmt.Sprintf("rq:%d", keyIndex), 1)
+		pipe.Expire(ctx, usageKey, multiKeyStateTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("mark multi key used error: %s", err.Error()))
+		}
+		return
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	entry := multiKeyMemoryEntryOf(channelId, keyIndex, day)
+	entry.LastUsed = now.UnixMilli()
+	entry.DailyRequests++
+}
+
+// RecordMultiKeyQuota 累加 Key 当日的消耗额度
+func RecordMultiKeyQuota(channelId int, keyIndex int, quota int) {
+	if quota <= 0 {
+		return
+	}
+	day := multiKeyDay(time.Now())
+	if multiKeyStateUseRedis() {
+		ctx := context.Background()
+		usageKey := multiKeyUsageRedisKey(channelId, day)
+		pipe := common.RDB.Pipeline()
+		pipe.HIncrBy(ctx, usageKey, fmt.Sprintf("qt:%d", keyIndex), int64(quota))
+		pipe.Expire(ctx, usageKey, multiKeyStateTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("record multi key quota error: %s", err.Error()))
+		}
+		return
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	multiKeyMemoryEntryOf(channelId, keyIndex, day).DailyQuota += int64(quota)
+}
+
+// SetMultiKeyCooldown 让 Key 冷却到 until，冷却期间不参与选择，到期后自动恢复
+func SetMultiKeyCooldown(channelId int, keyIndex int, until time.Time, reason string) {
+	if multiKeyStateUseRedis() {
+		ctx := context.Background()
+		stateKey := multiKeyStateRedisKey(channelId)
+		pipe := common.RDB.Pipeline()
+		pipe.HSet(ctx, stateKey, fmt.Sprintf("cd:%d", keyIndex), until.UnixMilli(), fmt.Sprintf("cr:%d", keyIndex), reason)
+		pipe.Expire(ctx, stateKey, multiKeyStateTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("set multi key cooldown error: %s", err.Error()))
+		}
+		return
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	entry := multiKeyMemoryEntryOf(channelId, keyIndex, multiKeyDay(time.Now()))
+	entry.CooldownUntil = until.UnixMilli()
+	entry.CooldownReason = reason
+}
+
+// ClearMultiKeyCooldown 立即结束指定 Key 的冷却，用于手动启用 Key
+func ClearMultiKeyCooldown(channelId int, keyIndexes ...int) {
+	if len(keyIndexes) == 0 {
+		return
+	}
+	if multiKeyStateUseRedis() {
+		fields := make([]string, 0, len(keyIndexes)*2)
+		for _, idx := range keyIndexes {
+			fields = append(fields, fmt.Sprintf("cd:%d", idx), fmt.Sprintf("cr:%d", idx))
+		}
+		if err := common.RDB.HDel(context.Background(), multiKeyStateRedisKey(channelId), fields...).Err(); err != nil {
+			common.SysError(fmt.Sprintf("clear multi key cooldown error: %s", err.Error()))
+		}
+		return
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	for _, idx := range keyIndexes {
+		if entry := multiKeyStates[channelId][idx]; entry != nil {
+			entry.CooldownUntil = 0
+			entry.CooldownReason = ""
+		}
+	}
+}
+
+// ResetMultiKeyStates 清除渠道所有 Key 的运行状态，删除 Key 导致索引变化时调用
+func ResetMultiKeyStates(channelId int) {
+	if multiKeyStateUseRedis() {
+		ctx := context.Background()
+		keys := []string{multiKeyStateRedisKey(channelId), multiKeyUsageRedisKey(channelId, multiKeyDay(time.Now()))}
+		if err := common.RDB.Del(ctx, keys...).Err(); err != nil {
+			common.SysError(fmt.Sprintf("reset multi key states error: %s", err.Error()))
+		}
+		return
+	}
+	multiKeyStateLock.Lock()
+	defer multiKeyStateLock.Unlock()
+	delete(multiKeyStates, channelId)
+}
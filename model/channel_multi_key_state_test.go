@@ -0,0 +1,84 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMultiKeyTestChannel(id int, mode constant.MultiKeyMode, settings string) *Channel {
+	return &Channel{
+		Id:            id,
+		Key:           "key-0\nkey-1\nkey-2",
+		OtherSettings: settings,
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:         true,
+			MultiKeySize:       3,
+			MultiKeyStatusList: map[int]int{2: common.ChannelStatusManuallyDisabled},
+			MultiKeyMode:       mode,
+		},
+	}
+}
+
+func TestGetNextEnabledKeyLeastUsed(t *testing.T) {
+	channel := newMultiKeyTestChannel(900001, constant.MultiKeyModeLeastUsed, "")
+	defer ResetMultiKeyStates(channel.Id)
+
+	// 禁用的 Key 不参与选择，其余 Key 按最久未使用轮流选中
+	var picked []int
+	for i := 0; i < 4; i++ {
+		_, idx, apiErr := channel.GetNextEnabledKey()
+		require.Nil(t, apiErr)
+		picked = append(picked, idx)
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.Equal(t, []int{0, 1, 0, 1}, picked)
+	require.Equal(t, int64(2), GetMultiKeyStates(channel.Id)[0].DailyRequests)
+}
+
+func TestGetNextEnabledKeyCooldownAndDailyLimit(t *testing.T) {
+	channel := newMultiKeyTestChannel(900002, constant.MultiKeyModeRateLimit, `{"multi_key_daily_request_limit": 2}`)
+	defer ResetMultiKeyStates(channel.Id)
+
+	SetMultiKeyCooldown(channel.Id, 0, time.Now().Add(time.Minute), "retry-after")
+	for i := 0; i < 2; i++ {
+		_, idx, apiErr := channel.GetNextEnabledKey()
+		require.Nil(t, apiErr)
+		require.Equal(t, 1, idx)
+	}
+	require.False(t, channel.hasAvailableMultiKey())
+	_, _, apiErr := channel.GetNextEnabledKey()
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeMultiKeyCoolingDown, apiErr.GetErrorCode())
+	require.False(t, types.IsChannelError(apiErr))
+
+	// 冷却结束后 Key 自动恢复
+	ClearMultiKeyCooldown(channel.Id, 0)
+	require.True(t, channel.hasAvailableMultiKey())
+	_, idx, apiErr := channel.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Equal(t, 0, idx)
+}
+
+func TestMultiKeyDailyQuotaLimit(t *testing.T) {
+	channel := newMultiKeyTestChannel(900003, constant.MultiKeyModeRandom, `{"multi_key_daily_quota_limit": 100}`)
+	defer ResetMultiKeyStates(channel.Id)
+
+	RecordMultiKeyQuota(channel.Id, 0, 100)
+	for i := 0; i < 5; i++ {
+		_, idx, apiErr := channel.GetNextEnabledKey()
+		require.Nil(t, apiErr)
+		require.Equal(t, 1, idx)
+	}
+
+	// 跨天后当日用量清零
+	multiKeyStateLock.Lock()
+	multiKeyStates[channel.Id][0].day = "20000101"
+	multiKeyStateLock.Unlock()
+	require.Zero(t, GetMultiKeyStates(channel.Id)[0].DailyQuota)
+}
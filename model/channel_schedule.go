@@ -0,0 +1,390 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 渠道排期：按时区内的星期 + 时间段，或 cron 表达式 + 持续时长 定义时间窗口，
+// 窗口内将渠道排除出选择、重新纳入选择，或临时覆盖优先级与权重。
+// 规则按顺序匹配，第一个命中的规则生效；没有规则命中时按 default 处理。
+
+const (
+	ChannelScheduleActionInclude  = "include"
+	ChannelScheduleActionExclude  = "exclude"
+	ChannelScheduleActionOverride = "override"
+
+	channelScheduleMaxDurationMinutes = 7 * 24 * 60
+)
+
+type ChannelScheduleRule struct {
+	Name string `json:"name,omitempty"`
+	// Weekdays 0-6，0 为周日，为空表示每天
+	Weekdays []int `json:"weekdays,omitempty"`
+	// Start / End 为 HH:MM，End 早于 Start 时跨越午夜，相等时表示全天
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Cron 为 5 段 cron 表达式（分 时 日 月 周），与 DurationMinutes 一起定义窗口，与 Weekdays / Start / End 互斥
+	Cron            string `json:"cron,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+	Action          string `json:"action"`
+	// Priority / Weight 仅 override 时生效，为空表示不覆盖
+	Priority *int64 `json:"priority,omitempty"`
+	Weight   *uint  `json:"weight,omitempty"`
+}
+
+type ChannelSchedule struct {
+	Timezone string `json:"timezone,omitempty"`
+	// Default 没有规则命中时的行为：include（默认）或 exclude
+	Default string                `json:"default,omitempty"`
+	Rules   []ChannelScheduleRule `json:"rules"`
+}
+
+// ChannelScheduleState 渠道在某一时刻的排期结果
+type ChannelScheduleState struct {
+	Excluded bool   `json:"excluded"`
+	Rule     string `json:"rule,omitempty"`
+	Priority *int64 `json:"priority,omitempty"`
+	Weight   *uint  `json:"weight,omitempty"`
+}
+
+type compiledChannelScheduleRule struct {
+	rule        ChannelScheduleRule
+	weekdays    [7]bool
+	startMinute int
+	endMinute   int
+	cron        *channelCron
+}
+
+type compiledChannelSchedule struct {
+	location *time.Location
+	exclude  bool
+	rules    []compiledChannelScheduleRule
+}
+
+// parseChannelSchedule 解析并校验排期配置，空字符串返回 nil
+func parseChannelSchedule(raw string) (*compiledChannelSchedule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var schedule ChannelSchedule
+	if err := common.UnmarshalJsonStr(raw, &schedule); err != nil {
+		return nil, err
+	}
+	compiled := &compiledChannelSchedule{location: time.Local}
+	if schedule.Timezone != "" {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", schedule.Timezone, err)
+		}
+		compiled.location = location
+	}
+	switch schedule.Default {
+	case "", ChannelScheduleActionInclude:
+	case ChannelScheduleActionExclude:
+		compiled.exclude = true
+	default:
+		return nil, fmt.Errorf("invalid default action %q", schedule.Default)
+	}
+	for i, rule := range schedule.Rules {
+		c, err := compileChannelScheduleRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		compiled.rules = append(compiled.rules, c)
+	}
+	return compiled, nil
+}
+
+func compileChannelScheduleRule(rule ChannelScheduleRule) (compiledChannelScheduleRule, error) {
+	c := compiledChannelScheduleRule{rule: rule}
+	switch rule.Action {
+	case ChannelScheduleActionInclude, ChannelScheduleActionExclude:
+	case ChannelScheduleActionOverride:
+		if rule.Priority == nil && rule.Weight == nil {
+			return c, errors.New("override requires priority or weight")
+		}
+	default:
+		return c, fmt.Errorf("invalid action %q", rule.Action)
+	}
+	if rule.Cron != "" {
+		if len(rule.Weekdays) > 0 || rule.Start != "" || rule.End != "" {
+			return c, errors.New("cron cannot be combined with weekdays, start or end")
+		}
+		if rule.DurationMinutes <= 0 || rule.DurationMinutes > channelScheduleMaxDurationMinutes {
+			return c, fmt.Errorf("duration_minutes must be between 1 and %d", channelScheduleMaxDurationMinutes)
+		}
+		cron, err := parseChannelCron(rule.Cron)
+		if err != nil {
+			return c, err
+		}
+		c.cron = cron
+		return c, nil
+	}
+	if len(rule.Weekdays) == 0 {
+		for i := range c.weekdays {
+			c.weekdays[i] = true
+		}
+	}
+	for _, day := range rule.Weekdays {
+		if day < 0 || day > 6 {
+			return c, fmt.Errorf("invalid weekday %d", day)
+		}
+		c.weekdays[day] = true
+	}
+	var err error
+	if c.startMinute, err = parseChannelScheduleClock(rule.Start); err != nil {
+		return c, err
+	}
+	if c.endMinute, err = parseChannelScheduleClock(rule.End); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// parseChannelScheduleClock 解析 HH:MM，为空时为 00:00
+func parseChannelScheduleClock(clock string) (int, error) {
+	if clock == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (r *compiledChannelScheduleRule) matches(now time.Time) bool {
+	if r.cron != nil {
+		// 窗口为 [cron 触发时刻, 触发时刻 + 持续时长)，向前查找最近的触发时刻
+		t := now.Truncate(time.Minute)
+		for i := 0; i < r.rule.DurationMinutes; i++ {
+			if r.cron.matches(t) {
+				return true
+			}
+			t = t.Add(-time.Minute)
+		}
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	weekday := int(now.Weekday())
+	switch {
+	case r.startMinute == r.endMinute:
+		return r.weekdays[weekday]
+	case r.startMinute < r.endMinute:
+		return r.weekdays[weekday] && minute >= r.startMinute && minute < r.endMinute
+	default:
+		// 跨越午夜的时间段属于开始的那一天
+		if minute >= r.startMinute {
+			return r.weekdays[weekday]
+		}
+		return minute < r.endMinute && r.weekdays[(weekday+6)%7]
+	}
+}
+
+func (s *compiledChannelSchedule) stateAt(now time.Time) ChannelScheduleState {
+	local := now.In(s.location)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !rule.matches(local) {
+			continue
+		}
+		state := ChannelScheduleState{Rule: rule.rule.Name}
+		switch rule.rule.Action {
+		case ChannelScheduleActionExclude:
+			state.Excluded = true
+		case ChannelScheduleActionOverride:
+			state.Priority = rule.rule.Priority
+			state.Weight = rule.rule.Weight
+		}
+		return state
+	}
+	return ChannelScheduleState{Excluded: s.exclude}
+}
+
+type channelScheduleCacheEntry struct {
+	raw      string
+	schedule *compiledChannelSchedule
+	minute   int64
+	state    ChannelScheduleState
+}
+
+// channelScheduleCache 渠道 ID -> 解析后的排期与当前分钟的结果，排期以分钟为粒度
+var channelScheduleCache sync.Map
+
+// GetScheduleState 返回渠道当前的排期结果，排期配置无效时视为没有排期
+func (channel *Channel) GetScheduleState() ChannelScheduleState {
+	return channel.scheduleStateAt(time.Now())
+}
+
+func (channel *Channel) scheduleStateAt(now time.Time) ChannelScheduleState {
+	if channel.Schedule == nil || *channel.Schedule == "" {
+		return ChannelScheduleState{}
+	}
+	raw := *channel.Schedule
+	minute := now.Unix() / 60
+	var entry *channelScheduleCacheEntry
+	if v, ok := channelScheduleCache.Load(channel.Id); ok {
+		entry = v.(*channelScheduleCacheEntry)
+		if entry.raw == raw && entry.minute == minute {
+			return entry.state
+		}
+	}
+	next := &channelScheduleCacheEntry{raw: raw, minute: minute}
+	if entry != nil && entry.raw == raw {
+		next.schedule = entry.schedule
+	} else {
+		schedule, err := parseChannelSchedule(raw)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid channel schedule: channel_id=%d, error=%v", channel.Id, err))
+		}
+		next.schedule = schedule
+	}
+	if next.schedule != nil {
+		next.state = next.schedule.stateAt(now)
+	}
+	channelScheduleCache.Store(channel.Id, next)
+	return next.state
+}
+
+// ValidateSchedule 校验渠道的排期配置
+func (channel *Channel) ValidateSchedule() error {
+	if channel.Schedule == nil {
+		return nil
+	}
+	_, err := parseChannelSchedule(*channel.Schedule)
+	return err
+}
+
+// GetSelectionPriority 返回渠道当前用于选择的优先级，排期规则可以临时覆盖
+func (channel *Channel) GetSelectionPriority() int64 {
+	if state := channel.GetScheduleState(); state.Priority != nil {
+		return *state.Priority
+	}
+	return channel.GetPriority()
+}
+
+// GetSelectionWeight 返回渠道当前用于选择的权重，排期规则可以临时覆盖
+func (channel *Channel) GetSelectionWeight() int {
+	if state := channel.GetScheduleState(); state.Weight != nil {
+		return int(*state.Weight)
+	}
+	return channel.GetWeight()
+}
+
+// filterScheduledChannels 去掉当前被排期排除的渠道，没有渠道被排除时返回原切片
+func filterScheduledChannels(channelIds []int) []int {
+	var filtered []int
+	for i, id := range channelIds {
+		channel, ok := channelsIDM[id]
+		excluded := ok && channel.GetScheduleState().Excluded
+		if excluded && filtered == nil {
+			filtered = make([]int, 0, len(channelIds))
+			filtered = append(filtered, channelIds[:i]...)
+		} else if !excluded && filtered != nil {
+			filtered = append(filtered, id)
+		}
+	}
+	if filtered == nil {
+		return channelIds
+	}
+	return filtered
+}
+
+// isChannelExcludedFromDB 未启用内存缓存时从数据库读取渠道排期与多 Key 信息，判断是否被排期排除或 Key 均不可用
+func isChannelExcludedFromDB(channelId int) bool {
+	channel := &Channel{Id: channelId}
+	if err := DB.Select("id", "schedule", "channel_info", "settings").First(channel).Error; err != nil {
+		return false
+	}
+	return channel.GetScheduleState().Excluded || !channel.hasAvailableMultiKey()
+}
+
+// channelCron 5 段 cron 表达式，每段为允许值的集合
+type channelCron struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+func parseChannelCron(expr string) (*channelCron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron %q: expected 5 fields", expr)
+	}
+	cron := &channelCron{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if cron.minute, err = parseChannelCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if cron.hour, err = parseChannelCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if cron.dom, err = parseChannelCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if cron.month, err = parseChannelCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if cron.dow, err = parseChannelCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 与 0 都表示周日
+	cron.dow[0] = cron.dow[0] || cron.dow[7]
+	return cron, nil
+}
+
+// parseChannelCronField 支持 *、a、a-b、*/n、a-b/n 以及逗号分隔的列表
+func parseChannelCronField(field string, min int, max int) ([]bool, error) {
+	allowed := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid cron step in %q", field)
+			}
+			step = n
+			part = part[:idx]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid cron value in %q", field)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid cron value in %q", field)
+				}
+			}
+			if lo < min || hi > max || lo > hi {
+				return nil, fmt.Errorf("cron value out of range in %q", field)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			allowed[v] = true
+		}
+	}
+	return allowed, nil
+}
+
+func (c *channelCron) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	// 与标准 cron 一致：日与周都有限制时满足其一即可
+	if !c.domAny && !c.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
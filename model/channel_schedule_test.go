@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelScheduleStateAt(t *testing.T) {
+	schedule, err := parseChannelSchedule(`{
+		"timezone": "Asia/Shanghai",
+		"rules": [
+			{"name": "maintenance", "cron": "30 2 * * 0", "duration_minutes": 90, "action": "exclude"},
+			{"name": "offpeak", "weekdays": [1, 2, 3, 4, 5], "start": "22:00", "end": "08:00", "action": "override", "priority": 10, "weight": 80}
+		]
+	}`)
+	require.NoError(t, err)
+	location, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(day int, hour int, minute int) time.Time {
+		// 2024-06-02 是周日
+		return time.Date(2024, 6, 2+day, hour, minute, 0, 0, location).UTC()
+	}
+
+	state := schedule.stateAt(at(0, 2, 29))
+	require.False(t, state.Excluded)
+	state = schedule.stateAt(at(0, 3, 59))
+	require.True(t, state.Excluded)
+	require.Equal(t, "maintenance", state.Rule)
+	require.False(t, schedule.stateAt(at(0, 4, 0)).Excluded)
+
+	// 周五 22:00 开始的时段持续到周六 08:00，周日 22:00 不在时段内
+	state = schedule.stateAt(at(6, 7, 59))
+	require.NotNil(t, state.Priority)
+	require.Equal(t, int64(10), *state.Priority)
+	require.Equal(t, uint(80), *state.Weight)
+	require.Nil(t, schedule.stateAt(at(6, 8, 0)).Priority)
+	require.Nil(t, schedule.stateAt(at(0, 23, 0)).Priority)
+	require.NotNil(t, schedule.stateAt(at(1, 23, 0)).Priority)
+
+	schedule, err = parseChannelSchedule(`{"timezone": "UTC", "default": "exclude", "rules": [{"start": "00:00", "end": "06:00", "action": "include"}]}`)
+	require.NoError(t, err)
+	require.False(t, schedule.stateAt(time.Date(2024, 6, 2, 5, 0, 0, 0, time.UTC)).Excluded)
+	require.True(t, schedule.stateAt(time.Date(2024, 6, 2, 6, 0, 0, 0, time.UTC)).Excluded)
+}
+
+func TestParseChannelScheduleInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"timezone": "Mars/Base", "rules": []}`,
+		`{"rules": [{"action": "pause"}]}`,
+		`{"rules": [{"action": "override"}]}`,
+		`{"rules": [{"start": "25:00", "action": "exclude"}]}`,
+		`{"rules": [{"cron": "0 3 * *", "duration_minutes": 60, "action": "exclude"}]}`,
+		`{"rules": [{"cron": "0 3 * * 0", "action": "exclude"}]}`,
+		`{"rules": [{"cron": "0 3 * * 0", "duration_minutes": 60, "weekdays": [1], "action": "exclude"}]}`,
+	} {
+		_, err := parseChannelSchedule(raw)
+		require.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,224 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 自适应渠道选择：以渠道静态权重为先验，按本节点观测到的实时信号调整有效权重
+//   - 延迟：首字时间（无首字数据时使用总耗时）的 EWMA，相对同层最快渠道计算因子
+//   - 错误：429 / 5xx 比例的 EWMA
+//   - 容量：多 Key 渠道中仍处于启用状态的 Key 比例
+
+type channelSelectionStats struct {
+	latencyEwma float64 // 毫秒
+	ttftEwma    float64 // 毫秒
+	errorEwma   float64 // 0-1
+	hasTTFT     bool
+	updatedAt   time.Time
+}
+
+var channelSelectionStatsMap = struct {
+	sync.RWMutex
+	stats map[string]*channelSelectionStats
+}{stats: make(map[string]*channelSelectionStats)}
+
+func channelSelectionStatsKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+func ewma(prev float64, sample float64, alpha float64) float64 {
+	return alpha*sample + (1-alpha)*prev
+}
+
+// RecordChannelSelectionSample 记录一次上游请求的耗时与结果，ttft 为 0 表示没有首字时间
+func RecordChannelSelectionSample(channelId int, modelName string, latency time.Duration, ttft time.Duration, throttledOrFailed bool) {
+	setting := operation_setting.GetChannelSelectionSetting()
+	alpha := setting.EwmaAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	errSample := 0.0
+	if throttledOrFailed {
+		errSample = 1
+	}
+	now := time.Now()
+	key := channelSelectionStatsKey(channelId, modelName)
+
+	channelSelectionStatsMap.Lock()
+	defer channelSelectionStatsMap.Unlock()
+	stats, ok := channelSelectionStatsMap.stats[key]
+	if !ok || isChannelSelectionStatsStale(stats, now) {
+		stats = &channelSelectionStats{errorEwma: errSample}
+		if !throttledOrFailed {
+			stats.latencyEwma = float64(latency.Milliseconds())
+		}
+		if ttft > 0 {
+			stats.ttftEwma = float64(ttft.Milliseconds())
+			stats.hasTTFT = true
+		}
+		stats.updatedAt = now
+		channelSelectionStatsMap.stats[key] = stats
+		return
+	}
+	stats.errorEwma = ewma(stats.errorEwma, errSample, alpha)
+	// 失败请求的耗时不代表上游正常响应速度，只计入错误率
+	if !throttledOrFailed {
+		if stats.latencyEwma == 0 {
+			stats.latencyEwma = float64(latency.Milliseconds())
+		} else {
+			stats.latencyEwma = ewma(stats.latencyEwma, float64(latency.Milliseconds()), alpha)
+		}
+	}
+	if ttft > 0 {
+		if !stats.hasTTFT {
+			stats.ttftEwma = float64(ttft.Milliseconds())
+			stats.hasTTFT = true
+		} else {
+			stats.ttftEwma = ewma(stats.ttftEwma, float64(ttft.Milliseconds()), alpha)
+		}
+	}
+	stats.updatedAt = now
+}
+
+func isChannelSelectionStatsStale(stats *channelSelectionStats, now time.Time) bool {
+	staleSeconds := operation_setting.GetChannelSelectionSetting().StaleSeconds
+	if staleSeconds <= 0 {
+		staleSeconds = 300
+	}
+	return now.Sub(stats.updatedAt) > time.Duration(staleSeconds)*time.Second
+}
+
+func getChannelSelectionStats(channelId int, modelName string, now time.Time) (channelSelectionStats, bool) {
+	channelSelectionStatsMap.RLock()
+	defer channelSelectionStatsMap.RUnlock()
+	stats, ok := channelSelectionStatsMap.stats[channelSelectionStatsKey(channelId, modelName)]
+	if !ok || isChannelSelectionStatsStale(stats, now) {
+		return channelSelectionStats{}, false
+	}
+	return *stats, true
+}
+
+func (s channelSelectionStats) latencySignal() float64 {
+	if s.hasTTFT {
+		return s.ttftEwma
+	}
+	return s.latencyEwma
+}
+
+// channelKeyCapacityFactor 多 Key 渠道中启用 Key 的比例
+func channelKeyCapacityFactor(channel *Channel) float64 {
+	if !channel.ChannelInfo.IsMultiKey || channel.ChannelInfo.MultiKeySize <= 0 {
+		return 1
+	}
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	defer lock.Unlock()
+	disabled := 0
+	for _, status := range channel.ChannelInfo.MultiKeyStatusList {
+		if status != common.ChannelStatusEnabled {
+			disabled++
+		}
+	}
+	enabled := channel.ChannelInfo.MultiKeySize - disabled
+	if enabled < 0 {
+		enabled = 0
+	}
+	return float64(enabled) / float64(channel.ChannelInfo.MultiKeySize)
+}
+
+// adaptiveChannelWeights 计算同一优先级内各渠道的有效权重，未启用自适应策略的渠道保持静态权重
+func adaptiveChannelWeights(targetChannels []*Channel, group string, modelName string) ([]float64, bool) {
+	adaptive := make([]bool, len(targetChannels))
+	anyAdaptive := false
+	for i, channel := range targetChannels {
+		tag := ""
+		if channel.Tag != nil {
+			tag = *channel.Tag
+		}
+		adaptive[i] = operation_setting.IsAdaptiveChannelSelection(group, tag)
+		anyAdaptive = anyAdaptive || adaptive[i]
+	}
+	if !anyAdaptive {
+		return nil, false
+	}
+
+	setting := operation_setting.GetChannelSelectionSetting()
+	minFactor := setting.MinWeightFactor
+	if minFactor <= 0 || minFactor > 1 {
+		minFactor = 0.05
+	}
+	penalty := setting.ErrorPenalty
+	if penalty <= 0 {
+		penalty = 1
+	}
+
+	now := time.Now()
+	stats := make([]channelSelectionStats, len(targetChannels))
+	hasStats := make([]bool, len(targetChannels))
+	bestLatency := math.MaxFloat64
+	sumWeight := 0
+	for i, channel := range targetChannels {
+		sumWeight += channel.GetSelectionWeight()
+		if !adaptive[i] {
+			continue
+		}
+		stats[i], hasStats[i] = getChannelSelectionStats(channel.Id, modelName, now)
+		if hasStats[i] && stats[i].latencySignal() > 0 && stats[i].latencySignal() < bestLatency {
+			bestLatency = stats[i].latencySignal()
+		}
+	}
+
+	weights := make([]float64, len(targetChannels))
+	for i, channel := range targetChannels {
+		prior := float64(channel.GetSelectionWeight())
+		if sumWeight == 0 {
+			// 与静态权重模式一致：全部权重为 0 时平均分配
+			prior = 100
+		}
+		if !adaptive[i] {
+			weights[i] = prior
+			continue
+		}
+		factor := math.Max(channelKeyCapacityFactor(channel), minFactor)
+		if hasStats[i] {
+			if signal := stats[i].latencySignal(); signal > 0 && bestLatency < math.MaxFloat64 {
+				factor *= math.Max(bestLatency/signal, minFactor)
+			}
+			factor *= math.Max(math.Pow(1-stats[i].errorEwma, penalty), minFactor)
+		}
+		weights[i] = prior * factor
+	}
+	return weights, true
+}
+
+// pickAdaptiveChannel 按有效权重随机选择一个渠道
+func pickAdaptiveChannel(targetChannels []*Channel, weights []float64) *Channel {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return nil
+	}
+	r := rand.Float64() * total
+	for i, channel := range targetChannels {
+		r -= weights[i]
+		if r < 0 {
+			return channel
+		}
+	}
+	// 浮点误差兜底：返回最后一个有效权重大于 0 的渠道
+	for i := len(targetChannels) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return targetChannels[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveChannelWeights(t *testing.T) {
+	setting := operation_setting.GetChannelSelectionSetting()
+	saved := *setting
+	setting.GroupStrategies = map[string]string{"adaptive-group": operation_setting.ChannelSelectionStrategyAdaptive}
+	t.Cleanup(func() { *setting = saved })
+
+	weight := uint(100)
+	fast := &Channel{Id: 980001, Weight: &weight}
+	slow := &Channel{Id: 980002, Weight: &weight}
+	throttled := &Channel{Id: 980003, Weight: &weight}
+	halfKeys := &Channel{Id: 980004, Weight: &weight}
+	halfKeys.ChannelInfo.IsMultiKey = true
+	halfKeys.ChannelInfo.MultiKeySize = 2
+	halfKeys.ChannelInfo.MultiKeyStatusList = map[int]int{1: common.ChannelStatusAutoDisabled}
+
+	RecordChannelSelectionSample(fast.Id, "m", time.Second, 100*time.Millisecond, false)
+	RecordChannelSelectionSample(slow.Id, "m", time.Second, 400*time.Millisecond, false)
+	RecordChannelSelectionSample(throttled.Id, "m", time.Second, 100*time.Millisecond, false)
+	RecordChannelSelectionSample(throttled.Id, "m", 0, 0, true)
+
+	targets := []*Channel{fast, slow, throttled, halfKeys}
+
+	_, ok := adaptiveChannelWeights(targets, "default", "m")
+	require.False(t, ok)
+
+	weights, ok := adaptiveChannelWeights(targets, "adaptive-group", "m")
+	require.True(t, ok)
+	require.InDelta(t, 100, weights[0], 0.001)
+	require.InDelta(t, 25, weights[1], 0.001)
+	require.Less(t, weights[2], weights[0])
+	require.InDelta(t, 50, weights[3], 0.001)
+}
@@ -0,0 +1,978 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+// 配置快照：将配置项、供应商、模型元数据、预填组与渠道导出为声明式快照，导入时先生成变更计划，
+// 确认后在一个事务中应用，便于用 Git 管理多个环境的配置。
+// 能力表（abilities）由渠道的分组与模型生成，不单独导出；渠道的余额、用量、多 Key 状态等运行时数据也不导出。
+
+const ConfigSnapshotVersion = 1
+
+const (
+	ConfigKindOption       = "option"
+	ConfigKindVendor       = "vendor"
+	ConfigKindModel        = "model"
+	ConfigKindPrefillGroup = "prefill_group"
+	ConfigKindChannel      = "channel"
+
+	ConfigChangeCreate = "create"
+	ConfigChangeUpdate = "update"
+	ConfigChangeDelete = "delete"
+
+	// 变更计划中密钥类字段的展示值
+	configMaskedValue = "******"
+)
+
+// ConfigSnapshot 配置快照。某一部分在快照中缺失（而不是空列表）时，导入会跳过该部分
+type ConfigSnapshot struct {
+	Version       int                    `json:"version" yaml:"version"`
+	Options       map[string]any         `json:"options" yaml:"options"`
+	Vendors       []SnapshotVendor       `json:"vendors" yaml:"vendors"`
+	Models        []SnapshotModel        `json:"models" yaml:"models"`
+	PrefillGroups []SnapshotPrefillGroup `json:"prefill_groups" yaml:"prefill_groups"`
+	Channels      []SnapshotChannel      `json:"channels" yaml:"channels"`
+}
+
+type SnapshotVendor struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Icon        string `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Status      int    `json:"status" yaml:"status"`
+}
+
+type SnapshotModel struct {
+	ModelName    string `json:"model_name" yaml:"model_name"`
+	Description  string `json:"description,omitempty" yaml:"description,omitempty"`
+	Icon         string `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Tags         string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Vendor       string `json:"vendor,omitempty" yaml:"vendor,omitempty"` // 供应商名称
+	Endpoints    string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+	Status       int    `json:"status" yaml:"status"`
+	SyncOfficial int    `json:"sync_official" yaml:"sync_official"`
+	NameRule     int    `json:"name_rule" yaml:"name_rule"`
+}
+
+type SnapshotPrefillGroup struct {
+	Name        string `json:"name" yaml:"name"`
+	Type        string `json:"type" yaml:"type"`
+	Items       any    `json:"items" yaml:"items"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// SnapshotChannel 渠道按名称匹配，快照中的渠道名称必须唯一
+type SnapshotChannel struct {
+	Name               string `json:"name" yaml:"name"`
+	Type               int    `json:"type" yaml:"type"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"` // 为空时导入保留现有 Key
+	Status             int    `json:"status" yaml:"status"`
+	Group              string `json:"group" yaml:"group"`
+	Models             string `json:"models" yaml:"models"`
+	Priority           int64  `json:"priority" yaml:"priority"`
+	Weight             uint   `json:"weight" yaml:"weight"`
+	AutoBan            int    `json:"auto_ban" yaml:"auto_ban"`
+	Tag                string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	BaseURL            string `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty" yaml:"openai_organization,omitempty"`
+	TestModel          string `json:"test_model,omitempty" yaml:"test_model,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty" yaml:"status_code_mapping,omitempty"`
+	Other              string `json:"other,omitempty" yaml:"other,omitempty"`
+	Setting            string `json:"setting,omitempty" yaml:"setting,omitempty"`
+	Settings           string `json:"settings,omitempty" yaml:"settings,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty" yaml:"param_override,omitempty"`
+	HeaderOverride     string `json:"header_override,omitempty" yaml:"header_override,omitempty"`
+	ResponseOverride   string `json:"response_override,omitempty" yaml:"response_override,omitempty"`
+	Remark             string `json:"remark,omitempty" yaml:"remark,omitempty"`
+	Schedule           string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	MultiKey           bool   `json:"multi_key,omitempty" yaml:"multi_key,omitempty"`
+	MultiKeyMode       string `json:"multi_key_mode,omitempty" yaml:"multi_key_mode,omitempty"`
+}
+
+// 导入渠道时写入的列，其余列（余额、用量、测试结果等）保持不变
+var snapshotChannelColumns = []string{
+	"type", "key", "status", "group", "models", "priority", "weight", "auto_ban", "tag", "base_url",
+	"openai_organization", "test_model", "model_mapping", "status_code_mapping", "other", "setting",
+	"settings", "param_override", "header_override", "response_override", "remark", "schedule", "channel_info",
+}
+
+type ConfigImportOptions struct {
+	// Prune 删除快照中没有的供应商、模型、预填组与渠道；配置项不会被删除
+	Prune bool
+	// Actor 记录在配置项修改记录中的操作人
+	Actor OptionActor
+}
+
+type ConfigFieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+type ConfigChange struct {
+	Kind   string              `json:"kind"`
+	Name   string              `json:"name"`
+	Action string              `json:"action"`
+	Fields []ConfigFieldChange `json:"fields,omitempty"`
+
+	apply func(tx *gorm.DB) error
+}
+
+// ConfigImportPlan 导入的变更计划，按应用顺序排列
+type ConfigImportPlan struct {
+	Changes []ConfigChange `json:"changes"`
+	Applied bool           `json:"applied"`
+
+	optionValues    map[string]string
+	channelsChanged bool
+	metaChanged     bool
+	multiKeyResets  []int
+}
+
+func (p *ConfigImportPlan) add(change ConfigChange) {
+	p.Changes = append(p.Changes, change)
+}
+
+// ExportConfigSnapshot 导出当前配置，渠道 Key 与密钥类配置项为明文
+func ExportConfigSnapshot() (*ConfigSnapshot, error) {
+	snapshot := &ConfigSnapshot{
+		Version: ConfigSnapshotVersion,
+		Options: make(map[string]any),
+	}
+	common.OptionMapRWMutex.RLock()
+	for key, value := range common.OptionMap {
+		snapshot.Options[key] = snapshotOptionValue(value)
+	}
+	common.OptionMapRWMutex.RUnlock()
+
+	var vendors []*Vendor
+	if err := DB.Order("name").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	snapshot.Vendors = make([]SnapshotVendor, 0, len(vendors))
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+		snapshot.Vendors = append(snapshot.Vendors, snapshotVendorFrom(vendor))
+	}
+
+	var models []*Model
+	if err := DB.Order("model_name").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	snapshot.Models = make([]SnapshotModel, 0, len(models))
+	for _, m := range models {
+		snapshot.Models = append(snapshot.Models, snapshotModelFrom(m, vendorNames))
+	}
+
+	var groups []*PrefillGroup
+	if err := DB.Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	snapshot.PrefillGroups = make([]SnapshotPrefillGroup, 0, len(groups))
+	for _, group := range groups {
+		snapshot.PrefillGroups = append(snapshot.PrefillGroups, snapshotPrefillGroupFrom(group))
+	}
+
+	var channels []*Channel
+	if err := DB.Order("name").Order("id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	snapshot.Channels = make([]SnapshotChannel, 0, len(channels))
+	for _, channel := range channels {
+		s, err := snapshotChannelFrom(channel)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Channels = append(snapshot.Channels, s)
+	}
+	return snapshot, nil
+}
+
+// PlanConfigImport 对比快照与当前配置，返回变更计划但不写入
+func PlanConfigImport(snapshot *ConfigSnapshot, opts ConfigImportOptions) (*ConfigImportPlan, error) {
+	return buildConfigImportPlan(DB, snapshot, opts)
+}
+
+// ApplyConfigImport 在一个事务中应用快照，任一变更失败时全部回滚
+func ApplyConfigImport(snapshot *ConfigSnapshot, opts ConfigImportOptions) (*ConfigImportPlan, error) {
+	var plan *ConfigImportPlan
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = buildConfigImportPlan(tx, snapshot, opts)
+		if err != nil {
+			return err
+		}
+		for _, change := range plan.Changes {
+			if err := change.apply(tx); err != nil {
+				return fmt.Errorf("%s %s %s: %w", change.Action, change.Kind, change.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Applied = true
+	plan.afterApply()
+	return plan, nil
+}
+
+// afterApply 事务提交后刷新本地缓存并通知其他节点
+func (p *ConfigImportPlan) afterApply() {
+	for key, value := range p.optionValues {
+		if err := updateOptionMap(key, value); err != nil {
+			common.SysLog("failed to update option map: " + err.Error())
+		}
+		publishCacheEvent(CacheEventOption, key)
+	}
+	if p.channelsChanged {
+		for _, id := range p.multiKeyResets {
+			ResetMultiKeyStates(id)
+		}
+		if common.MemoryCacheEnabled {
+			loadChannelCache()
+		}
+		publishCacheEvent(CacheEventChannels, "")
+	}
+	if p.channelsChanged || p.metaChanged {
+		RefreshPricing()
+	}
+}
+
+func buildConfigImportPlan(db *gorm.DB, snapshot *ConfigSnapshot, opts ConfigImportOptions) (*ConfigImportPlan, error) {
+	if snapshot == nil {
+		return nil, errors.New("配置快照为空")
+	}
+	if snapshot.Version != ConfigSnapshotVersion {
+		return nil, fmt.Errorf("不支持的配置快照版本: %d", snapshot.Version)
+	}
+	plan := &ConfigImportPlan{
+		Changes:      make([]ConfigChange, 0),
+		optionValues: make(map[string]string),
+	}
+	if err := planOptions(plan, snapshot.Options, opts.Actor); err != nil {
+		return nil, err
+	}
+	if err := planVendorsAndModels(db, plan, snapshot, opts); err != nil {
+		return nil, err
+	}
+	if err := planPrefillGroups(db, plan, snapshot.PrefillGroups, opts); err != nil {
+		return nil, err
+	}
+	if err := planChannels(db, plan, snapshot.Channels, opts); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func planOptions(plan *ConfigImportPlan, options map[string]any, actor OptionActor) error {
+	if options == nil {
+		return nil
+	}
+	current := make(map[string]string, len(common.OptionMap))
+	common.OptionMapRWMutex.RLock()
+	for key, value := range common.OptionMap {
+		current[key] = value
+	}
+	common.OptionMapRWMutex.RUnlock()
+
+	if actor.Source == "" {
+		actor.Source = OptionSourceImport
+	}
+	keys := lo.Keys(options)
+	sort.Strings(keys)
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if _, ok := current[key]; !ok {
+			return fmt.Errorf("未知的配置项: %s", key)
+		}
+		value, err := optionValueString(options[key])
+		if err != nil {
+			return fmt.Errorf("配置项 %s 的值无效: %w", key, err)
+		}
+		values[key] = value
+	}
+	// 与修改配置相同的校验，依赖的配置项优先取快照中的值
+	lookup := func(key string) string {
+		if value, ok := values[key]; ok {
+			return value
+		}
+		return current[key]
+	}
+	for _, key := range keys {
+		if err := ValidateOptionValue(key, values[key], lookup); err != nil {
+			return fmt.Errorf("配置项 %s 的值无效: %w", key, err)
+		}
+	}
+	for _, key := range keys {
+		oldValue, value := current[key], values[key]
+		fields := diffOptionValue(oldValue, value)
+		if len(fields) == 0 {
+			continue
+		}
+		if IsSecretOptionKey(key) {
+			fields = []ConfigFieldChange{{Field: "value", Old: configMaskedValue, New: configMaskedValue}}
+		}
+		plan.optionValues[key] = value
+		option := Option{Key: key, Value: value}
+		plan.add(ConfigChange{
+			Kind:   ConfigKindOption,
+			Name:   key,
+			Action: ConfigChangeUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				if err := tx.Save(&option).Error; err != nil {
+					return err
+				}
+				return recordOptionRevision(tx, key, oldValue, value, actor, 0)
+			},
+		})
+	}
+	return nil
+}
+
+func planVendorsAndModels(db *gorm.DB, plan *ConfigImportPlan, snapshot *ConfigSnapshot, opts ConfigImportOptions) error {
+	changeCount := len(plan.Changes)
+	var vendors []*Vendor
+	if err := db.Find(&vendors).Error; err != nil {
+		return err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	vendorsByName := make(map[string]*Vendor, len(vendors))
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+		vendorsByName[vendor.Name] = vendor
+	}
+	// 模型可以引用的供应商：快照提供了供应商列表时以快照为准
+	availableVendors := lo.Keys(vendorsByName)
+	if snapshot.Vendors != nil {
+		availableVendors = lo.Map(snapshot.Vendors, func(v SnapshotVendor, _ int) string { return v.Name })
+	}
+
+	var vendorDeletes []ConfigChange
+	if snapshot.Vendors != nil {
+		if err := checkSnapshotNames(ConfigKindVendor, lo.Map(snapshot.Vendors, func(v SnapshotVendor, _ int) string { return v.Name })); err != nil {
+			return err
+		}
+		for _, desired := range snapshot.Vendors {
+			desired := desired
+			existing, ok := vendorsByName[desired.Name]
+			if !ok {
+				plan.add(ConfigChange{
+					Kind:   ConfigKindVendor,
+					Name:   desired.Name,
+					Action: ConfigChangeCreate,
+					apply: func(tx *gorm.DB) error {
+						now := common.GetTimestamp()
+						return tx.Create(&Vendor{
+							Name:        desired.Name,
+							Description: desired.Description,
+							Icon:        desired.Icon,
+							Status:      desired.Status,
+							CreatedTime: now,
+							UpdatedTime: now,
+						}).Error
+					},
+				})
+				continue
+			}
+			fields := diffSnapshotFields(snapshotVendorFrom(existing), desired)
+			if len(fields) == 0 {
+				continue
+			}
+			id := existing.Id
+			plan.add(ConfigChange{
+				Kind:   ConfigKindVendor,
+				Name:   desired.Name,
+				Action: ConfigChangeUpdate,
+				Fields: fields,
+				apply: func(tx *gorm.DB) error {
+					return tx.Model(&Vendor{}).Where("id = ?", id).Updates(map[string]any{
+						"description":  desired.Description,
+						"icon":         desired.Icon,
+						"status":       desired.Status,
+						"updated_time": common.GetTimestamp(),
+					}).Error
+				},
+			})
+		}
+		if opts.Prune {
+			desiredNames := lo.SliceToMap(snapshot.Vendors, func(v SnapshotVendor) (string, bool) { return v.Name, true })
+			for _, vendor := range sortedByName(vendors, func(v *Vendor) string { return v.Name }) {
+				if desiredNames[vendor.Name] {
+					continue
+				}
+				id := vendor.Id
+				vendorDeletes = append(vendorDeletes, ConfigChange{
+					Kind:   ConfigKindVendor,
+					Name:   vendor.Name,
+					Action: ConfigChangeDelete,
+					apply: func(tx *gorm.DB) error {
+						return tx.Delete(&Vendor{}, id).Error
+					},
+				})
+			}
+		}
+	}
+
+	if snapshot.Models != nil {
+		if err := checkSnapshotNames(ConfigKindModel, lo.Map(snapshot.Models, func(m SnapshotModel, _ int) string { return m.ModelName })); err != nil {
+			return err
+		}
+		var models []*Model
+		if err := db.Find(&models).Error; err != nil {
+			return err
+		}
+		modelsByName := lo.SliceToMap(models, func(m *Model) (string, *Model) { return m.ModelName, m })
+		for _, desired := range snapshot.Models {
+			desired := desired
+			if desired.Vendor != "" && !lo.Contains(availableVendors, desired.Vendor) {
+				return fmt.Errorf("模型 %s 引用的供应商 %s 不存在", desired.ModelName, desired.Vendor)
+			}
+			existing, ok := modelsByName[desired.ModelName]
+			if !ok {
+				plan.add(ConfigChange{
+					Kind:   ConfigKindModel,
+					Name:   desired.ModelName,
+					Action: ConfigChangeCreate,
+					apply: func(tx *gorm.DB) error {
+						vendorId, err := snapshotVendorId(tx, desired.Vendor)
+						if err != nil {
+							return err
+						}
+						now := common.GetTimestamp()
+						m := &Model{
+							ModelName:   desired.ModelName,
+							Description: desired.Description,
+							Icon:        desired.Icon,
+							Tags:        desired.Tags,
+							VendorID:    vendorId,
+							Endpoints:   desired.Endpoints,
+							NameRule:    desired.NameRule,
+							CreatedTime: now,
+							UpdatedTime: now,
+						}
+						if err := tx.Create(m).Error; err != nil {
+							return err
+						}
+						// 创建时零值会被 default 标签覆盖，再写一次
+						return tx.Model(&Model{}).Where("id = ?", m.Id).Updates(map[string]any{
+							"status":        desired.Status,
+							"sync_official": desired.SyncOfficial,
+						}).Error
+					},
+				})
+				continue
+			}
+			fields := diffSnapshotFields(snapshotModelFrom(existing, vendorNames), desired)
+			if len(fields) == 0 {
+				continue
+			}
+			id := existing.Id
+			plan.add(ConfigChange{
+				Kind:   ConfigKindModel,
+				Name:   desired.ModelName,
+				Action: ConfigChangeUpdate,
+				Fields: fields,
+				apply: func(tx *gorm.DB) error {
+					vendorId, err := snapshotVendorId(tx, desired.Vendor)
+					if err != nil {
+						return err
+					}
+					return tx.Model(&Model{}).Where("id = ?", id).Updates(map[string]any{
+						"description":   desired.Description,
+						"icon":          desired.Icon,
+						"tags":          desired.Tags,
+						"vendor_id":     vendorId,
+						"endpoints":     desired.Endpoints,
+						"status":        desired.Status,
+						"sync_official": desired.SyncOfficial,
+						"name_rule":     desired.NameRule,
+						"updated_time":  common.GetTimestamp(),
+					}).Error
+				},
+			})
+		}
+		if opts.Prune {
+			desiredNames := lo.SliceToMap(snapshot.Models, func(m SnapshotModel) (string, bool) { return m.ModelName, true })
+			for _, m := range sortedByName(models, func(m *Model) string { return m.ModelName }) {
+				if desiredNames[m.ModelName] {
+					continue
+				}
+				id := m.Id
+				plan.add(ConfigChange{
+					Kind:   ConfigKindModel,
+					Name:   m.ModelName,
+					Action: ConfigChangeDelete,
+					apply: func(tx *gorm.DB) error {
+						return tx.Delete(&Model{}, id).Error
+					},
+				})
+			}
+		}
+	}
+	// 供应商最后删除，先让模型改为引用新的供应商
+	for _, change := range vendorDeletes {
+		plan.add(change)
+	}
+	plan.metaChanged = len(plan.Changes) > changeCount
+	return nil
+}
+
+func planPrefillGroups(db *gorm.DB, plan *ConfigImportPlan, groups []SnapshotPrefillGroup, opts ConfigImportOptions) error {
+	if groups == nil {
+		return nil
+	}
+	if err := checkSnapshotNames(ConfigKindPrefillGroup, lo.Map(groups, func(g SnapshotPrefillGroup, _ int) string { return g.Name })); err != nil {
+		return err
+	}
+	var existingGroups []*PrefillGroup
+	if err := db.Find(&existingGroups).Error; err != nil {
+		return err
+	}
+	groupsByName := lo.SliceToMap(existingGroups, func(g *PrefillGroup) (string, *PrefillGroup) { return g.Name, g })
+	for _, desired := range groups {
+		desired := desired
+		if desired.Type == "" {
+			return fmt.Errorf("预填组 %s 缺少类型", desired.Name)
+		}
+		items, err := common.Marshal(desired.Items)
+		if err != nil {
+			return fmt.Errorf("预填组 %s 的 items 无效: %w", desired.Name, err)
+		}
+		desired.Items = normalizeJSONValue(items)
+		existing, ok := groupsByName[desired.Name]
+		if !ok {
+			plan.add(ConfigChange{
+				Kind:   ConfigKindPrefillGroup,
+				Name:   desired.Name,
+				Action: ConfigChangeCreate,
+				apply: func(tx *gorm.DB) error {
+					now := common.GetTimestamp()
+					return tx.Create(&PrefillGroup{
+						Name:        desired.Name,
+						Type:        desired.Type,
+						Items:       JSONValue(items),
+						Description: desired.Description,
+						CreatedTime: now,
+						UpdatedTime: now,
+					}).Error
+				},
+			})
+			continue
+		}
+		fields := diffSnapshotFields(snapshotPrefillGroupFrom(existing), desired)
+		if len(fields) == 0 {
+			continue
+		}
+		id := existing.Id
+		plan.add(ConfigChange{
+			Kind:   ConfigKindPrefillGroup,
+			Name:   desired.Name,
+			Action: ConfigChangeUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				return tx.Model(&PrefillGroup{}).Where("id = ?", id).Updates(map[string]any{
+					"type":         desired.Type,
+					"items":        JSONValue(items),
+					"description":  desired.Description,
+					"updated_time": common.GetTimestamp(),
+				}).Error
+			},
+		})
+	}
+	if opts.Prune {
+		desiredNames := lo.SliceToMap(groups, func(g SnapshotPrefillGroup) (string, bool) { return g.Name, true })
+		for _, group := range sortedByName(existingGroups, func(g *PrefillGroup) string { return g.Name }) {
+			if desiredNames[group.Name] {
+				continue
+			}
+			id := group.Id
+			plan.add(ConfigChange{
+				Kind:   ConfigKindPrefillGroup,
+				Name:   group.Name,
+				Action: ConfigChangeDelete,
+				apply: func(tx *gorm.DB) error {
+					return tx.Delete(&PrefillGroup{}, id).Error
+				},
+			})
+		}
+	}
+	return nil
+}
+
+func planChannels(db *gorm.DB, plan *ConfigImportPlan, channels []SnapshotChannel, opts ConfigImportOptions) error {
+	if channels == nil {
+		return nil
+	}
+	if err := checkSnapshotNames(ConfigKindChannel, lo.Map(channels, func(c SnapshotChannel, _ int) string { return c.Name })); err != nil {
+		return err
+	}
+	var existingChannels []*Channel
+	if err := db.Order("id").Find(&existingChannels).Error; err != nil {
+		return err
+	}
+	channelsByName := lo.GroupBy(existingChannels, func(c *Channel) string { return c.Name })
+	for _, desired := range channels {
+		desired := desired
+		existing := channelsByName[desired.Name]
+		if len(existing) > 1 {
+			return fmt.Errorf("渠道名称 %s 在当前环境中不唯一，无法匹配", desired.Name)
+		}
+		if len(existing) == 0 {
+			if desired.Key == "" {
+				return fmt.Errorf("新建渠道 %s 缺少 Key", desired.Name)
+			}
+			plan.channelsChanged = true
+			plan.add(ConfigChange{
+				Kind:   ConfigKindChannel,
+				Name:   desired.Name,
+				Action: ConfigChangeCreate,
+				apply: func(tx *gorm.DB) error {
+					channel := &Channel{CreatedTime: common.GetTimestamp()}
+					desired.applyTo(channel)
+					if err := tx.Create(channel).Error; err != nil {
+						return err
+					}
+					return channel.AddAbilities(tx)
+				},
+			})
+			continue
+		}
+		channel := existing[0]
+		current, err := snapshotChannelFrom(channel)
+		if err != nil {
+			return err
+		}
+		if desired.Key == "" {
+			desired.Key = current.Key
+		}
+		fields := diffSnapshotFields(current, desired, "key")
+		if len(fields) == 0 {
+			continue
+		}
+		plan.channelsChanged = true
+		if channel.ChannelInfo.IsMultiKey && desired.Key != current.Key {
+			plan.multiKeyResets = append(plan.multiKeyResets, channel.Id)
+		}
+		plan.add(ConfigChange{
+			Kind:   ConfigKindChannel,
+			Name:   desired.Name,
+			Action: ConfigChangeUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				desired.applyTo(channel)
+				if err := tx.Model(channel).Select(snapshotChannelColumns).Updates(channel).Error; err != nil {
+					return err
+				}
+				return channel.UpdateAbilities(tx)
+			},
+		})
+	}
+	if opts.Prune {
+		desiredNames := lo.SliceToMap(channels, func(c SnapshotChannel) (string, bool) { return c.Name, true })
+		for _, channel := range sortedByName(existingChannels, func(c *Channel) string { return c.Name }) {
+			if desiredNames[channel.Name] {
+				continue
+			}
+			id := channel.Id
+			plan.channelsChanged = true
+			plan.add(ConfigChange{
+				Kind:   ConfigKindChannel,
+				Name:   channel.Name,
+				Action: ConfigChangeDelete,
+				apply: func(tx *gorm.DB) error {
+					if err := tx.Where("channel_id = ?", id).Delete(&Ability{}).Error; err != nil {
+						return err
+					}
+					return tx.Delete(&Channel{}, id).Error
+				},
+			})
+		}
+	}
+	return nil
+}
+
+func snapshotVendorFrom(vendor *Vendor) SnapshotVendor {
+	return SnapshotVendor{
+		Name:        vendor.Name,
+		Description: vendor.Description,
+		Icon:        vendor.Icon,
+		Status:      vendor.Status,
+	}
+}
+
+func snapshotModelFrom(m *Model, vendorNames map[int]string) SnapshotModel {
+	return SnapshotModel{
+		ModelName:    m.ModelName,
+		Description:  m.Description,
+		Icon:         m.Icon,
+		Tags:         m.Tags,
+		Vendor:       vendorNames[m.VendorID],
+		Endpoints:    m.Endpoints,
+		Status:       m.Status,
+		SyncOfficial: m.SyncOfficial,
+		NameRule:     m.NameRule,
+	}
+}
+
+func snapshotPrefillGroupFrom(group *PrefillGroup) SnapshotPrefillGroup {
+	return SnapshotPrefillGroup{
+		Name:        group.Name,
+		Type:        group.Type,
+		Items:       normalizeJSONValue(group.Items),
+		Description: group.Description,
+	}
+}
+
+func snapshotChannelFrom(channel *Channel) (SnapshotChannel, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return SnapshotChannel{}, fmt.Errorf("渠道 %s 的 Key 解密失败: %w", channel.Name, err)
+	}
+	status := channel.Status
+	// 自动禁用属于运行时状态，快照中记为启用
+	if status == common.ChannelStatusAutoDisabled {
+		status = common.ChannelStatusEnabled
+	}
+	autoBan := 0
+	if channel.GetAutoBan() {
+		autoBan = 1
+	}
+	s := SnapshotChannel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Key:                key,
+		Status:             status,
+		Group:              channel.Group,
+		Models:             channel.Models,
+		Priority:           channel.GetPriority(),
+		Weight:             uint(channel.GetWeight()),
+		AutoBan:            autoBan,
+		Tag:                channel.GetTag(),
+		BaseURL:            channel.GetBaseURL(),
+		OpenAIOrganization: lo.FromPtr(channel.OpenAIOrganization),
+		TestModel:          lo.FromPtr(channel.TestModel),
+		ModelMapping:       channel.GetModelMapping(),
+		StatusCodeMapping:  channel.GetStatusCodeMapping(),
+		Other:              channel.Other,
+		Setting:            lo.FromPtr(channel.Setting),
+		Settings:           channel.OtherSettings,
+		ParamOverride:      lo.FromPtr(channel.ParamOverride),
+		HeaderOverride:     lo.FromPtr(channel.HeaderOverride),
+		ResponseOverride:   lo.FromPtr(channel.ResponseOverride),
+		Remark:             lo.FromPtr(channel.Remark),
+		Schedule:           lo.FromPtr(channel.Schedule),
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		s.MultiKey = true
+		s.MultiKeyMode = string(channel.ChannelInfo.MultiKeyMode)
+	}
+	return s, nil
+}
+
+// applyTo 将快照中的渠道配置写入 channel，自动禁用的渠道保持自动禁用
+func (s SnapshotChannel) applyTo(channel *Channel) {
+	status := s.Status
+	if status == common.ChannelStatusEnabled && channel.Status == common.ChannelStatusAutoDisabled {
+		status = common.ChannelStatusAutoDisabled
+	}
+	channel.Name = s.Name
+	channel.Type = s.Type
+	channel.Key = s.Key
+	channel.Keys = nil
+	channel.Status = status
+	channel.Group = s.Group
+	channel.Models = s.Models
+	channel.Priority = lo.ToPtr(s.Priority)
+	channel.Weight = lo.ToPtr(s.Weight)
+	channel.AutoBan = lo.ToPtr(s.AutoBan)
+	channel.Tag = snapshotStringPtr(s.Tag)
+	channel.BaseURL = lo.ToPtr(s.BaseURL)
+	channel.OpenAIOrganization = snapshotStringPtr(s.OpenAIOrganization)
+	channel.TestModel = snapshotStringPtr(s.TestModel)
+	channel.ModelMapping = snapshotStringPtr(s.ModelMapping)
+	channel.StatusCodeMapping = lo.ToPtr(s.StatusCodeMapping)
+	channel.Other = s.Other
+	channel.Setting = snapshotStringPtr(s.Setting)
+	channel.OtherSettings = s.Settings
+	channel.ParamOverride = snapshotStringPtr(s.ParamOverride)
+	channel.HeaderOverride = snapshotStringPtr(s.HeaderOverride)
+	channel.ResponseOverride = snapshotStringPtr(s.ResponseOverride)
+	channel.Remark = snapshotStringPtr(s.Remark)
+	channel.Schedule = snapshotStringPtr(s.Schedule)
+
+	info := &channel.ChannelInfo
+	info.IsMultiKey = s.MultiKey
+	if !s.MultiKey {
+		return
+	}
+	info.MultiKeyMode = constant.MultiKeyMode(s.MultiKeyMode)
+	if info.MultiKeyMode == "" {
+		info.MultiKeyMode = constant.MultiKeyModeRandom
+	}
+	info.MultiKeySize = len(channel.GetKeys())
+	for idx := range info.MultiKeyStatusList {
+		if idx >= info.MultiKeySize {
+			delete(info.MultiKeyStatusList, idx)
+		}
+	}
+}
+
+func snapshotStringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func snapshotVendorId(tx *gorm.DB, name string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+	var vendor Vendor
+	if err := tx.Select("id").Where("name = ?", name).First(&vendor).Error; err != nil {
+		return 0, fmt.Errorf("供应商 %s 不存在: %w", name, err)
+	}
+	return vendor.Id, nil
+}
+
+func checkSnapshotNames(kind string, names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%s 名称不能为空", kind)
+		}
+		if seen[name] {
+			return fmt.Errorf("%s 名称重复: %s", kind, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func sortedByName[T any](items []T, name func(T) string) []T {
+	sorted := append([]T(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return name(sorted[i]) < name(sorted[j]) })
+	return sorted
+}
+
+// snapshotOptionValue JSON 对象与数组形式的配置项导出为结构化数据，便于在快照中逐项审阅
+func snapshotOptionValue(value string) any {
+	if structured, ok := parseStructuredOption(value); ok {
+		return structured
+	}
+	return value
+}
+
+func parseStructuredOption(value string) (any, bool) {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	var structured any
+	if err := common.Unmarshal([]byte(trimmed), &structured); err != nil {
+		return nil, false
+	}
+	return structured, true
+}
+
+// optionValueString 将快照中的配置项还原为数据库中保存的字符串
+func optionValueString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		b, err := common.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
+
+// diffOptionValue 对比配置项的新旧值，JSON 对象按顶层键逐项对比，忽略格式与键顺序的差异
+func diffOptionValue(oldValue string, newValue string) []ConfigFieldChange {
+	if oldValue == newValue {
+		return nil
+	}
+	oldStructured, oldOk := parseStructuredOption(oldValue)
+	newStructured, newOk := parseStructuredOption(newValue)
+	if oldOk && newOk {
+		if reflect.DeepEqual(oldStructured, newStructured) {
+			return nil
+		}
+		oldMap, oldIsMap := oldStructured.(map[string]any)
+		newMap, newIsMap := newStructured.(map[string]any)
+		if oldIsMap && newIsMap {
+			keys := lo.Union(lo.Keys(oldMap), lo.Keys(newMap))
+			sort.Strings(keys)
+			var fields []ConfigFieldChange
+			for _, key := range keys {
+				if !reflect.DeepEqual(oldMap[key], newMap[key]) {
+					fields = append(fields, ConfigFieldChange{Field: key, Old: oldMap[key], New: newMap[key]})
+				}
+			}
+			return fields
+		}
+		return []ConfigFieldChange{{Field: "value", Old: oldStructured, New: newStructured}}
+	}
+	return []ConfigFieldChange{{Field: "value", Old: oldValue, New: newValue}}
+}
+
+// normalizeJSONValue 统一 JSON 数据的类型（数字为 float64），用于比较
+func normalizeJSONValue(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	var v any
+	if err := common.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	return v
+}
+
+// diffSnapshotFields 逐字段对比两个同类型的快照结构体，masked 中的字段不展示具体值
+func diffSnapshotFields(current any, desired any, masked ...string) []ConfigFieldChange {
+	currentValue := reflect.ValueOf(current)
+	desiredValue := reflect.ValueOf(desired)
+	t := currentValue.Type()
+	var fields []ConfigFieldChange
+	for i := 0; i < t.NumField(); i++ {
+		oldField := currentValue.Field(i).Interface()
+		newField := desiredValue.Field(i).Interface()
+		if reflect.DeepEqual(oldField, newField) {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		change := ConfigFieldChange{Field: name, Old: oldField, New: newField}
+		if lo.Contains(masked, name) {
+			change.Old, change.New = configMaskedValue, configMaskedValue
+		}
+		fields = append(fields, change)
+	}
+	return fields
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSnapshotImport(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&Ability{}, &Vendor{}, &Model{}, &PrefillGroup{}, &Option{}, &OptionRevision{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM abilities")
+		DB.Exec("DELETE FROM vendors")
+		DB.Exec("DELETE FROM models")
+		DB.Exec("DELETE FROM prefill_groups")
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM option_revisions")
+	})
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"ModelRatio": `{"gpt-4o":1.5,"gpt-4o-mini":0.1}`, "SMTPToken": "smtp-secret"}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	require.NoError(t, (&Channel{Name: "a", Key: "key-a", Group: "default", Models: "gpt-4o", Status: common.ChannelStatusAutoDisabled}).Insert())
+	require.NoError(t, (&Channel{Name: "b", Key: "key-b", Group: "default", Models: "gpt-4o", Status: common.ChannelStatusEnabled}).Insert())
+	vendor := &Vendor{Name: "OpenAI", Status: 1}
+	require.NoError(t, vendor.Insert())
+	require.NoError(t, (&Model{ModelName: "gpt-4o", VendorID: vendor.Id, Status: 1}).Insert())
+
+	// 导出后原样导入没有变更
+	snapshot, err := ExportConfigSnapshot()
+	require.NoError(t, err)
+	require.Equal(t, common.ChannelStatusEnabled, snapshot.Channels[0].Status)
+	require.Equal(t, "OpenAI", snapshot.Models[0].Vendor)
+	plan, err := PlanConfigImport(snapshot, ConfigImportOptions{Prune: true})
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes)
+
+	snapshot.Options = map[string]any{"ModelRatio": map[string]any{"gpt-4o": 2, "gpt-4o-mini": 0.1}}
+	snapshot.Channels[0].Key = ""
+	snapshot.Channels[0].Models = "gpt-4o,gpt-4o-mini"
+	snapshot.Channels[1] = SnapshotChannel{Name: "c", Key: "key-c", Group: "default", Models: "gpt-4o", Status: common.ChannelStatusEnabled}
+
+	plan, err = PlanConfigImport(snapshot, ConfigImportOptions{})
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 3)
+	require.Equal(t, []ConfigFieldChange{{Field: "gpt-4o", Old: 1.5, New: float64(2)}}, plan.Changes[0].Fields)
+
+	plan, err = ApplyConfigImport(snapshot, ConfigImportOptions{Prune: true})
+	require.NoError(t, err)
+	require.True(t, plan.Applied)
+	require.Len(t, plan.Changes, 4)
+
+	// Key 为空时保留现有 Key，自动禁用状态保持不变
+	var channels []*Channel
+	require.NoError(t, DB.Order("name").Find(&channels).Error)
+	require.Len(t, channels, 2)
+	require.Equal(t, "key-a", channels[0].Key)
+	require.Equal(t, "gpt-4o,gpt-4o-mini", channels[0].Models)
+	require.Equal(t, common.ChannelStatusAutoDisabled, channels[0].Status)
+	require.Equal(t, "c", channels[1].Name)
+	var abilityCount int64
+	require.NoError(t, DB.Model(&Ability{}).Where("channel_id = ?", channels[0].Id).Count(&abilityCount).Error)
+	require.Equal(t, int64(2), abilityCount)
+	require.NoError(t, DB.Model(&Ability{}).Where("channel_id NOT IN ?", []int{channels[0].Id, channels[1].Id}).Count(&abilityCount).Error)
+	require.Zero(t, abilityCount)
+
+	common.OptionMapRWMutex.RLock()
+	require.JSONEq(t, `{"gpt-4o":2,"gpt-4o-mini":0.1}`, common.OptionMap["ModelRatio"])
+	common.OptionMapRWMutex.RUnlock()
+	revisions, _, err := GetOptionRevisions("ModelRatio", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	require.Equal(t, OptionSourceImport, revisions[0].Source)
+
+	// 新建渠道缺少 Key 时拒绝导入
+	snapshot.Channels = append(snapshot.Channels, SnapshotChannel{Name: "d", Group: "default", Models: "gpt-4o"})
+	_, err = ApplyConfigImport(snapshot, ConfigImportOptions{})
+	require.Error(t, err)
+}
+
+func TestConfigSnapshotImportValidatesOptions(t *testing.T) {
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"GitHubOAuthEnabled": "false", "GitHubClientId": "", "batch_setting.concurrency": "4"}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	snapshot := &ConfigSnapshot{Version: ConfigSnapshotVersion, Options: map[string]any{"GitHubOAuthEnabled": true}}
+	_, err := PlanConfigImport(snapshot, ConfigImportOptions{})
+	require.ErrorContains(t, err, "GitHubOAuthEnabled")
+
+	// 同一快照中提供了依赖的配置项时允许启用
+	snapshot.Options["GitHubClientId"] = "client-id"
+	plan, err := PlanConfigImport(snapshot, ConfigImportOptions{})
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 2)
+
+	snapshot.Options = map[string]any{"batch_setting.concurrency": -1}
+	_, err = PlanConfigImport(snapshot, ConfigImportOptions{})
+	require.ErrorContains(t, err, "batch_setting.concurrency")
+}
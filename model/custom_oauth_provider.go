@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
 )
 
 type accessPolicyPayload struct {
@@ -44,7 +46,7 @@ type CustomOAuthProvider struct {
 	Icon                  string `json:"icon" gorm:"type:varchar(128);default:''"`                       // Icon name from @lobehub/icons
 	Enabled               bool   `json:"enabled" gorm:"default:false"`                                   // Whether this provider is enabled
 	ClientId              string `json:"client_id" gorm:"type:varchar(256)"`                             // OAuth client ID
-	ClientSecret          string `json:"-" gorm:"type:varchar(512)"`                                     // OAuth client secret (not returned to frontend)
+	ClientSecret          string `json:"-" gorm:"type:text"`                                             // OAuth client secret, encrypted at rest (not returned to frontend)
 	AuthorizationEndpoint string `json:"authorization_endpoint" gorm:"type:varchar(512)"`                // Authorization URL
 	TokenEndpoint         string `json:"token_endpoint" gorm:"type:varchar(512)"`                        // Token exchange URL
 	UserInfoEndpoint      string `json:"user_info_endpoint" gorm:"type:varchar(512)"`                    // User info URL
@@ -70,6 +72,21 @@ func (CustomOAuthProvider) TableName() string {
 	return "custom_oauth_providers"
 }
 
+// BeforeSave encrypts the client secret when a master key is configured
+func (p *CustomOAuthProvider) BeforeSave(tx *gorm.DB) error {
+	secret, err := encryptSecret(p.ClientSecret)
+	if err != nil {
+		return err
+	}
+	p.ClientSecret = secret
+	return nil
+}
+
+// GetClientSecret returns the decrypted client secret
+func (p *CustomOAuthProvider) GetClientSecret() (string, error) {
+	return decryptSecret(p.ClientSecret)
+}
+
 // GetAllCustomOAuthProviders returns all custom OAuth providers
 func GetAllCustomOAuthProviders() ([]*CustomOAuthProvider, error) {
 	var providers []*CustomOAuthProvider
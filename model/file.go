@@ -0,0 +1,118 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// File /v1/files 上传的文件，内容保存在 service.FileStore 中
+type File struct {
+	Id         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Bytes      int64  `json:"bytes"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	Filename   string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	StorageKey string `json:"-" gorm:"type:varchar(128)"`
+}
+
+// FileChunk 数据库文件存储的分块内容，多节点部署时各节点都能读取其他节点上传的文件
+type FileChunk struct {
+	Id         int    `json:"id"`
+	StorageKey string `json:"storage_key" gorm:"type:varchar(128);uniqueIndex:idx_file_chunk_key_seq"`
+	Seq        int    `json:"seq" gorm:"uniqueIndex:idx_file_chunk_key_seq"`
+	Data       []byte `json:"-"`
+}
+
+func InsertFileChunk(storageKey string, seq int, data []byte) error {
+	return DB.Create(&FileChunk{StorageKey: storageKey, Seq: seq, Data: data}).Error
+}
+
+// GetFileChunk 返回文件的第 seq 个分块，分块不存在时返回 gorm.ErrRecordNotFound
+func GetFileChunk(storageKey string, seq int) (*FileChunk, error) {
+	var chunk FileChunk
+	err := DB.Where("storage_key = ? AND seq = ?", storageKey, seq).First(&chunk).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+func DeleteFileChunks(storageKey string) error {
+	return DB.Where("storage_key = ?", storageKey).Delete(&FileChunk{}).Error
+}
+
+func (f *File) Insert() error {
+	return DB.Create(f).Error
+}
+
+func GetUserFileById(userId int, id string) (*File, error) {
+	if id == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles 按创建时间倒序列出用户文件，after 为上一页最后一个文件的 ID
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var last File
+		if err := DB.Where("id = ? AND user_id = ?", after, userId).First(&last).Error; err == nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", last.CreatedAt, last.CreatedAt, last.Id)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// GetUserFileUsage 返回用户保存的文件数与总字节数
+func GetUserFileUsage(userId int) (int64, int64, error) {
+	var usage struct {
+		Count int64
+		Bytes int64
+	}
+	err := DB.Model(&File{}).Select("COUNT(*) AS count, COALESCE(SUM(bytes), 0) AS bytes").
+		Where("user_id = ?", userId).Scan(&usage).Error
+	return usage.Count, usage.Bytes, err
+}
+
+// GetExpiredFiles 返回创建时间早于 before 的文件，未结束的批处理任务引用的输入文件除外
+func GetExpiredFiles(before int64, limit int) ([]*File, error) {
+	var files []*File
+	activeInputs := DB.Model(&Batch{}).Select("input_file_id").Where("status IN ?", []string{
+		BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling,
+	})
+	err := DB.Where("created_at < ? AND id NOT IN (?)", before, activeInputs).
+		Order("created_at").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFileById(id string) error {
+	return DB.Where("id = ?", id).Delete(&File{}).Error
+}
+
+func IsFileNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+func NewFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
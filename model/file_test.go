@@ -0,0 +1,47 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setupFileTables(t *testing.T) {
+	t.Helper()
+	require.NoError(t, DB.AutoMigrate(&File{}, &Batch{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM files")
+		DB.Exec("DELETE FROM batches")
+	})
+}
+
+func TestGetUserFileUsage(t *testing.T) {
+	setupFileTables(t)
+	require.NoError(t, (&File{Id: "file-a", UserId: 1, Bytes: 100}).Insert())
+	require.NoError(t, (&File{Id: "file-b", UserId: 1, Bytes: 50}).Insert())
+	require.NoError(t, (&File{Id: "file-c", UserId: 2, Bytes: 10}).Insert())
+
+	count, bytes, err := GetUserFileUsage(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, count)
+	require.EqualValues(t, 150, bytes)
+
+	count, bytes, err = GetUserFileUsage(3)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Zero(t, bytes)
+}
+
+func TestGetExpiredFilesKeepsActiveBatchInputs(t *testing.T) {
+	setupFileTables(t)
+	require.NoError(t, (&File{Id: "file-old", UserId: 1, CreatedAt: 100}).Insert())
+	require.NoError(t, (&File{Id: "file-running", UserId: 1, CreatedAt: 100}).Insert())
+	require.NoError(t, (&File{Id: "file-new", UserId: 1, CreatedAt: 1000}).Insert())
+	require.NoError(t, DB.Create(&Batch{Id: "batch-a", UserId: 1, InputFileId: "file-running", Status: BatchStatusInProgress}).Error)
+	require.NoError(t, DB.Create(&Batch{Id: "batch-b", UserId: 1, InputFileId: "file-old", Status: BatchStatusCompleted}).Error)
+
+	files, err := GetExpiredFiles(500, 10)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "file-old", files[0].Id)
+}
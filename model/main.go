@@ -261,6 +261,7 @@ func migrateDB() error {
 		&User{},
 		&PasskeyCredential{},
 		&Option{},
+		&OptionRevision{},
 		&Redemption{},
 		&Ability{},
 		&Log{},
@@ -280,6 +281,14 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&File{},
+		&FileChunk{},
+		&Batch{},
+		&Budget{},
+		&Organization{},
+		&OrganizationMember{},
+		&RequestCapture{},
+		&ResponseState{},
 	)
 	if err != nil {
 		return err
@@ -293,6 +302,12 @@ func migrateDB() error {
 			return err
 		}
 	}
+	if err := migrateTokenKeyStorage(); err != nil {
+		return err
+	}
+	if err := migrateSecretEncryption(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -309,6 +324,7 @@ func migrateDBFast() error {
 		{&User{}, "User"},
 		{&PasskeyCredential{}, "PasskeyCredential"},
 		{&Option{}, "Option"},
+		{&OptionRevision{}, "OptionRevision"},
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
@@ -328,6 +344,14 @@ func migrateDBFast() error {
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&File{}, "File"},
+		{&FileChunk{}, "FileChunk"},
+		{&Batch{}, "Batch"},
+		{&Budget{}, "Budget"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&RequestCapture{}, "RequestCapture"},
+		{&ResponseState{}, "ResponseState"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -361,6 +385,12 @@ func migrateDBFast() error {
 			return err
 		}
 	}
+	if err := migrateTokenKeyStorage(); err != nil {
+		return err
+	}
+	if err := migrateSecretEncryption(); err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	return nil
 }
@@ -502,6 +532,32 @@ func migrateTokenModelLimitsToText() error {
 	return nil
 }
 
+// migrateTokenKeyStorage 令牌改为哈希存储：去掉明文列上的唯一索引（迁移后明文列为空），
+// 并在配置了固定密钥时将明文令牌迁移为哈希。可重复执行
+func migrateTokenKeyStorage() error {
+	if DB.Migrator().HasIndex(&Token{}, "idx_tokens_key") {
+		if err := DB.Migrator().DropIndex(&Token{}, "idx_tokens_key"); err != nil {
+			return fmt.Errorf("failed to drop unique index of tokens.key: %w", err)
+		}
+	}
+	if !common.TokenKeyHashEnabled {
+		var hashed int64
+		DB.Model(&Token{}).Where("key_hash <> ''").Count(&hashed)
+		if hashed > 0 {
+			common.SysError(fmt.Sprintf("%d tokens are stored as hash but no fixed secret (TOKEN_HASH_SECRET / CRYPTO_SECRET / SESSION_SECRET) is set, these tokens cannot be verified", hashed))
+		}
+		return nil
+	}
+	migrated, err := MigrateTokenKeysToHash()
+	if err != nil {
+		return fmt.Errorf("failed to migrate token keys to hash: %w", err)
+	}
+	if migrated > 0 {
+		common.SysLog(fmt.Sprintf("migrated %d token keys to hash storage", migrated))
+	}
+	return nil
+}
+
 // migrateSubscriptionPlanPriceAmount migrates price_amount column from float/double to decimal(10,6)
 // This is safe to run multiple times - it checks the column type first
 func migrateSubscriptionPlanPriceAmount() {
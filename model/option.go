@@ -12,6 +12,8 @@ import (
 	"github.com/QuantumNous/new-api/setting/performance_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"gorm.io/gorm"
 )
 
 type Option struct {
@@ -19,6 +21,42 @@ type Option struct {
 	Value string `json:"value"`
 }
 
+// IsSecretOptionKey 判断配置项是否为密钥类配置，这类配置不会通过 GET /api/option 返回
+func IsSecretOptionKey(key string) bool {
+	return strings.HasSuffix(key, "Token") ||
+		strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "api_key")
+}
+
+// BeforeSave 密钥类配置项加密后写入数据库
+func (option *Option) BeforeSave(tx *gorm.DB) error {
+	if !IsSecretOptionKey(option.Key) {
+		return nil
+	}
+	value, err := encryptSecret(option.Value)
+	if err != nil {
+		return err
+	}
+	option.Value = value
+	return nil
+}
+
+// AfterFind 解密密钥类配置项。解密失败时只记录日志，不影响读取其他配置项
+func (option *Option) AfterFind(tx *gorm.DB) error {
+	if !IsSecretOptionKey(option.Key) {
+		return nil
+	}
+	value, err := decryptSecret(option.Value)
+	if err != nil {
+		common.SysError("failed to decrypt option " + option.Key + ": " + err.Error())
+		return nil
+	}
+	option.Value = value
+	return nil
+}
+
 func AllOption() ([]*Option, error) {
 	var options []*Option
 	var err error
@@ -183,19 +221,45 @@ func SyncOptions(frequency int) {
 }
 
 func UpdateOption(key string, value string) error {
+	return UpdateOptionBy(key, value, OptionActor{Source: OptionSourceSystem})
+}
+
+// UpdateOptionBy 修改配置项并记录修改人，值有变化时保存一条修改记录
+func UpdateOptionBy(key string, value string, actor OptionActor) error {
+	return updateOption(key, value, actor, 0)
+}
+
+func updateOption(key string, value string, actor OptionActor, rollbackOf int) error {
+	common.OptionMapRWMutex.RLock()
+	previous := common.OptionMap[key]
+	common.OptionMapRWMutex.RUnlock()
 	// Save to database first
-	option := Option{
-		Key: key,
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		option := Option{
+			Key: key,
+		}
+		// https://gorm.io/docs/update.html#Save-All-Fields
+		if err := tx.FirstOrCreate(&option, Option{Key: key}).Error; err != nil {
+			return err
+		}
+		option.Value = value
+		// Save is a combination function.
+		// If save value does not contain primary key, it will execute Create,
+		// otherwise it will execute Update (with all fields).
+		if err := tx.Save(&option).Error; err != nil {
+			return err
+		}
+		return recordOptionRevision(tx, key, previous, value, actor, rollbackOf)
+	})
+	if err != nil {
+		return err
 	}
-	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
-	option.Value = value
-	// Save is a combination function.
-	// If save value does not contain primary key, it will execute Create,
-	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	publishCacheEvent(CacheEventOption, key)
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 修改配置项的来源
+const (
+	OptionSourceSystem   = "system"   // 系统内部写入，例如初始化与迁移
+	OptionSourceAdmin    = "admin"    // 管理员在设置页修改
+	OptionSourceImport   = "import"   // 导入配置快照
+	OptionSourceRollback = "rollback" // 回滚到历史版本
+)
+
+// OptionRevision 配置项的修改记录，保存修改前后的值与修改人，用于查看历史与回滚。
+// 值没有变化的写入不记录
+type OptionRevision struct {
+	Id            int    `json:"id"`
+	Key           string `json:"key" gorm:"type:varchar(255);index"`
+	Value         string `json:"value" gorm:"type:text"`
+	PreviousValue string `json:"previous_value" gorm:"type:text"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Username      string `json:"username" gorm:"type:varchar(64)"`
+	Source        string `json:"source" gorm:"type:varchar(32)"`
+	RollbackOf    int    `json:"rollback_of,omitempty"` // 回滚时对应的修改记录 ID
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// OptionActor 修改配置项的操作人
+type OptionActor struct {
+	UserId   int
+	Username string
+	Source   string
+}
+
+// OptionRevisionDetail 带结构化差异的修改记录，JSON 对象形式的配置项按顶层键列出变化
+type OptionRevisionDetail struct {
+	OptionRevision
+	Diff []ConfigFieldChange `json:"diff"`
+}
+
+// Detail 计算修改前后的差异，密钥类配置项不返回具体值
+func (r *OptionRevision) Detail() OptionRevisionDetail {
+	detail := OptionRevisionDetail{OptionRevision: *r}
+	if IsSecretOptionKey(r.Key) {
+		detail.Value = configMaskedValue
+		detail.PreviousValue = configMaskedValue
+		detail.Diff = []ConfigFieldChange{{Field: "value", Old: configMaskedValue, New: configMaskedValue}}
+		return detail
+	}
+	detail.Diff = diffOptionValue(r.PreviousValue, r.Value)
+	return detail
+}
+
+// BeforeSave 密钥类配置项的修改记录与配置项一样加密保存
+func (r *OptionRevision) BeforeSave(tx *gorm.DB) error {
+	if !IsSecretOptionKey(r.Key) {
+		return nil
+	}
+	var err error
+	if r.Value, err = encryptSecret(r.Value); err != nil {
+		return err
+	}
+	r.PreviousValue, err = encryptSecret(r.PreviousValue)
+	return err
+}
+
+// AfterFind 解密密钥类配置项的修改记录，解密失败时只记录日志
+func (r *OptionRevision) AfterFind(tx *gorm.DB) error {
+	if !IsSecretOptionKey(r.Key) {
+		return nil
+	}
+	for _, field := range []*string{&r.Value, &r.PreviousValue} {
+		value, err := decryptSecret(*field)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to decrypt option revision #%d: %s", r.Id, err.Error()))
+			return nil
+		}
+		*field = value
+	}
+	return nil
+}
+
+func recordOptionRevision(tx *gorm.DB, key string, previous string, value string, actor OptionActor, rollbackOf int) error {
+	if previous == value {
+		return nil
+	}
+	source := actor.Source
+	if source == "" {
+		source = OptionSourceSystem
+	}
+	return tx.Create(&OptionRevision{
+		Key:           key,
+		Value:         value,
+		PreviousValue: previous,
+		UserId:        actor.UserId,
+		Username:      actor.Username,
+		Source:        source,
+		RollbackOf:    rollbackOf,
+		CreatedAt:     common.GetTimestamp(),
+	}).Error
+}
+
+// GetOptionRevisions 按时间倒序返回修改记录，key 为空时返回全部配置项的记录
+func GetOptionRevisions(key string, startIdx int, num int) ([]*OptionRevision, int64, error) {
+	var revisions []*OptionRevision
+	var total int64
+	query := DB.Model(&OptionRevision{})
+	if key != "" {
+		query = query.Where(&OptionRevision{Key: key})
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&revisions).Error
+	return revisions, total, err
+}
+
+// RollbackOption 将配置项恢复为修改记录中的值，previous 为 true 时恢复为该次修改之前的值。
+// 回滚前按修改配置相同的规则校验，回滚本身也会记录一次修改
+func RollbackOption(revisionId int, previous bool, actor OptionActor) (*OptionRevision, error) {
+	var revision OptionRevision
+	if err := DB.First(&revision, "id = ?", revisionId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("修改记录不存在")
+		}
+		return nil, err
+	}
+	value := revision.Value
+	if previous {
+		value = revision.PreviousValue
+	}
+	// 回滚到的值可能已不满足当前配置，例如依赖的 Client Id 已被清空
+	if err := ValidateOptionValue(revision.Key, value, nil); err != nil {
+		return nil, err
+	}
+	actor.Source = OptionSourceRollback
+	if err := updateOption(revision.Key, value, actor, revision.Id); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
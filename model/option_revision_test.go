@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionRevisionRollback(t *testing.T) {
+	require.NoError(t, DB.AutoMigrate(&Option{}, &OptionRevision{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM option_revisions")
+	})
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"TestRatio": `{"a":1,"b":2}`}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	admin := OptionActor{UserId: 1, Username: "root", Source: OptionSourceAdmin}
+	require.NoError(t, UpdateOptionBy("TestRatio", `{"a":1,"b":20}`, admin))
+	// 值没有变化时不记录
+	require.NoError(t, UpdateOptionBy("TestRatio", `{"a":1,"b":20}`, admin))
+
+	revisions, total, err := GetOptionRevisions("TestRatio", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	first := revisions[0]
+	require.Equal(t, `{"a":1,"b":2}`, first.PreviousValue)
+	require.Equal(t, "root", first.Username)
+	require.Equal(t, []ConfigFieldChange{{Field: "b", Old: float64(2), New: float64(20)}}, first.Detail().Diff)
+
+	// 回滚到修改之前的值，回滚本身也记录一次修改
+	_, err = RollbackOption(first.Id, true, admin)
+	require.NoError(t, err)
+	common.OptionMapRWMutex.RLock()
+	require.Equal(t, `{"a":1,"b":2}`, common.OptionMap["TestRatio"])
+	common.OptionMapRWMutex.RUnlock()
+	var option Option
+	require.NoError(t, DB.First(&option, "key = ?", "TestRatio").Error)
+	require.Equal(t, `{"a":1,"b":2}`, option.Value)
+
+	revisions, total, err = GetOptionRevisions("", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	require.Equal(t, OptionSourceRollback, revisions[0].Source)
+	require.Equal(t, first.Id, revisions[0].RollbackOf)
+
+	_, err = RollbackOption(9999, false, admin)
+	require.Error(t, err)
+}
+
+func TestOptionRevisionRollbackValidates(t *testing.T) {
+	require.NoError(t, DB.AutoMigrate(&Option{}, &OptionRevision{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM option_revisions")
+	})
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{"GitHubOAuthEnabled": "false", "GitHubClientId": ""}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	// 启用 GitHub OAuth 之后 Client Id 被清空，不能再回滚为启用
+	revision := &OptionRevision{Key: "GitHubOAuthEnabled", Value: "true", PreviousValue: "false", Source: OptionSourceAdmin}
+	require.NoError(t, DB.Create(revision).Error)
+	_, err := RollbackOption(revision.Id, false, OptionActor{UserId: 1, Username: "root"})
+	require.ErrorContains(t, err, "GitHub Client Id")
+
+	common.OptionMapRWMutex.RLock()
+	require.Equal(t, "false", common.OptionMap["GitHubOAuthEnabled"])
+	common.OptionMapRWMutex.RUnlock()
+	var total int64
+	require.NoError(t, DB.Model(&OptionRevision{}).Count(&total).Error)
+	require.Equal(t, int64(1), total)
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// currentOptionValue 返回配置项的当前值
+func currentOptionValue(key string) string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	return common.OptionMap[key]
+}
+
+// ValidateOptionValue 校验配置项的值，修改配置、导入配置快照与回滚修改记录共用。
+// 启用登录方式等开关依赖其他配置项，lookup 返回这些配置项的值，为 nil 时使用当前值
+func ValidateOptionValue(key string, value string, lookup func(key string) string) error {
+	if lookup == nil {
+		lookup = currentOptionValue
+	}
+	enabled := value == "true"
+	switch key {
+	case "GitHubOAuthEnabled":
+		if enabled && lookup("GitHubClientId") == "" {
+			return errors.New("无法启用 GitHub OAuth，请先填入 GitHub Client Id 以及 GitHub Client Secret！")
+		}
+	case "discord.enabled":
+		if enabled && lookup("discord.client_id") == "" {
+			return errors.New("无法启用 Discord OAuth，请先填入 Discord Client Id 以及 Discord Client Secret！")
+		}
+	case "oidc.enabled":
+		if enabled && lookup("oidc.client_id") == "" {
+			return errors.New("无法启用 OIDC 登录，请先填入 OIDC Client Id 以及 OIDC Client Secret！")
+		}
+	case "LinuxDOOAuthEnabled":
+		if enabled && lookup("LinuxDOClientId") == "" {
+			return errors.New("无法启用 LinuxDO OAuth，请先填入 LinuxDO Client Id 以及 LinuxDO Client Secret！")
+		}
+	case "EmailDomainRestrictionEnabled":
+		if enabled && strings.Trim(lookup("EmailDomainWhitelist"), ", ") == "" {
+			return errors.New("无法启用邮箱域名限制，请先填入限制的邮箱域名！")
+		}
+	case "WeChatAuthEnabled":
+		if enabled && lookup("WeChatServerAddress") == "" {
+			return errors.New("无法启用微信登录，请先填入微信登录相关配置信息！")
+		}
+	case "TurnstileCheckEnabled":
+		if enabled && lookup("TurnstileSiteKey") == "" {
+			return errors.New("无法启用 Turnstile 校验，请先填入 Turnstile 校验相关配置信息！")
+		}
+	case "TelegramOAuthEnabled":
+		if enabled && lookup("TelegramBotToken") == "" {
+			return errors.New("无法启用 Telegram OAuth，请先填入 Telegram Bot Token！")
+		}
+	case "GroupRatio":
+		return ratio_setting.CheckGroupRatio(value)
+	case "ImageRatio":
+		return validateRatioMap(value, "图片倍率设置失败: ")
+	case "AudioRatio":
+		return validateRatioMap(value, "音频倍率设置失败: ")
+	case "AudioCompletionRatio":
+		return validateRatioMap(value, "音频补全倍率设置失败: ")
+	case "CreateCacheRatio":
+		return validateRatioMap(value, "缓存创建倍率设置失败: ")
+	case "ModelRequestRateLimitGroup":
+		return setting.CheckModelRequestRateLimitGroup(value)
+	case "AutomaticDisableStatusCodes", "AutomaticRetryStatusCodes":
+		_, err := operation_setting.ParseHTTPStatusCodeRanges(value)
+		return err
+	case "console_setting.api_info":
+		return console_setting.ValidateConsoleSettings(value, "ApiInfo")
+	case "console_setting.announcements":
+		return console_setting.ValidateConsoleSettings(value, "Announcements")
+	case "console_setting.faq":
+		return console_setting.ValidateConsoleSettings(value, "FAQ")
+	case "console_setting.uptime_kuma_groups":
+		return console_setting.ValidateConsoleSettings(value, "UptimeKumaGroups")
+	case "usage_rate_limit_setting.groups", "usage_rate_limit_setting.models":
+		return operation_setting.ValidateUsageRateLimitMap(value)
+	case "channel_selection_setting.group_strategies", "channel_selection_setting.tag_strategies":
+		return operation_setting.ValidateChannelSelectionStrategies(value)
+	case "model_fallback_setting.chains":
+		return operation_setting.ValidateModelFallbackChains(value)
+	case "guardrail_setting.policies":
+		return operation_setting.ValidateGuardrailPolicies(value)
+	case "pii_redaction_setting.pii_types":
+		return operation_setting.ValidatePIIRedactionTypes(value)
+	case "batch_setting.group_discounts":
+		return operation_setting.ValidateBatchGroupDiscounts(value)
+	case "batch_setting.concurrency", "batch_setting.max_running_batches", "batch_setting.max_file_size_mb":
+		return operation_setting.ValidateBatchPositiveInt(key, value)
+	case "batch_setting.max_user_files", "batch_setting.max_user_storage_mb", "batch_setting.file_retention_hours":
+		return operation_setting.ValidateBatchNonNegativeInt(key, value)
+	case "response_cache_setting.mode":
+		return operation_setting.ValidateResponseCacheMode(value)
+	case "response_cache_setting.billing_ratio":
+		return operation_setting.ValidateResponseCacheBillingRatio(value)
+	case "budget_setting.notify_percents":
+		return operation_setting.ValidateBudgetNotifyPercents(value)
+	case "AuditWebhookUrl":
+		if value != "" {
+			u, err := url.ParseRequestURI(value)
+			if err != nil || u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return errors.New("无效的审计 Webhook 地址（仅支持 http/https）")
+			}
+		}
+	}
+	return nil
+}
+
+func validateRatioMap(value string, prefix string) error {
+	ratios := make(map[string]float64)
+	if err := common.Unmarshal([]byte(value), &ratios); err != nil {
+		return errors.New(prefix + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+const (
+	OrgStatusEnabled  = 1
+	OrgStatusDisabled = 2
+)
+
+const (
+	orgMemberCacheNamespace = "new-api:org_member:v1"
+	orgMemberCacheTTL       = time.Minute
+)
+
+var (
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrOrgMemberNotFound  = errors.New("organization member not found")
+	ErrOrgQuotaNotEnough  = errors.New("organization quota not enough")
+	ErrOrgOwnerImmutable  = errors.New("organization owner cannot be changed or removed")
+	ErrOrgMemberDuplicate = errors.New("user is already a member of this organization")
+)
+
+// Organization 组织（团队），成员共享组织钱包额度，组织令牌的消耗从组织钱包扣除
+type Organization struct {
+	Id           int            `json:"id"`
+	Name         string         `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId      int            `json:"owner_id" gorm:"index"`
+	Status       int            `json:"status" gorm:"default:1"`
+	Quota        int            `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota    int            `json:"used_quota" gorm:"type:int;default:0"`
+	RequestCount int            `json:"request_count" gorm:"type:int;default:0"`
+	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
+	UpdatedTime  int64          `json:"updated_time" gorm:"bigint"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OrganizationMember 组织成员及其角色
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Role        string `json:"role" gorm:"type:varchar(16)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username,omitempty" gorm:"-"`
+}
+
+// UserOrganization 用户所在的组织及其角色
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// OrgRoleLevel 角色等级，数值越大权限越高，非法角色返回 0
+func OrgRoleLevel(role string) int {
+	switch role {
+	case OrgRoleOwner:
+		return 3
+	case OrgRoleAdmin:
+		return 2
+	case OrgRoleMember:
+		return 1
+	}
+	return 0
+}
+
+func IsValidOrgMemberRole(role string) bool {
+	// owner 仅在创建组织时授予，不能通过成员管理指定
+	return role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+var (
+	orgMemberCacheOnce sync.Once
+	orgMemberCache     *cachex.HybridCache[string]
+)
+
+func getOrgMemberCache() *cachex.HybridCache[string] {
+	orgMemberCacheOnce.Do(func() {
+		orgMemberCache = cachex.NewHybridCache[string](cachex.HybridCacheConfig[string]{
+			Namespace: cachex.Namespace(orgMemberCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.StringCodec{},
+			Memory: func() *hot.HotCache[string, string] {
+				return hot.NewHotCache[string, string](hot.LRU, 10000).
+					WithTTL(orgMemberCacheTTL).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return orgMemberCache
+}
+
+func orgMemberCacheKey(orgId int, userId int) string {
+	return fmt.Sprintf("%d:%d", orgId, userId)
+}
+
+func invalidateOrgMemberCache(orgId int, userId int) {
+	_, _ = getOrgMemberCache().DeleteMany([]string{orgMemberCacheKey(orgId, userId)})
+}
+
+func invalidateOrgCache(orgId int) {
+	_, _ = getOrgMemberCache().DeleteByPrefix(fmt.Sprintf("%d:", orgId))
+}
+
+// CreateOrganization 创建组织，创建者自动成为 owner
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("organization name is empty")
+	}
+	now := common.GetTimestamp()
+	org := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Status:      OrgStatusEnabled,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        OrgRoleOwner,
+			CreatedTime: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var org Organization
+	err := DB.First(&org, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetUserOrganizations 返回用户加入的所有组织
+func GetUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var orgs []*UserOrganization
+	err := DB.Table("organizations").
+		Select("organizations.*, organization_members.role").
+		Joins("JOIN organization_members ON organization_members.org_id = organizations.id").
+		Where("organization_members.user_id = ? AND organizations.deleted_at IS NULL", userId).
+		Order("organizations.id desc").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// GetAllOrganizations 管理员查看全部组织
+func GetAllOrganizations(startIdx int, num int) ([]*Organization, int64, error) {
+	var orgs []*Organization
+	var total int64
+	if err := DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func UpdateOrganizationName(id int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("organization name is empty")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":         name,
+		"updated_time": common.GetTimestamp(),
+	}).Error
+}
+
+func UpdateOrganizationStatus(id int, status int) error {
+	if status != OrgStatusEnabled && status != OrgStatusDisabled {
+		return fmt.Errorf("invalid organization status: %d", status)
+	}
+	err := DB.Model(&Organization{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       status,
+		"updated_time": common.GetTimestamp(),
+	}).Error
+	invalidateOrgCache(id)
+	return err
+}
+
+// DeleteOrganization 删除组织及其成员关系，组织令牌随之失效
+func DeleteOrganization(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Organization{}, id).Error
+	})
+	invalidateOrgCache(id)
+	return err
+}
+
+func GetOrgMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetOrgMembers 返回组织全部成员（附带用户名）
+func GetOrgMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Table("organization_members").
+		Select("organization_members.*, users.username").
+		Joins("LEFT JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.org_id = ?", orgId).
+		Order("organization_members.id asc").
+		Find(&members).Error
+	return members, err
+}
+
+func AddOrgMember(orgId int, userId int, role string) (*OrganizationMember, error) {
+	if !IsValidOrgMemberRole(role) {
+		return nil, fmt.Errorf("invalid organization role: %s", role)
+	}
+	if _, err := GetOrgMember(orgId, userId); err == nil {
+		return nil, ErrOrgMemberDuplicate
+	} else if !errors.Is(err, ErrOrgMemberNotFound) {
+		return nil, err
+	}
+	member := &OrganizationMember{
+		OrgId:       orgId,
+		UserId:      userId,
+		Role:        role,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if err := DB.Create(member).Error; err != nil {
+		return nil, err
+	}
+	invalidateOrgMemberCache(orgId, userId)
+	return member, nil
+}
+
+func UpdateOrgMemberRole(orgId int, userId int, role string) error {
+	if !IsValidOrgMemberRole(role) {
+		return fmt.Errorf("invalid organization role: %s", role)
+	}
+	member, err := GetOrgMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrgRoleOwner {
+		return ErrOrgOwnerImmutable
+	}
+	err = DB.Model(&OrganizationMember{}).Where("id = ?", member.Id).Update("role", role).Error
+	invalidateOrgMemberCache(orgId, userId)
+	return err
+}
+
+// RemoveOrgMember 移除成员，该成员创建的组织令牌随之失效
+func RemoveOrgMember(orgId int, userId int) error {
+	member, err := GetOrgMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrgRoleOwner {
+		return ErrOrgOwnerImmutable
+	}
+	err = DB.Delete(&OrganizationMember{}, member.Id).Error
+	invalidateOrgMemberCache(orgId, userId)
+	return err
+}
+
+// GetOrgMemberRoleWithCache 返回用户在已启用组织中的角色，非成员或组织不可用时返回空字符串
+func GetOrgMemberRoleWithCache(orgId int, userId int) (string, error) {
+	key := orgMemberCacheKey(orgId, userId)
+	if role, found, err := getOrgMemberCache().Get(key); err == nil && found {
+		return role, nil
+	}
+	role := ""
+	org, err := GetOrganizationById(orgId)
+	if err != nil && !errors.Is(err, ErrOrgNotFound) {
+		return "", err
+	}
+	if org != nil && org.Status == OrgStatusEnabled {
+		member, err := GetOrgMember(orgId, userId)
+		if err != nil && !errors.Is(err, ErrOrgMemberNotFound) {
+			return "", err
+		}
+		if member != nil {
+			role = member.Role
+		}
+	}
+	if err := getOrgMemberCache().SetWithTTL(key, role, orgMemberCacheTTL); err != nil {
+		common.SysLog("failed to set organization member cache: " + err.Error())
+	}
+	return role, nil
+}
+
+// CheckOrgTokenAccess 校验组织令牌的创建者仍是该组织成员且组织可用
+func CheckOrgTokenAccess(orgId int, userId int) error {
+	role, err := GetOrgMemberRoleWithCache(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return errors.New("组织不可用或令牌创建者已不是组织成员")
+	}
+	return nil
+}
+
+func GetOrganizationQuota(orgId int) (int, error) {
+	var quota int
+	err := DB.Model(&Organization{}).Where("id = ?", orgId).Select("quota").Find(&quota).Error
+	return quota, err
+}
+
+// PreConsumeOrganizationQuota 预扣组织额度，余额不足时返回 ErrOrgQuotaNotEnough
+func PreConsumeOrganizationQuota(orgId int, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	result := DB.Model(&Organization{}).Where("id = ? AND quota >= ?", orgId, quota).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota - ?", quota),
+		"used_quota": gorm.Expr("used_quota + ?", quota),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrgQuotaNotEnough
+	}
+	return nil
+}
+
+// AdjustOrganizationConsumedQuota 按实际消耗调整组织额度，delta > 0 表示补扣，delta < 0 表示退还
+func AdjustOrganizationConsumedQuota(orgId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota - ?", delta),
+		"used_quota": gorm.Expr("used_quota + ?", delta),
+	}).Error
+}
+
+// IncreaseOrganizationRequestCount 统计组织请求次数
+func IncreaseOrganizationRequestCount(orgId int) {
+	gopool.Go(func() {
+		if err := DB.Model(&Organization{}).Where("id = ?", orgId).
+			Update("request_count", gorm.Expr("request_count + ?", 1)).Error; err != nil {
+			common.SysLog(fmt.Sprintf("failed to increase organization %d request count: %s", orgId, err.Error()))
+		}
+	})
+}
+
+// AdjustOrganizationQuota 管理员直接调整组织余额（可为负数表示扣减）
+func AdjustOrganizationQuota(orgId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	result := DB.Model(&Organization{}).Where("id = ? AND quota + ? >= 0", orgId, delta).
+		Update("quota", gorm.Expr("quota + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrgQuotaNotEnough
+	}
+	return nil
+}
+
+// TransferUserQuotaToOrganization 从个人钱包向组织钱包划转额度
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("transfer quota must be greater than 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		result = tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrgNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+				common.SysLog("failed to decrease user quota cache: " + err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+// GetOrgTokens 返回组织令牌，userId > 0 时仅返回该成员创建的令牌
+func GetOrgTokens(orgId int, userId int, startIdx int, num int) ([]*Token, int64, error) {
+	var tokens []*Token
+	var total int64
+	tx := DB.Model(&Token{}).Where("org_id = ?", orgId)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, total, err
+}
+
+// DeleteOrgToken 组织管理员删除组织内任意成员的令牌
+func DeleteOrgToken(orgId int, tokenId int) error {
+	var token Token
+	if err := DB.Where("id = ? AND org_id = ?", tokenId, orgId).First(&token).Error; err != nil {
+		return err
+	}
+	return token.Delete()
+}
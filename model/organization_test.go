@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationMembership(t *testing.T) {
+	truncateTables(t)
+
+	org, err := CreateOrganization("team", 1)
+	require.NoError(t, err)
+
+	role, err := GetOrgMemberRoleWithCache(org.Id, 1)
+	require.NoError(t, err)
+	require.Equal(t, OrgRoleOwner, role)
+	require.Error(t, CheckOrgTokenAccess(org.Id, 2))
+
+	_, err = AddOrgMember(org.Id, 2, OrgRoleMember)
+	require.NoError(t, err)
+	_, err = AddOrgMember(org.Id, 2, OrgRoleAdmin)
+	require.ErrorIs(t, err, ErrOrgMemberDuplicate)
+	require.NoError(t, CheckOrgTokenAccess(org.Id, 2))
+
+	require.ErrorIs(t, UpdateOrgMemberRole(org.Id, 1, OrgRoleMember), ErrOrgOwnerImmutable)
+	require.ErrorIs(t, RemoveOrgMember(org.Id, 1), ErrOrgOwnerImmutable)
+
+	require.NoError(t, RemoveOrgMember(org.Id, 2))
+	require.Error(t, CheckOrgTokenAccess(org.Id, 2))
+
+	require.NoError(t, UpdateOrganizationStatus(org.Id, OrgStatusDisabled))
+	require.Error(t, CheckOrgTokenAccess(org.Id, 1))
+}
+
+func TestOrganizationQuota(t *testing.T) {
+	truncateTables(t)
+
+	user := &User{Username: "org_owner", Quota: 1000}
+	require.NoError(t, DB.Create(user).Error)
+	org, err := CreateOrganization("team", user.Id)
+	require.NoError(t, err)
+
+	require.Error(t, TransferUserQuotaToOrganization(user.Id, org.Id, 2000))
+	require.NoError(t, TransferUserQuotaToOrganization(user.Id, org.Id, 600))
+
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, 500))
+	require.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 500), ErrOrgQuotaNotEnough)
+	require.NoError(t, AdjustOrganizationConsumedQuota(org.Id, -200))
+
+	org, err = GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, 300, org.Quota)
+	require.Equal(t, 300, org.UsedQuota)
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, 400, quota)
+}
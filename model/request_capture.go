@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+var ErrRequestCaptureNotFound = errors.New("request capture not found")
+
+// RequestCapture 请求抓取索引，完整内容以 JSON 存放在磁盘缓存目录中
+type RequestCapture struct {
+	Id         int    `json:"id"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id" gorm:"index"`
+	ChannelId  int    `json:"channel_id" gorm:"index"`
+	ModelName  string `json:"model_name" gorm:"type:varchar(255);default:''"`
+	Path       string `json:"path" gorm:"type:varchar(255);default:''"`
+	StatusCode int    `json:"status_code"`
+	Failed     bool   `json:"failed"`
+	FilePath   string `json:"-" gorm:"type:varchar(512)"`
+	Size       int64  `json:"size"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt  int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (capture *RequestCapture) Insert() error {
+	return DB.Create(capture).Error
+}
+
+// GetRequestCaptureByRequestId 返回该请求最近一次的抓取记录
+func GetRequestCaptureByRequestId(requestId string) (*RequestCapture, error) {
+	var capture RequestCapture
+	err := DB.Where("request_id = ? AND expires_at > ?", requestId, common.GetTimestamp()).
+		Order("id desc").First(&capture).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRequestCaptureNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
+
+func GetRequestCaptures(tokenId int, channelId int, failedOnly bool, startIdx int, num int) ([]*RequestCapture, int64, error) {
+	var captures []*RequestCapture
+	var total int64
+	tx := DB.Model(&RequestCapture{}).Where("expires_at > ?", common.GetTimestamp())
+	if tokenId > 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	if channelId > 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if failedOnly {
+		tx = tx.Where("failed = ?", true)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Order("id desc").Limit(num).Offset(startIdx).Find(&captures).Error
+	return captures, total, err
+}
+
+func DeleteRequestCaptureById(id int) error {
+	return DB.Delete(&RequestCapture{}, id).Error
+}
+
+// GetExpiredRequestCaptures 返回已过期的抓取记录，供清理任务删除文件与索引
+func GetExpiredRequestCaptures(limit int) ([]*RequestCapture, error) {
+	var captures []*RequestCapture
+	err := DB.Where("expires_at <= ?", common.GetTimestamp()).Order("id asc").Limit(limit).Find(&captures).Error
+	return captures, err
+}
+
+// SetTokenCaptureUntil 设置令牌的抓取窗口截止时间，0 表示关闭
+func SetTokenCaptureUntil(tokenId int, until int64) error {
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return err
+	}
+	if err := DB.Model(&Token{}).Where("id = ?", tokenId).Update("capture_until", until).Error; err != nil {
+		return err
+	}
+	token.CaptureUntil = until
+	if common.RedisEnabled {
+		if err := cacheSetToken(*token); err != nil {
+			common.SysLog("failed to update token cache: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// SetChannelCaptureUntil 设置渠道的抓取窗口截止时间，0 表示关闭
+func SetChannelCaptureUntil(channelId int, until int64) error {
+	result := DB.Model(&Channel{}).Where("id = ?", channelId).Update("capture_until", until)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	CacheUpdateChannelCaptureUntil(channelId, until)
+	publishCacheEvent(CacheEventChannel, strconv.Itoa(channelId))
+	return nil
+}
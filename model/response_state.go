@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+var ErrResponseStateNotFound = errors.New("response not found")
+
+// ResponseState 网关保存的 Responses API 单轮会话：本轮输入项与上游返回的完整响应
+type ResponseState struct {
+	Id                 int             `json:"id"`
+	ResponseId         string          `json:"response_id" gorm:"type:varchar(191);index"`
+	UserId             int             `json:"user_id" gorm:"index"`
+	TokenId            int             `json:"token_id"`
+	ChannelId          int             `json:"channel_id"`
+	ModelName          string          `json:"model_name" gorm:"type:varchar(255);default:''"`
+	PreviousResponseId string          `json:"previous_response_id" gorm:"type:varchar(191);default:''"`
+	InputItems         json.RawMessage `json:"input_items" gorm:"type:json"`
+	Response           json.RawMessage `json:"response" gorm:"type:json"`
+	CreatedAt          int64           `json:"created_at" gorm:"bigint"`
+	ExpiresAt          int64           `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (state *ResponseState) Insert() error {
+	return DB.Create(state).Error
+}
+
+// GetResponseState 返回用户最近一次保存的同 id 响应
+func GetResponseState(userId int, responseId string) (*ResponseState, error) {
+	var state ResponseState
+	err := DB.Where("response_id = ? AND user_id = ? AND expires_at > ?", responseId, userId, common.GetTimestamp()).
+		Order("id desc").First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrResponseStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func DeleteResponseState(userId int, responseId string) error {
+	result := DB.Where("response_id = ? AND user_id = ?", responseId, userId).Delete(&ResponseState{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrResponseStateNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredResponseStates 删除一批已过期的响应，返回删除条数
+func DeleteExpiredResponseStates(limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&ResponseState{}).Where("expires_at <= ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Where("id IN ?", ids).Delete(&ResponseState{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,304 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/envelope"
+
+	"gorm.io/gorm"
+)
+
+const secretEncryptionBatchSize = 200
+
+// 加密存储的敏感数据：渠道 Key、自定义 OAuth 提供商的 Client Secret，
+// 以及名称符合 IsSecretOptionKey 的配置项（支付密钥、OAuth Client Secret 等）及其修改记录
+var secretKeyring atomic.Pointer[envelope.Keyring]
+
+var errSecretKeyringMissing = errors.New("数据已加密，但没有配置主密钥 ENCRYPTION_MASTER_KEYS 或 ENCRYPTION_MASTER_KEY_FILE")
+
+// InitSecretEncryption 加载主密钥。没有配置主密钥时敏感数据以明文存储
+func InitSecretEncryption() error {
+	var ring *envelope.Keyring
+	var err error
+	switch {
+	case constant.EncryptionMasterKeyFile != "":
+		ring, err = envelope.LoadKeyringFile(constant.EncryptionMasterKeyFile)
+	case constant.EncryptionMasterKeys != "":
+		ring, err = envelope.ParseKeyring(constant.EncryptionMasterKeys)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load encryption master keys: %w", err)
+	}
+	secretKeyring.Store(ring)
+	common.SysLog(fmt.Sprintf("secret encryption enabled, master key versions: %v, current: %d", ring.Versions(), ring.CurrentVersion()))
+	return nil
+}
+
+// SecretEncryptionEnabled 是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	return secretKeyring.Load() != nil
+}
+
+// IsEncryptedSecret 值是否为加密后的密文
+func IsEncryptedSecret(value string) bool {
+	return envelope.IsEncrypted(value)
+}
+
+// encryptSecret 使用当前版本的主密钥加密。没有配置主密钥、值为空或已经加密时原样返回
+func encryptSecret(value string) (string, error) {
+	ring := secretKeyring.Load()
+	if ring == nil || value == "" || envelope.IsEncrypted(value) {
+		return value, nil
+	}
+	return ring.Encrypt(value)
+}
+
+// decryptSecret 解密 encryptSecret 的结果，尚未迁移的明文原样返回
+func decryptSecret(value string) (string, error) {
+	if !envelope.IsEncrypted(value) {
+		return value, nil
+	}
+	ring := secretKeyring.Load()
+	if ring == nil {
+		return "", errSecretKeyringMissing
+	}
+	return ring.Decrypt(value)
+}
+
+// reencryptSecret 加密明文，rewrap 为 true 时还用当前版本的主密钥重新包装旧版本加密的值，
+// 不需要修改时 changed 为 false。重新包装只替换数据密钥的包装，不会解密数据本身
+func reencryptSecret(value string, rewrap bool) (result string, changed bool, err error) {
+	ring := secretKeyring.Load()
+	if ring == nil || value == "" {
+		return value, false, nil
+	}
+	if !envelope.IsEncrypted(value) {
+		result, err = ring.Encrypt(value)
+		return result, err == nil, err
+	}
+	if !rewrap || !ring.NeedsRewrap(value) {
+		return value, false, nil
+	}
+	result, err = ring.Rewrap(value)
+	return result, err == nil, err
+}
+
+// SecretReencryptResult 一次加密或重新包装的结果
+type SecretReencryptResult struct {
+	Updated int // 更新的值
+	Failed  int // 无法处理的值，通常是加密它的主密钥版本已经不在配置中
+}
+
+// ReencryptSecrets 加密仍为明文的敏感数据，rewrap 为 true 时还用当前版本的主密钥重新包装旧版本加密的数据。
+// 按条件更新，与并发的修改冲突时跳过该行（并发写入已经使用当前版本加密）。可重复执行
+func ReencryptSecrets(rewrap bool) (SecretReencryptResult, error) {
+	var result SecretReencryptResult
+	if !SecretEncryptionEnabled() {
+		return result, nil
+	}
+	// 跳过钩子，读写数据库中的原始值
+	db := DB.Session(&gorm.Session{SkipHooks: true})
+	steps := []func(*gorm.DB, bool, *SecretReencryptResult) error{
+		reencryptChannelKeys,
+		reencryptOAuthClientSecrets,
+		reencryptSecretOptions,
+		reencryptSecretOptionRevisions,
+	}
+	for _, step := range steps {
+		if err := step(db, rewrap, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// reencryptValue 计算新值，无法处理时记录日志并计入 Failed
+func (r *SecretReencryptResult) reencryptValue(value string, rewrap bool, name string) (string, bool) {
+	result, changed, err := reencryptSecret(value, rewrap)
+	if err != nil {
+		r.Failed++
+		common.SysError(fmt.Sprintf("failed to re-encrypt %s: %s", name, err.Error()))
+		return value, false
+	}
+	return result, changed
+}
+
+func reencryptChannelKeys(db *gorm.DB, rewrap bool, result *SecretReencryptResult) error {
+	lastId := 0
+	for {
+		var channels []*Channel
+		err := db.Select("id, "+commonKeyCol).Where("id > ?", lastId).Order("id").Limit(secretEncryptionBatchSize).Find(&channels).Error
+		if err != nil {
+			return err
+		}
+		for _, channel := range channels {
+			lastId = channel.Id
+			key, changed := result.reencryptValue(channel.Key, rewrap, fmt.Sprintf("key of channel #%d", channel.Id))
+			if !changed {
+				continue
+			}
+			res := db.Model(&Channel{}).Where("id = ? AND "+commonKeyCol+" = ?", channel.Id, channel.Key).Update("key", key)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Updated += int(res.RowsAffected)
+		}
+		if len(channels) < secretEncryptionBatchSize {
+			return nil
+		}
+	}
+}
+
+func reencryptOAuthClientSecrets(db *gorm.DB, rewrap bool, result *SecretReencryptResult) error {
+	var providers []*CustomOAuthProvider
+	if err := db.Select("id", "client_secret").Find(&providers).Error; err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		secret, changed := result.reencryptValue(provider.ClientSecret, rewrap, fmt.Sprintf("client secret of custom OAuth provider #%d", provider.Id))
+		if !changed {
+			continue
+		}
+		res := db.Model(&CustomOAuthProvider{}).Where("id = ? AND client_secret = ?", provider.Id, provider.ClientSecret).Update("client_secret", secret)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Updated += int(res.RowsAffected)
+	}
+	return nil
+}
+
+func reencryptSecretOptions(db *gorm.DB, rewrap bool, result *SecretReencryptResult) error {
+	var options []*Option
+	if err := db.Find(&options).Error; err != nil {
+		return err
+	}
+	for _, option := range options {
+		if !IsSecretOptionKey(option.Key) {
+			continue
+		}
+		value, changed := result.reencryptValue(option.Value, rewrap, "option "+option.Key)
+		if !changed {
+			continue
+		}
+		res := db.Model(&Option{}).Where(commonKeyCol+" = ? AND value = ?", option.Key, option.Value).Update("value", value)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Updated += int(res.RowsAffected)
+	}
+	return nil
+}
+
+func reencryptSecretOptionRevisions(db *gorm.DB, rewrap bool, result *SecretReencryptResult) error {
+	lastId := 0
+	for {
+		var revisions []*OptionRevision
+		err := db.Where("id > ?", lastId).Order("id").Limit(secretEncryptionBatchSize).Find(&revisions).Error
+		if err != nil {
+			return err
+		}
+		for _, revision := range revisions {
+			lastId = revision.Id
+			if !IsSecretOptionKey(revision.Key) {
+				continue
+			}
+			name := fmt.Sprintf("option revision #%d", revision.Id)
+			value, valueChanged := result.reencryptValue(revision.Value, rewrap, name)
+			previous, previousChanged := result.reencryptValue(revision.PreviousValue, rewrap, name)
+			if !valueChanged && !previousChanged {
+				continue
+			}
+			// 修改记录只追加不修改，不需要条件更新
+			err := db.Model(&OptionRevision{}).Where("id = ?", revision.Id).Updates(map[string]interface{}{
+				"value":          value,
+				"previous_value": previous,
+			}).Error
+			if err != nil {
+				return err
+			}
+			result.Updated++
+		}
+		if len(revisions) < secretEncryptionBatchSize {
+			return nil
+		}
+	}
+}
+
+// ReencryptTaskKeys 加密或重新包装已结束任务中保存的渠道 Key（Gemini、Vertex AI 视频任务下载结果时使用）。
+// 进行中的任务会在下次更新时按当前版本加密，这里只处理已结束的任务
+func ReencryptTaskKeys(rewrap bool) (SecretReencryptResult, error) {
+	var result SecretReencryptResult
+	if !SecretEncryptionEnabled() {
+		return result, nil
+	}
+	privateDataCol := "CAST(private_data AS TEXT)"
+	if common.UsingMySQL {
+		privateDataCol = "CAST(private_data AS CHAR)"
+	}
+	type taskRow struct {
+		ID          int64
+		UpdatedAt   int64
+		PrivateData string
+	}
+	var lastId int64
+	for {
+		var rows []taskRow
+		err := DB.Model(&Task{}).Select("id", "updated_at", "private_data").
+			Where("id > ?", lastId).
+			Where("status IN ?", []TaskStatus{TaskStatusSuccess, TaskStatusFailure}).
+			Where(privateDataCol+" LIKE ?", `%"key":%`).
+			Order("id").Limit(secretEncryptionBatchSize).Find(&rows).Error
+		if err != nil {
+			return result, err
+		}
+		for _, row := range rows {
+			lastId = row.ID
+			// 直接解析 JSON，不经过 TaskPrivateData.Scan 解密
+			var data TaskPrivateData
+			if err := common.Unmarshal([]byte(row.PrivateData), &data); err != nil {
+				continue
+			}
+			key, changed := result.reencryptValue(data.Key, rewrap, fmt.Sprintf("key of task #%d", row.ID))
+			if !changed {
+				continue
+			}
+			data.Key = key
+			res := DB.Model(&Task{}).Where("id = ? AND updated_at = ?", row.ID, row.UpdatedAt).UpdateColumn("private_data", data)
+			if res.Error != nil {
+				return result, res.Error
+			}
+			result.Updated += int(res.RowsAffected)
+		}
+		if len(rows) < secretEncryptionBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// migrateSecretEncryption 配置了主密钥时加密仍为明文存储的敏感数据。
+// 旧版本主密钥加密的数据由后台任务重新包装，不阻塞启动
+func migrateSecretEncryption() error {
+	if !SecretEncryptionEnabled() {
+		var encrypted int64
+		DB.Model(&Channel{}).Where(commonKeyCol+" LIKE ?", "envelope:%").Count(&encrypted)
+		if encrypted > 0 {
+			common.SysError(fmt.Sprintf("%d channel keys are encrypted but no master key (ENCRYPTION_MASTER_KEYS / ENCRYPTION_MASTER_KEY_FILE) is set, these channels cannot be used", encrypted))
+		}
+		return nil
+	}
+	result, err := ReencryptSecrets(false)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	if result.Updated > 0 {
+		common.SysLog(fmt.Sprintf("encrypted %d plaintext secrets", result.Updated))
+	}
+	return nil
+}
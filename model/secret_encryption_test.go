@@ -0,0 +1,154 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/envelope"
+
+	"github.com/stretchr/testify/require"
+)
+
+func useTestKeyring(t *testing.T, spec string) {
+	t.Helper()
+	ring, err := envelope.ParseKeyring(spec)
+	require.NoError(t, err)
+	secretKeyring.Store(ring)
+	t.Cleanup(func() { secretKeyring.Store(nil) })
+}
+
+func testMasterKey(version string, b byte) string {
+	return version + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func rawChannelKey(t *testing.T, id int) string {
+	t.Helper()
+	var key string
+	require.NoError(t, DB.Raw("SELECT "+commonKeyCol+" FROM channels WHERE id = ?", id).Scan(&key).Error)
+	return key
+}
+
+func TestChannelKeyEncryption(t *testing.T) {
+	initCol()
+	truncateTables(t)
+	// 启用加密前写入的明文
+	legacy := &Channel{Name: "legacy", Key: "sk-legacy"}
+	require.NoError(t, DB.Create(legacy).Error)
+	require.Equal(t, "sk-legacy", rawChannelKey(t, legacy.Id))
+
+	useTestKeyring(t, testMasterKey("1", 1))
+
+	channel := &Channel{Name: "multi", Key: "sk-a\nsk-b", ChannelInfo: ChannelInfo{IsMultiKey: true}}
+	require.NoError(t, DB.Create(channel).Error)
+	require.True(t, IsEncryptedSecret(rawChannelKey(t, channel.Id)))
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sk-a", "sk-b"}, loaded.GetKeys())
+	loaded.cacheKeys()
+	require.Nil(t, loaded.Keys, "decrypted keys must not be cached")
+
+	// 以 map 更新 key 时同样加密，只更新其他字段时保留原值
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", legacy.Id).Update("key", "sk-new").Error)
+	require.True(t, IsEncryptedSecret(rawChannelKey(t, legacy.Id)))
+	legacy, err = GetChannelById(legacy.Id, true)
+	require.NoError(t, err)
+	stored := legacy.Key
+	legacy.UpdateBalance(1)
+	require.Equal(t, stored, rawChannelKey(t, legacy.Id))
+	key, _, apiErr := legacy.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Equal(t, "sk-new", key)
+
+	// 编辑渠道时以渠道本身更新
+	legacy.Key = "sk-edited"
+	require.NoError(t, DB.Model(legacy).Updates(legacy).Error)
+	require.True(t, IsEncryptedSecret(rawChannelKey(t, legacy.Id)))
+	key, _, apiErr = legacy.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Equal(t, "sk-edited", key)
+
+	// 没有主密钥时无法解密
+	secretKeyring.Store(nil)
+	_, _, apiErr = legacy.GetNextEnabledKey()
+	require.NotNil(t, apiErr)
+}
+
+func TestReencryptSecrets(t *testing.T) {
+	initCol()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&Option{}, &OptionRevision{}, &CustomOAuthProvider{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM option_revisions")
+	})
+	plain := &Channel{Name: "plain", Key: "sk-plain"}
+	require.NoError(t, DB.Create(plain).Error)
+	require.NoError(t, DB.Create(&Option{Key: "StripeApiSecret", Value: "sk_live"}).Error)
+	require.NoError(t, DB.Create(&Option{Key: "TopUpLink", Value: "https://example.com"}).Error)
+	task := &Task{TaskID: "task_1", Status: TaskStatusSuccess, PrivateData: TaskPrivateData{Key: "vertex-json"}}
+	require.NoError(t, DB.Create(task).Error)
+
+	// 迁移：加密已有的明文
+	useTestKeyring(t, testMasterKey("1", 1))
+	result, err := ReencryptSecrets(false)
+	require.NoError(t, err)
+	require.Equal(t, SecretReencryptResult{Updated: 2}, result)
+	v1Key := rawChannelKey(t, plain.Id)
+	require.True(t, IsEncryptedSecret(v1Key))
+
+	var options []*Option
+	require.NoError(t, DB.Order(commonKeyCol).Find(&options).Error)
+	require.Equal(t, "sk_live", options[0].Value)
+	require.Equal(t, "https://example.com", options[1].Value)
+
+	taskResult, err := ReencryptTaskKeys(false)
+	require.NoError(t, err)
+	require.Equal(t, 1, taskResult.Updated)
+	var loadedTask Task
+	require.NoError(t, DB.First(&loadedTask, task.ID).Error)
+	require.Equal(t, "vertex-json", loadedTask.PrivateData.Key)
+
+	// 轮换：新版本加密新数据，旧版本加密的数据由后台任务重新包装
+	useTestKeyring(t, testMasterKey("2", 2)+","+testMasterKey("1", 1))
+	result, err = ReencryptSecrets(false)
+	require.NoError(t, err)
+	require.Zero(t, result.Updated)
+	result, err = ReencryptSecrets(true)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Updated)
+	taskResult, err = ReencryptTaskKeys(true)
+	require.NoError(t, err)
+	require.Equal(t, 1, taskResult.Updated)
+
+	// 移除旧版本后仍可解密
+	useTestKeyring(t, testMasterKey("2", 2))
+	require.NotEqual(t, v1Key, rawChannelKey(t, plain.Id))
+	channel, err := GetChannelById(plain.Id, true)
+	require.NoError(t, err)
+	key, err := channel.GetPlainKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain", key)
+	loadedTask = Task{}
+	require.NoError(t, DB.First(&loadedTask, task.ID).Error)
+	require.Equal(t, "vertex-json", loadedTask.PrivateData.Key)
+
+	common.OptionMapRWMutex.Lock()
+	oldOptions := common.OptionMap
+	common.OptionMap = map[string]string{}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptions
+		common.OptionMapRWMutex.Unlock()
+	})
+	require.NoError(t, UpdateOption("StripeApiSecret", "sk_live_2"))
+	var raw string
+	require.NoError(t, DB.Raw("SELECT value FROM options WHERE "+commonKeyCol+" = ?", "StripeApiSecret").Scan(&raw).Error)
+	require.True(t, IsEncryptedSecret(raw))
+	revisions, _, err := GetOptionRevisions("StripeApiSecret", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, "sk_live_2", revisions[0].Value)
+}
@@ -135,6 +135,11 @@ func InvalidateSubscriptionPlanCache(planId int) {
 	if planId <= 0 {
 		return
 	}
+	invalidateSubscriptionPlanCache(planId)
+	publishCacheEvent(CacheEventSubscriptionPlan, strconv.Itoa(planId))
+}
+
+func invalidateSubscriptionPlanCache(planId int) {
 	cache := getSubscriptionPlanCache()
 	_, _ = cache.DeleteMany([]string{subscriptionPlanCacheKey(planId)})
 	infoCache := getSubscriptionPlanInfoCache()
@@ -309,7 +314,16 @@ func calcNextResetTime(base time.Time, plan *SubscriptionPlan, endUnix int64) in
 	if plan == nil {
 		return 0
 	}
-	period := NormalizeResetPeriod(plan.QuotaResetPeriod)
+	next := calcPeriodNextResetTime(base, plan.QuotaResetPeriod, plan.QuotaResetCustomSeconds)
+	if next == 0 || (endUnix > 0 && next > endUnix) {
+		return 0
+	}
+	return next
+}
+
+// calcPeriodNextResetTime 计算周期的下一次重置时间（按自然日/周/月对齐），不重置时返回 0
+func calcPeriodNextResetTime(base time.Time, period string, customSeconds int64) int64 {
+	period = NormalizeResetPeriod(period)
 	if period == SubscriptionResetNever {
 		return 0
 	}
@@ -333,16 +347,13 @@ func calcNextResetTime(base time.Time, plan *SubscriptionPlan, endUnix int64) in
 		next = time.Date(base.Year(), base.Month(), 1, 0, 0, 0, 0, base.Location()).
 			AddDate(0, 1, 0)
 	case SubscriptionResetCustom:
-		if plan.QuotaResetCustomSeconds <= 0 {
+		if customSeconds <= 0 {
 			return 0
 		}
-		next = base.Add(time.Duration(plan.QuotaResetCustomSeconds) * time.Second)
+		next = base.Add(time.Duration(customSeconds) * time.Second)
 	default:
 		return 0
 	}
-	if endUnix > 0 && next.Unix() > endUnix {
-		return 0
-	}
 	return next.Unix()
 }
 
@@ -101,9 +101,10 @@ type TaskPrivateData struct {
 	UpstreamTaskID string `json:"upstream_task_id,omitempty"` // 上游真实 task ID
 	ResultURL      string `json:"result_url,omitempty"`       // 任务成功后的结果 URL（视频地址等）
 	// 计费上下文：用于异步退款/差额结算（轮询阶段读取）
-	BillingSource  string              `json:"billing_source,omitempty"`  // "wallet" 或 "subscription"
+	BillingSource  string              `json:"billing_source,omitempty"`  // "wallet"、"subscription" 或 "org_wallet"
 	SubscriptionId int                 `json:"subscription_id,omitempty"` // 订阅 ID，用于订阅退款
 	TokenId        int                 `json:"token_id,omitempty"`        // 令牌 ID，用于令牌额度退款
+	OrgId          int                 `json:"org_id,omitempty"`          // 组织 ID，组织令牌提交的任务从组织钱包结算
 	BillingContext *TaskBillingContext `json:"billing_context,omitempty"` // 计费参数快照（用于轮询阶段重新计算）
 }
 
@@ -146,13 +147,28 @@ func (p *TaskPrivateData) Scan(val interface{}) error {
 	if len(bytesValue) == 0 {
 		return nil
 	}
-	return common.Unmarshal(bytesValue, p)
+	if err := common.Unmarshal(bytesValue, p); err != nil {
+		return err
+	}
+	// Key 是渠道 Key 的副本，与渠道 Key 一样加密保存
+	key, err := decryptSecret(p.Key)
+	if err != nil {
+		common.SysError("failed to decrypt task key: " + err.Error())
+		return nil
+	}
+	p.Key = key
+	return nil
 }
 
 func (p TaskPrivateData) Value() (driver.Value, error) {
 	if (p == TaskPrivateData{}) {
 		return nil, nil
 	}
+	key, err := encryptSecret(p.Key)
+	if err != nil {
+		return nil, err
+	}
+	p.Key = key
 	return common.Marshal(p)
 }
 
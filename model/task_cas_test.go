@@ -33,7 +33,7 @@ func TestMain(m *testing.M) {
 	}
 	sqlDB.SetMaxOpenConns(1)
 
-	if err := db.AutoMigrate(&Task{}, &User{}, &Token{}, &Log{}, &Channel{}); err != nil {
+	if err := db.AutoMigrate(&Task{}, &User{}, &Token{}, &Log{}, &Channel{}, &Budget{}, &Organization{}, &OrganizationMember{}); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
 
@@ -48,6 +48,9 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM tokens")
 		DB.Exec("DELETE FROM logs")
 		DB.Exec("DELETE FROM channels")
+		DB.Exec("DELETE FROM budgets")
+		DB.Exec("DELETE FROM organizations")
+		DB.Exec("DELETE FROM organization_members")
 	})
 }
 
@@ -14,7 +14,10 @@ import (
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key                string         `json:"key,omitempty" gorm:"-"`                                       // 明文令牌，仅创建时返回一次
+	KeyHash            string         `json:"-" gorm:"type:varchar(64);index"`                              // 令牌的 HMAC 哈希
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16)"`                           // 令牌前缀，用于展示与识别
+	PlainKey           string         `json:"-" gorm:"column:key;type:char(48);index:idx_tokens_plain_key"` // 明文存储（未配置哈希密钥或尚未迁移）
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -27,12 +30,79 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                                   // 跨分组重试，仅auto分组有效
+	TpmLimit           int            `json:"tpm_limit" gorm:"default:0"`                          // 每分钟 token 数限制，0 为不限制
+	RpdLimit           int            `json:"rpd_limit" gorm:"default:0"`                          // 每日请求数限制，0 为不限制
+	QuotaPerHourLimit  int            `json:"quota_per_hour_limit" gorm:"default:0"`               // 每小时消费额度限制，0 为不限制
+	ResponseCache      bool           `json:"response_cache"`                                      // 是否启用响应缓存
+	OrgId              int            `json:"org_id" gorm:"index;default:0"`                       // 所属组织，非 0 时消耗组织钱包额度
+	CaptureUntil       int64          `json:"capture_until" gorm:"bigint;default:0"`               // 请求抓取窗口截止时间，0 表示未开启
+	GuardrailPolicy    string         `json:"guardrail_policy" gorm:"type:varchar(64);default:''"` // 内容审核策略，为空时按分组选择
+	PIIRedaction       bool           `json:"pii_redaction"`                                       // 转发前脱敏 PII，响应中还原
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
+const tokenKeyPrefixLength = 8
+
 func (token *Token) Clean() {
 	token.Key = ""
+	token.PlainKey = ""
+}
+
+// AfterFind 不从 PlainKey 还原 Key，查询到的令牌只通过 KeyPrefix 展示脱敏后的密钥
+func (token *Token) AfterFind(tx *gorm.DB) error {
+	if token.KeyPrefix == "" {
+		token.KeyPrefix = getTokenKeyPrefix(token.PlainKey)
+	}
+	return nil
+}
+
+func getTokenKeyPrefix(key string) string {
+	if len(key) <= tokenKeyPrefixLength {
+		return key
+	}
+	return key[:tokenKeyPrefixLength]
+}
+
+// SetKey 设置令牌明文，并按存储模式写入哈希或明文字段
+func (token *Token) SetKey(key string) {
+	token.Key = key
+	token.KeyPrefix = getTokenKeyPrefix(key)
+	if common.TokenKeyHashEnabled {
+		token.KeyHash = common.HashTokenKey(key)
+		token.PlainKey = ""
+	} else {
+		token.KeyHash = ""
+		token.PlainKey = key
+	}
+}
+
+// CacheKey 返回令牌在 Redis 中的缓存键，与存储模式无关，均为明文的 HMAC
+func (token *Token) CacheKey() string {
+	if token.KeyHash != "" {
+		return token.KeyHash
+	}
+	if token.Key != "" {
+		return common.HashTokenKey(token.Key)
+	}
+	if token.PlainKey != "" {
+		return common.HashTokenKey(token.PlainKey)
+	}
+	return ""
+}
+
+// MaskedKey 返回用于日志与错误信息的脱敏令牌
+func (token *Token) MaskedKey() string {
+	return "sk-" + token.KeyPrefix + "***"
+}
+
+// GetUsageRateLimit 返回令牌级的 TPM / RPD / 每小时消费限制
+func (token *Token) GetUsageRateLimit() operation_setting.UsageRateLimit {
+	return operation_setting.UsageRateLimit{
+		TPM:          token.TpmLimit,
+		RPD:          token.RpdLimit,
+		QuotaPerHour: token.QuotaPerHourLimit,
+	}
 }
 
 func (token *Token) GetIpLimits() []string {
@@ -145,7 +215,9 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		if err != nil {
 			return nil, 0, err
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		// 哈希存储的令牌只能按前缀或完整令牌搜索
+		baseQuery = baseQuery.Where("(key_prefix LIKE ? ESCAPE '!' OR key_hash = ? OR "+commonKeyCol+" LIKE ? ESCAPE '!')",
+			tokenPattern, common.HashTokenKey(token), tokenPattern)
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -170,40 +242,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	}
 	token, err = GetTokenByKey(key, false)
 	if err == nil {
-		if token.Status == common.TokenStatusExhausted {
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
-		} else if token.Status == common.TokenStatusExpired {
-			return token, errors.New("该令牌已过期")
-		}
-		if token.Status != common.TokenStatusEnabled {
-			return token, errors.New("该令牌状态不可用")
-		}
-		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
-			if !common.RedisEnabled {
-				token.Status = common.TokenStatusExpired
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			return token, errors.New("该令牌已过期")
-		}
-		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
-			if !common.RedisEnabled {
-				// in this case, we can make sure the token is exhausted
-				token.Status = common.TokenStatusExhausted
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, errors.New(fmt.Sprintf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota))
-		}
-		return token, nil
+		return token, checkTokenUsable(token)
 	}
 	common.SysLog("ValidateUserToken: failed to get token: " + err.Error())
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -213,6 +252,51 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	}
 }
 
+// ValidateUserTokenById 按令牌 ID 校验令牌是否可用，供网关内部发起的请求（如批处理任务）使用
+func ValidateUserTokenById(id int) (*Token, error) {
+	token, err := GetTokenById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("无效的令牌")
+		}
+		return nil, errors.New("无效的令牌，数据库查询出错，请联系管理员")
+	}
+	return token, checkTokenUsable(token)
+}
+
+func checkTokenUsable(token *Token) error {
+	if token.Status == common.TokenStatusExhausted {
+		return errors.New("该令牌额度已用尽 TokenStatusExhausted[" + token.MaskedKey() + "]")
+	} else if token.Status == common.TokenStatusExpired {
+		return errors.New("该令牌已过期")
+	}
+	if token.Status != common.TokenStatusEnabled {
+		return errors.New("该令牌状态不可用")
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
+		if !common.RedisEnabled {
+			token.Status = common.TokenStatusExpired
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		return errors.New("该令牌已过期")
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		if !common.RedisEnabled {
+			// in this case, we can make sure the token is exhausted
+			token.Status = common.TokenStatusExhausted
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		return errors.New(fmt.Sprintf("[%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", token.MaskedKey(), token.RemainQuota))
+	}
+	return nil
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("id 或 userId 为空！")
@@ -240,7 +324,21 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetTokenByIdWithCache 按缓存键优先从 Redis 读取令牌，未命中时按 ID 查询数据库
+func GetTokenByIdWithCache(id int, cacheKey string) (*Token, error) {
+	if common.RedisEnabled && cacheKey != "" {
+		token, err := cacheGetTokenByCacheKey(cacheKey)
+		if err == nil {
+			return token, nil
+		}
+	}
+	return GetTokenById(id)
+}
+
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
+	if key == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) && token != nil {
@@ -260,11 +358,81 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
-	return token, err
+	return getTokenByKeyFromDB(key)
+}
+
+// getTokenByKeyFromDB 先按哈希查找，未命中时回退到明文列（旧数据或明文存储模式），启用哈希存储时顺带迁移
+func getTokenByKeyFromDB(key string) (*Token, error) {
+	var token Token
+	if common.TokenKeyHashEnabled {
+		err := DB.Where("key_hash = ?", common.HashTokenKey(key)).First(&token).Error
+		if err == nil {
+			token.Key = key
+			return &token, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if err := DB.Where(commonKeyCol+" = ?", key).First(&token).Error; err != nil {
+		return nil, err
+	}
+	if common.TokenKeyHashEnabled {
+		if err := token.migratePlainKey(DB); err != nil {
+			common.SysLog(fmt.Sprintf("failed to migrate token %d key to hash: %s", token.Id, err.Error()))
+		}
+	}
+	token.Key = key
+	return &token, nil
+}
+
+// migratePlainKey 将明文存储的令牌改为哈希存储
+func (token *Token) migratePlainKey(tx *gorm.DB) error {
+	key := token.PlainKey
+	if key == "" {
+		return nil
+	}
+	keyHash := common.HashTokenKey(key)
+	keyPrefix := getTokenKeyPrefix(key)
+	err := tx.Unscoped().Model(&Token{}).Where("id = ? AND "+commonKeyCol+" = ?", token.Id, key).Updates(map[string]interface{}{
+		"key_hash":   keyHash,
+		"key_prefix": keyPrefix,
+		"key":        "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	token.KeyHash = keyHash
+	token.KeyPrefix = keyPrefix
+	token.PlainKey = ""
+	return nil
+}
+
+// MigrateTokenKeysToHash 启用哈希存储时将所有明文令牌（含已软删除的）迁移为哈希存储
+func MigrateTokenKeysToHash() (int, error) {
+	migrated := 0
+	for {
+		var tokens []*Token
+		err := DB.Unscoped().Where(commonKeyCol + " <> ''").Order("id").Limit(500).Find(&tokens).Error
+		if err != nil {
+			return migrated, err
+		}
+		if len(tokens) == 0 {
+			return migrated, nil
+		}
+		for _, token := range tokens {
+			if err := token.migratePlainKey(DB); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+	}
 }
 
 func (token *Token) Insert() error {
+	if token.KeyHash == "" && token.PlainKey == "" && token.Key != "" {
+		token.SetKey(token.Key)
+	}
 	var err error
 	err = DB.Create(token).Error
 	return err
@@ -283,7 +451,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry",
+		"tpm_limit", "rpd_limit", "quota_per_hour_limit", "response_cache", "guardrail_policy", "pii_redaction").Updates(token).Error
 	return err
 }
 
@@ -306,7 +475,7 @@ func (token *Token) Delete() (err error) {
 	defer func() {
 		if shouldUpdateRedis(true, err) {
 			gopool.Go(func() {
-				err := cacheDeleteToken(token.Key)
+				err := cacheDeleteToken(token.CacheKey())
 				if err != nil {
 					common.SysLog("failed to delete token cache: " + err.Error())
 				}
@@ -360,13 +529,14 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(tokenId int, key string, quota int) (err error) {
+// IncreaseTokenQuota cacheKey 为 Token.CacheKey()
+func IncreaseTokenQuota(tokenId int, cacheKey string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	if common.RedisEnabled && cacheKey != "" {
 		gopool.Go(func() {
-			err := cacheIncrTokenQuota(key, int64(quota))
+			err := cacheIncrTokenQuota(cacheKey, int64(quota))
 			if err != nil {
 				common.SysLog("failed to increase token quota: " + err.Error())
 			}
@@ -390,13 +560,14 @@ func increaseTokenQuota(id int, quota int) (err error) {
 	return err
 }
 
-func DecreaseTokenQuota(id int, key string, quota int) (err error) {
+// DecreaseTokenQuota cacheKey 为 Token.CacheKey()
+func DecreaseTokenQuota(id int, cacheKey string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	if common.RedisEnabled && cacheKey != "" {
 		gopool.Go(func() {
-			err := cacheDecrTokenQuota(key, int64(quota))
+			err := cacheDecrTokenQuota(cacheKey, int64(quota))
 			if err != nil {
 				common.SysLog("failed to decrease token quota: " + err.Error())
 			}
@@ -453,7 +624,7 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 	if common.RedisEnabled {
 		gopool.Go(func() {
 			for _, t := range tokens {
-				_ = cacheDeleteToken(t.Key)
+				_ = cacheDeleteToken(t.CacheKey())
 			}
 		})
 	}
@@ -8,8 +8,13 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 )
 
+// 令牌缓存键为 Token.CacheKey()，即令牌明文的 HMAC，缓存中不保存明文
+
 func cacheSetToken(token Token) error {
-	key := common.GenerateHMAC(token.Key)
+	key := token.CacheKey()
+	if key == "" {
+		return nil
+	}
 	token.Clean()
 	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
 	if err != nil {
@@ -19,16 +24,19 @@ func cacheSetToken(token Token) error {
 }
 
 func cacheDeleteToken(key string) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisDelKey(fmt.Sprintf("token:%s", key))
+	err := deleteTokenCache(key)
 	if err != nil {
 		return err
 	}
+	publishCacheEvent(CacheEventToken, key)
 	return nil
 }
 
+func deleteTokenCache(key string) error {
+	return common.RedisDelKey(fmt.Sprintf("token:%s", key))
+}
+
 func cacheIncrTokenQuota(key string, increment int64) error {
-	key = common.GenerateHMAC(key)
 	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
 	if err != nil {
 		return err
@@ -41,7 +49,6 @@ func cacheDecrTokenQuota(key string, decrement int64) error {
 }
 
 func cacheSetTokenField(key string, field string, value string) error {
-	key = common.GenerateHMAC(key)
 	err := common.RedisHSetField(fmt.Sprintf("token:%s", key), field, value)
 	if err != nil {
 		return err
@@ -51,15 +58,22 @@ func cacheSetTokenField(key string, field string, value string) error {
 
 // CacheGetTokenByKey 从缓存中获取 token，如果缓存中不存在，则从数据库中获取
 func cacheGetTokenByKey(key string) (*Token, error) {
-	hmacKey := common.GenerateHMAC(key)
+	token, err := cacheGetTokenByCacheKey(common.HashTokenKey(key))
+	if err != nil {
+		return nil, err
+	}
+	token.Key = key
+	return token, nil
+}
+
+func cacheGetTokenByCacheKey(cacheKey string) (*Token, error) {
 	if !common.RedisEnabled {
 		return nil, fmt.Errorf("redis is not enabled")
 	}
 	var token Token
-	err := common.RedisHGetObj(fmt.Sprintf("token:%s", hmacKey), &token)
+	err := common.RedisHGetObj(fmt.Sprintf("token:%s", cacheKey), &token)
 	if err != nil {
 		return nil, err
 	}
-	token.Key = key
 	return &token, nil
 }
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func withTokenKeyHash(t *testing.T, enabled bool) {
+	t.Helper()
+	prevEnabled, prevSecret := common.TokenKeyHashEnabled, common.TokenHashSecret
+	common.TokenKeyHashEnabled = enabled
+	common.TokenHashSecret = "test-token-secret"
+	initCol()
+	t.Cleanup(func() {
+		common.TokenKeyHashEnabled = prevEnabled
+		common.TokenHashSecret = prevSecret
+	})
+}
+
+func TestTokenInsertStoresHash(t *testing.T) {
+	truncateTables(t)
+	withTokenKeyHash(t, true)
+
+	key := "abcdefgh0123456789abcdefgh0123456789abcdefgh0123"
+	token := &Token{UserId: 1, Name: "hashed", Key: key, Status: common.TokenStatusEnabled}
+	require.NoError(t, token.Insert())
+	require.Equal(t, key, token.Key)
+
+	var stored Token
+	require.NoError(t, DB.First(&stored, token.Id).Error)
+	require.Empty(t, stored.PlainKey)
+	require.Empty(t, stored.Key)
+	require.Equal(t, common.HashTokenKey(key), stored.KeyHash)
+	require.Equal(t, "abcdefgh", stored.KeyPrefix)
+	require.Equal(t, "sk-abcdefgh***", stored.MaskedKey())
+
+	found, err := GetTokenByKey(key, true)
+	require.NoError(t, err)
+	require.Equal(t, token.Id, found.Id)
+	require.Equal(t, key, found.Key)
+	require.Equal(t, stored.CacheKey(), found.CacheKey())
+
+	_, err = GetTokenByKey("", true)
+	require.Error(t, err)
+	_, err = GetTokenByKey(key[:47]+"x", true)
+	require.Error(t, err)
+}
+
+func TestTokenPlainKeyMigratedOnLookup(t *testing.T) {
+	truncateTables(t)
+	withTokenKeyHash(t, false)
+
+	key := "legacy0123456789legacy0123456789legacy0123456789"
+	token := &Token{UserId: 1, Name: "legacy", Key: key, Status: common.TokenStatusEnabled}
+	require.NoError(t, token.Insert())
+	cacheKey := token.CacheKey()
+
+	var stored Token
+	require.NoError(t, DB.First(&stored, token.Id).Error)
+	require.Equal(t, key, stored.PlainKey)
+	require.Empty(t, stored.Key)
+	require.Equal(t, "legacy01", stored.KeyPrefix)
+	require.Empty(t, stored.KeyHash)
+
+	common.TokenKeyHashEnabled = true
+	found, err := GetTokenByKey(key, true)
+	require.NoError(t, err)
+	require.Equal(t, token.Id, found.Id)
+	require.Equal(t, cacheKey, found.CacheKey())
+
+	stored = Token{}
+	require.NoError(t, DB.First(&stored, token.Id).Error)
+	require.Empty(t, stored.PlainKey)
+	require.Equal(t, common.HashTokenKey(key), stored.KeyHash)
+
+	migrated, err := MigrateTokenKeysToHash()
+	require.NoError(t, err)
+	require.Zero(t, migrated)
+}
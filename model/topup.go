@@ -21,6 +21,27 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+
+	ProviderOrderId string  `json:"provider_order_id" gorm:"type:varchar(255)"` // 支付网关侧的订单号，查询、退款时使用
+	PaidAmount      float64 `json:"paid_amount"`                                // 网关回调中的实际支付金额
+	Currency        string  `json:"currency" gorm:"type:varchar(16)"`
+	RefundId        string  `json:"refund_id" gorm:"type:varchar(255)"`
+	RefundReason    string  `json:"refund_reason" gorm:"type:varchar(255)"`
+	RefundTime      int64   `json:"refund_time"`
+}
+
+var (
+	ErrTopUpNotFound      = errors.New("充值订单不存在")
+	ErrTopUpStatusInvalid = errors.New("充值订单状态错误")
+)
+
+// TopUpPayment 支付网关回调中与入账相关的信息
+type TopUpPayment struct {
+	ProviderOrderId string
+	PaidAmount      float64
+	Currency        string
+	CustomerId      string // Stripe Customer ID，写入用户的 stripe_customer
+	CustomerEmail   string // 用户没有邮箱时写入支付时使用的邮箱
 }
 
 func (topUp *TopUp) Insert() error {
@@ -35,6 +56,14 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// PaidMoney 实际支付金额，网关回调没有提供时使用下单时计算的金额
+func (topUp *TopUp) PaidMoney() float64 {
+	if topUp.PaidAmount > 0 {
+		return topUp.PaidAmount
+	}
+	return topUp.Money
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
@@ -55,55 +84,130 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
+// SetTopUpProviderOrderId 记录支付网关侧的订单号，只更新该字段，不影响并发的回调
+func SetTopUpProviderOrderId(tradeNo string, providerOrderId string) error {
+	if providerOrderId == "" {
+		return nil
 	}
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("provider_order_id", providerOrderId).Error
+}
 
-	var quota float64
-	topUp := &TopUp{}
-
+// lockTopUpTx 在事务中按订单号锁定充值订单
+func lockTopUpTx(tx *gorm.DB, tradeNo string) (*TopUp, error) {
 	refCol := "`trade_no`"
 	if common.UsingPostgreSQL {
 		refCol = `"trade_no"`
 	}
+	topUp := &TopUp{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTopUpNotFound
+		}
+		return nil, err
+	}
+	return topUp, nil
+}
+
+// CreditedQuota 充值订单对应的额度：
+// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
+// - Creem 订单：Amount 即为充值额度（早期的 Creem 订单没有记录支付方式）
+// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
+func (topUp *TopUp) CreditedQuota() int {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case "creem", "":
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
+// CompleteTopUp 支付成功后完成充值订单并给用户充值。已完成的订单直接返回，重复的回调不会重复入账
+func CompleteTopUp(tradeNo string, payment TopUpPayment) error {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+
+	var topUp *TopUp
+	var quota int
+	completed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpTx(tx, tradeNo)
 		if err != nil {
-			return errors.New("充值订单不存在")
+			return err
+		}
+		if topUp.Status == common.TopUpStatusSuccess {
+			return nil
 		}
-
 		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
+			return ErrTopUpStatusInvalid
 		}
 
+		quota = topUp.CreditedQuota()
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
+		if payment.ProviderOrderId != "" {
+			topUp.ProviderOrderId = payment.ProviderOrderId
+		}
+		if payment.PaidAmount > 0 {
+			topUp.PaidAmount = payment.PaidAmount
+			topUp.Currency = payment.Currency
+		}
+		if err := tx.Save(topUp).Error; err != nil {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
-		if err != nil {
+		updateFields := map[string]interface{}{
+			"quota": gorm.Expr("quota + ?", quota),
+		}
+		if payment.CustomerId != "" {
+			updateFields["stripe_customer"] = payment.CustomerId
+		}
+		if payment.CustomerEmail != "" {
+			var user User
+			if err := tx.Select("id", "email").Where("id = ?", topUp.UserId).First(&user).Error; err != nil {
+				return err
+			}
+			if user.Email == "" {
+				updateFields["email"] = payment.CustomerEmail
+			}
+		}
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error; err != nil {
 			return err
 		}
-
+		completed = true
 		return nil
 	})
-
 	if err != nil {
-		common.SysError("topup failed: " + err.Error())
-		return errors.New("充值失败，请稍后重试")
+		return err
+	}
+	if !completed {
+		return nil
 	}
 
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
-
+	_ = invalidateUserCache(topUp.UserId)
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%.2f，支付方式：%s", logger.FormatQuota(quota), topUp.Money, topUp.PaymentMethod))
 	return nil
 }
 
+// ExpireTopUp 关闭未支付的充值订单，已支付或已关闭的订单不受影响
+func ExpireTopUp(tradeNo string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		topUp, err := lockTopUpTx(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusPending {
+			return nil
+		}
+		topUp.Status = common.TopUpStatusExpired
+		return tx.Save(topUp).Error
+	})
+}
+
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
 	// Start transaction
 	tx := DB.Begin()
@@ -241,20 +345,15 @@ func ManualCompleteTopUp(tradeNo string) error {
 		return errors.New("未提供订单号")
 	}
 
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
 	var userId int
 	var quotaToAdd int
 	var payMoney float64
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
-		topUp := &TopUp{}
 		// 行级锁，避免并发补单
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
-			return errors.New("充值订单不存在")
+		topUp, err := lockTopUpTx(tx, tradeNo)
+		if err != nil {
+			return err
 		}
 
 		// 幂等处理：已成功直接返回
@@ -266,17 +365,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 			return errors.New("订单状态不是待支付，无法补单")
 		}
 
-		// 计算应充值额度：
-		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
-		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
-		} else {
-			dAmount := decimal.NewFromInt(topUp.Amount)
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
-		}
+		quotaToAdd = topUp.CreditedQuota()
 		if quotaToAdd <= 0 {
 			return errors.New("无效的充值额度")
 		}
@@ -306,73 +395,3 @@ func ManualCompleteTopUp(tradeNo string) error {
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
 	return nil
 }
-func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
-	}
-
-	var quota int64
-	topUp := &TopUp{}
-
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
-		if err != nil {
-			return errors.New("充值订单不存在")
-		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
-		}
-
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
-			return err
-		}
-
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
-		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
-		updateFields := map[string]interface{}{
-			"quota": gorm.Expr("quota + ?", quota),
-		}
-
-		// 如果有客户邮箱，尝试更新用户邮箱（仅当用户邮箱为空时）
-		if customerEmail != "" {
-			// 先检查用户当前邮箱是否为空
-			var user User
-			err = tx.Where("id = ?", topUp.UserId).First(&user).Error
-			if err != nil {
-				return err
-			}
-
-			// 如果用户邮箱为空，则更新为支付时使用的邮箱
-			if user.Email == "" {
-				updateFields["email"] = customerEmail
-			}
-		}
-
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		common.SysError("creem topup failed: " + err.Error())
-		return errors.New("充值失败，请稍后重试")
-	}
-
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
-
-	return nil
-}
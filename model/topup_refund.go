@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTopUpRefundQuotaInsufficient = errors.New("用户剩余额度不足，无法扣回充值额度")
+	ErrTopUpRefundSubscription      = errors.New("订阅订单暂不支持退款")
+)
+
+// 退款分两步：BeginTopUpRefund 在事务中扣回额度并把订单标记为退款中，调用支付网关退款成功后
+// FinishTopUpRefund 标记为已退款，失败时 CancelTopUpRefund 退回扣除的额度。先扣额度再退款，
+// 避免网关已经退款而用户在此期间把额度用掉
+
+// BeginTopUpRefund 扣回充值订单对应的额度并标记为退款中，返回扣回的额度。
+// 用户剩余额度不足时失败，不会把额度扣成负数。resume 为 true 时允许继续处理已经处于退款中的订单（不再重复扣回）
+func BeginTopUpRefund(tradeNo string, resume bool) (*TopUp, int, error) {
+	var topUp *TopUp
+	quota := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpTx(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.Status == common.TopUpStatusRefunding && resume {
+			return nil
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return ErrTopUpStatusInvalid
+		}
+		var orders int64
+		if err := tx.Model(&SubscriptionOrder{}).Where("trade_no = ?", tradeNo).Count(&orders).Error; err != nil {
+			return err
+		}
+		if orders > 0 {
+			return ErrTopUpRefundSubscription
+		}
+
+		quota = topUp.CreditedQuota()
+		if quota > 0 {
+			result := tx.Model(&User{}).Where("id = ? AND quota >= ?", topUp.UserId, quota).
+				Update("quota", gorm.Expr("quota - ?", quota))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrTopUpRefundQuotaInsufficient
+			}
+		}
+		topUp.Status = common.TopUpStatusRefunding
+		return tx.Save(topUp).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if quota > 0 {
+		_ = invalidateUserCache(topUp.UserId)
+	}
+	return topUp, quota, nil
+}
+
+// FinishTopUpRefund 支付网关退款成功后把订单标记为已退款
+func FinishTopUpRefund(tradeNo string, refundId string, reason string) error {
+	var topUp *TopUp
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpTx(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusRefunding {
+			return ErrTopUpStatusInvalid
+		}
+		topUp.Status = common.TopUpStatusRefunded
+		topUp.RefundId = refundId
+		topUp.RefundReason = reason
+		topUp.RefundTime = common.GetTimestamp()
+		return tx.Save(topUp).Error
+	})
+	if err != nil {
+		return err
+	}
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("充值订单 %s 已退款，扣回额度: %v，退款金额：%.2f", tradeNo, logger.FormatQuota(topUp.CreditedQuota()), topUp.PaidMoney()))
+	return nil
+}
+
+// CancelTopUpRefund 支付网关退款失败时退回扣除的额度，订单恢复为已支付
+func CancelTopUpRefund(tradeNo string) error {
+	var topUp *TopUp
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpTx(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusRefunding {
+			return ErrTopUpStatusInvalid
+		}
+		if quota := topUp.CreditedQuota(); quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+				return err
+			}
+		}
+		topUp.Status = common.TopUpStatusSuccess
+		return tx.Save(topUp).Error
+	})
+	if err != nil {
+		return err
+	}
+	_ = invalidateUserCache(topUp.UserId)
+	return nil
+}
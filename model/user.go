@@ -1037,3 +1037,10 @@ func RootUserExists() bool {
 	}
 	return true
 }
+
+// GetUserIdByUsername 按用户名查询用户 ID，用户不存在时返回 gorm.ErrRecordNotFound
+func GetUserIdByUsername(username string) (int, error) {
+	var user User
+	err := DB.Select("id").Where("username = ?", username).First(&user).Error
+	return user.Id, err
+}
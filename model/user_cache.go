@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -49,8 +50,16 @@ func getUserCacheKey(userId int) string {
 	return fmt.Sprintf("user:%d", userId)
 }
 
-// invalidateUserCache clears user cache
+// invalidateUserCache clears user cache and notifies other nodes
 func invalidateUserCache(userId int) error {
+	if err := deleteUserCache(userId); err != nil {
+		return err
+	}
+	publishCacheEvent(CacheEventUser, strconv.Itoa(userId))
+	return nil
+}
+
+func deleteUserCache(userId int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
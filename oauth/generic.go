@@ -94,6 +94,12 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 
 	logger.LogDebug(ctx, "[OAuth-Generic-%s] ExchangeToken: code=%s...", p.config.Slug, code[:min(len(code), 10)])
 
+	clientSecret, err := p.config.GetClientSecret()
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[OAuth-Generic-%s] ExchangeToken: failed to decrypt client secret: %s", p.config.Slug, err.Error()))
+		return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthConnectFailed, map[string]any{"Provider": p.config.Name}, err.Error())
+	}
+
 	redirectUri := fmt.Sprintf("%s/oauth/%s", system_setting.ServerAddress, p.config.Slug)
 	values := url.Values{}
 	values.Set("grant_type", "authorization_code")
@@ -108,11 +114,10 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 	}
 
 	var req *http.Request
-	var err error
 
 	if authStyle == AuthStyleInParams {
 		values.Set("client_id", p.config.ClientId)
-		values.Set("client_secret", p.config.ClientSecret)
+		values.Set("client_secret", clientSecret)
 	}
 
 	req, err = http.NewRequestWithContext(ctx, "POST", p.config.TokenEndpoint, strings.NewReader(values.Encode()))
@@ -124,7 +129,7 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 
 	if authStyle == AuthStyleInHeader {
 		// Basic Auth
-		credentials := base64.StdEncoding.EncodeToString([]byte(p.config.ClientId + ":" + p.config.ClientSecret))
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.config.ClientId + ":" + clientSecret))
 		req.Header.Set("Authorization", "Basic "+credentials)
 	}
 
@@ -0,0 +1,277 @@
+// Package envelope implements envelope encryption for secrets stored in the database.
+//
+// Every value is encrypted with its own random data key (DEK) using AES-256-GCM, and the
+// DEK is wrapped by a versioned master key (KEK). Rotating the master key only requires
+// re-wrapping the DEK, the encrypted payload itself is left untouched.
+//
+// Encrypted values are self-describing strings:
+//
+//	envelope:v1:<kek version>:<base64 wrapped DEK>:<base64 nonce+ciphertext>
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	prefix  = "envelope:v1:"
+	keySize = 32
+)
+
+var (
+	ErrNoKeyring      = errors.New("envelope: master key is not configured")
+	ErrUnknownVersion = errors.New("envelope: unknown master key version")
+	ErrMalformed      = errors.New("envelope: malformed value")
+)
+
+// Keyring holds the versioned master keys. The highest version encrypts new values,
+// older versions are kept only to decrypt values that have not been re-wrapped yet.
+type Keyring struct {
+	keys    map[int][]byte
+	current int
+}
+
+// NewKeyring builds a keyring from version -> 32-byte master key.
+func NewKeyring(keys map[int][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeyring
+	}
+	ring := &Keyring{keys: make(map[int][]byte, len(keys))}
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("envelope: invalid master key version %d", version)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("envelope: master key version %d must be %d bytes, got %d", version, keySize, len(key))
+		}
+		ring.keys[version] = append([]byte(nil), key...)
+		if version > ring.current {
+			ring.current = version
+		}
+	}
+	return ring, nil
+}
+
+// ParseKeyring parses master keys in the form "2:<base64>,1:<base64>". Entries may also be
+// separated by newlines, blank lines and lines starting with # are ignored.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keys := make(map[int][]byte)
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(spec, ",", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		versionText, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("envelope: master key entry must be <version>:<base64 key>")
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(versionText))
+		if err != nil {
+			return nil, fmt.Errorf("envelope: invalid master key version %q", versionText)
+		}
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("envelope: duplicate master key version %d", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("envelope: master key version %d is not valid base64: %w", version, err)
+		}
+		keys[version] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys)
+}
+
+// LoadKeyringFile reads master keys from a file in the same format as ParseKeyring,
+// typically one "<version>:<base64 key>" per line mounted from a secret manager.
+func LoadKeyringFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(data))
+}
+
+// CurrentVersion returns the master key version used for new values.
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// Versions returns the configured master key versions in ascending order.
+func (k *Keyring) Versions() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// IsEncrypted reports whether value is an envelope produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Version returns the master key version that wrapped value.
+func Version(value string) (int, error) {
+	parts, err := split(value)
+	if err != nil {
+		return 0, err
+	}
+	return parts.version, nil
+}
+
+// Encrypt seals plaintext with a fresh data key wrapped by the current master key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	payload, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.current], dek)
+	if err != nil {
+		return "", err
+	}
+	return format(k.current, wrapped, payload), nil
+}
+
+// Decrypt opens a value produced by Encrypt with any configured master key version.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	parts, err := split(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := k.unwrap(parts)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, parts.payload)
+	if err != nil {
+		return "", fmt.Errorf("envelope: decrypt payload: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRewrap reports whether value was wrapped by an older master key version.
+func (k *Keyring) NeedsRewrap(value string) bool {
+	version, err := Version(value)
+	return err == nil && version != k.current
+}
+
+// Rewrap re-wraps the data key of value with the current master key. The encrypted payload
+// is kept as is, so the plaintext never leaves this function.
+func (k *Keyring) Rewrap(value string) (string, error) {
+	parts, err := split(value)
+	if err != nil {
+		return "", err
+	}
+	if parts.version == k.current {
+		return value, nil
+	}
+	dek, err := k.unwrap(parts)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.current], dek)
+	if err != nil {
+		return "", err
+	}
+	return format(k.current, wrapped, parts.payload), nil
+}
+
+type envelopeParts struct {
+	version int
+	wrapped []byte
+	payload []byte
+}
+
+func (k *Keyring) unwrap(parts envelopeParts) ([]byte, error) {
+	kek, ok := k.keys[parts.version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, parts.version)
+	}
+	dek, err := open(kek, parts.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+func format(version int, wrapped []byte, payload []byte) string {
+	return prefix + strconv.Itoa(version) + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(payload)
+}
+
+func split(value string) (envelopeParts, error) {
+	if !IsEncrypted(value) {
+		return envelopeParts{}, ErrMalformed
+	}
+	fields := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(fields) != 3 {
+		return envelopeParts{}, ErrMalformed
+	}
+	version, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return envelopeParts{}, ErrMalformed
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return envelopeParts{}, ErrMalformed
+	}
+	payload, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return envelopeParts{}, ErrMalformed
+	}
+	return envelopeParts{version: version, wrapped: wrapped, payload: payload}, nil
+}
+
+// seal returns nonce+ciphertext.
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,70 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func TestEncryptDecryptAndRewrap(t *testing.T) {
+	oldRing, err := ParseKeyring("1:" + testKey(1))
+	require.NoError(t, err)
+	sealed, err := oldRing.Encrypt("sk-secret")
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(sealed))
+	require.NotContains(t, sealed, "sk-secret")
+
+	other, err := oldRing.Encrypt("sk-secret")
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, other, "every value gets its own data key and nonce")
+
+	// Rotate: version 2 becomes current, version 1 is kept for decryption.
+	ring, err := ParseKeyring("# rotated\n2:" + testKey(2) + "\n1:" + testKey(1))
+	require.NoError(t, err)
+	require.Equal(t, 2, ring.CurrentVersion())
+	require.Equal(t, []int{1, 2}, ring.Versions())
+	require.True(t, ring.NeedsRewrap(sealed))
+
+	plaintext, err := ring.Decrypt(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", plaintext)
+
+	rewrapped, err := ring.Rewrap(sealed)
+	require.NoError(t, err)
+	require.False(t, ring.NeedsRewrap(rewrapped))
+	version, err := Version(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	newOnly, err := ParseKeyring("2:" + testKey(2))
+	require.NoError(t, err)
+	plaintext, err = newOnly.Decrypt(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", plaintext)
+	_, err = newOnly.Decrypt(sealed)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	_, err := ParseKeyring("")
+	require.ErrorIs(t, err, ErrNoKeyring)
+	_, err = ParseKeyring("1:" + base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+	_, err = ParseKeyring("1:" + testKey(1) + ",1:" + testKey(2))
+	require.Error(t, err)
+	_, err = ParseKeyring(testKey(1))
+	require.Error(t, err)
+
+	ring, err := ParseKeyring("1:" + testKey(1))
+	require.NoError(t, err)
+	_, err = ring.Decrypt("envelope:v1:1:!!:!!")
+	require.ErrorIs(t, err, ErrMalformed)
+	_, err = ring.Decrypt("plaintext")
+	require.ErrorIs(t, err, ErrMalformed)
+}
@@ -0,0 +1,165 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const queueSize = 1024
+
+// Event is a lightweight notification. Subscribers reload the referenced data themselves,
+// so events carry identifiers only.
+type Event struct {
+	Type   string `json:"type"`
+	Key    string `json:"key,omitempty"`
+	Source string `json:"source"`
+	Time   int64  `json:"time"`
+}
+
+// FromSelf reports whether the event was published by this process.
+func (e Event) FromSelf() bool {
+	return e.Source == nodeId
+}
+
+type Handler func(Event)
+
+var (
+	nodeId = newNodeId()
+
+	mu       sync.RWMutex
+	handlers = make(map[string][]Handler)
+
+	started atomic.Bool
+	client  *redis.Client
+	channel string
+	queue   = make(chan Event, queueSize)
+)
+
+func newNodeId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// NodeId returns the identifier this process stamps on published events.
+func NodeId() string {
+	return nodeId
+}
+
+// Subscribe registers handler for events of eventType. Handlers run on a single dispatcher
+// goroutine in publish order and must not block.
+func Subscribe(eventType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[eventType] = append(handlers[eventType], handler)
+}
+
+// Start begins delivering events. With a Redis client, events are broadcast to every process
+// subscribed to redisChannel, including this one. Without one, events are delivered in-process only.
+func Start(ctx context.Context, redisClient *redis.Client, redisChannel string) {
+	if !started.CompareAndSwap(false, true) {
+		return
+	}
+	client = redisClient
+	channel = redisChannel
+	go dispatchLoop(ctx)
+	if client != nil {
+		go subscribeLoop(ctx)
+	}
+}
+
+// Started reports whether Start has been called.
+func Started() bool {
+	return started.Load()
+}
+
+// Publish broadcasts an event. It is a no-op before Start. When the Redis publish fails the
+// event is still delivered locally and other nodes catch up on their next periodic resync.
+func Publish(eventType string, key string) {
+	if !started.Load() {
+		return
+	}
+	event := Event{Type: eventType, Key: key, Source: nodeId, Time: time.Now().UnixMilli()}
+	if client != nil {
+		payload, err := json.Marshal(event)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			err = client.Publish(ctx, channel, payload).Err()
+			cancel()
+			if err == nil {
+				return
+			}
+		}
+		log.Printf("eventbus: publish %s failed, delivering locally: %v", eventType, err)
+	}
+	enqueue(event)
+}
+
+func enqueue(event Event) {
+	select {
+	case queue <- event:
+	default:
+		log.Printf("eventbus: queue full, dropping %s event", event.Type)
+	}
+}
+
+func subscribeLoop(ctx context.Context) {
+	pubsub := client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	// The channel reconnects automatically; events published while disconnected are lost
+	// and are recovered by the periodic resync.
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("eventbus: invalid event payload: %v", err)
+				continue
+			}
+			enqueue(event)
+		}
+	}
+}
+
+func dispatchLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-queue:
+			dispatch(event)
+		}
+	}
+}
+
+func dispatch(event Event) {
+	mu.RLock()
+	list := handlers[event.Type]
+	mu.RUnlock()
+	for _, handler := range list {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("eventbus: handler for %s panicked: %v", event.Type, r)
+				}
+			}()
+			handler(event)
+		}()
+	}
+}
@@ -0,0 +1,40 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProcessDelivery(t *testing.T) {
+	// Publish before Start is dropped.
+	Publish("test", "early")
+
+	received := make(chan Event, 4)
+	Subscribe("test", func(event Event) {
+		received <- event
+	})
+	Subscribe("test", func(event Event) {
+		panic("handler failure must not stop delivery")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Start(ctx, nil, "")
+	require.True(t, Started())
+
+	Publish("test", "1")
+	Publish("other", "ignored")
+	Publish("test", "2")
+	for _, key := range []string{"1", "2"} {
+		select {
+		case event := <-received:
+			require.Equal(t, key, event.Key)
+			require.True(t, event.FromSelf())
+		case <-time.After(time.Second):
+			t.Fatal("event not delivered")
+		}
+	}
+	require.Empty(t, received)
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "new_api"
+
+var enabled atomic.Bool
+
+var registry = prometheus.NewRegistry()
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "requests_total",
+		Help:      "Relay attempts sent to upstream channels, partitioned by outcome.",
+	}, []string{"channel_id", "channel_type", "model", "group", "result", "status_code"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "retries_total",
+		Help:      "Retries performed by the relay loop after a failed attempt.",
+	}, []string{"model", "group"})
+
+	upstreamFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "upstream_first_token_seconds",
+		Help:      "Time from dispatching the upstream request to the first response byte sent to the client.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 8, 13, 21, 34, 60},
+	}, []string{"channel_id", "model"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "upstream_duration_seconds",
+		Help:      "Total time spent on a single upstream attempt, including streaming.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300, 600},
+	}, []string{"channel_id", "model"})
+
+	channelAutoDisabled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "auto_disabled_total",
+		Help:      "Channels (or multi-key entries) automatically disabled after upstream errors.",
+	}, []string{"channel_id"})
+
+	channelAffinityLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel_affinity",
+		Name:      "lookups_total",
+		Help:      "Channel affinity cache lookups, partitioned by hit or miss.",
+	}, []string{"rule", "result"})
+
+	billingPreConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "pre_consumed_quota_total",
+		Help:      "Quota pre-consumed by billing sessions.",
+	}, []string{"source"})
+
+	billingRefunded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "refunded_quota_total",
+		Help:      "Pre-consumed quota returned after failed requests.",
+	}, []string{"source"})
+
+	billingSettled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "billing",
+		Name:      "settled_quota_total",
+		Help:      "Final quota charged by billing sessions after settlement.",
+	}, []string{"source"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayRetries,
+		upstreamFirstToken,
+		upstreamDuration,
+		channelAutoDisabled,
+		channelAffinityLookups,
+		billingPreConsumed,
+		billingRefunded,
+		billingSettled,
+	)
+}
+
+// SetEnabled toggles metric collection. All Observe/Inc helpers are no-ops while disabled.
+func SetEnabled(v bool) {
+	enabled.Store(v)
+}
+
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Handler returns the OpenMetrics/Prometheus exposition handler for the gateway registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
+
+// RelayAttempt describes the outcome of a single upstream attempt in the relay loop.
+type RelayAttempt struct {
+	ChannelId   int
+	ChannelType int
+	Model       string
+	Group       string
+	StatusCode  int
+	Success     bool
+	// FirstToken is zero when nothing was sent to the client (e.g. upstream error before streaming).
+	FirstToken time.Duration
+	Duration   time.Duration
+}
+
+func ObserveRelayAttempt(a RelayAttempt) {
+	if !Enabled() {
+		return
+	}
+	channelId := strconv.Itoa(a.ChannelId)
+	result := "error"
+	if a.Success {
+		result = "success"
+	}
+	relayRequests.WithLabelValues(channelId, strconv.Itoa(a.ChannelType), a.Model, a.Group, result, strconv.Itoa(a.StatusCode)).Inc()
+	if a.FirstToken > 0 {
+		upstreamFirstToken.WithLabelValues(channelId, a.Model).Observe(a.FirstToken.Seconds())
+	}
+	if a.Duration > 0 {
+		upstreamDuration.WithLabelValues(channelId, a.Model).Observe(a.Duration.Seconds())
+	}
+}
+
+func IncRelayRetry(model string, group string) {
+	if !Enabled() {
+		return
+	}
+	relayRetries.WithLabelValues(model, group).Inc()
+}
+
+func IncChannelAutoDisabled(channelId int) {
+	if !Enabled() {
+		return
+	}
+	channelAutoDisabled.WithLabelValues(strconv.Itoa(channelId)).Inc()
+}
+
+func ObserveChannelAffinityLookup(rule string, hit bool) {
+	if !Enabled() {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	channelAffinityLookups.WithLabelValues(rule, result).Inc()
+}
+
+func AddBillingPreConsumed(source string, quota int) {
+	if !Enabled() || quota <= 0 {
+		return
+	}
+	billingPreConsumed.WithLabelValues(source).Add(float64(quota))
+}
+
+func AddBillingRefunded(source string, quota int) {
+	if !Enabled() || quota <= 0 {
+		return
+	}
+	billingRefunded.WithLabelValues(source).Add(float64(quota))
+}
+
+func AddBillingSettled(source string, quota int) {
+	if !Enabled() || quota <= 0 {
+		return
+	}
+	billingSettled.WithLabelValues(source).Add(float64(quota))
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorsRegisteredOnce(t *testing.T) {
+	var already prometheus.AlreadyRegisteredError
+	require.True(t, errors.As(registry.Register(relayRequests), &already))
+	require.True(t, errors.As(registry.Register(billingSettled), &already))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	seen := make(map[string]bool)
+	for _, family := range families {
+		require.False(t, seen[family.GetName()], "duplicate metric family %s", family.GetName())
+		seen[family.GetName()] = true
+	}
+}
+
+func TestRelayAndBillingMetrics(t *testing.T) {
+	SetEnabled(false)
+	ObserveRelayAttempt(RelayAttempt{ChannelId: 7, ChannelType: 1, Model: "gpt-disabled", Group: "default", StatusCode: 200, Success: true})
+	require.Zero(t, testutil.ToFloat64(relayRequests.WithLabelValues("7", "1", "gpt-disabled", "default", "success", "200")))
+
+	SetEnabled(true)
+	t.Cleanup(func() { SetEnabled(false) })
+
+	ObserveRelayAttempt(RelayAttempt{ChannelId: 7, ChannelType: 1, Model: "gpt-test", Group: "default", StatusCode: 200, Success: true, FirstToken: time.Second, Duration: 2 * time.Second})
+	ObserveRelayAttempt(RelayAttempt{ChannelId: 7, ChannelType: 1, Model: "gpt-test", Group: "default", StatusCode: 502})
+	IncRelayRetry("gpt-test", "default")
+	require.Equal(t, float64(1), testutil.ToFloat64(relayRequests.WithLabelValues("7", "1", "gpt-test", "default", "success", "200")))
+	require.Equal(t, float64(1), testutil.ToFloat64(relayRequests.WithLabelValues("7", "1", "gpt-test", "default", "error", "502")))
+	require.Equal(t, float64(1), testutil.ToFloat64(relayRetries.WithLabelValues("gpt-test", "default")))
+	// 上游失败且未向客户端输出时不记录首字耗时
+	require.Equal(t, 1, testutil.CollectAndCount(upstreamFirstToken, "new_api_relay_upstream_first_token_seconds"))
+
+	AddBillingPreConsumed("wallet", 100)
+	AddBillingSettled("wallet", 80)
+	AddBillingRefunded("wallet", 0)
+	require.Equal(t, float64(100), testutil.ToFloat64(billingPreConsumed.WithLabelValues("wallet")))
+	require.Equal(t, float64(80), testutil.ToFloat64(billingSettled.WithLabelValues("wallet")))
+	require.Zero(t, testutil.CollectAndCount(billingRefunded))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, strings.Contains(rec.Body.String(), `new_api_billing_settled_quota_total{source="wallet"} 80`))
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/QuantumNous/new-api"
+
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Attribute keys shared by relay spans.
+const (
+	AttrChannelId        = attribute.Key("new_api.channel.id")
+	AttrChannelType      = attribute.Key("new_api.channel.type")
+	AttrModel            = attribute.Key("new_api.model")
+	AttrUpstreamModel    = attribute.Key("new_api.upstream_model")
+	AttrGroup            = attribute.Key("new_api.group")
+	AttrTokenId          = attribute.Key("new_api.token.id")
+	AttrUserId           = attribute.Key("new_api.user.id")
+	AttrRequestId        = attribute.Key("new_api.request_id")
+	AttrRetryIndex       = attribute.Key("new_api.retry_index")
+	AttrStream           = attribute.Key("new_api.stream")
+	AttrPromptTokens     = attribute.Key("new_api.usage.prompt_tokens")
+	AttrCompletionTokens = attribute.Key("new_api.usage.completion_tokens")
+	AttrTotalTokens      = attribute.Key("new_api.usage.total_tokens")
+	AttrQuota            = attribute.Key("new_api.billing.quota")
+	AttrPreConsumedQuota = attribute.Key("new_api.billing.pre_consumed_quota")
+	AttrTTFBMs           = attribute.Key("new_api.upstream.ttfb_ms")
+	AttrErrorCode        = attribute.Key("new_api.error_code")
+)
+
+// Config controls the tracer provider installed by Init.
+type Config struct {
+	Exporter    string
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+	// PropagateUpstream forwards the W3C trace context to upstream providers.
+	PropagateUpstream bool
+}
+
+var (
+	enabled           atomic.Bool
+	propagateUpstream atomic.Bool
+	propagator        = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+// Init installs the global tracer provider and returns its shutdown function. While tracing is not
+// initialized every helper in this package works on the no-op provider.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "new-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	sampler := sdktrace.ParentBased(sdktrace.AlwaysSample())
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	enabled.Store(true)
+	propagateUpstream.Store(cfg.PropagateUpstream)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(cfg.Exporter) {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "", ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			// 未配置时使用 OTEL_EXPORTER_OTLP_* 环境变量或默认的 localhost:4318
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter: %s", cfg.Exporter)
+	}
+}
+
+func Enabled() bool {
+	return enabled.Load()
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a child span of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Extract returns ctx carrying the remote span context from the incoming W3C traceparent header.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// InjectUpstream writes the trace context of ctx into an upstream request when forwarding is enabled.
+func InjectUpstream(ctx context.Context, header http.Header) {
+	if !Enabled() || !propagateUpstream.Load() {
+		return
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// SetAttributes adds attributes to the span in ctx, if any.
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// SetError marks span as failed.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceId returns the trace id of the span in ctx, or "" when the span is not sampled.
+func TraceId(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
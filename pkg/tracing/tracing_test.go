@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestPropagation(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, span := provider.Tracer("test").Start(Extract(context.Background(), incoming), "root")
+	defer span.End()
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceId(ctx))
+
+	upstream := http.Header{}
+	InjectUpstream(ctx, upstream)
+	require.Empty(t, upstream.Get("traceparent"))
+
+	enabled.Store(true)
+	propagateUpstream.Store(true)
+	t.Cleanup(func() {
+		enabled.Store(false)
+		propagateUpstream.Store(false)
+	})
+	InjectUpstream(ctx, upstream)
+	require.Contains(t, upstream.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NotContains(t, upstream.Get("traceparent"), "00f067aa0ba902b7")
+}
@@ -31,6 +31,14 @@ type Adaptor interface {
 	ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error)
 }
 
+// TokenCountAdaptor 由支持上游原生输入 token 计数的适配器实现
+type TokenCountAdaptor interface {
+	// SupportCountTokens 判断当前渠道、模型与请求格式是否支持原生计数
+	SupportCountTokens(info *relaycommon.RelayInfo) bool
+	// CountTokens 请求上游计数并返回输入 token 数，request 为 Claude 或 Gemini 格式的请求
+	CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error)
+}
+
 type TaskAdaptor interface {
 	Init(info *relaycommon.RelayInfo)
 
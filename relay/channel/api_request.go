@@ -1,11 +1,13 @@
 package channel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"regexp"
 	"strings"
 	"sync"
@@ -13,6 +15,7 @@ import (
 
 	common2 "github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -23,6 +26,8 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
@@ -292,6 +297,12 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
+	return DoApiRequestWithURL(a, c, info, fullRequestURL, requestBody)
+}
+
+// DoApiRequestWithURL 使用给定的请求地址发起请求，请求头与 Header Override 的处理与 DoApiRequest 相同，
+// 用于同一渠道下的附属接口（如 token 计数）
+func DoApiRequestWithURL(a Adaptor, c *gin.Context, info *common.RelayInfo, fullRequestURL string, requestBody io.Reader) (*http.Response, error) {
 	if common2.DebugEnabled {
 		println("fullRequestURL:", fullRequestURL)
 	}
@@ -318,6 +329,27 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	return resp, nil
 }
 
+// DoCountTokensRequest 以 JSON 请求上游 token 计数接口并将响应解析到 result
+func DoCountTokensRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, fullRequestURL string, body any, result any) error {
+	data, err := common2.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal count tokens request failed: %w", err)
+	}
+	resp, err := DoApiRequestWithURL(a, c, info, fullRequestURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read count tokens response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("count tokens failed with status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return common2.Unmarshal(respBody, result)
+}
+
 func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
@@ -515,20 +547,84 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	req, span := startUpstreamSpan(c, req, info)
+	defer span.End()
+	capture := service.CaptureUpstreamRequest(c, req)
 	resp, err := client.Do(req)
+	service.CaptureUpstreamResponse(capture, resp, err)
 	if err != nil {
+		tracing.SetError(span, err)
 		logger.LogError(c, "do request failed: "+err.Error())
 		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
 	}
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	service.ObserveMultiKeyRateLimit(c, info, resp)
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
+	if resp.StatusCode == http.StatusOK && common.HasResponseOverride(info) {
+		if err := applyResponseOverrideToBody(resp, info); err != nil {
+			return nil, err
+		}
+	}
 	return resp, nil
 }
 
+// startUpstreamSpan 为上游请求创建 span，记录首字节耗时，并按配置向上游透传 traceparent。
+// span 在收到响应头时结束，流式响应的耗时记录在 relay.stream 中
+func startUpstreamSpan(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Request, trace.Span) {
+	_, span := tracing.Tracer().Start(c.Request.Context(), "upstream.request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			tracing.AttrChannelId.Int(info.ChannelId),
+			tracing.AttrChannelType.Int(info.ChannelType),
+			tracing.AttrUpstreamModel.String(info.UpstreamModelName),
+		),
+	)
+	if !span.IsRecording() {
+		return req, span
+	}
+	start := time.Now()
+	ctx := trace.ContextWithSpan(req.Context(), span)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			span.SetAttributes(tracing.AttrTTFBMs.Int64(time.Since(start).Milliseconds()))
+			span.AddEvent("first_response_byte")
+		},
+	})
+	req = req.WithContext(ctx)
+	tracing.InjectUpstream(ctx, req.Header)
+	return req, span
+}
+
+// applyResponseOverrideToBody 对非流式 JSON 响应应用渠道响应改写，流式响应在 StreamScannerHandler 中逐块处理
+func applyResponseOverrideToBody(resp *http.Response, info *common.RelayInfo) error {
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "application/json") {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	result, err := common.ApplyResponseOverride(body, info, common.BuildResponseOverrideContext(info))
+	if err != nil {
+		if fixedErr, ok := common.AsParamOverrideReturnError(err); ok {
+			return common.NewAPIErrorFromParamOverride(fixedErr)
+		}
+		return types.NewError(err, types.ErrorCodeChannelResponseOverrideInvalid, types.ErrOptionWithSkipRetry())
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(result))
+	resp.ContentLength = int64(len(result))
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
 func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.BuildRequestURL(info)
 	if err != nil {
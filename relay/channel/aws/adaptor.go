@@ -182,3 +182,15 @@ func (a *Adaptor) GetModelList() (models []string) {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) SupportCountTokens(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == types.RelayFormatClaude && strings.Contains(getAwsModelID(info.UpstreamModelName), "anthropic.")
+}
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeRequest, ok := request.(*dto.ClaudeRequest)
+	if !ok {
+		return 0, fmt.Errorf("invalid request type, expected dto.ClaudeRequest, got %T", request)
+	}
+	return awsCountTokens(c, info, claudeRequest)
+}
@@ -349,3 +349,44 @@ func handleNovaRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor)
 	c.JSON(http.StatusOK, response)
 	return nil, &response.Usage
 }
+
+// awsCountTokens 使用 Bedrock CountTokens 接口统计 Claude 请求的输入 token 数。
+// 计数接口只接受基础模型 ID，不使用跨区域推理配置
+func awsCountTokens(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (int, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return 0, err
+	}
+	awsClaudeReq := &AwsClaudeRequest{
+		AnthropicVersion: "bedrock-2023-05-31",
+		System:           request.System,
+		Messages:         request.Messages,
+		MaxTokens:        1,
+		Tools:            request.Tools,
+		ToolChoice:       request.ToolChoice,
+		Thinking:         request.Thinking,
+	}
+	if request.MaxTokens != nil && *request.MaxTokens > 0 {
+		awsClaudeReq.MaxTokens = *request.MaxTokens
+	}
+	body, err := common.Marshal(awsClaudeReq)
+	if err != nil {
+		return 0, errors.Wrap(err, "marshal aws count tokens request fail")
+	}
+
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+	output, err := awsCli.CountTokens(ctx, &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(getAwsModelID(info.UpstreamModelName)),
+		Input: &bedrockruntimeTypes.CountTokensInputMemberInvokeModel{
+			Value: bedrockruntimeTypes.InvokeModelTokensRequest{Body: body},
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "aws count tokens fail")
+	}
+	if output.InputTokens == nil {
+		return 0, errors.New("aws count tokens response missing input tokens")
+	}
+	return int(*output.InputTokens), nil
+}
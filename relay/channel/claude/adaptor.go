@@ -110,3 +110,20 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) SupportCountTokens(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == types.RelayFormatClaude
+}
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeRequest, ok := request.(*dto.ClaudeRequest)
+	if !ok {
+		return 0, fmt.Errorf("invalid request type, expected dto.ClaudeRequest, got %T", request)
+	}
+	var result dto.ClaudeCountTokensResponse
+	fullRequestURL := fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl)
+	if err := channel.DoCountTokensRequest(a, c, info, fullRequestURL, claudeRequest.ToCountTokensRequest(info.UpstreamModelName), &result); err != nil {
+		return 0, err
+	}
+	return result.InputTokens, nil
+}
@@ -285,3 +285,24 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) SupportCountTokens(info *relaycommon.RelayInfo) bool {
+	return info.RelayFormat == types.RelayFormatGemini
+}
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	geminiRequest, ok := request.(*dto.GeminiChatRequest)
+	if !ok {
+		return 0, fmt.Errorf("invalid request type, expected dto.GeminiChatRequest, got %T", request)
+	}
+	version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+	fullRequestURL := fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName)
+	countRequest := dto.GeminiCountTokensUpstreamRequest{
+		GenerateContentRequest: geminiRequest.ToCountTokensContent("models/" + info.UpstreamModelName),
+	}
+	var result dto.GeminiCountTokensResponse
+	if err := channel.DoCountTokensRequest(a, c, info, fullRequestURL, countRequest, &result); err != nil {
+		return 0, err
+	}
+	return result.TotalTokens, nil
+}
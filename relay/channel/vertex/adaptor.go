@@ -420,3 +420,52 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) SupportCountTokens(info *relaycommon.RelayInfo) bool {
+	switch a.RequestMode {
+	case RequestModeClaude:
+		// API Key 模式仅支持 Google 发布的模型
+		return info.RelayFormat == types.RelayFormatClaude && info.ChannelOtherSettings.VertexKeyType != dto.VertexKeyTypeAPIKey
+	case RequestModeGemini:
+		return info.RelayFormat == types.RelayFormatGemini && !strings.HasPrefix(info.UpstreamModelName, "imagen")
+	}
+	return false
+}
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	switch a.RequestMode {
+	case RequestModeClaude:
+		claudeRequest, ok := request.(*dto.ClaudeRequest)
+		if !ok {
+			return 0, fmt.Errorf("invalid request type, expected dto.ClaudeRequest, got %T", request)
+		}
+		model := info.UpstreamModelName
+		if v, ok := claudeModelMap[info.UpstreamModelName]; ok {
+			model = v
+		}
+		fullRequestURL, err := a.getRequestUrl(info, "count-tokens", "rawPredict")
+		if err != nil {
+			return 0, err
+		}
+		var result dto.ClaudeCountTokensResponse
+		if err := channel.DoCountTokensRequest(a, c, info, fullRequestURL, claudeRequest.ToCountTokensRequest(model), &result); err != nil {
+			return 0, err
+		}
+		return result.InputTokens, nil
+	case RequestModeGemini:
+		geminiRequest, ok := request.(*dto.GeminiChatRequest)
+		if !ok {
+			return 0, fmt.Errorf("invalid request type, expected dto.GeminiChatRequest, got %T", request)
+		}
+		fullRequestURL, err := a.getRequestUrl(info, info.UpstreamModelName, "countTokens")
+		if err != nil {
+			return 0, err
+		}
+		var result dto.GeminiCountTokensResponse
+		if err := channel.DoCountTokensRequest(a, c, info, fullRequestURL, geminiRequest.ToCountTokensContent(""), &result); err != nil {
+			return 0, err
+		}
+		return result.TotalTokens, nil
+	}
+	return 0, errors.New("unsupported request mode")
+}
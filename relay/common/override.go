@@ -169,6 +169,30 @@ func ApplyParamOverrideWithRelayInfo(jsonData []byte, info *RelayInfo) ([]byte,
 	return result, nil
 }
 
+// ApplyResponseOverride 使用渠道 response_override 改写上游响应体（非流式 JSON 或单个 SSE data 块），
+// 规则与 param_override 相同。conditionContext 由调用方通过 BuildResponseOverrideContext 构建，流式响应可复用
+func ApplyResponseOverride(jsonData []byte, info *RelayInfo, conditionContext map[string]interface{}) ([]byte, error) {
+	responseOverride := getResponseOverrideMap(info)
+	if len(responseOverride) == 0 {
+		return jsonData, nil
+	}
+	return ApplyParamOverride(jsonData, responseOverride, conditionContext)
+}
+
+// BuildResponseOverrideContext 在 param_override 条件上下文的基础上增加 is_stream
+func BuildResponseOverrideContext(info *RelayInfo) map[string]interface{} {
+	ctx := BuildParamOverrideContext(info)
+	if ctx == nil {
+		return nil
+	}
+	ctx["is_stream"] = info.IsStream
+	return ctx
+}
+
+func HasResponseOverride(info *RelayInfo) bool {
+	return len(getResponseOverrideMap(info)) > 0
+}
+
 func getParamOverrideMap(info *RelayInfo) map[string]interface{} {
 	if info == nil || info.ChannelMeta == nil {
 		return nil
@@ -176,6 +200,13 @@ func getParamOverrideMap(info *RelayInfo) map[string]interface{} {
 	return info.ChannelMeta.ParamOverride
 }
 
+func getResponseOverrideMap(info *RelayInfo) map[string]interface{} {
+	if info == nil || info.ChannelMeta == nil {
+		return nil
+	}
+	return info.ChannelMeta.ResponseOverride
+}
+
 func getHeaderOverrideMap(info *RelayInfo) map[string]interface{} {
 	if info == nil || info.ChannelMeta == nil {
 		return nil
@@ -1931,6 +1931,75 @@ func TestRemoveDisabledFieldsAllowInferenceGeo(t *testing.T) {
 	assertJSONEqual(t, `{"inference_geo":"eu","store":true}`, string(out))
 }
 
+func TestApplyResponseOverride(t *testing.T) {
+	info := &RelayInfo{
+		OriginModelName: "public-alias",
+		IsStream:        true,
+		ChannelMeta: &ChannelMeta{
+			UpstreamModelName: "vendor-model-v2",
+			ResponseOverride: map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{
+						"mode": "move",
+						"from": "choices.0.delta.reasoning",
+						"to":   "choices.0.delta.reasoning_content",
+					},
+					map[string]interface{}{
+						"mode": "delete",
+						"path": "vendor_extra",
+					},
+					map[string]interface{}{
+						"mode":  "set",
+						"path":  "model",
+						"value": "public-alias",
+					},
+					map[string]interface{}{
+						"mode":  "set",
+						"path":  "choices.0.finish_reason",
+						"value": "stop",
+						"conditions": []interface{}{
+							map[string]interface{}{
+								"path":  "choices.0.finish_reason",
+								"mode":  "full",
+								"value": "eos",
+							},
+							map[string]interface{}{
+								"path":  "is_stream",
+								"mode":  "full",
+								"value": true,
+							},
+						},
+						"logic": "AND",
+					},
+				},
+			},
+		},
+	}
+
+	input := []byte(`{"model":"vendor-model-v2","vendor_extra":{"a":1},"choices":[{"delta":{"reasoning":"think"},"finish_reason":"eos"}]}`)
+	out, err := ApplyResponseOverride(input, info, BuildResponseOverrideContext(info))
+	if err != nil {
+		t.Fatalf("ApplyResponseOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"public-alias","choices":[{"delta":{"reasoning_content":"think"},"finish_reason":"stop"}]}`, string(out))
+
+	info.IsStream = false
+	out, err = ApplyResponseOverride(input, info, BuildResponseOverrideContext(info))
+	if err != nil {
+		t.Fatalf("ApplyResponseOverride returned error: %v", err)
+	}
+	assertJSONEqual(t, `{"model":"public-alias","choices":[{"delta":{"reasoning_content":"think"},"finish_reason":"eos"}]}`, string(out))
+
+	info.ChannelMeta.ResponseOverride = nil
+	out, err = ApplyResponseOverride(input, info, BuildResponseOverrideContext(info))
+	if err != nil {
+		t.Fatalf("ApplyResponseOverride returned error: %v", err)
+	}
+	if string(out) != string(input) {
+		t.Fatalf("expected body to be unchanged without response override, got: %s", out)
+	}
+}
+
 func assertJSONEqual(t *testing.T, want, got string) {
 	t.Helper()
 
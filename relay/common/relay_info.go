@@ -70,6 +70,7 @@ type ChannelMeta struct {
 	ChannelCreateTime    int64
 	ParamOverride        map[string]interface{}
 	HeadersOverride      map[string]interface{}
+	ResponseOverride     map[string]interface{}
 	ChannelSetting       dto.ChannelSettings
 	ChannelOtherSettings dto.ChannelOtherSettings
 	UpstreamModelName    string
@@ -84,8 +85,9 @@ type TokenCountMeta struct {
 
 type RelayInfo struct {
 	TokenId           int
-	TokenKey          string
+	TokenKey          string // 令牌缓存键（Token.CacheKey()），不是明文令牌
 	TokenGroup        string
+	OrgId             int // 令牌所属组织，非 0 时从组织钱包计费
 	UserId            int
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
@@ -150,6 +152,9 @@ type RelayInfo struct {
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
 
+	// ModelFallbackPath 跨模型降级时依次尝试的模型，第一个为用户请求的模型；未降级时为空
+	ModelFallbackPath []string
+
 	PriceData types.PriceData
 
 	Request dto.Request
@@ -188,6 +193,7 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 		ChannelCreateTime:    c.GetInt64("channel_create_time"),
 		ParamOverride:        paramOverride,
 		HeadersOverride:      headerOverride,
+		ResponseOverride:     common.GetContextKeyStringMap(c, constant.ContextKeyChannelResponseOverride),
 		UpstreamModelName:    common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
 		IsModelMapped:        false,
 		SupportStreamOptions: false,
@@ -462,6 +468,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrgId:          common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -485,6 +492,10 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		info.RelayMode = c.GetInt("relay_mode")
 	}
 
+	if fallbackPath, ok := common.GetContextKeyType[[]string](c, constant.ContextKeyModelFallbackPath); ok {
+		info.ModelFallbackPath = fallbackPath
+	}
+
 	if strings.HasPrefix(c.Request.URL.Path, "/pg") {
 		info.IsPlayground = true
 		info.RequestURLPath = strings.TrimPrefix(info.RequestURLPath, "/pg")
@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -50,6 +51,17 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	if cachedUsage, hit := service.TryServeResponseCache(c, info, request); hit {
+		postConsumeQuota(c, info, cachedUsage)
+		return nil
+	}
+
+	// PII 脱敏在缓存查询之后执行，缓存键与缓存内容均为原文
+	piiRedacted := service.ApplyPIIRedaction(c, info, request)
+	if piiRedacted {
+		defer service.FinishPIIRestore(c)
+	}
+
 	includeUsage := true
 	// 判断用户是否需要返回使用情况
 	if request.StreamOptions != nil {
@@ -86,6 +98,8 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		if newApiErr != nil {
 			return newApiErr
 		}
+		service.FinishPIIRestore(c)
+		service.SaveResponseCache(c, info, usage)
 
 		var containAudioTokens = usage.CompletionTokenDetails.AudioTokens > 0 || usage.PromptTokensDetails.AudioTokens > 0
 		var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
@@ -111,8 +125,22 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			}
 		}
 		requestBody = common.ReaderOnly(storage)
+		if piiRedacted {
+			body, err := storage.Bytes()
+			if err != nil {
+				return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+			}
+			body, err = service.RedactPIIRequestBody(c, body)
+			if err != nil {
+				return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			}
+			requestBody = bytes.NewReader(body)
+		}
 	} else {
+		_, convertSpan := tracing.Start(c.Request.Context(), "relay.convert_request")
 		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
+		tracing.SetError(convertSpan, err)
+		convertSpan.End()
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 		}
@@ -210,6 +238,9 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return newApiErr
 	}
 
+	service.FinishPIIRestore(c)
+	service.SaveResponseCache(c, info, usage.(*dto.Usage))
+
 	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
 	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
 
@@ -424,9 +455,11 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		service.RecordMultiKeyQuota(relayInfo, quota)
 	}
 
-	if err := service.SettleBilling(ctx, relayInfo, quota); err != nil {
+	service.RecordUsageTrace(ctx, promptTokens, completionTokens)
+	if err := service.SettleBilling(ctx, relayInfo, quota, totalTokens); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
 
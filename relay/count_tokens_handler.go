@@ -0,0 +1,40 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountTokensHelper 处理 Claude /v1/messages/count_tokens 与 Gemini :countTokens 请求。
+// 所选渠道支持原生计数时转发上游，否则（或上游计数失败时）在本地估算，返回输入 token 数及是否来自上游
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (int, bool, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	request := info.Request
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return 0, false, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	if operation_setting.GetCountTokensSetting().PreferUpstream {
+		if adaptor := GetAdaptor(info.ApiType); adaptor != nil {
+			adaptor.Init(info)
+			if counter, ok := adaptor.(channel.TokenCountAdaptor); ok && counter.SupportCountTokens(info) {
+				tokens, err := counter.CountTokens(c, info, request)
+				if err == nil {
+					return tokens, true, nil
+				}
+				logger.LogWarn(c, fmt.Sprintf("upstream count tokens failed, fallback to local estimate: %s", err.Error()))
+			}
+		}
+	}
+	return service.EstimateInputTokens(info.OriginModelName, request.GetTokenCountMeta()), false, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -42,6 +43,11 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 批处理任务按分组折扣计费
+	if common.GetContextKeyString(ctx, constant.ContextKeyBatchId) != "" {
+		groupRatioInfo.GroupRatio *= operation_setting.GetBatchDiscountRatio(relayInfo.UsingGroup)
+	}
+
 	return groupRatioInfo
 }
 
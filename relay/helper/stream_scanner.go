@@ -176,6 +176,11 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		})
 	}
 
+	var responseOverrideCtx map[string]interface{}
+	if relaycommon.HasResponseOverride(info) {
+		responseOverrideCtx = relaycommon.BuildResponseOverrideContext(info)
+	}
+
 	dataChan := make(chan string, 10)
 
 	wg.Add(1)
@@ -188,6 +193,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			common.SafeSendBool(stopChan, true)
 		}()
 		for data := range dataChan {
+			data = applyStreamResponseOverride(c, info, data, responseOverrideCtx)
 			writeMutex.Lock()
 			success := dataHandler(data)
 			writeMutex.Unlock()
@@ -281,3 +287,17 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		logger.LogInfo(c, "client disconnected")
 	}
 }
+
+// applyStreamResponseOverride 对单个 SSE data 块应用渠道响应改写。
+// 流式响应已开始输出，改写失败（包括 return_error）时记录日志并保留原始数据
+func applyStreamResponseOverride(c *gin.Context, info *relaycommon.RelayInfo, data string, conditionContext map[string]interface{}) string {
+	if conditionContext == nil || !strings.HasPrefix(data, "{") {
+		return data
+	}
+	result, err := relaycommon.ApplyResponseOverride([]byte(data), info, conditionContext)
+	if err != nil {
+		logger.LogWarn(c, "failed to apply response override to stream chunk: "+err.Error())
+		return data
+	}
+	return string(result)
+}
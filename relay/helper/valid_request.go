@@ -322,6 +322,25 @@ func GetAndValidateGeminiRequest(c *gin.Context) (*dto.GeminiChatRequest, error)
 	return request, nil
 }
 
+// GetAndValidateCountTokensRequest 解析 Claude /v1/messages/count_tokens 与 Gemini :countTokens 请求
+func GetAndValidateCountTokensRequest(c *gin.Context, format types.RelayFormat) (dto.Request, error) {
+	switch format {
+	case types.RelayFormatClaude:
+		return GetAndValidateClaudeRequest(c)
+	case types.RelayFormatGemini:
+		countRequest := &dto.GeminiCountTokensRequest{}
+		if err := common.UnmarshalBodyReusable(c, countRequest); err != nil {
+			return nil, err
+		}
+		request := countRequest.ToGeminiChatRequest()
+		if len(request.Contents) == 0 {
+			return nil, errors.New("contents is required")
+		}
+		return request, nil
+	}
+	return nil, fmt.Errorf("unsupported count tokens format: %s", format)
+}
+
 func GetAndValidateGeminiEmbeddingRequest(c *gin.Context) (*dto.GeminiEmbeddingRequest, error) {
 	request := &dto.GeminiEmbeddingRequest{}
 	err := common.UnmarshalBodyReusable(c, request)
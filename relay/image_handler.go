@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
@@ -53,7 +54,10 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		}
 		requestBody = common.ReaderOnly(storage)
 	} else {
+		_, convertSpan := tracing.Start(c.Request.Context(), "relay.convert_request")
 		convertedRequest, err := adaptor.ConvertImageRequest(c, info, *request)
+		tracing.SetError(convertSpan, err)
+		convertSpan.End()
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed)
 		}
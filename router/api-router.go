@@ -70,6 +70,7 @@ func SetApiRouter(router *gin.Engine) {
 			{
 				selfRoute.GET("/self/groups", controller.GetUserGroups)
 				selfRoute.GET("/self", controller.GetSelf)
+				selfRoute.GET("/self/budget", controller.GetSelfBudget)
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
@@ -83,6 +84,8 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.GET("/topup/info", controller.GetTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
+				selfRoute.POST("/topup/cancel", controller.CancelTopUp)
+				selfRoute.GET("/topup/invoice/:id", controller.GetTopUpInvoice)
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestEpay)
 				selfRoute.POST("/amount", controller.RequestAmount)
@@ -91,6 +94,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.PUT("/setting/invoice", controller.UpdateUserInvoiceSetting)
 
 				// 2FA routes
 				selfRoute.GET("/2fa/status", controller.Get2FAStatus)
@@ -114,11 +118,16 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", controller.AdminRefundTopUp)
+				adminRoute.POST("/topup/sync", controller.AdminSyncTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id/oauth/bindings", controller.GetUserOAuthBindingsByAdmin)
 				adminRoute.DELETE("/:id/oauth/bindings/:provider_id", controller.UnbindCustomOAuthByAdmin)
 				adminRoute.DELETE("/:id/bindings/:binding_type", controller.AdminClearUserBinding)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/budget", controller.GetUserBudget)
+				adminRoute.PUT("/:id/budget", controller.UpdateUserBudget)
+				adminRoute.DELETE("/:id/budget", controller.DeleteUserBudget)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
@@ -158,6 +167,43 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
 		}
 
+		// Organizations (shared wallet, members, org-owned tokens)
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/self", controller.GetSelfOrganizations)
+			orgRoute.POST("/", controller.CreateOrganization)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+			orgRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			orgRoute.POST("/:id/members", controller.AddOrganizationMember)
+			orgRoute.PUT("/:id/members/:user_id", controller.UpdateOrganizationMember)
+			orgRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			orgRoute.POST("/:id/deposit", middleware.CriticalRateLimit(), controller.DepositOrganizationQuota)
+			orgRoute.GET("/:id/tokens", controller.GetOrganizationTokens)
+			orgRoute.DELETE("/:id/tokens/:token_id", controller.DeleteOrganizationToken)
+			orgRoute.GET("/:id/logs", controller.GetOrganizationLogs)
+		}
+		orgAdminRoute := apiRouter.Group("/org/admin")
+		orgAdminRoute.Use(middleware.AdminAuth())
+		{
+			orgAdminRoute.GET("/list", controller.AdminListOrganizations)
+			orgAdminRoute.POST("/:id/quota", controller.AdminAdjustOrganizationQuota)
+			orgAdminRoute.PUT("/:id/status", controller.AdminUpdateOrganizationStatus)
+		}
+
+		// Request/response capture for debugging relay conversions (root only, captures contain user payloads)
+		captureRoute := apiRouter.Group("/capture")
+		captureRoute.Use(middleware.RootAuth())
+		{
+			captureRoute.GET("/", controller.GetRequestCaptures)
+			captureRoute.GET("/:request_id", controller.GetRequestCapture)
+			captureRoute.DELETE("/:request_id", controller.DeleteRequestCapture)
+			captureRoute.PUT("/token/:id", controller.UpdateTokenCaptureWindow)
+			captureRoute.PUT("/channel/:id", controller.UpdateChannelCaptureWindow)
+		}
+
 		// Subscription payment callbacks (no auth)
 		apiRouter.POST("/subscription/epay/notify", controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/notify", controller.SubscriptionEpayNotify)
@@ -168,11 +214,21 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/history", controller.GetOptionHistory)
+			optionRoute.POST("/rollback", controller.RollbackOption)
 			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
 			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
+		// 声明式配置快照导出与导入
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth())
+		{
+			configRoute.GET("/export", controller.ExportConfigSnapshot)
+			configRoute.POST("/export/plain", middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.ExportConfigSnapshotPlain)
+			configRoute.POST("/import", controller.ImportConfigSnapshot)
+		}
 
 		// Custom OAuth provider management (root only)
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
@@ -204,6 +260,7 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
+			channelRoute.GET("/health", controller.GetChannelHealthSummary)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
 			channelRoute.GET("/:id", controller.GetChannel)
@@ -229,6 +286,11 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/:id/codex/oauth/complete", controller.CompleteCodexOAuthForChannel)
 			channelRoute.POST("/:id/codex/refresh", controller.RefreshCodexChannelCredential)
 			channelRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
+			channelRoute.GET("/:id/breaker", controller.GetChannelBreaker)
+			channelRoute.DELETE("/:id/breaker", controller.ResetChannelBreaker)
+			channelRoute.GET("/:id/health", controller.GetChannelHealth)
+			channelRoute.GET("/:id/maintenance", controller.GetChannelMaintenance)
+			channelRoute.POST("/:id/maintenance", controller.UpdateChannelMaintenance)
 			channelRoute.POST("/ollama/pull", controller.OllamaPullModel)
 			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
 			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
@@ -251,6 +313,9 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.GET("/:id/budget", controller.GetTokenBudget)
+			tokenRoute.PUT("/:id/budget", controller.UpdateTokenBudget)
+			tokenRoute.DELETE("/:id/budget", controller.DeleteTokenBudget)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
@@ -0,0 +1,17 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	// 配置了独立监听地址时，由 main 单独启动指标服务，不在主服务上暴露
+	if !constant.MetricsEnabled || constant.MetricsListenAddr != "" {
+		return
+	}
+	router.GET("/metrics", middleware.RouteTag("metrics"), middleware.MetricsAuth(), gin.WrapH(metrics.Handler()))
+}
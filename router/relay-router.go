@@ -80,6 +80,26 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// batch related routes（由网关逐条转发执行，不经过 Distribute）
+		batchRouter := relayV1Router.Group("")
+		batchRouter.GET("/files", controller.ListFiles)
+		batchRouter.POST("/files", controller.UploadFile)
+		batchRouter.GET("/files/:id", controller.GetFile)
+		batchRouter.DELETE("/files/:id", controller.DeleteFile)
+		batchRouter.GET("/files/:id/content", controller.GetFileContent)
+		batchRouter.POST("/batches", controller.CreateBatch)
+		batchRouter.GET("/batches", controller.ListBatches)
+		batchRouter.GET("/batches/:id", controller.GetBatch)
+		batchRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+	}
+	{
+		// 网关响应存储（需开启 responses_store_setting，不经过 Distribute）
+		responsesStoreRouter := relayV1Router.Group("")
+		responsesStoreRouter.GET("/responses/:id", controller.GetResponse)
+		responsesStoreRouter.DELETE("/responses/:id", controller.DeleteResponse)
+		responsesStoreRouter.GET("/responses/:id/input_items", controller.ListResponseInputItems)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -89,6 +109,9 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		httpRouter.POST("/messages/count_tokens", func(c *gin.Context) {
+			controller.RelayCountTokens(c, types.RelayFormatClaude)
+		})
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -142,9 +165,7 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/engines/:model/embeddings", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
-		httpRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		httpRouter.POST("/models/*path", controller.RelayGemini)
 
 		// other relay routes
 		httpRouter.POST("/moderations", func(c *gin.Context) {
@@ -153,11 +174,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -196,9 +212,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter.Use(middleware.Distribute())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
-		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		relayGeminiRouter.POST("/models/*path", controller.RelayGemini)
 	}
 }
 
@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/tracing"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
@@ -12,6 +14,7 @@ import (
 const (
 	BillingSourceWallet       = "wallet"
 	BillingSourceSubscription = "subscription"
+	BillingSourceOrgWallet    = "org_wallet"
 )
 
 // PreConsumeBilling 根据用户计费偏好创建 BillingSession 并执行预扣费。
@@ -31,9 +34,24 @@ func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycom
 
 // SettleBilling 执行计费结算。如果 RelayInfo 上有 BillingSession 则通过 session 结算，
 // 否则回退到旧的 PostConsumeQuota 路径（兼容按次计费等场景）。
-func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuota int) error {
+// 结算后按实际 token 数与额度校正用量限流的预占计数，totalTokens 未知时传 -1 保留预估值。
+func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuota int, totalTokens int) (err error) {
+	defer ReconcileUsageRateLimit(ctx, totalTokens, actualQuota)
+	preConsumedQuota := relayInfo.FinalPreConsumedQuota
 	if relayInfo.Billing != nil {
-		preConsumed := relayInfo.Billing.GetPreConsumedQuota()
+		preConsumedQuota = relayInfo.Billing.GetPreConsumedQuota()
+	}
+	_, span := tracing.Start(traceContext(ctx), "billing.settle",
+		tracing.AttrQuota.Int(actualQuota),
+		tracing.AttrPreConsumedQuota.Int(preConsumedQuota),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	if relayInfo.Billing != nil {
+		preConsumed := preConsumedQuota
 		delta := actualQuota - preConsumed
 
 		if delta > 0 {
@@ -62,7 +80,7 @@ func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuo
 		if actualQuota != 0 {
 			if relayInfo.BillingSource == BillingSourceSubscription {
 				checkAndSendSubscriptionQuotaNotify(relayInfo)
-			} else {
+			} else if relayInfo.BillingSource != BillingSourceOrgWallet {
 				checkAndSendQuotaNotify(relayInfo, actualQuota-preConsumed, preConsumed)
 			}
 		}
@@ -76,3 +94,19 @@ func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuo
 	}
 	return nil
 }
+
+// RecordUsageTrace 将本次请求的 token 用量记录到当前尝试的 span 上
+func RecordUsageTrace(ctx *gin.Context, promptTokens int, completionTokens int) {
+	tracing.SetAttributes(traceContext(ctx),
+		tracing.AttrPromptTokens.Int(promptTokens),
+		tracing.AttrCompletionTokens.Int(completionTokens),
+		tracing.AttrTotalTokens.Int(promptTokens+completionTokens),
+	)
+}
+
+func traceContext(ctx *gin.Context) context.Context {
+	if ctx == nil || ctx.Request == nil {
+		return context.Background()
+	}
+	return ctx.Request.Context()
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+type budgetTarget struct {
+	scope    string
+	targetId int
+}
+
+func budgetTargets(userId int, tokenId int) []budgetTarget {
+	targets := make([]budgetTarget, 0, 2)
+	if tokenId > 0 {
+		targets = append(targets, budgetTarget{scope: model.BudgetScopeToken, targetId: tokenId})
+	}
+	if userId > 0 {
+		targets = append(targets, budgetTarget{scope: model.BudgetScopeUser, targetId: userId})
+	}
+	return targets
+}
+
+func budgetScopeName(scope string) string {
+	if scope == model.BudgetScopeToken {
+		return "令牌"
+	}
+	return "用户"
+}
+
+func budgetExceededError(budget *model.Budget) error {
+	if latest, err := model.GetBudgetById(budget.Id); err == nil {
+		budget = latest
+	}
+	return fmt.Errorf("%s budget exceeded: used %s of %s in the current %s window, resets at %s",
+		budget.Scope, logger.FormatQuota(budget.UsedQuota), logger.FormatQuota(budget.Quota), budget.Period,
+		time.Unix(budget.NextResetTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+// ReserveBudgets 预扣令牌额度时占用令牌与用户的预算窗口额度，任一预算不足时回滚并返回错误
+func ReserveBudgets(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if quota <= 0 {
+		return CheckBudgets(relayInfo)
+	}
+	reserved := make([]*model.Budget, 0, 2)
+	rollback := func() {
+		for _, budget := range reserved {
+			if err := model.AdjustBudgetUsedQuota(budget.Id, -quota); err != nil {
+				common.SysLog(fmt.Sprintf("failed to rollback budget %d: %s", budget.Id, err.Error()))
+			}
+		}
+	}
+	for _, target := range budgetTargets(relayInfo.UserId, relayInfo.TokenId) {
+		budget, err := model.GetBudgetWithCache(target.scope, target.targetId)
+		if err != nil {
+			rollback()
+			return err
+		}
+		if budget == nil {
+			continue
+		}
+		ok, err := model.ReserveBudgetQuota(budget.Id, quota)
+		if err != nil {
+			rollback()
+			return err
+		}
+		if !ok {
+			rollback()
+			return budgetExceededError(budget)
+		}
+		reserved = append(reserved, budget)
+	}
+	for _, budget := range reserved {
+		checkAndSendBudgetNotify(budget.Id)
+	}
+	return nil
+}
+
+// CheckBudgets 仅检查预算是否已用尽，用于未预扣费（信任额度）的请求
+func CheckBudgets(relayInfo *relaycommon.RelayInfo) error {
+	for _, target := range budgetTargets(relayInfo.UserId, relayInfo.TokenId) {
+		budget, err := model.GetBudgetWithCache(target.scope, target.targetId)
+		if err != nil {
+			return err
+		}
+		if budget == nil {
+			continue
+		}
+		latest, err := model.GetBudgetById(budget.Id)
+		if err != nil {
+			return err
+		}
+		if latest.UsedQuota >= latest.Quota {
+			return budgetExceededError(latest)
+		}
+	}
+	return nil
+}
+
+// AdjustBudgets 按实际消耗调整预算已用额度，delta > 0 表示补扣，delta < 0 表示退还
+func AdjustBudgets(userId int, tokenId int, delta int) {
+	if delta == 0 {
+		return
+	}
+	for _, target := range budgetTargets(userId, tokenId) {
+		budget, err := model.GetBudgetWithCache(target.scope, target.targetId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to get budget (%s %d): %s", target.scope, target.targetId, err.Error()))
+			continue
+		}
+		if budget == nil {
+			continue
+		}
+		if err := model.AdjustBudgetUsedQuota(budget.Id, delta); err != nil {
+			common.SysLog(fmt.Sprintf("failed to adjust budget %d (delta=%d): %s", budget.Id, delta, err.Error()))
+			continue
+		}
+		if delta > 0 {
+			checkAndSendBudgetNotify(budget.Id)
+		}
+	}
+}
+
+// checkAndSendBudgetNotify 预算使用达到提醒档位时通知预算所属用户
+func checkAndSendBudgetNotify(budgetId int) {
+	gopool.Go(func() {
+		budget, err := model.GetBudgetById(budgetId)
+		if err != nil || budget.Quota <= 0 {
+			return
+		}
+		percent := operation_setting.GetBudgetNotifyPercent(budget.UsedQuota * 100 / budget.Quota)
+		if percent == 0 || percent <= budget.NotifiedPercent {
+			return
+		}
+		marked, err := model.MarkBudgetNotified(budget.Id, percent)
+		if err != nil || !marked {
+			return
+		}
+		user, err := model.GetUserCache(budget.UserId)
+		if err != nil {
+			return
+		}
+		prompt := fmt.Sprintf("%s预算已使用 %d%%", budgetScopeName(budget.Scope), percent)
+		content := "{{value}}（{{value}} #{{value}}），本周期已用 {{value}} / {{value}}，将于 {{value}} 重置。"
+		values := []interface{}{
+			prompt,
+			budgetScopeName(budget.Scope),
+			budget.TargetId,
+			logger.FormatQuota(budget.UsedQuota),
+			logger.FormatQuota(budget.Quota),
+			time.Unix(budget.NextResetTime, 0).Format("2006-01-02 15:04:05"),
+		}
+		if err := NotifyUser(budget.UserId, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyTypeBudgetWarning, prompt, content, values)); err != nil {
+			common.SysError(fmt.Sprintf("failed to send budget notify to user %d: %s", budget.UserId, err.Error()))
+		}
+	})
+}
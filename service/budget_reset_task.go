@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	budgetResetTickInterval = 1 * time.Minute
+	budgetResetBatchSize    = 300
+)
+
+var (
+	budgetResetOnce    sync.Once
+	budgetResetRunning atomic.Bool
+)
+
+func StartBudgetResetTask() {
+	budgetResetOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("budget reset task started: tick=%s", budgetResetTickInterval))
+			ticker := time.NewTicker(budgetResetTickInterval)
+			defer ticker.Stop()
+
+			runBudgetResetOnce()
+			for range ticker.C {
+				runBudgetResetOnce()
+			}
+		})
+	})
+}
+
+func runBudgetResetOnce() {
+	if !budgetResetRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer budgetResetRunning.Store(false)
+
+	ctx := context.Background()
+	totalReset := 0
+	for {
+		n, err := model.ResetDueBudgets(budgetResetBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("budget reset task failed: %v", err))
+			return
+		}
+		totalReset += n
+		if n < budgetResetBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && totalReset > 0 {
+		logger.LogDebug(ctx, "budget reset: reset_count=%d", totalReset)
+	}
+}
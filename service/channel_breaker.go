@@ -0,0 +1,45 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// RecordChannelBreakerResult 将一次上游尝试的结果计入渠道熔断器
+// 客户端请求错误（参数错误、敏感词等）与渠道健康无关，不计入统计
+func RecordChannelBreakerResult(channelId int, modelName string, apiErr *types.NewAPIError, latency time.Duration) {
+	if channelId <= 0 {
+		return
+	}
+	failed, ok := classifyChannelBreakerResult(apiErr)
+	if !ok {
+		return
+	}
+	model.RecordChannelBreakerResult(channelId, modelName, failed, latency)
+}
+
+func classifyChannelBreakerResult(apiErr *types.NewAPIError) (failed bool, record bool) {
+	if apiErr == nil {
+		return false, true
+	}
+	if types.IsChannelError(apiErr) {
+		return true, true
+	}
+	if types.IsSkipRetryError(apiErr) {
+		return false, false
+	}
+	code := apiErr.StatusCode
+	switch {
+	case code < 100 || code >= 500:
+		return true, true
+	case code == http.StatusTooManyRequests, code == http.StatusUnauthorized,
+		code == http.StatusForbidden, code == http.StatusRequestTimeout:
+		return true, true
+	case code >= 400:
+		return false, false
+	}
+	return false, true
+}
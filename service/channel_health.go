@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// RecordChannelHealth 将一次上游尝试的结果计入渠道健康统计，keyIndex 为 -1 表示非多 Key 渠道
+func RecordChannelHealth(channelId int, modelName string, keyIndex int, apiErr *types.NewAPIError, latency time.Duration, ttft time.Duration) {
+	if channelId <= 0 {
+		return
+	}
+	model.RecordChannelHealthSample(model.ChannelHealthSample{
+		ChannelId:  channelId,
+		Model:      modelName,
+		KeyIndex:   keyIndex,
+		ErrorClass: classifyChannelHealthError(apiErr),
+		Latency:    latency,
+		TTFT:       ttft,
+	})
+}
+
+// classifyChannelHealthError 将上游错误归类，成功时返回空字符串
+func classifyChannelHealthError(apiErr *types.NewAPIError) string {
+	if apiErr == nil {
+		return ""
+	}
+	var netErr net.Error
+	if errors.Is(apiErr, context.DeadlineExceeded) || (errors.As(apiErr, &netErr) && netErr.Timeout()) ||
+		apiErr.GetErrorCode() == types.ErrorCodeChannelResponseTimeExceeded {
+		return model.ChannelHealthErrorTimeout
+	}
+	if types.IsChannelError(apiErr) {
+		return model.ChannelHealthErrorChannel
+	}
+	if apiErr.GetErrorCode() == types.ErrorCodeDoRequestFailed {
+		return model.ChannelHealthErrorNetwork
+	}
+	code := apiErr.StatusCode
+	switch {
+	case code == http.StatusTooManyRequests:
+		return model.ChannelHealthErrorRateLimit
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return model.ChannelHealthErrorAuth
+	case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+		return model.ChannelHealthErrorTimeout
+	case code < 100:
+		return model.ChannelHealthErrorNetwork
+	case code >= 500:
+		return model.ChannelHealthErrorServer
+	case code >= 400:
+		return model.ChannelHealthErrorClient
+	}
+	return model.ChannelHealthErrorOther
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// channelInFlight 渠道 ID -> 本节点正在处理的上游请求数，用于判断维护中的渠道是否已排空
+var channelInFlight sync.Map
+
+// AcquireChannelInFlight 记录一个正在处理的上游请求，返回的函数在请求结束时调用
+func AcquireChannelInFlight(channelId int) func() {
+	v, _ := channelInFlight.LoadOrStore(channelId, &atomic.Int64{})
+	counter := v.(*atomic.Int64)
+	counter.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			counter.Add(-1)
+		})
+	}
+}
+
+// GetChannelInFlight 返回渠道在本节点正在处理的上游请求数
+func GetChannelInFlight(channelId int) int64 {
+	v, ok := channelInFlight.Load(channelId)
+	if !ok {
+		return 0
+	}
+	return v.(*atomic.Int64).Load()
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMultiKeyCooldown = time.Minute
+	maxMultiKeyCooldown     = 24 * time.Hour
+)
+
+func isMultiKeyRateLimitMode(c *gin.Context) bool {
+	return common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) &&
+		constant.MultiKeyMode(common.GetContextKeyString(c, constant.ContextKeyChannelMultiKeyMode)) == constant.MultiKeyModeRateLimit
+}
+
+// ObserveMultiKeyRateLimit 限流感知模式下根据上游响应冷却当前 Key：
+// 429 时按 retry-after 或限流重置时间冷却，x-ratelimit-remaining-* 为 0 时提前冷却到对应的重置时间
+func ObserveMultiKeyRateLimit(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) {
+	if resp == nil || info == nil || info.ChannelMeta == nil || !isMultiKeyRateLimitMode(c) {
+		return
+	}
+	now := time.Now()
+	cooldown, reason := multiKeyCooldownFromResponse(resp.StatusCode, resp.Header, now)
+	if cooldown == 0 {
+		return
+	}
+	if cooldown < 0 {
+		cooldown = multiKeyDefaultCooldown(info)
+	}
+	common.SysLog(fmt.Sprintf("channel #%d key #%d cooling down for %s: %s", info.ChannelId, info.ChannelMultiKeyIndex, cooldown, reason))
+	model.SetMultiKeyCooldown(info.ChannelId, info.ChannelMultiKeyIndex, now.Add(cooldown), reason)
+}
+
+// multiKeyDefaultCooldown 上游没有给出重置时间时使用的冷却时长
+func multiKeyDefaultCooldown(info *relaycommon.RelayInfo) time.Duration {
+	if seconds := info.ChannelOtherSettings.MultiKeyCooldownSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultMultiKeyCooldown
+}
+
+// IsMultiKeyRateLimited 限流感知模式下 429 只冷却 Key，不触发自动禁用
+func IsMultiKeyRateLimited(c *gin.Context, err *types.NewAPIError) bool {
+	return err != nil && err.StatusCode == http.StatusTooManyRequests && isMultiKeyRateLimitMode(c)
+}
+
+// RecordMultiKeyQuota 配置了单 Key 每日额度上限时累加当前 Key 的消耗
+func RecordMultiKeyQuota(relayInfo *relaycommon.RelayInfo, quota int) {
+	if relayInfo == nil || relayInfo.ChannelMeta == nil || !relayInfo.ChannelIsMultiKey {
+		return
+	}
+	if relayInfo.ChannelOtherSettings.MultiKeyDailyQuotaLimit <= 0 {
+		return
+	}
+	model.RecordMultiKeyQuota(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, quota)
+}
+
+// multiKeyCooldownFromResponse 计算 Key 需要冷却的时长，无需冷却时返回 0。
+// 429 且上游未给出任何重置时间时返回 -1，由调用方使用默认冷却时长
+func multiKeyCooldownFromResponse(statusCode int, header http.Header, now time.Time) (time.Duration, string) {
+	if statusCode == http.StatusTooManyRequests {
+		if raw := header.Get("Retry-After-Ms"); raw != "" {
+			if ms, err := strconv.ParseFloat(raw, 64); err == nil && ms > 0 {
+				return clampMultiKeyCooldown(time.Duration(ms * float64(time.Millisecond))), "retry-after-ms"
+			}
+		}
+		if raw := header.Get("Retry-After"); raw != "" {
+			if d, ok := parseRateLimitReset(raw, now); ok {
+				return clampMultiKeyCooldown(d), "retry-after"
+			}
+		}
+	}
+	var cooldown time.Duration
+	reason := ""
+	exhausted := false
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if len(values) == 0 || !strings.Contains(lower, "ratelimit") || !strings.Contains(lower, "remaining") {
+			continue
+		}
+		remaining, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil || remaining > 0 {
+			continue
+		}
+		exhausted = true
+		resetName := strings.Replace(lower, "remaining", "reset", 1)
+		if d, ok := parseRateLimitReset(header.Get(resetName), now); ok && d > cooldown {
+			cooldown = d
+			reason = lower + " exhausted"
+		}
+	}
+	if cooldown > 0 {
+		return clampMultiKeyCooldown(cooldown), reason
+	}
+	if statusCode == http.StatusTooManyRequests {
+		return -1, "rate limited"
+	}
+	if exhausted {
+		return -1, "rate limit exhausted"
+	}
+	return 0, ""
+}
+
+// parseRateLimitReset 解析限流重置时间，支持秒数、Unix 时间戳、Go duration（如 6m0s）、RFC3339 与 HTTP 日期
+func parseRateLimitReset(raw string, now time.Time) (time.Duration, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, false
+	}
+	if value, err := strconv.ParseFloat(raw, 64); err == nil {
+		if value <= 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+			return 0, false
+		}
+		// 大于 1e9 视为 Unix 时间戳
+		if value > 1e9 {
+			d := time.Unix(int64(value), 0).Sub(now)
+			return d, d > 0
+		}
+		return time.Duration(value * float64(time.Second)), true
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return d, d > 0
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		d := t.Sub(now)
+		return d, d > 0
+	}
+	if t, err := http.ParseTime(raw); err == nil {
+		d := t.Sub(now)
+		return d, d > 0
+	}
+	return 0, false
+}
+
+func clampMultiKeyCooldown(d time.Duration) time.Duration {
+	if d > maxMultiKeyCooldown {
+		return maxMultiKeyCooldown
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiKeyCooldownFromResponse(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	cooldown, reason := multiKeyCooldownFromResponse(http.StatusTooManyRequests, header, now)
+	require.Equal(t, 30*time.Second, cooldown)
+	require.Equal(t, "retry-after", reason)
+
+	// 成功响应中剩余请求数为 0 时提前冷却到重置时间
+	header = http.Header{}
+	header.Set("X-Ratelimit-Remaining-Requests", "0")
+	header.Set("X-Ratelimit-Reset-Requests", "6m0s")
+	header.Set("X-Ratelimit-Remaining-Tokens", "1200")
+	header.Set("X-Ratelimit-Reset-Tokens", "20ms")
+	cooldown, _ = multiKeyCooldownFromResponse(http.StatusOK, header, now)
+	require.Equal(t, 6*time.Minute, cooldown)
+
+	header = http.Header{}
+	header.Set("Anthropic-Ratelimit-Tokens-Remaining", "0")
+	header.Set("Anthropic-Ratelimit-Tokens-Reset", now.Add(90*time.Second).Format(time.RFC3339))
+	cooldown, _ = multiKeyCooldownFromResponse(http.StatusOK, header, now)
+	require.Equal(t, 90*time.Second, cooldown)
+
+	// 429 没有任何重置时间时由调用方使用默认冷却时长
+	cooldown, _ = multiKeyCooldownFromResponse(http.StatusTooManyRequests, http.Header{}, now)
+	require.Less(t, cooldown, time.Duration(0))
+
+	cooldown, _ = multiKeyCooldownFromResponse(http.StatusOK, http.Header{}, now)
+	require.Zero(t, cooldown)
+
+	header = http.Header{}
+	header.Set("Retry-After", now.Add(48*time.Hour).Format(http.TimeFormat))
+	cooldown, _ = multiKeyCooldownFromResponse(http.StatusTooManyRequests, header, now)
+	require.Equal(t, maxMultiKeyCooldown, cooldown)
+}
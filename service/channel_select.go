@@ -2,12 +2,15 @@ package service
 
 import (
 	"errors"
+	"net/http"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
 )
 
@@ -160,3 +163,22 @@ func CacheGetRandomSatisfiedChannel(param *RetryParam) (*model.Channel, string,
 	}
 	return channel, selectGroup, nil
 }
+
+// RecordChannelSelectionSample 将一次上游尝试的耗时与 429/5xx 结果计入自适应渠道选择统计
+// 客户端请求错误与上游健康无关，不计入统计
+func RecordChannelSelectionSample(channelId int, modelName string, apiErr *types.NewAPIError, latency time.Duration, ttft time.Duration) {
+	if channelId <= 0 {
+		return
+	}
+	throttledOrFailed := false
+	if apiErr != nil {
+		code := apiErr.StatusCode
+		switch {
+		case types.IsChannelError(apiErr), code < 100, code >= 500, code == http.StatusTooManyRequests:
+			throttledOrFailed = true
+		default:
+			return
+		}
+	}
+	model.RecordChannelSelectionSample(channelId, modelName, latency, ttft, throttledOrFailed)
+}
@@ -51,7 +51,11 @@ func RefreshCodexChannelCredential(ctx context.Context, channelID int, opts Code
 		return nil, nil, fmt.Errorf("channel type is not Codex")
 	}
 
-	oauthKey, err := parseCodexOAuthKey(strings.TrimSpace(ch.Key))
+	rawKey, err := ch.GetPlainKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	oauthKey, err := parseCodexOAuthKey(strings.TrimSpace(rawKey))
 	if err != nil {
 		return nil, nil, err
 	}
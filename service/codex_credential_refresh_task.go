@@ -88,7 +88,11 @@ func runCodexCredentialAutoRefreshOnce() {
 				continue
 			}
 
-			rawKey := strings.TrimSpace(ch.Key)
+			rawKey, err := ch.GetPlainKey()
+			if err != nil {
+				continue
+			}
+			rawKey = strings.TrimSpace(rawKey)
 			if rawKey == "" {
 				continue
 			}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatJSON = "json"
+
+	// 渠道 Key 与密钥类配置项的导出方式
+	ConfigKeyModeRedact  = "redact"  // 不导出，导入时保留现有值
+	ConfigKeyModeEncrypt = "encrypt" // 使用 CONFIG_SNAPSHOT_SECRET 加密
+	ConfigKeyModePlain   = "plain"   // 明文导出
+
+	// 加密值为 enc: 加版本前缀的密文，旧快照使用 enc:v1:，当前导出为 enc:v2:
+	configEncryptedPrefix = "enc:"
+)
+
+// ExportConfig 导出配置快照，format 为 yaml 或 json，keyMode 决定渠道 Key 与密钥类配置项的导出方式
+func ExportConfig(format string, keyMode string) ([]byte, error) {
+	snapshot, err := model.ExportConfigSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if err := protectConfigSecrets(snapshot, keyMode); err != nil {
+		return nil, err
+	}
+	return EncodeConfigSnapshot(snapshot, format)
+}
+
+// ImportConfig 解析快照并生成变更计划，apply 为 true 时在一个事务中应用
+func ImportConfig(data []byte, apply bool, opts model.ConfigImportOptions) (*model.ConfigImportPlan, error) {
+	snapshot, err := DecodeConfigSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := revealConfigSecrets(snapshot); err != nil {
+		return nil, err
+	}
+	if apply {
+		return model.ApplyConfigImport(snapshot, opts)
+	}
+	return model.PlanConfigImport(snapshot, opts)
+}
+
+func EncodeConfigSnapshot(snapshot *model.ConfigSnapshot, format string) ([]byte, error) {
+	switch format {
+	case "", ConfigFormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(snapshot); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ConfigFormatJSON:
+		data, err := common.Marshal(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// DecodeConfigSnapshot 解析 YAML 或 JSON 格式的快照
+func DecodeConfigSnapshot(data []byte) (*model.ConfigSnapshot, error) {
+	var snapshot model.ConfigSnapshot
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("配置快照为空")
+	}
+	var err error
+	if trimmed[0] == '{' {
+		err = common.Unmarshal(trimmed, &snapshot)
+	} else {
+		err = yaml.Unmarshal(trimmed, &snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置快照失败: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func protectConfigSecrets(snapshot *model.ConfigSnapshot, keyMode string) error {
+	switch keyMode {
+	case "", ConfigKeyModeRedact:
+		for i := range snapshot.Channels {
+			snapshot.Channels[i].Key = ""
+		}
+		for key := range snapshot.Options {
+			if model.IsSecretOptionKey(key) {
+				delete(snapshot.Options, key)
+			}
+		}
+	case ConfigKeyModeEncrypt:
+		if constant.ConfigSnapshotSecret == "" {
+			return errors.New("加密导出需要设置 CONFIG_SNAPSHOT_SECRET")
+		}
+		for i := range snapshot.Channels {
+			encrypted, err := encryptConfigSecret(snapshot.Channels[i].Key)
+			if err != nil {
+				return err
+			}
+			snapshot.Channels[i].Key = encrypted
+		}
+		for key, value := range snapshot.Options {
+			if s, ok := value.(string); ok && model.IsSecretOptionKey(key) {
+				encrypted, err := encryptConfigSecret(s)
+				if err != nil {
+					return err
+				}
+				snapshot.Options[key] = encrypted
+			}
+		}
+	case ConfigKeyModePlain:
+	default:
+		return fmt.Errorf("不支持的 Key 导出方式: %s", keyMode)
+	}
+	return nil
+}
+
+// revealConfigSecrets 解密快照中带 enc: 前缀的渠道 Key 与配置项
+func revealConfigSecrets(snapshot *model.ConfigSnapshot) error {
+	for i := range snapshot.Channels {
+		key, err := decryptConfigSecret(snapshot.Channels[i].Key)
+		if err != nil {
+			return fmt.Errorf("渠道 %s 的 Key 解密失败: %w", snapshot.Channels[i].Name, err)
+		}
+		snapshot.Channels[i].Key = key
+	}
+	for key, value := range snapshot.Options {
+		if s, ok := value.(string); ok {
+			plaintext, err := decryptConfigSecret(s)
+			if err != nil {
+				return fmt.Errorf("配置项 %s 解密失败: %w", key, err)
+			}
+			snapshot.Options[key] = plaintext
+		}
+	}
+	return nil
+}
+
+func encryptConfigSecret(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	encrypted, err := common.EncryptWithPassphrase(constant.ConfigSnapshotSecret, value)
+	if err != nil {
+		return "", err
+	}
+	return configEncryptedPrefix + encrypted, nil
+}
+
+func decryptConfigSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, configEncryptedPrefix) {
+		return value, nil
+	}
+	if constant.ConfigSnapshotSecret == "" {
+		return "", errors.New("快照包含加密内容，需要设置 CONFIG_SNAPSHOT_SECRET")
+	}
+	return common.DecryptWithPassphrase(constant.ConfigSnapshotSecret, strings.TrimPrefix(value, configEncryptedPrefix))
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSnapshotSecrets(t *testing.T) {
+	secret := constant.ConfigSnapshotSecret
+	constant.ConfigSnapshotSecret = "snapshot-secret"
+	t.Cleanup(func() { constant.ConfigSnapshotSecret = secret })
+
+	newSnapshot := func() *model.ConfigSnapshot {
+		return &model.ConfigSnapshot{
+			Version:  model.ConfigSnapshotVersion,
+			Options:  map[string]any{"SMTPToken": "smtp-secret", "GroupRatio": map[string]any{"vip": 0.8}},
+			Channels: []model.SnapshotChannel{{Name: "a", Key: "sk-a"}},
+		}
+	}
+
+	// 加密导出经 YAML 往返后可以解密
+	snapshot := newSnapshot()
+	require.NoError(t, protectConfigSecrets(snapshot, ConfigKeyModeEncrypt))
+	require.True(t, strings.HasPrefix(snapshot.Channels[0].Key, "enc:v2:"))
+	data, err := EncodeConfigSnapshot(snapshot, ConfigFormatYAML)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "smtp-secret")
+	decoded, err := DecodeConfigSnapshot(data)
+	require.NoError(t, err)
+	require.NoError(t, revealConfigSecrets(decoded))
+	require.Equal(t, newSnapshot().Options, decoded.Options)
+	require.Equal(t, newSnapshot().Channels, decoded.Channels)
+
+	constant.ConfigSnapshotSecret = "other-secret"
+	decoded, err = DecodeConfigSnapshot(data)
+	require.NoError(t, err)
+	require.Error(t, revealConfigSecrets(decoded))
+
+	// 快照中缺失的部分在导入时跳过
+	decoded, err = DecodeConfigSnapshot([]byte("version: 1\nchannels: []\n"))
+	require.NoError(t, err)
+	require.Nil(t, decoded.Models)
+	require.NotNil(t, decoded.Channels)
+
+	// 脱敏导出不包含 Key 与密钥类配置项
+	snapshot = newSnapshot()
+	require.NoError(t, protectConfigSecrets(snapshot, ConfigKeyModeRedact))
+	require.Empty(t, snapshot.Channels[0].Key)
+	require.NotContains(t, snapshot.Options, "SMTPToken")
+	require.Contains(t, snapshot.Options, "GroupRatio")
+}
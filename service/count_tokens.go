@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EstimateInputTokens 在本地估算请求的输入 token 数，用于上游不支持原生计数时的 count_tokens 响应。
+// 与 EstimateRequestToken 不同，不受 CountToken 开关影响，也不会下载媒体文件
+func EstimateInputTokens(modelName string, meta *types.TokenCountMeta) int {
+	if meta == nil {
+		return 0
+	}
+	tokens := CountTokenInput(meta.CombineText, modelName)
+	tokens += meta.ToolsCount * 8
+	tokens += meta.MessagesCount * 3
+	for _, file := range meta.Files {
+		switch file.FileType {
+		case types.FileTypeImage:
+			tokens += 520
+		case types.FileTypeAudio:
+			tokens += 256
+		case types.FileTypeVideo:
+			tokens += 4096 * 2
+		default:
+			tokens += 4096
+		}
+	}
+	return tokens
+}
+
+// ChargeCountTokens 按 count_tokens_setting.price 对计数请求扣费并记录消费日志，价格为 0 时免费
+func ChargeCountTokens(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, inputTokens int, upstream bool) *types.NewAPIError {
+	price := operation_setting.GetCountTokensSetting().Price
+	if price <= 0 {
+		return nil
+	}
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+	quota := usdToQuota(price, groupRatio)
+	if quota <= 0 {
+		return nil
+	}
+	remaining := relayInfo.UserQuota
+	if relayInfo.OrgId > 0 {
+		orgQuota, err := model.GetOrganizationQuota(relayInfo.OrgId)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		remaining = orgQuota
+	}
+	if remaining < quota {
+		return types.NewErrorWithStatusCode(fmt.Errorf("额度不足，剩余额度: %s", logger.FormatQuota(remaining)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if err := PostConsumeQuota(relayInfo, quota, 0, true); err != nil {
+		return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:      relayInfo.ChannelId,
+		ModelName:      relayInfo.OriginModelName,
+		TokenName:      ctx.GetString("token_name"),
+		Quota:          quota,
+		Content:        "Count tokens",
+		TokenId:        relayInfo.TokenId,
+		PromptTokens:   inputTokens,
+		UseTimeSeconds: int(time.Now().Unix() - relayInfo.StartTime.Unix()),
+		Group:          relayInfo.UsingGroup,
+		Other: map[string]any{
+			"count_tokens":          true,
+			"count_tokens_upstream": upstream,
+			"model_price":           price,
+			"group_ratio":           groupRatio,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateInputTokens(t *testing.T) {
+	require.Zero(t, EstimateInputTokens("claude-sonnet-4-20250514", nil))
+
+	text := EstimateInputTokens("claude-sonnet-4-20250514", &types.TokenCountMeta{CombineText: "hello world"})
+	require.Positive(t, text)
+
+	withExtras := EstimateInputTokens("claude-sonnet-4-20250514", &types.TokenCountMeta{
+		CombineText:   "hello world",
+		ToolsCount:    1,
+		MessagesCount: 2,
+		Files:         []*types.FileMeta{{FileType: types.FileTypeImage}},
+	})
+	require.Equal(t, text+8+2*3+520, withExtras)
+}
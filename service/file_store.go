@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// FileStore /v1/files 与批处理输入输出文件的存储后端，由 FILE_STORE 选择数据库（默认）或本地磁盘，
+// 也可通过 SetFileStore 替换为对象存储等实现
+type FileStore interface {
+	Save(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var (
+	fileStore     FileStore
+	fileStoreLock sync.RWMutex
+)
+
+func SetFileStore(store FileStore) {
+	fileStoreLock.Lock()
+	defer fileStoreLock.Unlock()
+	fileStore = store
+}
+
+func GetFileStore() FileStore {
+	fileStoreLock.RLock()
+	defer fileStoreLock.RUnlock()
+	if fileStore != nil {
+		return fileStore
+	}
+	if constant.FileStore == constant.FileStoreLocal {
+		return &localFileStore{}
+	}
+	return &dbFileStore{}
+}
+
+// localFileStore 本地磁盘存储，目录由 FILE_STORE_DIR 指定，默认位于磁盘缓存目录下的 files 子目录
+// （磁盘缓存的过期清理只清理根目录下的文件，不会清理子目录）。
+// 多节点部署时各节点必须挂载同一个共享目录，否则其他节点无法读取上传的文件与批处理结果
+type localFileStore struct{}
+
+func (s *localFileStore) dir() string {
+	if constant.FileStoreDir != "" {
+		return constant.FileStoreDir
+	}
+	return filepath.Join(common.GetDiskCacheDir(), "files")
+}
+
+func (s *localFileStore) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid file key: %s", key)
+	}
+	return filepath.Join(s.dir(), key), nil
+}
+
+func (s *localFileStore) Save(key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(s.dir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create file store directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	n, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	return n, nil
+}
+
+func (s *localFileStore) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *localFileStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
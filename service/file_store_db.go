@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// dbFileChunkSize 数据库存储的分块大小，需小于 MySQL max_allowed_packet
+const dbFileChunkSize = 1 << 20
+
+// dbFileStore 数据库存储，文件内容按块写入 file_chunks 表，多节点部署时所有节点共享
+type dbFileStore struct{}
+
+func (s *dbFileStore) Save(key string, r io.Reader) (int64, error) {
+	buf := make([]byte, dbFileChunkSize)
+	var total int64
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			_ = model.DeleteFileChunks(key)
+			return 0, fmt.Errorf("failed to read file: %w", err)
+		}
+		// 空文件也写入一个空分块，Open 据此区分空文件与不存在的文件
+		if n > 0 || seq == 0 {
+			if insertErr := model.InsertFileChunk(key, seq, buf[:n]); insertErr != nil {
+				_ = model.DeleteFileChunks(key)
+				return 0, fmt.Errorf("failed to write file: %w", insertErr)
+			}
+			total += int64(n)
+		}
+		if err != nil {
+			return total, nil
+		}
+	}
+}
+
+func (s *dbFileStore) Open(key string) (io.ReadCloser, error) {
+	chunk, err := model.GetFileChunk(key, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &dbFileReader{key: key, data: chunk.Data, next: 1}, nil
+}
+
+func (s *dbFileStore) Delete(key string) error {
+	return model.DeleteFileChunks(key)
+}
+
+// dbFileReader 按需逐块读取文件内容，避免大文件一次性加载到内存
+type dbFileReader struct {
+	key  string
+	data []byte
+	next int
+	eof  bool
+}
+
+func (r *dbFileReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		chunk, err := model.GetFileChunk(r.key, r.next)
+		if model.IsFileNotFound(err) {
+			r.eof = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.data = chunk.Data
+		r.next++
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *dbFileReader) Close() error {
+	return nil
+}
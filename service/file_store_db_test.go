@@ -0,0 +1,37 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBFileStoreRoundTrip(t *testing.T) {
+	t.Cleanup(func() { model.DB.Exec("DELETE FROM file_chunks") })
+	store := &dbFileStore{}
+	content := bytes.Repeat([]byte("0123456789"), dbFileChunkSize/4)
+
+	n, err := store.Save("file-large", bytes.NewReader(content))
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), n)
+	reader, err := store.Open("file-large")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	_, err = store.Save("file-empty", bytes.NewReader(nil))
+	require.NoError(t, err)
+	reader, err = store.Open("file-empty")
+	require.NoError(t, err)
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	require.NoError(t, store.Delete("file-large"))
+	_, err = store.Open("file-large")
+	require.True(t, model.IsFileNotFound(err))
+}
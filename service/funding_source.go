@@ -7,12 +7,12 @@ import (
 )
 
 // ---------------------------------------------------------------------------
-// FundingSource — 资金来源接口（钱包 or 订阅）
+// FundingSource — 资金来源接口（钱包 / 订阅 / 组织钱包）
 // ---------------------------------------------------------------------------
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "org_wallet"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -63,6 +63,40 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// ---------------------------------------------------------------------------
+// OrgWalletFunding — 组织钱包资金来源实现
+// ---------------------------------------------------------------------------
+
+type OrgWalletFunding struct {
+	orgId    int
+	consumed int // 实际预扣的组织额度
+}
+
+func (o *OrgWalletFunding) Source() string { return BillingSourceOrgWallet }
+
+func (o *OrgWalletFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := model.PreConsumeOrganizationQuota(o.orgId, amount); err != nil {
+		return err
+	}
+	o.consumed = amount
+	return nil
+}
+
+func (o *OrgWalletFunding) Settle(delta int) error {
+	return model.AdjustOrganizationConsumedQuota(o.orgId, delta)
+}
+
+func (o *OrgWalletFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	// 与钱包相同，quota += N 非幂等，不能重试
+	return model.AdjustOrganizationConsumedQuota(o.orgId, -o.consumed)
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
@@ -0,0 +1,477 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const guardrailDefaultReplacement = "[REDACTED]"
+
+// GuardrailDecision 单条规则的命中记录，写入日志的 other.guardrail
+type GuardrailDecision struct {
+	Stage    string   `json:"stage"`
+	Rule     string   `json:"rule,omitempty"`
+	Provider string   `json:"provider"`
+	Action   string   `json:"action"`
+	Labels   []string `json:"labels,omitempty"`
+	Count    int      `json:"count"`
+	// Late 命中时部分内容已经发送给客户端（流式跨事件匹配与滑动窗口审核），redact 无法生效，block 只能中断后续输出
+	Late bool `json:"late,omitempty"`
+}
+
+// GuardrailModerationResult 审核模型的结果
+type GuardrailModerationResult struct {
+	Flagged    bool
+	Categories []string
+}
+
+// GuardrailModerationFunc 通过网关自身的 /v1/moderations 调用审核模型，由 main 注入
+var GuardrailModerationFunc func(c *gin.Context, model string, input string) (*GuardrailModerationResult, error)
+
+type guardrailState struct {
+	mu         sync.Mutex
+	policyName string
+	policy     *operation_setting.GuardrailPolicy
+	decisions  []GuardrailDecision
+	writer     *guardrailWriter
+}
+
+// record 记录命中结果，同一规则在同一阶段的多次命中合并为一条
+func (s *guardrailState) record(decision GuardrailDecision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.decisions {
+		d := &s.decisions[i]
+		if d.Stage == decision.Stage && d.Rule == decision.Rule && d.Provider == decision.Provider &&
+			d.Action == decision.Action && d.Late == decision.Late {
+			d.Count += decision.Count
+			for _, label := range decision.Labels {
+				if !common.StringsContains(d.Labels, label) {
+					d.Labels = append(d.Labels, label)
+				}
+			}
+			return
+		}
+	}
+	s.decisions = append(s.decisions, decision)
+}
+
+// InitGuardrail 解析当前请求生效的审核策略，未开启时返回 nil
+func InitGuardrail(c *gin.Context) *guardrailState {
+	if state := getGuardrailState(c); state != nil {
+		return state
+	}
+	tokenPolicy := common.GetContextKeyString(c, constant.ContextKeyTokenGuardrailPolicy)
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	name, policy := operation_setting.GetGuardrailPolicy(tokenPolicy, group)
+	if policy == nil {
+		return nil
+	}
+	state := &guardrailState{policyName: name, policy: policy}
+	common.SetContextKey(c, constant.ContextKeyGuardrailState, state)
+	return state
+}
+
+func getGuardrailState(c *gin.Context) *guardrailState {
+	state, ok := common.GetContextKeyType[*guardrailState](c, constant.ContextKeyGuardrailState)
+	if !ok {
+		return nil
+	}
+	return state
+}
+
+// GetGuardrailDecisions 返回本次请求的审核命中记录
+func GetGuardrailDecisions(c *gin.Context) []GuardrailDecision {
+	state := getGuardrailState(c)
+	if state == nil {
+		return nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if len(state.decisions) == 0 {
+		return nil
+	}
+	return append([]GuardrailDecision(nil), state.decisions...)
+}
+
+// GuardrailPolicyHasStage 当前请求的审核策略是否包含该阶段的规则
+func GuardrailPolicyHasStage(c *gin.Context, stage string) bool {
+	state := InitGuardrail(c)
+	return state != nil && state.policy.HasStage(stage)
+}
+
+type guardrailMatcher struct {
+	label    string
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+var (
+	guardrailPIIMatchers = map[string]guardrailMatcher{
+		operation_setting.GuardrailPIIEmail: {
+			re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		},
+		operation_setting.GuardrailPIIPhone: {
+			re: regexp.MustCompile(`(?:\+86[- ]?)?\b1[3-9]\d{9}\b|\+[1-9]\d{7,14}\b`),
+		},
+		operation_setting.GuardrailPIIIdNumber: {
+			re:       regexp.MustCompile(`\b\d{17}[\dXx]\b`),
+			validate: validChineseIdNumber,
+		},
+		operation_setting.GuardrailPIICreditCard: {
+			re:       regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+			validate: validLuhn,
+		},
+	}
+	guardrailMatcherCache sync.Map
+)
+
+// validChineseIdNumber 校验 18 位身份证号的校验码
+func validChineseIdNumber(s string) bool {
+	if len(s) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(s[i]-'0') * weights[i]
+	}
+	checkCodes := "10X98765432"
+	return checkCodes[sum%11] == strings.ToUpper(s[17:])[0]
+}
+
+// validLuhn 校验银行卡号的 Luhn 校验位
+func validLuhn(s string) bool {
+	digits := make([]int, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// getGuardrailMatchers 返回规则对应的本地匹配器，按规则内容缓存
+func getGuardrailMatchers(rule *operation_setting.GuardrailRule) []guardrailMatcher {
+	key := fmt.Sprintf("%s|%q|%q|%q", rule.Provider, rule.Keywords, rule.Patterns, rule.PIITypes)
+	if cached, ok := guardrailMatcherCache.Load(key); ok {
+		return cached.([]guardrailMatcher)
+	}
+	var matchers []guardrailMatcher
+	switch rule.Provider {
+	case operation_setting.GuardrailProviderKeyword:
+		for _, keyword := range rule.Keywords {
+			if strings.TrimSpace(keyword) == "" {
+				continue
+			}
+			matchers = append(matchers, guardrailMatcher{
+				label: keyword,
+				re:    regexp.MustCompile(`(?i)` + regexp.QuoteMeta(keyword)),
+			})
+		}
+	case operation_setting.GuardrailProviderRegex:
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				common.SysError(fmt.Sprintf("guardrail rule %s has invalid pattern %q: %s", rule.Name, pattern, err.Error()))
+				continue
+			}
+			matchers = append(matchers, guardrailMatcher{label: pattern, re: re})
+		}
+	case operation_setting.GuardrailProviderPII:
+		for _, piiType := range rule.GetPIITypes() {
+			matcher, ok := guardrailPIIMatchers[piiType]
+			if !ok {
+				continue
+			}
+			matcher.label = piiType
+			matchers = append(matchers, matcher)
+		}
+	}
+	guardrailMatcherCache.Store(key, matchers)
+	return matchers
+}
+
+type guardrailMatch struct {
+	label      string
+	start, end int
+}
+
+// findGuardrailMatches 返回文本中所有命中的位置，按起始位置排序且互不重叠
+func findGuardrailMatches(matchers []guardrailMatcher, text string) []guardrailMatch {
+	var matches []guardrailMatch
+	for _, matcher := range matchers {
+		for _, loc := range matcher.re.FindAllStringIndex(text, -1) {
+			if matcher.validate != nil && !matcher.validate(text[loc[0]:loc[1]]) {
+				continue
+			}
+			matches = append(matches, guardrailMatch{label: matcher.label, start: loc[0], end: loc[1]})
+		}
+	}
+	if len(matches) < 2 {
+		return matches
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+	merged := matches[:1]
+	for _, m := range matches[1:] {
+		if m.start < merged[len(merged)-1].end {
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+func redactGuardrailMatches(text string, matches []guardrailMatch, replacement string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(text[last:m.start])
+		sb.WriteString(replacement)
+		last = m.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func guardrailMatchLabels(matches []guardrailMatch) []string {
+	labels := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if !common.StringsContains(labels, m.label) {
+			labels = append(labels, m.label)
+		}
+	}
+	return labels
+}
+
+func guardrailReplacement(rule *operation_setting.GuardrailRule) string {
+	if rule.Replacement != "" {
+		return rule.Replacement
+	}
+	return guardrailDefaultReplacement
+}
+
+// moderateGuardrailText 调用审核模型，命中规则关注的分类时返回命中的分类。调用失败时放行
+func moderateGuardrailText(c *gin.Context, rule *operation_setting.GuardrailRule, text string) (bool, []string) {
+	if GuardrailModerationFunc == nil || strings.TrimSpace(text) == "" {
+		return false, nil
+	}
+	result, err := GuardrailModerationFunc(c, rule.Model, text)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("guardrail moderation failed, rule %s: %s", rule.Name, err.Error()))
+		return false, nil
+	}
+	if result == nil || !result.Flagged {
+		return false, nil
+	}
+	if len(rule.Categories) == 0 {
+		return true, result.Categories
+	}
+	var hit []string
+	for _, category := range result.Categories {
+		if common.StringsContains(rule.Categories, category) {
+			hit = append(hit, category)
+		}
+	}
+	return len(hit) > 0, hit
+}
+
+// checkGuardrailTexts 按顺序执行策略中作用于该阶段的规则。redact 会修改返回的文本，
+// block 命中时立即返回该条记录。moderation 为 false 时跳过审核模型
+func checkGuardrailTexts(c *gin.Context, policy *operation_setting.GuardrailPolicy, stage string, texts []string, moderation bool) ([]string, []GuardrailDecision, *GuardrailDecision) {
+	var decisions []GuardrailDecision
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !rule.AppliesTo(stage) {
+			continue
+		}
+		decision := GuardrailDecision{Stage: stage, Rule: rule.Name, Provider: rule.Provider, Action: rule.Action}
+		if rule.Provider == operation_setting.GuardrailProviderModeration {
+			if !moderation {
+				continue
+			}
+			flagged, categories := moderateGuardrailText(c, rule, strings.Join(texts, "\n"))
+			if !flagged {
+				continue
+			}
+			decision.Labels = categories
+			decision.Count = 1
+		} else {
+			matchers := getGuardrailMatchers(rule)
+			if len(matchers) == 0 {
+				continue
+			}
+			for j, text := range texts {
+				matches := findGuardrailMatches(matchers, text)
+				if len(matches) == 0 {
+					continue
+				}
+				decision.Count += len(matches)
+				for _, label := range guardrailMatchLabels(matches) {
+					if !common.StringsContains(decision.Labels, label) {
+						decision.Labels = append(decision.Labels, label)
+					}
+				}
+				if rule.Action == operation_setting.GuardrailActionRedact {
+					texts[j] = redactGuardrailMatches(text, matches, guardrailReplacement(rule))
+				}
+			}
+			if decision.Count == 0 {
+				continue
+			}
+		}
+		decisions = append(decisions, decision)
+		if rule.Action == operation_setting.GuardrailActionBlock {
+			return texts, decisions, &decisions[len(decisions)-1]
+		}
+	}
+	return texts, decisions, nil
+}
+
+var (
+	guardrailPromptKeys     = map[string]bool{"content": true, "text": true, "input": true, "prompt": true, "instructions": true, "system": true, "output": true}
+	guardrailCompletionKeys = map[string]bool{"content": true, "text": true, "delta": true, "reasoning_content": true}
+)
+
+// walkGuardrailTexts 遍历 JSON 中位于指定字段下的字符串，fn 返回替换后的内容
+func walkGuardrailTexts(v any, keys map[string]bool, matched bool, fn func(string) string) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, child := range value {
+			value[k] = walkGuardrailTexts(child, keys, keys[k], fn)
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = walkGuardrailTexts(child, keys, matched, fn)
+		}
+	case string:
+		if matched && value != "" {
+			return fn(value)
+		}
+	}
+	return v
+}
+
+func decodeGuardrailJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// collectGuardrailTexts 提取 JSON 中需要检查的文本
+func collectGuardrailTexts(v any, keys map[string]bool) []string {
+	var texts []string
+	walkGuardrailTexts(v, keys, false, func(s string) string {
+		texts = append(texts, s)
+		return s
+	})
+	return texts
+}
+
+// checkGuardrailJSON 检查 JSON 中的文本，有脱敏时返回改写后的 JSON
+func checkGuardrailJSON(c *gin.Context, state *guardrailState, stage string, data []byte, keys map[string]bool, moderation bool) ([]byte, *GuardrailDecision, error) {
+	v, err := decodeGuardrailJSON(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	texts := collectGuardrailTexts(v, keys)
+	if len(texts) == 0 {
+		return nil, nil, nil
+	}
+	original := append([]string(nil), texts...)
+	redacted, decisions, block := checkGuardrailTexts(c, state.policy, stage, texts, moderation)
+	for _, decision := range decisions {
+		state.record(decision)
+	}
+	if block != nil {
+		return nil, block, nil
+	}
+	replacements := make(map[string]string)
+	for i := range original {
+		if original[i] != redacted[i] {
+			replacements[original[i]] = redacted[i]
+		}
+	}
+	if len(replacements) == 0 {
+		return nil, nil, nil
+	}
+	v = walkGuardrailTexts(v, keys, false, func(s string) string {
+		if r, ok := replacements[s]; ok {
+			return r
+		}
+		return s
+	})
+	out, err := common.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, nil, nil
+}
+
+func newGuardrailBlockedError(decision *GuardrailDecision) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(
+		fmt.Errorf("content blocked by guardrail rule %s", guardrailDecisionName(decision)),
+		types.ErrorCodeGuardrailBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+func guardrailDecisionName(decision *GuardrailDecision) string {
+	if decision.Rule != "" {
+		return decision.Rule
+	}
+	return decision.Provider
+}
+
+// CheckGuardrailPrompt 在转发前检查请求体。返回脱敏后的请求体，未改写时为 nil；命中 block 时返回错误
+func CheckGuardrailPrompt(c *gin.Context, body []byte) ([]byte, *types.NewAPIError) {
+	state := InitGuardrail(c)
+	if state == nil || !state.policy.HasStage(operation_setting.GuardrailStagePrompt) {
+		return nil, nil
+	}
+	out, block, err := checkGuardrailJSON(c, state, operation_setting.GuardrailStagePrompt, body, guardrailPromptKeys, true)
+	if err != nil {
+		// 非 JSON 请求体不检查
+		logger.LogWarn(c, "guardrail skipped non-json request body: "+err.Error())
+		return nil, nil
+	}
+	if block != nil {
+		return nil, newGuardrailBlockedError(block)
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withGuardrailPolicy(t *testing.T, policy operation_setting.GuardrailPolicy) {
+	t.Helper()
+	setting := operation_setting.GetGuardrailSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.Policies = map[string]operation_setting.GuardrailPolicy{"test": policy}
+	setting.GroupPolicies = map[string]string{operation_setting.GuardrailAllGroups: "test"}
+	t.Cleanup(func() {
+		*setting = prev
+	})
+}
+
+func buildGuardrailContextForTest() (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	common.SetContextKey(ctx, constant.ContextKeyUsingGroup, "default")
+	return ctx, rec
+}
+
+func TestGuardrailPIIDetection(t *testing.T) {
+	require.True(t, validChineseIdNumber("11010519491231002X"))
+	require.False(t, validChineseIdNumber("110105194912310021"))
+	require.True(t, validLuhn("4111 1111 1111 1111"))
+	require.False(t, validLuhn("4111 1111 1111 1112"))
+
+	policy := &operation_setting.GuardrailPolicy{Rules: []operation_setting.GuardrailRule{
+		{Name: "pii", Provider: operation_setting.GuardrailProviderPII, Action: operation_setting.GuardrailActionRedact},
+	}}
+	texts := []string{
+		"mail alice@example.com or call 13812345678",
+		"id 11010519491231002X card 4111111111111111 order 4111111111111112",
+	}
+	redacted, decisions, block := checkGuardrailTexts(nil, policy, operation_setting.GuardrailStagePrompt, texts, false)
+	require.Nil(t, block)
+	require.Equal(t, "mail [REDACTED] or call [REDACTED]", redacted[0])
+	require.Equal(t, "id [REDACTED] card [REDACTED] order 4111111111111112", redacted[1])
+	require.Len(t, decisions, 1)
+	require.Equal(t, 4, decisions[0].Count)
+	require.ElementsMatch(t, []string{"email", "phone", "id_number", "credit_card"}, decisions[0].Labels)
+}
+
+func TestCheckGuardrailPrompt(t *testing.T) {
+	withGuardrailPolicy(t, operation_setting.GuardrailPolicy{Rules: []operation_setting.GuardrailRule{
+		{Name: "email", Provider: operation_setting.GuardrailProviderPII, PIITypes: []string{"email"}, Action: operation_setting.GuardrailActionRedact, Replacement: "<email>"},
+		{Name: "secret", Provider: operation_setting.GuardrailProviderKeyword, Keywords: []string{"Project X"}, Action: operation_setting.GuardrailActionBlock, Stage: operation_setting.GuardrailStagePrompt},
+	}})
+
+	ctx, _ := buildGuardrailContextForTest()
+	body := []byte(`{"model":"gpt-4o","temperature":0.7,"messages":[{"role":"user","content":[{"type":"text","text":"write to bob@example.com"}]}]}`)
+	out, apiErr := CheckGuardrailPrompt(ctx, body)
+	require.Nil(t, apiErr)
+	require.JSONEq(t, `{"model":"gpt-4o","temperature":0.7,"messages":[{"role":"user","content":[{"type":"text","text":"write to <email>"}]}]}`, string(out))
+	require.Len(t, GetGuardrailDecisions(ctx), 1)
+
+	ctx, _ = buildGuardrailContextForTest()
+	out, apiErr = CheckGuardrailPrompt(ctx, []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"tell me about project x"}]}`))
+	require.Nil(t, out)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeGuardrailBlocked, apiErr.GetErrorCode())
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestGuardrailWriterStream(t *testing.T) {
+	withGuardrailPolicy(t, operation_setting.GuardrailPolicy{Rules: []operation_setting.GuardrailRule{
+		{Name: "email", Provider: operation_setting.GuardrailProviderPII, PIITypes: []string{"email"}, Action: operation_setting.GuardrailActionRedact},
+		{Name: "secret", Provider: operation_setting.GuardrailProviderKeyword, Keywords: []string{"forbidden"}, Action: operation_setting.GuardrailActionBlock},
+	}})
+
+	ctx, rec := buildGuardrailContextForTest()
+	InstallGuardrailWriter(ctx, &relaycommon.RelayInfo{RelayFormat: types.RelayFormatOpenAI})
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+
+	_, _ = ctx.Writer.WriteString(`data: {"choices":[{"delta":{"content":"reach me at eve@example.com"}}]}` + "\n\n")
+	// 关键词跨两个事件
+	_, _ = ctx.Writer.WriteString(`data: {"choices":[{"delta":{"content":" this is forb"}}]}` + "\n\n")
+	_, _ = ctx.Writer.WriteString(`data: {"choices":[{"delta":{"content":"idden text"}}]}` + "\n\n")
+	_, _ = ctx.Writer.WriteString("data: [DONE]\n\n")
+	FinishGuardrail(ctx)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `reach me at [REDACTED]`)
+	require.Contains(t, body, ` this is forb`)
+	require.Contains(t, body, string(types.ErrorCodeGuardrailBlocked))
+	require.NotContains(t, body, "idden text")
+	require.NotContains(t, body, "[DONE]")
+
+	decisions := GetGuardrailDecisions(ctx)
+	require.Len(t, decisions, 2)
+	require.Equal(t, "email", decisions[0].Rule)
+	require.False(t, decisions[0].Late)
+	require.Equal(t, "secret", decisions[1].Rule)
+	require.True(t, decisions[1].Late)
+}
+
+func TestGuardrailWriterNonStream(t *testing.T) {
+	withGuardrailPolicy(t, operation_setting.GuardrailPolicy{Rules: []operation_setting.GuardrailRule{
+		{Name: "phone", Provider: operation_setting.GuardrailProviderPII, PIITypes: []string{"phone"}, Action: operation_setting.GuardrailActionRedact, Stage: operation_setting.GuardrailStageCompletion},
+	}})
+
+	ctx, rec := buildGuardrailContextForTest()
+	InstallGuardrailWriter(ctx, &relaycommon.RelayInfo{RelayFormat: types.RelayFormatOpenAI})
+	ctx.Header("Content-Length", "80")
+	ctx.JSON(http.StatusOK, gin.H{"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "call 13812345678"}}}})
+	require.Empty(t, rec.Body.String())
+	FinishGuardrail(ctx)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"choices":[{"message":{"role":"assistant","content":"call [REDACTED]"}}]}`, rec.Body.String())
+	require.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+}
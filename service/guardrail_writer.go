@@ -0,0 +1,238 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// guardrailWriter 在响应写给客户端前执行 completion 阶段的审核。
+// 非流式响应整体缓冲后检查；流式响应按 SSE 事件逐条检查，并用滑动窗口检查跨事件的内容
+type guardrailWriter struct {
+	*bufferedSSEWriter
+	c           *gin.Context
+	state       *guardrailState
+	relayFormat types.RelayFormat
+
+	// window 最近输出的文本，pending 为上次调用审核模型后新增的字符数
+	window  string
+	pending int
+}
+
+// InstallGuardrailWriter 策略包含 completion 阶段的规则时接管响应输出
+func InstallGuardrailWriter(c *gin.Context, info *relaycommon.RelayInfo) {
+	if info.RelayFormat == types.RelayFormatOpenAIRealtime {
+		return
+	}
+	state := InitGuardrail(c)
+	if state == nil || state.writer != nil || !state.policy.HasStage(operation_setting.GuardrailStageCompletion) {
+		return
+	}
+	w := &guardrailWriter{
+		c:           c,
+		state:       state,
+		relayFormat: info.RelayFormat,
+	}
+	w.bufferedSSEWriter = newBufferedSSEWriter(c.Writer, w)
+	state.writer = w
+	c.Writer = w
+}
+
+// FinishGuardrail 写出缓冲的响应并恢复原始 writer，可重复调用
+func FinishGuardrail(c *gin.Context) {
+	state := getGuardrailState(c)
+	if state == nil || state.writer == nil {
+		return
+	}
+	w := state.writer
+	w.finish()
+	if c.Writer == gin.ResponseWriter(w) {
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// processEvent 检查一条 SSE 事件，返回实际写出的内容，拦截后丢弃后续输出
+func (w *guardrailWriter) processEvent(event string) (string, bool) {
+	lines := strings.Split(strings.TrimSuffix(event, "\n\n"), "\n")
+	changed := false
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload[0] != '{' {
+			continue
+		}
+		out, block, err := checkGuardrailJSON(w.c, w.state, operation_setting.GuardrailStageCompletion, []byte(payload), guardrailCompletionKeys, false)
+		if err != nil {
+			continue
+		}
+		if block != nil {
+			return w.blockedEvent(block), true
+		}
+		if out != nil {
+			payload = string(out)
+			lines[i] = "data: " + payload
+			changed = true
+		}
+		v, err := decodeGuardrailJSON([]byte(payload))
+		if err != nil {
+			continue
+		}
+		if !isGuardrailSummaryEvent(v) {
+			if block := w.feedWindow(strings.Join(collectGuardrailTexts(v, guardrailCompletionKeys), "")); block != nil {
+				return w.blockedEvent(block), true
+			}
+		}
+	}
+	if !changed {
+		return event, false
+	}
+	return strings.Join(lines, "\n") + "\n\n", false
+}
+
+// isGuardrailSummaryEvent 汇总事件重复携带已输出的全文，不计入滑动窗口
+func isGuardrailSummaryEvent(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	eventType, _ := m["type"].(string)
+	return strings.HasSuffix(eventType, ".done") || eventType == "response.completed"
+}
+
+// feedWindow 将新输出的文本加入滑动窗口，检查跨事件的命中，累计足够的文本后调用审核模型
+func (w *guardrailWriter) feedWindow(text string) *GuardrailDecision {
+	if text == "" {
+		return nil
+	}
+	policy := w.state.policy
+	boundary := len(w.window)
+	w.window += text
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !rule.AppliesTo(operation_setting.GuardrailStageCompletion) || rule.Provider == operation_setting.GuardrailProviderModeration {
+			continue
+		}
+		var spanning []guardrailMatch
+		for _, m := range findGuardrailMatches(getGuardrailMatchers(rule), w.window) {
+			if m.start < boundary && m.end > boundary {
+				spanning = append(spanning, m)
+			}
+		}
+		if len(spanning) == 0 {
+			continue
+		}
+		decision := GuardrailDecision{
+			Stage:    operation_setting.GuardrailStageCompletion,
+			Rule:     rule.Name,
+			Provider: rule.Provider,
+			Action:   rule.Action,
+			Labels:   guardrailMatchLabels(spanning),
+			Count:    len(spanning),
+			Late:     true,
+		}
+		w.state.record(decision)
+		if rule.Action == operation_setting.GuardrailActionBlock {
+			return &decision
+		}
+	}
+
+	size := policy.GetStreamWindow()
+	w.pending += utf8.RuneCountInString(text)
+	var block *GuardrailDecision
+	if w.pending >= size {
+		block = w.moderateWindow(false)
+	}
+	if runes := []rune(w.window); len(runes) > size {
+		w.window = string(runes[len(runes)-size:])
+	}
+	return block
+}
+
+// moderateWindow 用审核模型检查窗口中的文本。窗口内容大多已经发送，命中均标记为 late；
+// final 为 true 时响应已经结束，只记录结果
+func (w *guardrailWriter) moderateWindow(final bool) *GuardrailDecision {
+	w.pending = 0
+	policy := w.state.policy
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !rule.AppliesTo(operation_setting.GuardrailStageCompletion) || rule.Provider != operation_setting.GuardrailProviderModeration {
+			continue
+		}
+		flagged, categories := moderateGuardrailText(w.c, rule, w.window)
+		if !flagged {
+			continue
+		}
+		decision := GuardrailDecision{
+			Stage:    operation_setting.GuardrailStageCompletion,
+			Rule:     rule.Name,
+			Provider: rule.Provider,
+			Action:   rule.Action,
+			Labels:   categories,
+			Count:    1,
+			Late:     true,
+		}
+		w.state.record(decision)
+		if !final && rule.Action == operation_setting.GuardrailActionBlock {
+			return &decision
+		}
+	}
+	return nil
+}
+
+func (w *guardrailWriter) blockedEvent(decision *GuardrailDecision) string {
+	apiErr := newGuardrailBlockedError(decision)
+	if w.relayFormat == types.RelayFormatClaude {
+		data, _ := common.Marshal(gin.H{"type": "error", "error": apiErr.ToClaudeError()})
+		return "event: error\ndata: " + string(data) + "\n\n"
+	}
+	data, _ := common.Marshal(gin.H{"error": apiErr.ToOpenAIError()})
+	return "data: " + string(data) + "\n\n"
+}
+
+func (w *guardrailWriter) blockedBody(decision *GuardrailDecision) []byte {
+	apiErr := newGuardrailBlockedError(decision)
+	var data []byte
+	if w.relayFormat == types.RelayFormatClaude {
+		data, _ = common.Marshal(gin.H{"type": "error", "error": apiErr.ToClaudeError()})
+	} else {
+		data, _ = common.Marshal(gin.H{"error": apiErr.ToOpenAIError()})
+	}
+	return data
+}
+
+// finishStream 写出末尾不完整的事件，并用审核模型检查窗口中剩余的文本
+func (w *guardrailWriter) finishStream(rest string) string {
+	if w.pending > 0 {
+		w.moderateWindow(true)
+	}
+	return rest
+}
+
+// finishBody 检查缓冲的非流式响应
+func (w *guardrailWriter) finishBody(status int, body []byte) (int, []byte) {
+	if status != http.StatusOK || len(body) == 0 {
+		return status, body
+	}
+	out, block, err := checkGuardrailJSON(w.c, w.state, operation_setting.GuardrailStageCompletion, body, guardrailCompletionKeys, true)
+	switch {
+	case err != nil:
+		logger.LogWarn(w.c, fmt.Sprintf("guardrail skipped non-json response body: %s", err.Error()))
+	case block != nil:
+		w.Header().Set("Content-Type", "application/json")
+		return http.StatusBadRequest, w.blockedBody(block)
+	case out != nil:
+		return status, out
+	}
+	return status, body
+}
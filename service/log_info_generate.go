@@ -50,11 +50,21 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if len(relayInfo.ModelFallbackPath) > 1 {
+		other["model_fallback"] = true
+		other["requested_model"] = relayInfo.ModelFallbackPath[0]
+		other["model_fallback_path"] = relayInfo.ModelFallbackPath
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
 	}
 
+	if common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		other["cache_hit"] = true
+	}
+
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	isMultiKey := common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey)
@@ -68,15 +78,29 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["local_count_tokens"] = isLocalCountTokens
 	}
 
+	if IsRequestCaptured(ctx) {
+		adminInfo["request_capture"] = true
+	}
+
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
+	appendPIIRedactionInfo(ctx, other)
+	appendGuardrailInfo(ctx, other)
 	return other
 }
 
+// appendGuardrailInfo 写入内容审核的命中记录。记录日志时响应已经输出完毕，先写出审核缓冲的内容
+func appendGuardrailInfo(ctx *gin.Context, other map[string]interface{}) {
+	FinishGuardrail(ctx)
+	if decisions := GetGuardrailDecisions(ctx); len(decisions) > 0 {
+		other["guardrail"] = decisions
+	}
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelFallbackCandidates 按降级链顺序返回尚未尝试过且令牌有权访问的模型。
+// triedModels 为已尝试的模型，第一个元素为用户请求的模型
+func GetModelFallbackCandidates(c *gin.Context, group string, triedModels []string) []string {
+	if len(triedModels) == 0 {
+		return nil
+	}
+	fallbacks := operation_setting.GetModelFallbacks(group, triedModels[0])
+	if len(fallbacks) == 0 {
+		return nil
+	}
+	tried := make(map[string]bool, len(triedModels))
+	for _, modelName := range triedModels {
+		tried[modelName] = true
+	}
+	candidates := make([]string, 0, len(fallbacks))
+	for _, modelName := range fallbacks {
+		if tried[modelName] || !IsTokenModelAllowed(c, modelName) {
+			continue
+		}
+		tried[modelName] = true
+		candidates = append(candidates, modelName)
+	}
+	return candidates
+}
+
+// IsTokenModelAllowed 判断令牌的模型限制是否允许访问该模型
+func IsTokenModelAllowed(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	s, ok := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	tokenModelLimit, _ := s.(map[string]bool)
+	_, ok = tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// ShouldFallbackModel 判断当前模型失败后是否可以降级到下一个模型。
+// 已向客户端输出内容、指定了渠道或错误由请求本身引起时不降级
+func ShouldFallbackModel(c *gin.Context, apiErr *types.NewAPIError) bool {
+	if apiErr == nil || c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if _, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId); ok {
+		return false
+	}
+	if ShouldSkipRetryAfterChannelAffinityFailure(c) {
+		return false
+	}
+	// 当前模型已无可用渠道
+	if apiErr.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return true
+	}
+	if types.IsChannelError(apiErr) {
+		return true
+	}
+	if types.IsSkipRetryError(apiErr) {
+		return false
+	}
+	code := apiErr.StatusCode
+	if code >= http.StatusOK && code < http.StatusMultipleChoices {
+		return false
+	}
+	if code < 100 || code > 599 {
+		return true
+	}
+	return operation_setting.ShouldRetryByStatusCode(code)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withModelFallbackChains(t *testing.T, chains map[string]map[string][]string) {
+	t.Helper()
+	setting := operation_setting.GetModelFallbackSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.Chains = chains
+	t.Cleanup(func() {
+		*setting = prev
+	})
+}
+
+func buildModelFallbackContextForTest() *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return ctx
+}
+
+func TestGetModelFallbackCandidates(t *testing.T) {
+	withModelFallbackChains(t, map[string]map[string][]string{
+		"default": {"gpt-4o": {"claude-sonnet", "gemini-pro"}},
+		"*":       {"gpt-4o": {"gemini-flash"}},
+	})
+	ctx := buildModelFallbackContextForTest()
+
+	require.Equal(t, []string{"claude-sonnet", "gemini-pro"}, GetModelFallbackCandidates(ctx, "default", []string{"gpt-4o"}))
+	require.Equal(t, []string{"gemini-pro"}, GetModelFallbackCandidates(ctx, "default", []string{"gpt-4o", "claude-sonnet"}))
+	require.Equal(t, []string{"gemini-flash"}, GetModelFallbackCandidates(ctx, "vip", []string{"gpt-4o"}))
+	require.Empty(t, GetModelFallbackCandidates(ctx, "default", []string{"claude-sonnet"}))
+
+	common.SetContextKey(ctx, constant.ContextKeyTokenModelLimitEnabled, true)
+	common.SetContextKey(ctx, constant.ContextKeyTokenModelLimit, map[string]bool{"gpt-4o": true, "gemini-pro": true})
+	require.Equal(t, []string{"gemini-pro"}, GetModelFallbackCandidates(ctx, "default", []string{"gpt-4o"}))
+}
+
+func TestShouldFallbackModel(t *testing.T) {
+	ctx := buildModelFallbackContextForTest()
+
+	require.False(t, ShouldFallbackModel(ctx, nil))
+	require.True(t, ShouldFallbackModel(ctx, types.NewError(errors.New("no channel"), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())))
+	require.True(t, ShouldFallbackModel(ctx, types.NewErrorWithStatusCode(errors.New("upstream"), types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable)))
+	require.False(t, ShouldFallbackModel(ctx, types.NewErrorWithStatusCode(errors.New("invalid"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())))
+
+	ctx.Set("specific_channel_id", "1")
+	require.False(t, ShouldFallbackModel(ctx, types.NewError(errors.New("no channel"), types.ErrorCodeGetChannelFailed)))
+}
@@ -0,0 +1,292 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting"
+)
+
+const (
+	ProviderCreem        = "creem"
+	CreemSignatureHeader = "creem-signature"
+)
+
+func init() {
+	Register(&CreemProvider{})
+}
+
+// CreemProvider Creem 一次性付款与订阅。网关侧的订单号为 Checkout ID
+type CreemProvider struct{}
+
+func (*CreemProvider) Name() string {
+	return ProviderCreem
+}
+
+func (*CreemProvider) Enabled() bool {
+	return setting.CreemApiKey != "" && setting.CreemProducts != "[]"
+}
+
+func creemApiBase() string {
+	// 根据测试模式选择 API 端点
+	if setting.CreemTestMode {
+		return "https://test-api.creem.io/v1"
+	}
+	return "https://api.creem.io/v1"
+}
+
+// 生成HMAC-SHA256签名
+func generateCreemSignature(payload string, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 验证Creem webhook签名
+func verifyCreemSignature(payload string, signature string, secret string) bool {
+	if secret == "" {
+		log.Printf("Creem webhook secret not set")
+		if setting.CreemTestMode {
+			log.Printf("Skip Creem webhook sign verify in test mode")
+			return true
+		}
+		return false
+	}
+
+	expectedSignature := generateCreemSignature(payload, secret)
+	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+}
+
+type creemCheckoutRequest struct {
+	ProductId string `json:"product_id"`
+	RequestId string `json:"request_id"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type creemCheckoutResponse struct {
+	CheckoutUrl string `json:"checkout_url"`
+	Id          string `json:"id"`
+	Status      string `json:"status"`
+	Order       *struct {
+		Id         string `json:"id"`
+		AmountPaid int    `json:"amount_paid"`
+		Currency   string `json:"currency"`
+		Status     string `json:"status"`
+	} `json:"order"`
+}
+
+func callCreemApi(ctx context.Context, method string, path string, payload any) ([]byte, error) {
+	if setting.CreemApiKey == "" {
+		return nil, fmt.Errorf("未配置Creem API密钥")
+	}
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求数据失败: %v", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, creemApiBase()+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	log.Printf("Creem API resp - status code: %d, resp: %s", resp.StatusCode, string(respBody))
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Creem API http status %d ", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+func (*CreemProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	// 构建请求数据，用户邮箱会在支付页面预填充
+	requestData := creemCheckoutRequest{
+		ProductId: req.ProductId,
+		RequestId: req.TradeNo, // 这个作为订单ID传递给Creem
+		Metadata:  req.Metadata,
+	}
+	requestData.Customer.Email = req.Email
+
+	log.Printf("发送Creem支付请求 - 产品ID: %s, 订单号: %s", req.ProductId, req.TradeNo)
+	body, err := callCreemApi(ctx, http.MethodPost, "/checkouts", requestData)
+	if err != nil {
+		return nil, err
+	}
+	var checkoutResp creemCheckoutResponse
+	if err := json.Unmarshal(body, &checkoutResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if checkoutResp.CheckoutUrl == "" {
+		return nil, fmt.Errorf("Creem API resp no checkout url ")
+	}
+	log.Printf("Creem 支付链接创建成功 - 订单号: %s, 支付链接: %s", req.TradeNo, checkoutResp.CheckoutUrl)
+	return &Checkout{URL: checkoutResp.CheckoutUrl, ProviderOrderId: checkoutResp.Id}, nil
+}
+
+// CreemWebhookEvent Creem webhook 数据格式
+type CreemWebhookEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	CreatedAt int64  `json:"created_at"`
+	Object    struct {
+		Id        string `json:"id"`
+		Object    string `json:"object"`
+		RequestId string `json:"request_id"`
+		Order     struct {
+			Object      string `json:"object"`
+			Id          string `json:"id"`
+			Customer    string `json:"customer"`
+			Product     string `json:"product"`
+			Amount      int    `json:"amount"`
+			Currency    string `json:"currency"`
+			SubTotal    int    `json:"sub_total"`
+			TaxAmount   int    `json:"tax_amount"`
+			AmountDue   int    `json:"amount_due"`
+			AmountPaid  int    `json:"amount_paid"`
+			Status      string `json:"status"`
+			Type        string `json:"type"`
+			Transaction string `json:"transaction"`
+			CreatedAt   string `json:"created_at"`
+			UpdatedAt   string `json:"updated_at"`
+			Mode        string `json:"mode"`
+		} `json:"order"`
+		Product struct {
+			Id                string  `json:"id"`
+			Object            string  `json:"object"`
+			Name              string  `json:"name"`
+			Description       string  `json:"description"`
+			Price             int     `json:"price"`
+			Currency          string  `json:"currency"`
+			BillingType       string  `json:"billing_type"`
+			BillingPeriod     string  `json:"billing_period"`
+			Status            string  `json:"status"`
+			TaxMode           string  `json:"tax_mode"`
+			TaxCategory       string  `json:"tax_category"`
+			DefaultSuccessUrl *string `json:"default_success_url"`
+			CreatedAt         string  `json:"created_at"`
+			UpdatedAt         string  `json:"updated_at"`
+			Mode              string  `json:"mode"`
+		} `json:"product"`
+		Units    int `json:"units"`
+		Customer struct {
+			Id        string `json:"id"`
+			Object    string `json:"object"`
+			Email     string `json:"email"`
+			Name      string `json:"name"`
+			Country   string `json:"country"`
+			CreatedAt string `json:"created_at"`
+			UpdatedAt string `json:"updated_at"`
+			Mode      string `json:"mode"`
+		} `json:"customer"`
+		Status   string            `json:"status"`
+		Metadata map[string]string `json:"metadata"`
+		Mode     string            `json:"mode"`
+	} `json:"object"`
+}
+
+func (*CreemProvider) VerifyWebhook(r *http.Request) (*Notification, error) {
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := r.Header.Get(CreemSignatureHeader)
+	if setting.CreemTestMode {
+		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
+	} else if signature == "" {
+		return nil, fmt.Errorf("%w: Creem Webhook缺少签名头", ErrInvalidSignature)
+	}
+	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event CreemWebhookEvent
+	if err := common.Unmarshal(bodyBytes, &event); err != nil {
+		return nil, fmt.Errorf("解析Creem Webhook参数失败: %w", err)
+	}
+	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", event.EventType, event.Id)
+
+	notification := &Notification{
+		TradeNo:         event.Object.RequestId,
+		Status:          NotificationIgnored,
+		ProviderOrderId: event.Object.Id,
+	}
+	if event.EventType != "checkout.completed" || event.Object.Order.Status != "paid" {
+		return notification, nil
+	}
+	// 获取引用ID（这是我们创建订单时传递的request_id）
+	if notification.TradeNo == "" {
+		return nil, fmt.Errorf("Creem Webhook缺少request_id字段")
+	}
+	notification.Status = NotificationPaid
+	notification.PaidAmount = float64(event.Object.Order.AmountPaid) / 100
+	notification.Currency = strings.ToUpper(event.Object.Order.Currency)
+	notification.CustomerEmail = event.Object.Customer.Email
+	// 目前只有一次性付款（充值）会完成充值订单
+	notification.SubscriptionOnly = event.Object.Order.Type != "onetime"
+	notification.Payload = common.GetJsonString(event)
+	return notification, nil
+}
+
+func (*CreemProvider) QueryOrder(ctx context.Context, order *Order) (*OrderStatus, error) {
+	if order.ProviderOrderId == "" {
+		return nil, ErrProviderOrderMissing
+	}
+	body, err := callCreemApi(ctx, http.MethodGet, "/checkouts?checkout_id="+url.QueryEscape(order.ProviderOrderId), nil)
+	if err != nil {
+		return nil, err
+	}
+	var checkout creemCheckoutResponse
+	if err := json.Unmarshal(body, &checkout); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	status := &OrderStatus{Status: common.TopUpStatusPending, ProviderOrderId: checkout.Id}
+	switch {
+	case checkout.Order != nil && checkout.Order.Status == "paid":
+		status.Status = common.TopUpStatusSuccess
+		status.PaidAmount = float64(checkout.Order.AmountPaid) / 100
+		status.Currency = strings.ToUpper(checkout.Order.Currency)
+	case checkout.Status == "expired":
+		status.Status = common.TopUpStatusExpired
+	}
+	return status, nil
+}
+
+// Refund Creem 没有开放退款接口，需要在 Creem 后台退款后登记线下退款
+func (*CreemProvider) Refund(ctx context.Context, order *Order, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+func (*CreemProvider) Cancel(ctx context.Context, order *Order) error {
+	return ErrNotSupported
+}
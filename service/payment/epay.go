@@ -0,0 +1,229 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/samber/lo"
+)
+
+const ProviderEpay = "epay"
+
+func init() {
+	Register(&EpayProvider{})
+}
+
+// EpayProvider 易支付。支付方式由管理员在 PayMethods 中配置，订单记录的是具体的支付方式
+type EpayProvider struct{}
+
+func (*EpayProvider) Name() string {
+	return ProviderEpay
+}
+
+func (*EpayProvider) Enabled() bool {
+	return operation_setting.PayAddress != "" && operation_setting.EpayId != "" && operation_setting.EpayKey != ""
+}
+
+// NewEpayClient 按当前配置创建易支付客户端，未配置时返回 nil
+func NewEpayClient() *epay.Client {
+	if operation_setting.PayAddress == "" || operation_setting.EpayId == "" || operation_setting.EpayKey == "" {
+		return nil
+	}
+	withUrl, err := epay.NewClient(&epay.Config{
+		PartnerID: operation_setting.EpayId,
+		Key:       operation_setting.EpayKey,
+	}, operation_setting.PayAddress)
+	if err != nil {
+		return nil
+	}
+	return withUrl
+}
+
+func (*EpayProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	client := NewEpayClient()
+	if client == nil {
+		return nil, fmt.Errorf("当前管理员未配置支付信息")
+	}
+	notifyUrl, err := url.Parse(req.NotifyURL)
+	if err != nil {
+		return nil, fmt.Errorf("回调地址配置错误: %w", err)
+	}
+	returnUrl, err := url.Parse(req.ReturnURL)
+	if err != nil {
+		return nil, fmt.Errorf("回调地址配置错误: %w", err)
+	}
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           req.Method,
+		ServiceTradeNo: req.TradeNo,
+		Name:           req.Title,
+		Money:          strconv.FormatFloat(req.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{URL: uri, Params: params}, nil
+}
+
+// VerifyWebhook 验证异步通知或同步跳转的参数，POST 从表单读取，GET 从 URL Query 读取
+func (*EpayProvider) VerifyWebhook(r *http.Request) (*Notification, error) {
+	var values url.Values
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		values = r.PostForm
+	} else {
+		values = r.URL.Query()
+	}
+	params := lo.Reduce(lo.Keys(values), func(m map[string]string, key string, _ int) map[string]string {
+		m[key] = values.Get(key)
+		return m
+	}, map[string]string{})
+	if len(params) == 0 {
+		return nil, fmt.Errorf("易支付回调参数为空")
+	}
+
+	client := NewEpayClient()
+	if client == nil {
+		return nil, fmt.Errorf("易支付回调失败 未找到配置信息")
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, ErrInvalidSignature
+	}
+
+	notification := &Notification{
+		TradeNo:         verifyInfo.ServiceTradeNo,
+		Status:          NotificationIgnored,
+		ProviderOrderId: verifyInfo.TradeNo,
+		Payload:         common.GetJsonString(verifyInfo),
+	}
+	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
+		notification.Status = NotificationPaid
+		notification.PaidAmount, _ = strconv.ParseFloat(verifyInfo.Money, 64)
+		notification.Currency = "CNY"
+	}
+	return notification, nil
+}
+
+// epayFlexInt 易支付各实现返回的 code、status 有的是数字有的是字符串
+type epayFlexInt int
+
+func (v *epayFlexInt) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		*v = 0
+		return nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return err
+	}
+	*v = epayFlexInt(n)
+	return nil
+}
+
+type epayApiResponse struct {
+	Code    epayFlexInt `json:"code"`
+	Msg     string      `json:"msg"`
+	TradeNo string      `json:"trade_no"`
+	Money   string      `json:"money"`
+	Status  epayFlexInt `json:"status"`
+}
+
+// callEpayApi 调用易支付的商户 API（api.php），查询订单使用 GET，退款使用 POST 表单
+func callEpayApi(ctx context.Context, method string, act string, form url.Values) (*epayApiResponse, error) {
+	if operation_setting.PayAddress == "" || operation_setting.EpayId == "" || operation_setting.EpayKey == "" {
+		return nil, fmt.Errorf("当前管理员未配置支付信息")
+	}
+	u, err := url.Parse(operation_setting.PayAddress)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/api.php")
+
+	form.Set("pid", operation_setting.EpayId)
+	form.Set("key", operation_setting.EpayKey)
+	var body io.Reader
+	if method == http.MethodGet {
+		form.Set("act", act)
+		u.RawQuery = form.Encode()
+	} else {
+		u.RawQuery = url.Values{"act": {act}}.Encode()
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("易支付接口返回状态码 %d", resp.StatusCode)
+	}
+	var result epayApiResponse
+	if err := common.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析易支付接口响应失败: %w", err)
+	}
+	if result.Code != 1 {
+		return nil, fmt.Errorf("易支付接口返回错误: %s", result.Msg)
+	}
+	return &result, nil
+}
+
+func (*EpayProvider) QueryOrder(ctx context.Context, order *Order) (*OrderStatus, error) {
+	result, err := callEpayApi(ctx, http.MethodGet, "order", url.Values{"out_trade_no": {order.TradeNo}})
+	if err != nil {
+		return nil, err
+	}
+	status := &OrderStatus{Status: common.TopUpStatusPending, ProviderOrderId: result.TradeNo}
+	if result.Status == 1 {
+		status.Status = common.TopUpStatusSuccess
+		status.PaidAmount, _ = strconv.ParseFloat(result.Money, 64)
+		status.Currency = "CNY"
+	}
+	return status, nil
+}
+
+func (*EpayProvider) Refund(ctx context.Context, order *Order, reason string) (*RefundResult, error) {
+	_, err := callEpayApi(ctx, http.MethodPost, "refund", url.Values{
+		"out_trade_no": {order.TradeNo},
+		"money":        {strconv.FormatFloat(order.Money, 'f', 2, 64)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{RefundId: order.ProviderOrderId}, nil
+}
+
+// Cancel 易支付没有关闭订单的接口，未支付的订单由用户放弃支付即可
+func (*EpayProvider) Cancel(ctx context.Context, order *Order) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,199 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// tradeNo lock
+var orderLocks sync.Map
+var createLock sync.Mutex
+
+// LockOrder 尝试对给定订单号加锁
+func LockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if !ok {
+		createLock.Lock()
+		defer createLock.Unlock()
+		lock, ok = orderLocks.Load(tradeNo)
+		if !ok {
+			lock = new(sync.Mutex)
+			orderLocks.Store(tradeNo, lock)
+		}
+	}
+	lock.(*sync.Mutex).Lock()
+}
+
+// UnlockOrder 释放给定订单号的锁
+func UnlockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if ok {
+		lock.(*sync.Mutex).Unlock()
+	}
+}
+
+// HandleNotification 处理验签后的回调：支付成功时完成订阅订单或充值订单，过期时关闭订单。
+// 已经处理过的订单直接返回，重复回调不会重复入账。订单不存在时返回 model.ErrTopUpNotFound
+func HandleNotification(n *Notification) error {
+	if n.Status == NotificationIgnored {
+		return nil
+	}
+	if n.TradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+
+	LockOrder(n.TradeNo)
+	defer UnlockOrder(n.TradeNo)
+
+	switch n.Status {
+	case NotificationPaid:
+		// Try complete subscription order first
+		err := model.CompleteSubscriptionOrder(n.TradeNo, n.Payload)
+		if err == nil || !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+			return err
+		}
+		if n.SubscriptionOnly {
+			return nil
+		}
+		err = model.CompleteTopUp(n.TradeNo, model.TopUpPayment{
+			ProviderOrderId: n.ProviderOrderId,
+			PaidAmount:      n.PaidAmount,
+			Currency:        n.Currency,
+			CustomerId:      n.CustomerId,
+			CustomerEmail:   n.CustomerEmail,
+		})
+		if errors.Is(err, model.ErrTopUpStatusInvalid) {
+			// 已过期或已退款的订单不再入账，需要管理员核实后处理
+			common.SysError(fmt.Sprintf("payment notification for closed top-up order %s ignored", n.TradeNo))
+			return nil
+		}
+		return err
+	case NotificationExpired:
+		err := model.ExpireSubscriptionOrder(n.TradeNo)
+		if err == nil || !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+			return err
+		}
+		return model.ExpireTopUp(n.TradeNo)
+	}
+	return nil
+}
+
+func orderOf(topUp *model.TopUp) *Order {
+	return &Order{
+		TradeNo:         topUp.TradeNo,
+		ProviderOrderId: topUp.ProviderOrderId,
+		Money:           topUp.PaidMoney(),
+		Method:          topUp.PaymentMethod,
+	}
+}
+
+func providerOf(topUp *model.TopUp) (Provider, error) {
+	provider := ForMethod(topUp.PaymentMethod)
+	if provider == nil {
+		return nil, fmt.Errorf("未找到支付方式 %s 对应的支付网关", topUp.PaymentMethod)
+	}
+	return provider, nil
+}
+
+// RefundTopUp 全额退款并扣回充值额度。先在事务中扣回额度并标记为退款中，再调用网关退款，
+// 网关退款失败时退回额度。offline 为 true 时不调用网关，用于已在网关后台退款、网关不支持退款
+// 或退款中断后需要人工确认的订单
+func RefundTopUp(ctx context.Context, tradeNo string, reason string, offline bool) (*model.TopUp, error) {
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return nil, model.ErrTopUpNotFound
+	}
+	var provider Provider
+	if !offline {
+		var err error
+		if provider, err = providerOf(topUp); err != nil {
+			return nil, err
+		}
+	}
+
+	topUp, _, err := model.BeginTopUpRefund(tradeNo, offline)
+	if err != nil {
+		return nil, err
+	}
+	refundId := ""
+	if !offline {
+		result, err := provider.Refund(ctx, orderOf(topUp), reason)
+		if err != nil {
+			if cancelErr := model.CancelTopUpRefund(tradeNo); cancelErr != nil {
+				common.SysError(fmt.Sprintf("failed to restore quota of top-up order %s after refund failure: %s", tradeNo, cancelErr.Error()))
+			}
+			return nil, fmt.Errorf("支付网关退款失败: %w", err)
+		}
+		refundId = result.RefundId
+	}
+	if err := model.FinishTopUpRefund(tradeNo, refundId, reason); err != nil {
+		return nil, err
+	}
+	return model.GetTopUpByTradeNo(tradeNo), nil
+}
+
+// CancelTopUp 用户关闭自己未支付的充值订单，网关不支持关闭订单时返回 ErrNotSupported
+func CancelTopUp(ctx context.Context, userId int, tradeNo string) error {
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil || topUp.UserId != userId {
+		return model.ErrTopUpNotFound
+	}
+	if topUp.Status != common.TopUpStatusPending {
+		return model.ErrTopUpStatusInvalid
+	}
+	provider, err := providerOf(topUp)
+	if err != nil {
+		return err
+	}
+	if err := provider.Cancel(ctx, orderOf(topUp)); err != nil {
+		return err
+	}
+	return model.ExpireTopUp(tradeNo)
+}
+
+// SyncTopUp 向网关查询未支付的充值订单，已支付时完成充值，已过期时关闭订单
+func SyncTopUp(ctx context.Context, tradeNo string) (*OrderStatus, error) {
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return nil, model.ErrTopUpNotFound
+	}
+	if topUp.Status != common.TopUpStatusPending {
+		return nil, model.ErrTopUpStatusInvalid
+	}
+	provider, err := providerOf(topUp)
+	if err != nil {
+		return nil, err
+	}
+	status, err := provider.QueryOrder(ctx, orderOf(topUp))
+	if err != nil {
+		return nil, err
+	}
+	switch status.Status {
+	case common.TopUpStatusSuccess:
+		err = model.CompleteTopUp(tradeNo, model.TopUpPayment{
+			ProviderOrderId: status.ProviderOrderId,
+			PaidAmount:      status.PaidAmount,
+			Currency:        status.Currency,
+		})
+	case common.TopUpStatusExpired:
+		err = model.ExpireTopUp(tradeNo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -0,0 +1,189 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to open test db: " + err.Error())
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("failed to get sql.DB: " + err.Error())
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	model.DB = db
+	model.LOG_DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	common.LogConsumeEnabled = true
+
+	if err := db.AutoMigrate(&model.User{}, &model.TopUp{}, &model.SubscriptionOrder{}, &model.Log{}); err != nil {
+		panic("failed to migrate: " + err.Error())
+	}
+	Register(mock)
+	os.Exit(m.Run())
+}
+
+// mockProvider 本地测试网关：回调以 URL Query 携带订单号和状态，签名头固定为 ok
+type mockProvider struct {
+	refundErr error
+	refunds   []string
+}
+
+var mock = &mockProvider{}
+
+func (*mockProvider) Name() string  { return "mock" }
+func (*mockProvider) Enabled() bool { return true }
+
+func (*mockProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	return &Checkout{URL: "https://pay.example.com/" + req.TradeNo, ProviderOrderId: "mock_" + req.TradeNo}, nil
+}
+
+func (*mockProvider) VerifyWebhook(r *http.Request) (*Notification, error) {
+	if r.Header.Get("X-Mock-Signature") != "ok" {
+		return nil, ErrInvalidSignature
+	}
+	query := r.URL.Query()
+	return &Notification{
+		TradeNo:         query.Get("trade_no"),
+		Status:          NotificationStatus(query.Get("status")),
+		ProviderOrderId: "mock_" + query.Get("trade_no"),
+		PaidAmount:      2,
+		Currency:        "USD",
+	}, nil
+}
+
+func (*mockProvider) QueryOrder(ctx context.Context, order *Order) (*OrderStatus, error) {
+	return &OrderStatus{Status: common.TopUpStatusSuccess, ProviderOrderId: order.ProviderOrderId}, nil
+}
+
+func (m *mockProvider) Refund(ctx context.Context, order *Order, reason string) (*RefundResult, error) {
+	if m.refundErr != nil {
+		return nil, m.refundErr
+	}
+	m.refunds = append(m.refunds, order.TradeNo)
+	return &RefundResult{RefundId: "re_" + order.TradeNo}, nil
+}
+
+func (*mockProvider) Cancel(ctx context.Context, order *Order) error {
+	return ErrNotSupported
+}
+
+func seedTopUp(t *testing.T, userId int, quota int, tradeNo string) {
+	t.Helper()
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM users")
+		model.DB.Exec("DELETE FROM top_ups")
+		model.DB.Exec("DELETE FROM logs")
+	})
+	user := &model.User{Id: userId, Username: "payer", Quota: quota, Status: common.UserStatusEnabled}
+	user.SetSetting(dto.UserSetting{InvoiceCompanyName: "Acme Ltd", InvoiceTaxId: "VAT-001"})
+	require.NoError(t, model.DB.Create(user).Error)
+	checkout, err := mock.CreateCheckout(context.Background(), &CheckoutRequest{TradeNo: tradeNo, Money: 2})
+	require.NoError(t, err)
+	require.NoError(t, (&model.TopUp{
+		UserId:          userId,
+		Amount:          2,
+		Money:           2,
+		TradeNo:         tradeNo,
+		PaymentMethod:   "mock",
+		Status:          common.TopUpStatusPending,
+		ProviderOrderId: checkout.ProviderOrderId,
+	}).Insert())
+}
+
+func userQuota(t *testing.T, userId int) int {
+	t.Helper()
+	quota, err := model.GetUserQuota(userId, true)
+	require.NoError(t, err)
+	return quota
+}
+
+func TestTopUpPaymentAndRefund(t *testing.T) {
+	seedTopUp(t, 1, 0, "mock-order-1")
+	credited := int(2 * common.QuotaPerUnit)
+
+	_, err := mock.VerifyWebhook(httptest.NewRequest(http.MethodPost, "/api/mock/webhook?trade_no=mock-order-1&status=paid", nil))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/mock/webhook?trade_no=mock-order-1&status=paid", nil)
+	req.Header.Set("X-Mock-Signature", "ok")
+	notification, err := ForMethod("mock").VerifyWebhook(req)
+	require.NoError(t, err)
+	require.NoError(t, HandleNotification(notification))
+	require.NoError(t, HandleNotification(notification), "duplicate notifications are acknowledged")
+	require.Equal(t, credited, userQuota(t, 1))
+
+	topUp := model.GetTopUpByTradeNo("mock-order-1")
+	require.Equal(t, common.TopUpStatusSuccess, topUp.Status)
+	require.Equal(t, "USD", topUp.Currency)
+
+	topUp, err = RefundTopUp(context.Background(), "mock-order-1", "duplicate purchase", false)
+	require.NoError(t, err)
+	require.Equal(t, common.TopUpStatusRefunded, topUp.Status)
+	require.Equal(t, "re_mock-order-1", topUp.RefundId)
+	require.Equal(t, []string{"mock-order-1"}, mock.refunds)
+	require.Zero(t, userQuota(t, 1))
+
+	_, err = RefundTopUp(context.Background(), "mock-order-1", "", false)
+	require.ErrorIs(t, err, model.ErrTopUpStatusInvalid)
+
+	user, err := model.GetUserById(1, false)
+	require.NoError(t, err)
+	invoice, err := service.NewTopUpInvoice(topUp, user)
+	require.NoError(t, err)
+	require.Equal(t, "Acme Ltd", invoice.BuyerName)
+	content, err := service.RenderTopUpInvoice(invoice)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "VAT-001")
+	require.Contains(t, string(content), "已退款")
+}
+
+func TestRefundTopUpRollback(t *testing.T) {
+	seedTopUp(t, 2, 0, "mock-order-2")
+	require.NoError(t, model.CompleteTopUp("mock-order-2", model.TopUpPayment{}))
+	credited := int(2 * common.QuotaPerUnit)
+
+	// 网关退款失败时退回扣除的额度
+	mock.refundErr = errors.New("gateway unavailable")
+	t.Cleanup(func() { mock.refundErr = nil })
+	_, err := RefundTopUp(context.Background(), "mock-order-2", "", false)
+	require.Error(t, err)
+	require.Equal(t, credited, userQuota(t, 2))
+	require.Equal(t, common.TopUpStatusSuccess, model.GetTopUpByTradeNo("mock-order-2").Status)
+
+	// 额度已经用掉一部分时不能扣回
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 2).Update("quota", credited-1).Error)
+	_, err = RefundTopUp(context.Background(), "mock-order-2", "", true)
+	require.ErrorIs(t, err, model.ErrTopUpRefundQuotaInsufficient)
+	require.Equal(t, credited-1, userQuota(t, 2))
+
+	// 线下退款不调用网关
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 2).Update("quota", credited+5).Error)
+	mock.refundErr = nil
+	mock.refunds = nil
+	topUp, err := RefundTopUp(context.Background(), "mock-order-2", "refunded in dashboard", true)
+	require.NoError(t, err)
+	require.Equal(t, common.TopUpStatusRefunded, topUp.Status)
+	require.Empty(t, mock.refunds)
+	require.Equal(t, 5, userQuota(t, 2))
+
+	require.ErrorIs(t, CancelTopUp(context.Background(), 2, "mock-order-2"), model.ErrTopUpStatusInvalid)
+}
@@ -0,0 +1,146 @@
+// Package payment 定义支付网关接口。充值与订阅购买通过 Provider 创建支付、验证回调、查询订单、退款和取消，
+// 新增网关（PayPal、支付宝直连等）只需要实现 Provider 并在 init 中 Register
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var (
+	// ErrNotSupported 网关不支持该操作，例如 Creem 没有退款接口
+	ErrNotSupported = errors.New("该支付方式不支持此操作")
+	// ErrInvalidSignature 回调验签失败
+	ErrInvalidSignature = errors.New("回调签名验证失败")
+	// ErrProviderOrderMissing 订单没有记录网关侧的订单号，无法查询或退款
+	ErrProviderOrderMissing = errors.New("订单缺少支付网关订单号")
+)
+
+// Provider 支付网关
+type Provider interface {
+	// Name 网关名称，与订单的支付方式相同（易支付除外，见 ForMethod）
+	Name() string
+	// Enabled 管理员是否已经配置该网关
+	Enabled() bool
+	// CreateCheckout 创建支付，返回用户跳转的支付页面
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error)
+	// VerifyWebhook 验证并解析网关的异步通知
+	VerifyWebhook(r *http.Request) (*Notification, error)
+	// QueryOrder 主动查询订单在网关侧的状态
+	QueryOrder(ctx context.Context, order *Order) (*OrderStatus, error)
+	// Refund 全额退款
+	Refund(ctx context.Context, order *Order, reason string) (*RefundResult, error)
+	// Cancel 关闭未支付的订单，关闭后用户无法再通过原支付链接付款
+	Cancel(ctx context.Context, order *Order) error
+}
+
+// CheckoutRequest 创建支付的参数，各网关只使用其中需要的字段
+type CheckoutRequest struct {
+	TradeNo      string  // 本地订单号
+	Title        string  // 商品名称
+	Money        float64 // 支付金额
+	Currency     string
+	Subscription bool // 订阅购买
+
+	UserId     int
+	Username   string
+	Email      string
+	CustomerId string // 网关侧的客户 ID，例如 Stripe Customer
+
+	Method    string // 易支付的支付方式（alipay、wxpay 等）
+	PriceId   string // Stripe Price ID，为空时使用全局配置的 StripePriceId
+	Quantity  int64  // Stripe 按数量计价
+	ProductId string // Creem 产品 ID
+	Metadata  map[string]string
+
+	SuccessURL string // 支付成功后跳转的地址，为空时使用默认地址
+	CancelURL  string
+	NotifyURL  string // 易支付的异步通知地址
+	ReturnURL  string // 易支付的同步跳转地址
+}
+
+// Checkout 创建支付的结果
+type Checkout struct {
+	URL             string            // 支付页面地址
+	Params          map[string]string // 需要以表单提交到 URL 的参数（易支付）
+	ProviderOrderId string            // 网关侧的订单号，创建时没有的（易支付）在回调时记录
+}
+
+// NotificationStatus 回调对应的订单状态
+type NotificationStatus string
+
+const (
+	NotificationPaid    NotificationStatus = "paid"
+	NotificationExpired NotificationStatus = "expired"
+	// NotificationIgnored 验签通过但不需要处理的事件
+	NotificationIgnored NotificationStatus = "ignored"
+)
+
+// Notification 验签后的网关回调
+type Notification struct {
+	TradeNo         string
+	Status          NotificationStatus
+	ProviderOrderId string
+	PaidAmount      float64
+	Currency        string
+	CustomerId      string
+	CustomerEmail   string
+	// SubscriptionOnly 只用于完成订阅订单，例如 Creem 的周期性扣款
+	SubscriptionOnly bool
+	// Payload 回调内容，记录到订阅订单
+	Payload string
+}
+
+// Order 查询、退款、取消时使用的订单信息
+type Order struct {
+	TradeNo         string
+	ProviderOrderId string
+	Money           float64 // 实际支付金额
+	Method          string
+}
+
+// OrderStatus 网关侧的订单状态，Status 取 common.TopUpStatus*
+type OrderStatus struct {
+	Status          string
+	ProviderOrderId string
+	PaidAmount      float64
+	Currency        string
+}
+
+// RefundResult 退款结果
+type RefundResult struct {
+	RefundId string
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = make(map[string]Provider)
+)
+
+// Register 注册支付网关，同名的网关会被替换
+func Register(provider Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// Get 按名称获取支付网关，未注册时返回 nil
+func Get(name string) Provider {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	return providers[name]
+}
+
+// ForMethod 按订单的支付方式找到支付网关。易支付的订单记录的是具体的支付方式（alipay、wxpay 等），
+// 其余网关与支付方式同名；早期的 Creem 充值订单没有记录支付方式
+func ForMethod(method string) Provider {
+	if provider := Get(method); provider != nil {
+		return provider
+	}
+	if method == "" {
+		return Get(ProviderCreem)
+	}
+	return Get(ProviderEpay)
+}
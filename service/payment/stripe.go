@@ -0,0 +1,219 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/refund"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const ProviderStripe = "stripe"
+
+func init() {
+	Register(&StripeProvider{})
+}
+
+// StripeProvider Stripe Checkout。网关侧的订单号为 Checkout Session ID
+type StripeProvider struct{}
+
+func (*StripeProvider) Name() string {
+	return ProviderStripe
+}
+
+func (*StripeProvider) Enabled() bool {
+	return setting.StripeApiSecret != "" && setting.StripeWebhookSecret != "" && setting.StripePriceId != ""
+}
+
+func setupStripeKey() error {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return fmt.Errorf("无效的Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+	return nil
+}
+
+// CreateCheckout 创建 Checkout Session。充值按 StripePriceId 的数量计价，订阅使用套餐的 Price ID
+func (*StripeProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if err := setupStripeKey(); err != nil {
+		return nil, err
+	}
+
+	// Use custom URLs if provided, otherwise use defaults
+	successURL := req.SuccessURL
+	if successURL == "" {
+		successURL = system_setting.ServerAddress + "/console/log"
+	}
+	cancelURL := req.CancelURL
+	if cancelURL == "" {
+		cancelURL = system_setting.ServerAddress + "/console/topup"
+	}
+	priceId := req.PriceId
+	if priceId == "" {
+		priceId = setting.StripePriceId
+	}
+	quantity := req.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(req.TradeNo),
+		SuccessURL:        stripe.String(successURL),
+		CancelURL:         stripe.String(cancelURL),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(priceId),
+				Quantity: stripe.Int64(quantity),
+			},
+		},
+	}
+	params.Context = ctx
+	if req.Subscription {
+		params.Mode = stripe.String(string(stripe.CheckoutSessionModeSubscription))
+	} else {
+		params.Mode = stripe.String(string(stripe.CheckoutSessionModePayment))
+		params.AllowPromotionCodes = stripe.Bool(setting.StripePromotionCodesEnabled)
+	}
+
+	if "" == req.CustomerId {
+		if "" != req.Email {
+			params.CustomerEmail = stripe.String(req.Email)
+		}
+		params.CustomerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
+	} else {
+		params.Customer = stripe.String(req.CustomerId)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{URL: result.URL, ProviderOrderId: result.ID}, nil
+}
+
+func (*StripeProvider) VerifyWebhook(r *http.Request) (*Notification, error) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	event, err := webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), setting.StripeWebhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+	}
+
+	referenceId := event.GetObjectValue("client_reference_id")
+	status := event.GetObjectValue("status")
+	notification := &Notification{
+		TradeNo:         referenceId,
+		Status:          NotificationIgnored,
+		ProviderOrderId: event.GetObjectValue("id"),
+	}
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted:
+		if status != "complete" {
+			return notification, nil
+		}
+		customerId := event.GetObjectValue("customer")
+		total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
+		currency := strings.ToUpper(event.GetObjectValue("currency"))
+		notification.Status = NotificationPaid
+		notification.CustomerId = customerId
+		notification.PaidAmount = total / 100
+		notification.Currency = currency
+		notification.Payload = common.GetJsonString(map[string]any{
+			"customer":     customerId,
+			"amount_total": event.GetObjectValue("amount_total"),
+			"currency":     currency,
+			"event_type":   string(event.Type),
+		})
+	case stripe.EventTypeCheckoutSessionExpired:
+		if status == "expired" {
+			notification.Status = NotificationExpired
+		}
+	}
+	return notification, nil
+}
+
+func getStripeSession(ctx context.Context, order *Order) (*stripe.CheckoutSession, error) {
+	if order.ProviderOrderId == "" {
+		return nil, ErrProviderOrderMissing
+	}
+	if err := setupStripeKey(); err != nil {
+		return nil, err
+	}
+	params := &stripe.CheckoutSessionParams{}
+	params.Context = ctx
+	return session.Get(order.ProviderOrderId, params)
+}
+
+func (*StripeProvider) QueryOrder(ctx context.Context, order *Order) (*OrderStatus, error) {
+	result, err := getStripeSession(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	status := &OrderStatus{Status: common.TopUpStatusPending, ProviderOrderId: result.ID}
+	switch result.Status {
+	case stripe.CheckoutSessionStatusComplete:
+		if result.PaymentStatus != stripe.CheckoutSessionPaymentStatusUnpaid {
+			status.Status = common.TopUpStatusSuccess
+			status.PaidAmount = float64(result.AmountTotal) / 100
+			status.Currency = strings.ToUpper(string(result.Currency))
+		}
+	case stripe.CheckoutSessionStatusExpired:
+		status.Status = common.TopUpStatusExpired
+	}
+	return status, nil
+}
+
+// Refund 按 Checkout Session 对应的 PaymentIntent 全额退款，订阅模式的 Session 没有 PaymentIntent
+func (*StripeProvider) Refund(ctx context.Context, order *Order, reason string) (*RefundResult, error) {
+	result, err := getStripeSession(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if result.PaymentIntent == nil || result.PaymentIntent.ID == "" {
+		return nil, ErrNotSupported
+	}
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(result.PaymentIntent.ID),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	params.Context = ctx
+	if reason != "" {
+		params.AddMetadata("reason", reason)
+	}
+	params.AddMetadata("trade_no", order.TradeNo)
+	// 同一订单重复退款时由 Stripe 去重
+	params.SetIdempotencyKey("refund-" + order.TradeNo)
+	created, err := refund.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{RefundId: created.ID}, nil
+}
+
+func (*StripeProvider) Cancel(ctx context.Context, order *Order) error {
+	if order.ProviderOrderId == "" {
+		return ErrProviderOrderMissing
+	}
+	if err := setupStripeKey(); err != nil {
+		return err
+	}
+	params := &stripe.CheckoutSessionExpireParams{}
+	params.Context = ctx
+	_, err := session.Expire(order.ProviderOrderId, params)
+	return err
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	piiPlaceholderRegex = regexp.MustCompile(`\[PII_[A-Z_]+_\d+\]`)
+	// piiPlaceholderPartialRegex 匹配文本末尾可能被流式输出截断的占位符前缀
+	piiPlaceholderPartialRegex = regexp.MustCompile(`\[(?:P(?:I(?:I(?:_[A-Z_]*\d*)?)?)?)?$`)
+	// piiStreamDeltaKeys 流式输出中按字段缓存截断占位符的文本字段
+	piiStreamDeltaKeys = []string{"content", "reasoning_content", "reasoning"}
+)
+
+// PIIVault 单次请求内原文与占位符的映射，只保存在请求内存中
+type PIIVault struct {
+	mu            sync.Mutex
+	piiTypes      []string
+	byOriginal    map[string]string
+	byPlaceholder map[string]string
+	counts        map[string]int
+	writer        *piiRestoreWriter
+}
+
+func newPIIVault(piiTypes []string) *PIIVault {
+	return &PIIVault{
+		piiTypes:      piiTypes,
+		byOriginal:    make(map[string]string),
+		byPlaceholder: make(map[string]string),
+		counts:        make(map[string]int),
+	}
+}
+
+// Redact 将文本中的 PII 替换为占位符，相同原文使用相同的占位符
+func (v *PIIVault) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+	matches := findGuardrailMatches(getPIIMatchers(v.piiTypes), text)
+	if len(matches) == 0 {
+		return text
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		original := text[m.start:m.end]
+		placeholder, ok := v.byOriginal[original]
+		if !ok {
+			v.counts[m.label]++
+			placeholder = fmt.Sprintf("[PII_%s_%d]", strings.ToUpper(m.label), v.counts[m.label])
+			v.byOriginal[original] = placeholder
+			v.byPlaceholder[placeholder] = original
+		}
+		sb.WriteString(text[last:m.start])
+		sb.WriteString(placeholder)
+		last = m.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// Restore 将文本中的占位符还原为原文
+func (v *PIIVault) Restore(text string) string {
+	if !strings.Contains(text, "[PII_") {
+		return text
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return piiPlaceholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := v.byPlaceholder[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// RedactedTypes 返回各类型脱敏的数量（去重后）
+func (v *PIIVault) RedactedTypes() map[string]int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	result := make(map[string]int, len(v.counts))
+	for piiType, count := range v.counts {
+		result[piiType] = count
+	}
+	return result
+}
+
+func (v *PIIVault) empty() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.byPlaceholder) == 0
+}
+
+func getPIIMatchers(piiTypes []string) []guardrailMatcher {
+	return getGuardrailMatchers(&operation_setting.GuardrailRule{
+		Provider: operation_setting.GuardrailProviderPII,
+		PIITypes: piiTypes,
+	})
+}
+
+func getPIIVault(c *gin.Context) *PIIVault {
+	vault, ok := common.GetContextKeyType[*PIIVault](c, constant.ContextKeyPIIVault)
+	if !ok {
+		return nil
+	}
+	return vault
+}
+
+// piiRedactionRequested 全局开关 + 令牌或分组开启
+func piiRedactionRequested(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !operation_setting.GetPIIRedactionSetting().Enabled {
+		return false
+	}
+	return common.GetContextKeyBool(c, constant.ContextKeyTokenPIIRedaction) || operation_setting.IsPIIRedactionGroup(info.UsingGroup)
+}
+
+// piiRedactionSupported 目前只支持 /v1/chat/completions 对话请求
+func piiRedactionSupported(info *relaycommon.RelayInfo) bool {
+	return info.RelayMode == relayconstant.RelayModeChatCompletions
+}
+
+func piiRedactionEnabled(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	return piiRedactionRequested(c, info) && piiRedactionSupported(info)
+}
+
+// CheckPIIRedactionSupported 开启 PII 脱敏时拒绝无法脱敏的请求（Claude、Gemini 原生格式、Responses、
+// Completions、Embeddings、异步任务等），避免原文被发往上游
+func CheckPIIRedactionSupported(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	if !piiRedactionRequested(c, info) || piiRedactionSupported(info) {
+		return nil
+	}
+	return types.NewErrorWithStatusCode(
+		errors.New("PII redaction is enabled for this token, only /v1/chat/completions requests are supported"),
+		types.ErrorCodePIIRedactionUnsupported, http.StatusBadRequest,
+		types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// ApplyPIIRedaction 转发前将消息中的 PII 替换为占位符，并接管响应输出以还原占位符。
+// 返回 true 表示请求中存在被替换的内容
+func ApplyPIIRedaction(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) bool {
+	if !piiRedactionEnabled(c, info) {
+		return false
+	}
+	vault := getPIIVault(c)
+	if vault == nil {
+		vault = newPIIVault(operation_setting.GetPIIRedactionTypes())
+		common.SetContextKey(c, constant.ContextKeyPIIVault, vault)
+	}
+	for i := range request.Messages {
+		redactPIIMessage(vault, &request.Messages[i])
+	}
+	if vault.empty() {
+		return false
+	}
+	installPIIRestoreWriter(c, vault)
+	return true
+}
+
+func redactPIIMessage(vault *PIIVault, message *dto.Message) {
+	switch content := message.Content.(type) {
+	case string:
+		message.SetStringContent(vault.Redact(content))
+	case []any:
+		for _, item := range content {
+			part, ok := item.(map[string]any)
+			if !ok || part["type"] != dto.ContentTypeText {
+				continue
+			}
+			if text, ok := part["text"].(string); ok {
+				part["text"] = vault.Redact(text)
+			}
+		}
+	case []dto.MediaContent:
+		for i := range content {
+			if content[i].Type == dto.ContentTypeText {
+				content[i].Text = vault.Redact(content[i].Text)
+			}
+		}
+		message.SetMediaContent(content)
+	}
+}
+
+// RedactPIIRequestBody 透传请求体时按同一映射替换 messages 中的文本
+func RedactPIIRequestBody(c *gin.Context, body []byte) ([]byte, error) {
+	vault := getPIIVault(c)
+	if vault == nil {
+		return body, nil
+	}
+	v, err := decodeGuardrailJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]any)
+	if !ok {
+		return body, nil
+	}
+	messages, ok := root["messages"].([]any)
+	if !ok {
+		return body, nil
+	}
+	for _, message := range messages {
+		walkGuardrailTexts(message, map[string]bool{"content": true, "text": true}, false, vault.Redact)
+	}
+	return common.Marshal(root)
+}
+
+// appendPIIRedactionInfo 写入被脱敏的 PII 类型与数量
+func appendPIIRedactionInfo(c *gin.Context, other map[string]interface{}) {
+	vault := getPIIVault(c)
+	if vault == nil || vault.empty() {
+		return
+	}
+	FinishPIIRestore(c)
+	other["pii_redaction"] = vault.RedactedTypes()
+}
+
+// piiRestoreWriter 在响应写给客户端前还原占位符。非流式响应整体缓冲后替换；
+// 流式响应逐个事件替换，被拆分到多个 delta 的占位符会暂存到下一个事件
+type piiRestoreWriter struct {
+	*bufferedSSEWriter
+	vault *PIIVault
+
+	// carry 按 choice 与字段暂存的截断占位符，lastChunk 用于补发暂存内容
+	carry     map[string]string
+	lastChunk map[string]any
+}
+
+func installPIIRestoreWriter(c *gin.Context, vault *PIIVault) {
+	if vault.writer != nil && !vault.writer.finished {
+		return
+	}
+	w := &piiRestoreWriter{
+		vault: vault,
+		carry: make(map[string]string),
+	}
+	w.bufferedSSEWriter = newBufferedSSEWriter(c.Writer, w)
+	vault.writer = w
+	c.Writer = w
+}
+
+// FinishPIIRestore 写出缓冲的响应并恢复原始 writer，可重复调用
+func FinishPIIRestore(c *gin.Context) {
+	vault := getPIIVault(c)
+	if vault == nil || vault.writer == nil {
+		return
+	}
+	w := vault.writer
+	w.finish()
+	if c.Writer == gin.ResponseWriter(w) {
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// processEvent 还原一条 SSE 事件中的占位符
+func (w *piiRestoreWriter) processEvent(event string) (string, bool) {
+	lines := strings.Split(strings.TrimSuffix(event, "\n\n"), "\n")
+	var prefix string
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "[DONE]" {
+			prefix = w.flushCarry()
+			continue
+		}
+		if payload == "" || payload[0] != '{' {
+			continue
+		}
+		v, err := decodeGuardrailJSON([]byte(payload))
+		if err != nil {
+			continue
+		}
+		chunk, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		finished := w.restoreChunk(chunk)
+		out, err := common.Marshal(chunk)
+		if err != nil {
+			continue
+		}
+		lines[i] = "data: " + string(out)
+		if finished {
+			// 结束前补发暂存的内容
+			prefix = w.flushCarry()
+		}
+	}
+	// 其余字段（如工具调用参数）中的完整占位符直接替换
+	return prefix + w.vault.Restore(strings.Join(lines, "\n")+"\n\n"), false
+}
+
+// restoreChunk 还原 choices[].delta 中的文本字段，返回是否包含 finish_reason
+func (w *piiRestoreWriter) restoreChunk(chunk map[string]any) bool {
+	choices, ok := chunk["choices"].([]any)
+	if !ok {
+		return false
+	}
+	finished := false
+	for idx, item := range choices {
+		choice, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+			finished = true
+		}
+		delta, ok := choice["delta"].(map[string]any)
+		if !ok {
+			continue
+		}
+		index := strconv.Itoa(idx)
+		if n, ok := choice["index"].(interface{ String() string }); ok {
+			index = n.String()
+		}
+		for _, key := range piiStreamDeltaKeys {
+			text, ok := delta[key].(string)
+			if !ok {
+				continue
+			}
+			carryKey := index + "/" + key
+			text = w.vault.Restore(w.carry[carryKey] + text)
+			delete(w.carry, carryKey)
+			if loc := piiPlaceholderPartialRegex.FindStringIndex(text); loc != nil {
+				w.carry[carryKey] = text[loc[0]:]
+				text = text[:loc[0]]
+			}
+			delta[key] = text
+		}
+	}
+	w.lastChunk = chunk
+	return finished
+}
+
+// flushCarry 将暂存的内容作为一个单独的 chunk 发出
+func (w *piiRestoreWriter) flushCarry() string {
+	if len(w.carry) == 0 {
+		return ""
+	}
+	var choices []any
+	for carryKey, text := range w.carry {
+		index, key, _ := strings.Cut(carryKey, "/")
+		choices = append(choices, map[string]any{
+			"index": json.Number(index),
+			"delta": map[string]any{key: text},
+		})
+	}
+	w.carry = make(map[string]string)
+	chunk := map[string]any{"object": "chat.completion.chunk", "choices": choices}
+	for _, field := range []string{"id", "created", "model"} {
+		if value, ok := w.lastChunk[field]; ok {
+			chunk[field] = value
+		}
+	}
+	data, err := common.Marshal(chunk)
+	if err != nil {
+		return ""
+	}
+	return "data: " + string(data) + "\n\n"
+}
+
+// finishStream 补发暂存的内容，末尾不完整的事件中的完整占位符直接替换
+func (w *piiRestoreWriter) finishStream(rest string) string {
+	return w.flushCarry() + w.vault.Restore(rest)
+}
+
+// finishBody 还原非流式响应中的占位符。占位符与原文均不含需要 JSON 转义的字符，直接按文本替换
+func (w *piiRestoreWriter) finishBody(status int, body []byte) (int, []byte) {
+	return status, []byte(w.vault.Restore(string(body)))
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withPIIRedactionSetting(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetPIIRedactionSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.Groups = []string{"compliance"}
+	setting.PIITypes = nil
+	t.Cleanup(func() {
+		*setting = prev
+	})
+}
+
+func TestPIIVaultRedactRestore(t *testing.T) {
+	vault := newPIIVault(operation_setting.GetPIIRedactionTypes())
+	redacted := vault.Redact("alice@example.com, 13812345678, alice@example.com, bob@example.com")
+	require.Equal(t, "[PII_EMAIL_1], [PII_PHONE_1], [PII_EMAIL_1], [PII_EMAIL_2]", redacted)
+	require.Equal(t, "to alice@example.com and bob@example.com [PII_EMAIL_9]", vault.Restore("to [PII_EMAIL_1] and [PII_EMAIL_2] [PII_EMAIL_9]"))
+	require.Equal(t, map[string]int{"email": 2, "phone": 1}, vault.RedactedTypes())
+}
+
+func TestApplyPIIRedaction(t *testing.T) {
+	withPIIRedactionSetting(t)
+	ctx, _ := buildGuardrailContextForTest()
+	info := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, UsingGroup: "default"}
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{
+		{Role: "user", Content: "my id is 11010519491231002X"},
+	}}
+	require.False(t, ApplyPIIRedaction(ctx, info, request))
+	require.Equal(t, "my id is 11010519491231002X", request.Messages[0].StringContent())
+
+	common.SetContextKey(ctx, constant.ContextKeyTokenPIIRedaction, true)
+	request.Messages = append(request.Messages, dto.Message{Role: "user", Content: []any{
+		map[string]any{"type": "text", "text": "mail me at carol@example.com"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}},
+	}})
+	require.True(t, ApplyPIIRedaction(ctx, info, request))
+	require.Equal(t, "my id is [PII_ID_NUMBER_1]", request.Messages[0].StringContent())
+	require.Equal(t, "mail me at [PII_EMAIL_1]", request.Messages[1].StringContent())
+
+	body, err := RedactPIIRequestBody(ctx, []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"mail me at carol@example.com"}]}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"mail me at [PII_EMAIL_1]"}]}`, string(body))
+	FinishPIIRestore(ctx)
+}
+
+func TestCheckPIIRedactionSupported(t *testing.T) {
+	withPIIRedactionSetting(t)
+	ctx, _ := buildGuardrailContextForTest()
+	chat := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, UsingGroup: "compliance"}
+	require.Nil(t, CheckPIIRedactionSupported(ctx, chat))
+
+	for _, info := range []*relaycommon.RelayInfo{
+		{RelayFormat: types.RelayFormatClaude, UsingGroup: "compliance"},
+		{RelayFormat: types.RelayFormatGemini, RelayMode: relayconstant.RelayModeGemini, UsingGroup: "compliance"},
+		{RelayFormat: types.RelayFormatOpenAIResponses, RelayMode: relayconstant.RelayModeResponses, UsingGroup: "compliance"},
+		{RelayFormat: types.RelayFormatOpenAI, RelayMode: relayconstant.RelayModeCompletions, UsingGroup: "compliance"},
+	} {
+		apiErr := CheckPIIRedactionSupported(ctx, info)
+		require.NotNil(t, apiErr)
+		require.Equal(t, types.ErrorCodePIIRedactionUnsupported, apiErr.GetErrorCode())
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	}
+
+	// 未开启脱敏的令牌不受影响
+	require.Nil(t, CheckPIIRedactionSupported(ctx, &relaycommon.RelayInfo{RelayFormat: types.RelayFormatClaude, UsingGroup: "default"}))
+}
+
+func TestPIIRestoreWriterStream(t *testing.T) {
+	withPIIRedactionSetting(t)
+	ctx, rec := buildGuardrailContextForTest()
+	info := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, UsingGroup: "compliance"}
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "reply to dave@example.com"}}}
+	require.True(t, ApplyPIIRedaction(ctx, info, request))
+
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	_, _ = ctx.Writer.WriteString(`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Sending to [PII_EM"}}]}` + "\n\n")
+	_, _ = ctx.Writer.WriteString(`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"AIL_1] now ["}}]}` + "\n\n")
+	_, _ = ctx.Writer.WriteString(`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n")
+	_, _ = ctx.Writer.WriteString("data: [DONE]\n\n")
+	FinishPIIRestore(ctx)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `"content":"Sending to "`)
+	require.Contains(t, body, `"content":"dave@example.com now "`)
+	require.Contains(t, body, `"content":"["`)
+	require.NotContains(t, body, "PII_")
+
+	other := map[string]interface{}{}
+	appendPIIRedactionInfo(ctx, other)
+	require.Equal(t, map[string]int{"email": 1}, other["pii_redaction"])
+}
+
+func TestPIIRestoreWriterNonStream(t *testing.T) {
+	withPIIRedactionSetting(t)
+	ctx, rec := buildGuardrailContextForTest()
+	common.SetContextKey(ctx, constant.ContextKeyTokenPIIRedaction, true)
+	info := &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions}
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "call 13812345678"}}}
+	require.True(t, ApplyPIIRedaction(ctx, info, request))
+
+	ctx.JSON(http.StatusOK, gin.H{"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "Calling [PII_PHONE_1]"}}}})
+	require.Empty(t, rec.Body.String())
+	FinishPIIRestore(ctx)
+	require.JSONEq(t, `{"choices":[{"message":{"role":"assistant","content":"Calling 13812345678"}}]}`, rec.Body.String())
+}
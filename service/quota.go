@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -86,16 +85,30 @@ func calculateAudioQuota(info QuotaInfo) int {
 	return int(quota.Round(0).IntPart())
 }
 
+// usdToQuota 将美元金额按分组倍率换算为额度，金额或倍率不为正时返回 0
+func usdToQuota(amount, groupRatio float64) int {
+	if amount <= 0 {
+		return 0
+	}
+	if groupRatio <= 0 {
+		return 0
+	}
+	quota := decimal.NewFromFloat(amount).
+		Mul(decimal.NewFromFloat(common.QuotaPerUnit)).
+		Mul(decimal.NewFromFloat(groupRatio)).
+		Round(0).
+		IntPart()
+	if quota <= 0 {
+		return 0
+	}
+	return int(quota)
+}
+
 func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) error {
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
-	if err != nil {
-		return err
-	}
-
-	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
+	token, err := model.GetTokenByIdWithCache(relayInfo.TokenId, relayInfo.TokenKey)
 	if err != nil {
 		return err
 	}
@@ -138,17 +151,33 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 	quota := calculateAudioQuota(quotaInfo)
 
-	if userQuota < quota {
-		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
-	}
-
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
 
-	err = PostConsumeQuota(relayInfo, quota, 0, false)
-	if err != nil {
-		return err
+	// 组织令牌与 BillingSession 一样从组织钱包预扣，余额不足时拒绝
+	if relayInfo.OrgId > 0 {
+		if err := model.PreConsumeOrganizationQuota(relayInfo.OrgId, quota); err != nil {
+			if errors.Is(err, model.ErrOrgQuotaNotEnough) {
+				return fmt.Errorf("organization quota is not enough, need quota: %s", logger.FormatQuota(quota))
+			}
+			return err
+		}
+		if err := postConsumeTokenQuota(relayInfo, quota); err != nil {
+			_ = model.AdjustOrganizationConsumedQuota(relayInfo.OrgId, -quota)
+			return err
+		}
+	} else {
+		userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+		if err != nil {
+			return err
+		}
+		if userQuota < quota {
+			return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
+		}
+		if err := PostConsumeQuota(relayInfo, quota, 0, false); err != nil {
+			return err
+		}
 	}
 	logger.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
 	return nil
@@ -211,7 +240,10 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordMultiKeyQuota(relayInfo, quota)
 	}
+	// 实时会话按响应逐次扣费，不经过 SettleBilling，会话结束时单独校正用量限流计数
+	ReconcileUsageRateLimit(ctx, totalTokens, quota)
 
 	logModel := modelName
 	if extraContent != "" {
@@ -308,9 +340,11 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordMultiKeyQuota(relayInfo, quota)
 	}
 
-	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
+	RecordUsageTrace(ctx, promptTokens, completionTokens)
+	if err := SettleBilling(ctx, relayInfo, quota, totalTokens); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
 
@@ -414,9 +448,11 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordMultiKeyQuota(relayInfo, quota)
 	}
 
-	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
+	RecordUsageTrace(ctx, usage.PromptTokens, usage.CompletionTokens)
+	if err := SettleBilling(ctx, relayInfo, quota, totalTokens); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
 
@@ -452,15 +488,19 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := model.GetTokenByIdWithCache(relayInfo.TokenId, relayInfo.TokenKey)
 	if err != nil {
 		return err
 	}
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
+	if err = ReserveBudgets(relayInfo, quota); err != nil {
+		return err
+	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
+		AdjustBudgets(relayInfo.UserId, relayInfo.TokenId, -quota)
 		return err
 	}
 	return nil
@@ -480,6 +520,11 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			}
 			relayInfo.SubscriptionPostDelta += delta
 		}
+	} else if relayInfo != nil && relayInfo.OrgId > 0 {
+		// Organization wallet
+		if err := model.AdjustOrganizationConsumedQuota(relayInfo.OrgId, quota); err != nil {
+			return err
+		}
 	} else {
 		// Wallet
 		if quota > 0 {
@@ -492,18 +537,11 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if !relayInfo.IsPlayground {
-		if quota > 0 {
-			err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
-		} else {
-			err = model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, -quota)
-		}
-		if err != nil {
-			return err
-		}
+	if err := postConsumeTokenQuota(relayInfo, quota); err != nil {
+		return err
 	}
 
-	if sendEmail {
+	if sendEmail && relayInfo.OrgId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -512,6 +550,23 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 	return nil
 }
 
+// postConsumeTokenQuota 按实际消耗调整令牌额度与预算，操练场请求不关联令牌
+func postConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) (err error) {
+	if relayInfo.IsPlayground {
+		return nil
+	}
+	if quota > 0 {
+		err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
+	} else {
+		err = model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, -quota)
+	}
+	if err != nil {
+		return err
+	}
+	AdjustBudgets(relayInfo.UserId, relayInfo.TokenId, quota)
+	return nil
+}
+
 func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int) {
 	gopool.Go(func() {
 		userSetting := relayInfo.UserSetting
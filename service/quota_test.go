@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreWssConsumeQuotaUsesOrganizationWallet(t *testing.T) {
+	truncate(t)
+	t.Cleanup(func() { model.DB.Exec("DELETE FROM organizations") })
+	seedUser(t, 1, 0)
+	seedToken(t, 1, 1, "org-token", 1000000)
+	require.NoError(t, model.DB.Create(&model.Organization{Id: 1, Name: "org", OwnerId: 1, Quota: 1000000}).Error)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{
+		UserId:          1,
+		TokenId:         1,
+		OrgId:           1,
+		OriginModelName: "gpt-4o-realtime-preview",
+	}
+	usage := &dto.RealtimeUsage{}
+	usage.InputTokenDetails.TextTokens = 1000
+	usage.OutputTokenDetails.TextTokens = 1000
+
+	// 个人余额为 0 也能从组织钱包扣费
+	require.NoError(t, PreWssConsumeQuota(ctx, info, usage))
+	orgQuota, err := model.GetOrganizationQuota(1)
+	require.NoError(t, err)
+	consumed := 1000000 - orgQuota
+	require.Positive(t, consumed)
+	require.Equal(t, 1000000-consumed, getTokenRemainQuota(t, 1))
+	require.Equal(t, 0, getUserQuota(t, 1))
+
+	// 组织余额不足时拒绝，令牌额度不变
+	require.NoError(t, model.DB.Model(&model.Organization{}).Where("id = ?", 1).Update("quota", 0).Error)
+	require.Error(t, PreWssConsumeQuota(ctx, info, usage))
+	require.Equal(t, 1000000-consumed, getTokenRemainQuota(t, 1))
+	orgQuota, err = model.GetOrganizationQuota(1)
+	require.NoError(t, err)
+	require.Zero(t, orgQuota)
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginKeyRequestCapture 本次请求的抓取记录，在第一次命中抓取窗口的上游请求时创建
+const ginKeyRequestCapture = "request_capture"
+
+// captureSensitiveHeaders 抓取时需要脱敏的请求/响应头
+var captureSensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-goog-api-key":      true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// captureSensitiveQueryParams 抓取时需要脱敏的 URL 查询参数，如 Gemini 的 key、百度的 access_token
+var captureSensitiveQueryParams = map[string]bool{
+	"key":           true,
+	"api_key":       true,
+	"api-key":       true,
+	"apikey":        true,
+	"access_token":  true,
+	"token":         true,
+	"client_secret": true,
+}
+
+// CaptureBody 抓取到的报文，非 UTF-8 内容以 base64 保存
+type CaptureBody struct {
+	Encoding  string `json:"encoding"`
+	Body      string `json:"body"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated"`
+}
+
+// CaptureUpstreamAttempt 一次发往上游的请求及其响应（重试时每个渠道一条）
+type CaptureUpstreamAttempt struct {
+	ChannelId       int               `json:"channel_id"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     *CaptureBody      `json:"request_body,omitempty"`
+	StatusCode      int               `json:"status_code"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    *CaptureBody      `json:"response_body,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	StartedAt       int64             `json:"started_at"`
+
+	requestTap  *captureTapReadCloser
+	responseTap *captureTapReadCloser
+}
+
+// RequestCaptureRecord 落盘的抓取内容
+type RequestCaptureRecord struct {
+	RequestId      string                    `json:"request_id"`
+	Method         string                    `json:"method"`
+	Path           string                    `json:"path"`
+	ClientHeaders  map[string]string         `json:"client_headers"`
+	ClientBody     *CaptureBody              `json:"client_body,omitempty"`
+	Attempts       []*CaptureUpstreamAttempt `json:"attempts"`
+	StatusCode     int                       `json:"status_code"`
+	Error          string                    `json:"error,omitempty"`
+	CreatedAt      int64                     `json:"created_at"`
+	CompletedAt    int64                     `json:"completed_at"`
+	ModelName      string                    `json:"model_name"`
+	TokenId        int                       `json:"token_id"`
+	UserId         int                       `json:"user_id"`
+	LastChannelId  int                       `json:"last_channel_id"`
+	upstreamFailed bool
+}
+
+// captureTapReadCloser 在读取报文的同时保留前 limit 字节
+type captureTapReadCloser struct {
+	rc        io.ReadCloser
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	size      int64
+	limit     int
+	truncated bool
+}
+
+func (t *captureTapReadCloser) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		t.size += int64(n)
+		remaining := t.limit - t.buf.Len()
+		if remaining < n {
+			t.truncated = true
+		}
+		if remaining > 0 {
+			t.buf.Write(p[:min(n, remaining)])
+		}
+		t.mu.Unlock()
+	}
+	return n, err
+}
+
+func (t *captureTapReadCloser) Close() error {
+	return t.rc.Close()
+}
+
+func (t *captureTapReadCloser) snapshot() *CaptureBody {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	body := newCaptureBody(t.buf.Bytes(), t.truncated)
+	body.Size = t.size
+	return body
+}
+
+func newCaptureBody(data []byte, truncated bool) *CaptureBody {
+	body := &CaptureBody{Encoding: "utf8", Size: int64(len(data)), Truncated: truncated}
+	if utf8.Valid(data) {
+		body.Body = string(data)
+	} else {
+		body.Encoding = "base64"
+		body.Body = base64.StdEncoding.EncodeToString(data)
+	}
+	return body
+}
+
+func captureHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if captureSensitiveHeaders[strings.ToLower(name)] {
+			headers[name] = "***"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func captureURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	query := u.Query()
+	for name := range query {
+		if captureSensitiveQueryParams[strings.ToLower(name)] {
+			query.Set(name, "***")
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// isRequestCaptureWindowActive 判断当前令牌或所选渠道是否处于抓取窗口内
+func isRequestCaptureWindowActive(c *gin.Context) bool {
+	if !operation_setting.GetRequestCaptureSetting().Enabled {
+		return false
+	}
+	now := common.GetTimestamp()
+	if until, ok := common.GetContextKeyType[int64](c, constant.ContextKeyTokenCaptureUntil); ok && until > now {
+		return true
+	}
+	if until, ok := common.GetContextKeyType[int64](c, constant.ContextKeyChannelCaptureUntil); ok && until > now {
+		return true
+	}
+	return false
+}
+
+func getRequestCapture(c *gin.Context) *RequestCaptureRecord {
+	if c == nil {
+		return nil
+	}
+	if v, ok := c.Get(ginKeyRequestCapture); ok {
+		if record, ok := v.(*RequestCaptureRecord); ok {
+			return record
+		}
+	}
+	return nil
+}
+
+// IsRequestCaptured 当前请求是否已被抓取，用于在日志中标记可查看抓取内容
+func IsRequestCaptured(c *gin.Context) bool {
+	return getRequestCapture(c) != nil
+}
+
+// CaptureUpstreamRequest 在发往上游前记录转换后的请求，未处于抓取窗口时返回 nil。
+// 请求体通过 tap 在发送过程中记录，不会额外读取或缓冲整个请求体
+func CaptureUpstreamRequest(c *gin.Context, req *http.Request) *CaptureUpstreamAttempt {
+	if c == nil || req == nil || !isRequestCaptureWindowActive(c) {
+		return nil
+	}
+	record := getRequestCapture(c)
+	if record == nil {
+		record = &RequestCaptureRecord{
+			RequestId:     c.GetString(common.RequestIdKey),
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.Path,
+			ClientHeaders: captureHeaders(c.Request.Header),
+			CreatedAt:     common.GetTimestamp(),
+		}
+		c.Set(ginKeyRequestCapture, record)
+	}
+	attempt := &CaptureUpstreamAttempt{
+		ChannelId:      common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		Method:         req.Method,
+		URL:            captureURL(req.URL),
+		RequestHeaders: captureHeaders(req.Header),
+		StartedAt:      common.GetTimestamp(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		attempt.requestTap = &captureTapReadCloser{rc: req.Body, limit: operation_setting.GetRequestCaptureMaxBodyBytes()}
+		req.Body = attempt.requestTap
+	}
+	record.Attempts = append(record.Attempts, attempt)
+	return attempt
+}
+
+// CaptureUpstreamResponse 记录上游响应头与状态，响应体在被中转逻辑读取时记录
+func CaptureUpstreamResponse(attempt *CaptureUpstreamAttempt, resp *http.Response, err error) {
+	if attempt == nil {
+		return
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+	if resp == nil {
+		return
+	}
+	attempt.StatusCode = resp.StatusCode
+	attempt.ResponseHeaders = captureHeaders(resp.Header)
+	if resp.Body != nil {
+		attempt.responseTap = &captureTapReadCloser{rc: resp.Body, limit: operation_setting.GetRequestCaptureMaxBodyBytes()}
+		resp.Body = attempt.responseTap
+	}
+}
+
+// SaveRequestCapture 在请求结束时将抓取内容写入磁盘并建立 RequestId 索引
+func SaveRequestCapture(c *gin.Context, relayErr error) {
+	record := getRequestCapture(c)
+	if record == nil {
+		return
+	}
+	c.Set(ginKeyRequestCapture, nil)
+
+	for _, attempt := range record.Attempts {
+		if attempt.requestTap != nil {
+			attempt.RequestBody = attempt.requestTap.snapshot()
+		}
+		if attempt.responseTap != nil {
+			attempt.ResponseBody = attempt.responseTap.snapshot()
+		}
+		if attempt.Error != "" || attempt.StatusCode >= http.StatusBadRequest {
+			record.upstreamFailed = true
+		}
+		record.LastChannelId = attempt.ChannelId
+	}
+	if relayErr != nil {
+		record.Error = relayErr.Error()
+	}
+	failed := relayErr != nil || record.upstreamFailed
+	if operation_setting.GetRequestCaptureSetting().FailedOnly && !failed {
+		return
+	}
+
+	if storage, err := common.GetBodyStorage(c); err == nil {
+		if data, err := storage.Bytes(); err == nil {
+			limit := operation_setting.GetRequestCaptureMaxBodyBytes()
+			truncated := len(data) > limit
+			if truncated {
+				data = data[:limit]
+			}
+			record.ClientBody = newCaptureBody(data, truncated)
+			record.ClientBody.Size = storage.Size()
+		}
+	}
+	record.StatusCode = c.Writer.Status()
+	record.CompletedAt = common.GetTimestamp()
+	record.ModelName = common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	record.TokenId = common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	record.UserId = common.GetContextKeyInt(c, constant.ContextKeyUserId)
+
+	data, err := common.Marshal(record)
+	if err != nil {
+		logger.LogWarn(c, "failed to marshal request capture: "+err.Error())
+		return
+	}
+	filePath, err := common.WriteDiskCacheFile(common.DiskCacheTypeCapture, data)
+	if err != nil {
+		logger.LogWarn(c, "failed to write request capture: "+err.Error())
+		return
+	}
+	capture := &model.RequestCapture{
+		RequestId:  record.RequestId,
+		UserId:     record.UserId,
+		TokenId:    record.TokenId,
+		ChannelId:  record.LastChannelId,
+		ModelName:  record.ModelName,
+		Path:       record.Path,
+		StatusCode: record.StatusCode,
+		Failed:     failed,
+		FilePath:   filePath,
+		Size:       int64(len(data)),
+		CreatedAt:  record.CreatedAt,
+		ExpiresAt:  time.Now().Add(operation_setting.GetRequestCaptureTTL()).Unix(),
+	}
+	if err := capture.Insert(); err != nil {
+		logger.LogWarn(c, "failed to save request capture index: "+err.Error())
+		_ = common.RemoveDiskCacheFile(filePath)
+	}
+}
+
+// ReadRequestCapture 读取抓取内容，文件仅存在于写入它的节点上
+func ReadRequestCapture(capture *model.RequestCapture) (*RequestCaptureRecord, error) {
+	data, err := common.ReadDiskCacheFile(capture.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	var record RequestCaptureRecord
+	if err := common.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteRequestCapture 删除抓取文件与索引
+func DeleteRequestCapture(capture *model.RequestCapture) error {
+	if capture.FilePath != "" {
+		if err := common.RemoveDiskCacheFile(capture.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return model.DeleteRequestCaptureById(capture.Id)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	requestCaptureCleanupTickInterval = 10 * time.Minute
+	requestCaptureCleanupBatchSize    = 200
+)
+
+var (
+	requestCaptureCleanupOnce    sync.Once
+	requestCaptureCleanupRunning atomic.Bool
+)
+
+// StartRequestCaptureCleanupTask 清理过期的请求抓取。
+// 抓取文件保存在各节点本地磁盘，因此每个节点都需要运行
+func StartRequestCaptureCleanupTask() {
+	requestCaptureCleanupOnce.Do(func() {
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("request capture cleanup task started: tick=%s", requestCaptureCleanupTickInterval))
+			ticker := time.NewTicker(requestCaptureCleanupTickInterval)
+			defer ticker.Stop()
+
+			runRequestCaptureCleanupOnce()
+			for range ticker.C {
+				runRequestCaptureCleanupOnce()
+			}
+		})
+	})
+}
+
+func runRequestCaptureCleanupOnce() {
+	if !requestCaptureCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer requestCaptureCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	totalDeleted := 0
+	for {
+		captures, err := model.GetExpiredRequestCaptures(requestCaptureCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("request capture cleanup failed: %v", err))
+			return
+		}
+		for _, capture := range captures {
+			if err := DeleteRequestCapture(capture); err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to delete request capture %d: %v", capture.Id, err))
+				return
+			}
+			totalDeleted++
+		}
+		if len(captures) < requestCaptureCleanupBatchSize {
+			break
+		}
+	}
+	// 其他节点删除索引后，本节点残留的文件按 TTL 清理
+	removed, err := common.CleanupOldDiskCacheFilesByType(common.DiskCacheTypeCapture, operation_setting.GetRequestCaptureTTL())
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("request capture file cleanup failed: %v", err))
+	}
+	if common.DebugEnabled && totalDeleted+removed > 0 {
+		logger.LogDebug(ctx, "request capture cleanup: deleted=%d, orphan_files=%d", totalDeleted, removed)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureTapTruncates(t *testing.T) {
+	tap := &captureTapReadCloser{rc: io.NopCloser(strings.NewReader("hello world")), limit: 5}
+	data, err := io.ReadAll(tap)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+
+	body := tap.snapshot()
+	require.Equal(t, "hello", body.Body)
+	require.Equal(t, int64(11), body.Size)
+	require.True(t, body.Truncated)
+}
+
+func TestCaptureUpstreamRequestWindow(t *testing.T) {
+	setting := operation_setting.GetRequestCaptureSetting()
+	prev := *setting
+	setting.Enabled = true
+	t.Cleanup(func() { *setting = prev })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req := httptest.NewRequest(http.MethodPost, "https://upstream.example/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+
+	require.Nil(t, CaptureUpstreamRequest(c, req))
+
+	common.SetContextKey(c, constant.ContextKeyChannelCaptureUntil, time.Now().Add(time.Minute).Unix())
+	attempt := CaptureUpstreamRequest(c, req)
+	require.NotNil(t, attempt)
+	require.Equal(t, "***", attempt.RequestHeaders["Authorization"])
+	require.True(t, IsRequestCaptured(c))
+
+	_, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"model":"m"}`, attempt.requestTap.snapshot().Body)
+}
+
+func TestCaptureURLRedactsSensitiveQuery(t *testing.T) {
+	u, err := url.Parse("https://upstream.example/v1beta/models/gemini:generateContent?alt=sse&key=AIza-secret")
+	require.NoError(t, err)
+	require.Equal(t, "https://upstream.example/v1beta/models/gemini:generateContent?alt=sse&key=%2A%2A%2A", captureURL(u))
+
+	u, err = url.Parse("https://aip.baidubce.com/rpc/2.0/chat?access_token=baidu-secret")
+	require.NoError(t, err)
+	require.NotContains(t, captureURL(u), "baidu-secret")
+	require.Equal(t, "https://upstream.example/v1/chat", captureURL(&url.URL{Scheme: "https", Host: "upstream.example", Path: "/v1/chat"}))
+}
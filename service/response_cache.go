@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const (
+	responseCacheNamespace = "new-api:response_cache:v1"
+	// responseCacheOtherRatioKey 命中缓存时追加到 PriceData.OtherRatios 的键
+	responseCacheOtherRatioKey = "response_cache"
+	// ginKeyResponseCacheKey 本次请求的缓存键，未命中时写入，供响应完成后保存
+	ginKeyResponseCacheKey = "response_cache_key"
+)
+
+// ResponseCacheEntry 缓存的响应，Body 为返回给客户端的原始字节（已是客户端格式）
+type ResponseCacheEntry struct {
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	IsStream    bool      `json:"is_stream"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+var (
+	responseCacheOnce sync.Once
+	responseCache     *cachex.HybridCache[ResponseCacheEntry]
+)
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		setting := operation_setting.GetResponseCacheSetting()
+		capacity := setting.MemoryCapacity
+		if capacity <= 0 {
+			capacity = 10000
+		}
+		ttl := time.Duration(setting.TTLSeconds) * time.Second
+		if ttl <= 0 {
+			ttl = time.Hour
+		}
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, capacity).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+// responseCacheWriter 在向客户端写出响应的同时保留一份副本，超过上限后停止记录
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCacheWriter) record(n int, data func()) {
+	if w.overflow {
+		return
+	}
+	if w.limit > 0 && w.buf.Len()+n > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	data()
+}
+
+func (w *responseCacheWriter) Write(data []byte) (int, error) {
+	w.record(len(data), func() { w.buf.Write(data) })
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	w.record(len(s), func() { w.buf.WriteString(s) })
+	return w.ResponseWriter.WriteString(s)
+}
+
+// responseCacheEnabled 判断当前请求是否启用响应缓存：全局开关 + 令牌或分组开启
+func responseCacheEnabled(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !operation_setting.GetResponseCacheSetting().Enabled {
+		return false
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) && !operation_setting.IsResponseCacheGroup(info.UsingGroup) {
+		return false
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions,
+		relayconstant.RelayModeEmbeddings, relayconstant.RelayModeResponses:
+	default:
+		return false
+	}
+	// 依赖服务端会话状态的请求无法安全复用
+	if req, ok := info.Request.(*dto.OpenAIResponsesRequest); ok && req.PreviousResponseID != "" {
+		return false
+	}
+	return true
+}
+
+// responseCacheControl 解析客户端 Cache-Control：no-cache 跳过读取，no-store 跳过读取与写入
+func responseCacheControl(c *gin.Context) (noCache bool, noStore bool) {
+	for _, directive := range strings.Split(strings.ToLower(c.GetHeader("Cache-Control")), ",") {
+		switch strings.TrimSpace(directive) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+			noCache = true
+		}
+	}
+	return
+}
+
+// BuildResponseCacheKey 根据规范化后的请求（模型映射后）计算缓存键
+func BuildResponseCacheKey(info *relaycommon.RelayInfo, request any) (string, error) {
+	body, err := common.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	userScope := "shared"
+	if !operation_setting.GetResponseCacheSetting().SharedAcrossUsers {
+		userScope = fmt.Sprintf("user:%d", info.UserId)
+	}
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s|%d|%s|", info.RelayFormat, info.RelayMode, userScope)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TryServeResponseCache 在请求上游之前查找缓存。
+// 命中时直接向客户端写出缓存的响应并返回其 usage；未命中时记录本次响应，待 SaveResponseCache 写入缓存。
+func TryServeResponseCache(c *gin.Context, info *relaycommon.RelayInfo, request any) (*dto.Usage, bool) {
+	if w, ok := c.Writer.(*responseCacheWriter); ok {
+		// 重试时恢复原始 writer，避免重复包装
+		c.Writer = w.ResponseWriter
+	}
+	c.Set(ginKeyResponseCacheKey, "")
+	if !responseCacheEnabled(c, info) {
+		return nil, false
+	}
+	noCache, noStore := responseCacheControl(c)
+	key, err := BuildResponseCacheKey(info, request)
+	if err != nil {
+		logger.LogWarn(c, "failed to build response cache key: "+err.Error())
+		return nil, false
+	}
+
+	if !noCache {
+		entry, found, err := getResponseCache().Get(key)
+		if err != nil {
+			logger.LogWarn(c, "failed to get response cache: "+err.Error())
+		}
+		if found {
+			serveResponseCacheEntry(c, info, &entry)
+			return &entry.Usage, true
+		}
+	}
+
+	if !noStore {
+		c.Set(ginKeyResponseCacheKey, key)
+		c.Writer = &responseCacheWriter{
+			ResponseWriter: c.Writer,
+			limit:          operation_setting.GetResponseCacheSetting().MaxEntryKB << 10,
+		}
+	}
+	return nil, false
+}
+
+func serveResponseCacheEntry(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) {
+	common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+	info.IsStream = entry.IsStream
+	info.PriceData.AddOtherRatio(responseCacheOtherRatioKey, operation_setting.GetResponseCacheBillingRatio())
+	info.SetFirstResponseTime()
+
+	c.Writer.Header().Set("X-Cache", "HIT")
+	if !entry.IsStream {
+		c.Data(http.StatusOK, entry.ContentType, entry.Body)
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+	// 按事件逐条回放，保持客户端的流式体验
+	for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+		if len(event) == 0 {
+			continue
+		}
+		if _, err := c.Writer.Write(event); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// SaveResponseCache 在上游成功返回后写入缓存，仅缓存完整且未超限的 200 响应
+func SaveResponseCache(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage) {
+	w, ok := c.Writer.(*responseCacheWriter)
+	if !ok {
+		return
+	}
+	c.Writer = w.ResponseWriter
+	key := c.GetString(ginKeyResponseCacheKey)
+	if key == "" || usage == nil || w.overflow || w.buf.Len() == 0 || w.Status() != http.StatusOK {
+		return
+	}
+	// 客户端中途断开时响应可能不完整
+	if c.Request != nil && c.Request.Context().Err() != nil {
+		return
+	}
+	setting := operation_setting.GetResponseCacheSetting()
+	if setting.TTLSeconds <= 0 {
+		return
+	}
+	entry := ResponseCacheEntry{
+		ContentType: w.Header().Get("Content-Type"),
+		Body:        w.buf.Bytes(),
+		IsStream:    info.IsStream,
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if err := getResponseCache().SetWithTTL(key, entry, time.Duration(setting.TTLSeconds)*time.Second); err != nil {
+		logger.LogWarn(c, "failed to save response cache: "+err.Error())
+	}
+}
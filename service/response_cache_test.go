@@ -0,0 +1,101 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withResponseCacheSetting(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetResponseCacheSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.BillingRatio = 0.2
+	setting.MaxEntryKB = 64
+	t.Cleanup(func() {
+		*setting = prev
+	})
+}
+
+func buildResponseCacheContextForTest(cacheControl string) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if cacheControl != "" {
+		ctx.Request.Header.Set("Cache-Control", cacheControl)
+	}
+	common.SetContextKey(ctx, constant.ContextKeyTokenResponseCache, true)
+	return ctx, rec
+}
+
+func TestBuildResponseCacheKey(t *testing.T) {
+	withResponseCacheSetting(t)
+	info := &relaycommon.RelayInfo{UserId: 1, RelayFormat: types.RelayFormatOpenAI, RelayMode: relayconstant.RelayModeChatCompletions}
+	req := &dto.GeneralOpenAIRequest{Model: "gpt-test", Messages: []dto.Message{{Role: "user", Content: "hi"}}}
+
+	key1, err := BuildResponseCacheKey(info, req)
+	require.NoError(t, err)
+	key2, err := BuildResponseCacheKey(info, req)
+	require.NoError(t, err)
+	require.Equal(t, key1, key2)
+
+	other := &dto.GeneralOpenAIRequest{Model: "gpt-mapped", Messages: req.Messages}
+	key3, err := BuildResponseCacheKey(info, other)
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key3)
+
+	otherUser := &relaycommon.RelayInfo{UserId: 2, RelayFormat: types.RelayFormatOpenAI, RelayMode: relayconstant.RelayModeChatCompletions}
+	key4, err := BuildResponseCacheKey(otherUser, req)
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key4)
+
+	operation_setting.GetResponseCacheSetting().SharedAcrossUsers = true
+	key5, err := BuildResponseCacheKey(info, req)
+	require.NoError(t, err)
+	key6, err := BuildResponseCacheKey(otherUser, req)
+	require.NoError(t, err)
+	require.Equal(t, key5, key6)
+}
+
+func TestResponseCacheServeHit(t *testing.T) {
+	withResponseCacheSetting(t)
+	req := &dto.GeneralOpenAIRequest{Model: "gpt-cache-test", Messages: []dto.Message{{Role: "user", Content: "hello"}}}
+	newInfo := func() *relaycommon.RelayInfo {
+		return &relaycommon.RelayInfo{UserId: 920001, RelayFormat: types.RelayFormatOpenAI, RelayMode: relayconstant.RelayModeChatCompletions}
+	}
+	body := `{"id":"chatcmpl-1","choices":[]}`
+	usage := &dto.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}
+
+	ctx, _ := buildResponseCacheContextForTest("")
+	info := newInfo()
+	_, hit := TryServeResponseCache(ctx, info, req)
+	require.False(t, hit)
+	ctx.Data(http.StatusOK, "application/json", []byte(body))
+	SaveResponseCache(ctx, info, usage)
+
+	// no-cache 跳过读取
+	ctx, _ = buildResponseCacheContextForTest("no-cache")
+	_, hit = TryServeResponseCache(ctx, newInfo(), req)
+	require.False(t, hit)
+
+	ctx, rec := buildResponseCacheContextForTest("")
+	info = newInfo()
+	cachedUsage, hit := TryServeResponseCache(ctx, info, req)
+	require.True(t, hit)
+	require.Equal(t, usage.TotalTokens, cachedUsage.TotalTokens)
+	require.Equal(t, body, rec.Body.String())
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.True(t, common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit))
+	require.Equal(t, 0.2, info.PriceData.OtherRatios[responseCacheOtherRatioKey])
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetResponsesStoreResponse 记录上游返回的完整 Responses 响应对象，请求结束后写入网关响应存储
+func SetResponsesStoreResponse(c *gin.Context, response []byte) {
+	if !operation_setting.GetResponsesStoreSetting().Enabled || len(response) == 0 {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesStoreResponse, response)
+}
+
+// SetResponsesStoreStreamEvent 从流式 response.completed 事件中提取完整响应对象
+func SetResponsesStoreStreamEvent(c *gin.Context, data string) {
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		return
+	}
+	var event struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := common.UnmarshalJsonStr(data, &event); err != nil {
+		return
+	}
+	SetResponsesStoreResponse(c, event.Response)
+}
+
+// supportsPreviousResponseId 上游自身保存会话，previous_response_id 可以原样透传
+func supportsPreviousResponseId(channelType int) bool {
+	switch channelType {
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeAzure, constant.ChannelTypeCodex:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExpandResponsesPreviousResponse 在网关响应存储中查找 previous_response_id 对应的历史轮次，
+// 当前渠道无法识别该 id 时（非 OpenAI 上游，或历史响应来自其他渠道）展开为完整输入。
+// 未找到历史时保持请求不变，由上游自行处理
+func ExpandResponsesPreviousResponse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	if !operation_setting.GetResponsesStoreSetting().Enabled || request.PreviousResponseID == "" {
+		return nil
+	}
+	state, err := model.GetResponseState(info.UserId, request.PreviousResponseID)
+	if err != nil {
+		if errors.Is(err, model.ErrResponseStateNotFound) {
+			return nil
+		}
+		return err
+	}
+	if supportsPreviousResponseId(info.ChannelType) && state.ChannelId == info.ChannelId {
+		return nil
+	}
+
+	// 从最近一轮向前回溯，再按时间顺序拼接
+	chain := []*model.ResponseState{state}
+	maxDepth := operation_setting.GetResponsesStoreMaxChainDepth()
+	for len(chain) < maxDepth && state.PreviousResponseId != "" {
+		state, err = model.GetResponseState(info.UserId, state.PreviousResponseId)
+		if err != nil {
+			if errors.Is(err, model.ErrResponseStateNotFound) {
+				break
+			}
+			return err
+		}
+		chain = append(chain, state)
+	}
+
+	items := make([]json.RawMessage, 0)
+	for i := len(chain) - 1; i >= 0; i-- {
+		inputItems, err := parseStoredResponseItems(chain[i].InputItems)
+		if err != nil {
+			return err
+		}
+		items = append(items, inputItems...)
+		outputItems, err := getResponseOutputItems(chain[i].Response)
+		if err != nil {
+			return err
+		}
+		items = append(items, outputItems...)
+	}
+	currentItems, err := NormalizeResponsesInputItems(request.Input)
+	if err != nil {
+		return err
+	}
+	items = append(items, currentItems...)
+
+	input, err := common.Marshal(items)
+	if err != nil {
+		return err
+	}
+	request.Input = input
+	request.PreviousResponseID = ""
+	logger.LogDebug(c, "expanded previous_response_id %s into %d input items from %d stored responses", chain[0].ResponseId, len(items), len(chain))
+	return nil
+}
+
+// SaveResponsesState 保存本轮输入与上游响应。request 为客户端原始请求，仅保存本轮新增的输入项
+func SaveResponsesState(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) {
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		return
+	}
+	if bytes.Equal(bytes.TrimSpace(request.Store), []byte("false")) {
+		return
+	}
+	value, ok := common.GetContextKey(c, constant.ContextKeyResponsesStoreResponse)
+	if !ok {
+		return
+	}
+	response, _ := value.([]byte)
+	var meta struct {
+		Id string `json:"id"`
+	}
+	if err := common.Unmarshal(response, &meta); err != nil || meta.Id == "" {
+		return
+	}
+	inputItems, err := NormalizeResponsesInputItems(request.Input)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to parse responses input for store: %v", err))
+		return
+	}
+	inputJson, err := common.Marshal(inputItems)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to marshal responses input for store: %v", err))
+		return
+	}
+	now := time.Now()
+	state := &model.ResponseState{
+		ResponseId:         meta.Id,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		ChannelId:          info.ChannelId,
+		ModelName:          info.OriginModelName,
+		PreviousResponseId: request.PreviousResponseID,
+		InputItems:         inputJson,
+		Response:           response,
+		CreatedAt:          now.Unix(),
+		ExpiresAt:          now.Add(operation_setting.GetResponsesStoreTTL()).Unix(),
+	}
+	if err := state.Insert(); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to save response %s: %v", meta.Id, err))
+	}
+}
+
+// NormalizeResponsesInputItems 将 input 统一为输入项数组，字符串输入视为一条用户消息
+func NormalizeResponsesInputItems(input json.RawMessage) ([]json.RawMessage, error) {
+	input = bytes.TrimSpace(input)
+	if len(input) == 0 || bytes.Equal(input, []byte("null")) {
+		return []json.RawMessage{}, nil
+	}
+	if input[0] == '"' {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	}
+	return parseStoredResponseItems(input)
+}
+
+func parseStoredResponseItems(data json.RawMessage) ([]json.RawMessage, error) {
+	items := make([]json.RawMessage, 0)
+	if len(data) == 0 {
+		return items, nil
+	}
+	if err := common.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// getResponseOutputItems 返回响应的输出项，reasoning 项依赖上游签名，跨上游无法复用，予以丢弃
+func getResponseOutputItems(response json.RawMessage) ([]json.RawMessage, error) {
+	var resp struct {
+		Output []json.RawMessage `json:"output"`
+	}
+	if err := common.Unmarshal(response, &resp); err != nil {
+		return nil, err
+	}
+	items := make([]json.RawMessage, 0, len(resp.Output))
+	for _, item := range resp.Output {
+		var meta struct {
+			Type string `json:"type"`
+		}
+		if err := common.Unmarshal(item, &meta); err != nil {
+			return nil, err
+		}
+		if meta.Type == "reasoning" {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
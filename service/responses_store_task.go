@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	responsesStoreCleanupTickInterval = 10 * time.Minute
+	responsesStoreCleanupBatchSize    = 500
+)
+
+var (
+	responsesStoreCleanupOnce    sync.Once
+	responsesStoreCleanupRunning atomic.Bool
+)
+
+// StartResponsesStoreCleanupTask 清理网关响应存储中已过期的响应
+func StartResponsesStoreCleanupTask() {
+	responsesStoreCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("responses store cleanup task started: tick=%s", responsesStoreCleanupTickInterval))
+			ticker := time.NewTicker(responsesStoreCleanupTickInterval)
+			defer ticker.Stop()
+
+			runResponsesStoreCleanupOnce()
+			for range ticker.C {
+				runResponsesStoreCleanupOnce()
+			}
+		})
+	})
+}
+
+func runResponsesStoreCleanupOnce() {
+	if !responsesStoreCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer responsesStoreCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	var totalDeleted int64
+	for {
+		n, err := model.DeleteExpiredResponseStates(responsesStoreCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("responses store cleanup failed: %v", err))
+			return
+		}
+		totalDeleted += n
+		if n < responsesStoreCleanupBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && totalDeleted > 0 {
+		logger.LogDebug(ctx, "responses store cleanup: deleted=%d", totalDeleted)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func seedResponseState(t *testing.T, responseId string, previousId string, channelId int, input string, output string) {
+	t.Helper()
+	state := &model.ResponseState{
+		ResponseId:         responseId,
+		UserId:             1,
+		ChannelId:          channelId,
+		PreviousResponseId: previousId,
+		InputItems:         json.RawMessage(input),
+		Response:           json.RawMessage(`{"id":"` + responseId + `","output":` + output + `}`),
+		CreatedAt:          time.Now().Unix(),
+		ExpiresAt:          time.Now().Add(time.Hour).Unix(),
+	}
+	require.NoError(t, state.Insert())
+}
+
+func TestNormalizeResponsesInputItems(t *testing.T) {
+	items, err := NormalizeResponsesInputItems(json.RawMessage(`"hi"`))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.JSONEq(t, `{"type":"message","role":"user","content":"hi"}`, string(items[0]))
+
+	items, err = NormalizeResponsesInputItems(json.RawMessage(`[{"type":"message","role":"user","content":"a"},{"type":"function_call_output","call_id":"c1","output":"ok"}]`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	items, err = NormalizeResponsesInputItems(nil)
+	require.NoError(t, err)
+	require.Empty(t, items)
+}
+
+func TestExpandResponsesPreviousResponse(t *testing.T) {
+	truncate(t)
+	setting := operation_setting.GetResponsesStoreSetting()
+	prev := *setting
+	setting.Enabled = true
+	t.Cleanup(func() {
+		*setting = prev
+	})
+
+	seedResponseState(t, "resp_1", "", 10, `[{"type":"message","role":"user","content":"q1"}]`,
+		`[{"type":"reasoning","summary":[]},{"type":"message","role":"assistant","content":[{"type":"output_text","text":"a1"}]}]`)
+	seedResponseState(t, "resp_2", "resp_1", 10, `[{"type":"message","role":"user","content":"q2"}]`,
+		`[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"a2"}]}]`)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+
+	// 历史响应来自同一 OpenAI 渠道时原样透传
+	info := &relaycommon.RelayInfo{UserId: 1, ChannelMeta: &relaycommon.ChannelMeta{ChannelType: constant.ChannelTypeOpenAI, ChannelId: 10}}
+	request := &dto.OpenAIResponsesRequest{Input: json.RawMessage(`"q3"`), PreviousResponseID: "resp_2"}
+	require.NoError(t, ExpandResponsesPreviousResponse(ctx, info, request))
+	require.Equal(t, "resp_2", request.PreviousResponseID)
+
+	info.ChannelType = constant.ChannelTypeDeepSeek
+	require.NoError(t, ExpandResponsesPreviousResponse(ctx, info, request))
+	require.Empty(t, request.PreviousResponseID)
+	require.JSONEq(t, `[
+		{"type":"message","role":"user","content":"q1"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"a1"}]},
+		{"type":"message","role":"user","content":"q2"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"a2"}]},
+		{"type":"message","role":"user","content":"q3"}
+	]`, string(request.Input))
+
+	// 其他用户的响应不可见
+	info.UserId = 2
+	request = &dto.OpenAIResponsesRequest{Input: json.RawMessage(`"q3"`), PreviousResponseID: "resp_2"}
+	require.NoError(t, ExpandResponsesPreviousResponse(ctx, info, request))
+	require.Equal(t, "resp_2", request.PreviousResponseID)
+}
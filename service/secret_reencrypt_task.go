@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const secretReencryptDelay = 30 * time.Second
+
+var secretReencryptOnce sync.Once
+
+// StartSecretReencryptTask 轮换主密钥后，用当前版本的主密钥重新包装旧版本加密的敏感数据，
+// 并加密已结束任务中仍为明文的渠道 Key。启动后执行一次，完成后才可以从配置中移除旧版本的主密钥
+func StartSecretReencryptTask() {
+	secretReencryptOnce.Do(func() {
+		if !common.IsMasterNode || !model.SecretEncryptionEnabled() {
+			return
+		}
+		gopool.Go(func() {
+			// 等待启动时的其他任务完成，避免与启动争抢数据库连接
+			time.Sleep(secretReencryptDelay)
+			runSecretReencryptOnce()
+		})
+	})
+}
+
+func runSecretReencryptOnce() {
+	ctx := context.Background()
+	start := time.Now()
+	result, err := model.ReencryptSecrets(true)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("secret re-encryption failed after %d updates: %v", result.Updated, err))
+		return
+	}
+	taskResult, err := model.ReencryptTaskKeys(true)
+	result.Updated += taskResult.Updated
+	result.Failed += taskResult.Failed
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("task key re-encryption failed after %d updates: %v", result.Updated, err))
+		return
+	}
+	if result.Failed > 0 {
+		logger.LogWarn(ctx, fmt.Sprintf("secret re-encryption finished: updated=%d, failed=%d, keep the old master keys until the failed values are fixed", result.Updated, result.Failed))
+		return
+	}
+	if result.Updated > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("secret re-encryption finished: updated=%d, elapsed=%s, old master key versions can be removed", result.Updated, time.Since(start)))
+	}
+}
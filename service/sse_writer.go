@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedSSEHooks 由接管响应输出的功能实现，调用时已持有 bufferedSSEWriter 的锁
+type bufferedSSEHooks interface {
+	// processEvent 处理一条完整的 SSE 事件（含结尾空行），返回写给客户端的内容，stop 为 true 时丢弃之后的输出
+	processEvent(event string) (out string, stop bool)
+	// finishStream 流式响应结束时处理末尾不完整的事件，返回写给客户端的内容
+	finishStream(rest string) string
+	// finishBody 处理缓冲的非流式响应，返回写给客户端的状态码与响应体
+	finishBody(status int, body []byte) (int, []byte)
+}
+
+// bufferedSSEWriter 在响应写给客户端前交给 hooks 处理。非流式响应整体缓冲，结束时处理后写出；
+// 流式响应（text/event-stream）按 SSE 事件逐条处理后立即写出
+type bufferedSSEWriter struct {
+	gin.ResponseWriter
+	hooks bufferedSSEHooks
+
+	mu       sync.Mutex
+	status   int
+	decided  bool
+	stream   bool
+	buf      bytes.Buffer
+	stopped  bool
+	finished bool
+}
+
+func newBufferedSSEWriter(w gin.ResponseWriter, hooks bufferedSSEHooks) *bufferedSSEWriter {
+	return &bufferedSSEWriter{ResponseWriter: w, hooks: hooks}
+}
+
+func (w *bufferedSSEWriter) WriteHeader(code int) {
+	if code <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = code
+	if w.decided && w.stream {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *bufferedSSEWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.decided && w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *bufferedSSEWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status != 0 && !w.finished {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *bufferedSSEWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.decided || w.ResponseWriter.Written()
+}
+
+func (w *bufferedSSEWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.decided && w.stream && !w.finished {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *bufferedSSEWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedSSEWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+		if w.stream && w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+	if w.stopped {
+		return len(data), nil
+	}
+	w.buf.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for !w.stopped {
+		raw := w.buf.Bytes()
+		idx := bytes.Index(raw, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := string(raw[:idx+2])
+		w.buf.Next(idx + 2)
+		out, stop := w.hooks.processEvent(event)
+		if stop {
+			w.stopped = true
+			w.buf.Reset()
+		}
+		if _, err := w.ResponseWriter.WriteString(out); err != nil {
+			return len(data), err
+		}
+	}
+	return len(data), nil
+}
+
+// finish 写出缓冲的内容，之后的写入直接透传，可重复调用
+func (w *bufferedSSEWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished {
+		return
+	}
+	w.finished = true
+	if !w.decided {
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if w.stream {
+		if !w.stopped {
+			if tail := w.hooks.finishStream(w.buf.String()); tail != "" {
+				_, _ = w.ResponseWriter.WriteString(tail)
+			}
+		}
+		w.buf.Reset()
+		w.ResponseWriter.Flush()
+		return
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	status, body = w.hooks.finishBody(status, body)
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(status)
+	_, _ = w.ResponseWriter.Write(body)
+}
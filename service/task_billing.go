@@ -64,15 +64,15 @@ func LogTaskConsumption(c *gin.Context, info *relaycommon.RelayInfo) {
 // 异步任务计费辅助函数
 // ---------------------------------------------------------------------------
 
-// resolveTokenKey 通过 TokenId 运行时获取令牌 Key（用于 Redis 缓存操作）。
-// 如果令牌已被删除或查询失败，返回空字符串。
-func resolveTokenKey(ctx context.Context, tokenId int, taskID string) string {
+// resolveTokenKey 通过 TokenId 运行时获取令牌缓存键（用于 Redis 缓存操作）。
+// 如果令牌已被删除或查询失败，返回 false。
+func resolveTokenKey(ctx context.Context, tokenId int, taskID string) (string, bool) {
 	token, err := model.GetTokenById(tokenId)
 	if err != nil {
 		logger.LogWarn(ctx, fmt.Sprintf("获取令牌 key 失败 (tokenId=%d, task=%s): %s", tokenId, taskID, err.Error()))
-		return ""
+		return "", false
 	}
-	return token.Key
+	return token.CacheKey(), true
 }
 
 // taskIsSubscription 判断任务是否通过订阅计费。
@@ -80,11 +80,14 @@ func taskIsSubscription(task *model.Task) bool {
 	return task.PrivateData.BillingSource == BillingSourceSubscription && task.PrivateData.SubscriptionId > 0
 }
 
-// taskAdjustFunding 调整任务的资金来源（钱包或订阅），delta > 0 表示扣费，delta < 0 表示退还。
+// taskAdjustFunding 调整任务的资金来源（钱包、订阅或组织钱包），delta > 0 表示扣费，delta < 0 表示退还。
 func taskAdjustFunding(task *model.Task, delta int) error {
 	if taskIsSubscription(task) {
 		return model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta))
 	}
+	if task.PrivateData.OrgId > 0 {
+		return model.AdjustOrganizationConsumedQuota(task.PrivateData.OrgId, delta)
+	}
 	if delta > 0 {
 		return model.DecreaseUserQuota(task.UserId, delta)
 	}
@@ -97,8 +100,8 @@ func taskAdjustTokenQuota(ctx context.Context, task *model.Task, delta int) {
 	if task.PrivateData.TokenId <= 0 || delta == 0 {
 		return
 	}
-	tokenKey := resolveTokenKey(ctx, task.PrivateData.TokenId, task.TaskID)
-	if tokenKey == "" {
+	tokenKey, ok := resolveTokenKey(ctx, task.PrivateData.TokenId, task.TaskID)
+	if !ok {
 		return
 	}
 	var err error
@@ -109,7 +112,9 @@ func taskAdjustTokenQuota(ctx context.Context, task *model.Task, delta int) {
 	}
 	if err != nil {
 		logger.LogWarn(ctx, fmt.Sprintf("调整令牌额度失败 (delta=%d, task=%s): %s", delta, task.TaskID, err.Error()))
+		return
 	}
+	AdjustBudgets(task.UserId, task.PrivateData.TokenId, delta)
 }
 
 // taskBillingOther 从 task 的 BillingContext 构建日志 Other 字段。
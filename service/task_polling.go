@@ -192,7 +192,11 @@ func updateSunoTasks(ctx context.Context, channelId int, taskIds []string, taskM
 		return errors.New("adaptor not found")
 	}
 	proxy := ch.GetSetting().Proxy
-	resp, err := adaptor.FetchTask(*ch.BaseURL, ch.Key, map[string]any{
+	key, err := ch.GetPlainKey()
+	if err != nil {
+		return fmt.Errorf("decrypt key of channel #%d failed: %w", channelId, err)
+	}
+	resp, err := adaptor.FetchTask(*ch.BaseURL, key, map[string]any{
 		"ids": taskIds,
 	}, proxy)
 	if err != nil {
@@ -325,11 +329,15 @@ func updateVideoTasks(ctx context.Context, platform constant.TaskPlatform, chann
 	if adaptor == nil {
 		return fmt.Errorf("video adaptor not found")
 	}
+	apiKey, err := cacheGetChannel.GetPlainKey()
+	if err != nil {
+		return fmt.Errorf("decrypt key of channel #%d failed: %w", channelId, err)
+	}
 	info := &relaycommon.RelayInfo{}
 	info.ChannelMeta = &relaycommon.ChannelMeta{
 		ChannelBaseUrl: cacheGetChannel.GetBaseURL(),
 	}
-	info.ApiKey = cacheGetChannel.Key
+	info.ApiKey = apiKey
 	adaptor.Init(info)
 	for _, taskId := range taskIds {
 		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
@@ -353,11 +361,14 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 		logger.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
 		return fmt.Errorf("task %s not found", taskId)
 	}
-	key := ch.Key
-
-	privateData := task.PrivateData
-	if privateData.Key != "" {
-		key = privateData.Key
+	// 优先使用提交任务时保存的 Key
+	key := task.PrivateData.Key
+	if key == "" {
+		channelKey, err := ch.GetPlainKey()
+		if err != nil {
+			return fmt.Errorf("decrypt key of channel #%d failed: %w", ch.Id, err)
+		}
+		key = channelKey
 	}
 	resp, err := adaptor.FetchTask(baseURL, key, map[string]any{
 		"task_id": task.GetUpstreamTaskID(),
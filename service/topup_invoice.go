@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// TopUpInvoice 充值订单的收据，买方信息取自用户设置中的收据抬头
+type TopUpInvoice struct {
+	Number        string
+	IssuedAt      string
+	SellerName    string
+	SellerWebsite string
+
+	BuyerName    string
+	BuyerTaxId   string
+	BuyerAddress string
+	BuyerEmail   string
+
+	TradeNo       string
+	PaymentMethod string
+	Description   string
+	Amount        string
+	Currency      string
+	PaidAt        string
+
+	Refunded     bool
+	RefundedAt   string
+	RefundReason string
+}
+
+const invoiceTimeLayout = "2006-01-02 15:04:05"
+
+func formatInvoiceTime(ts int64) string {
+	if ts <= 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format(invoiceTimeLayout)
+}
+
+// NewTopUpInvoice 生成充值订单的收据，只有已支付或已退款的订单可以开具
+func NewTopUpInvoice(topUp *model.TopUp, user *model.User) (*TopUpInvoice, error) {
+	if topUp.Status != common.TopUpStatusSuccess && topUp.Status != common.TopUpStatusRefunded {
+		return nil, errors.New("订单未支付，无法开具收据")
+	}
+	setting := user.GetSetting()
+	paidAt := topUp.CompleteTime
+	if paidAt == 0 {
+		paidAt = topUp.CreateTime
+	}
+
+	description := fmt.Sprintf("账户充值 %s", logger.FormatQuota(topUp.CreditedQuota()))
+	if order := model.GetSubscriptionOrderByTradeNo(topUp.TradeNo); order != nil {
+		description = "订阅套餐"
+		if plan, err := model.GetSubscriptionPlanById(order.PlanId); err == nil {
+			description = "订阅套餐：" + plan.Title
+		}
+	}
+
+	buyerName := setting.InvoiceCompanyName
+	if buyerName == "" {
+		buyerName = user.DisplayName
+	}
+	if buyerName == "" {
+		buyerName = user.Username
+	}
+
+	return &TopUpInvoice{
+		Number:        fmt.Sprintf("R%s%08d", time.Unix(paidAt, 0).Format("20060102"), topUp.Id),
+		IssuedAt:      time.Now().Format(invoiceTimeLayout),
+		SellerName:    common.SystemName,
+		SellerWebsite: system_setting.ServerAddress,
+		BuyerName:     buyerName,
+		BuyerTaxId:    setting.InvoiceTaxId,
+		BuyerAddress:  setting.InvoiceAddress,
+		BuyerEmail:    user.Email,
+		TradeNo:       topUp.TradeNo,
+		PaymentMethod: topUp.PaymentMethod,
+		Description:   description,
+		Amount:        fmt.Sprintf("%.2f", topUp.PaidMoney()),
+		Currency:      topUp.Currency,
+		PaidAt:        formatInvoiceTime(paidAt),
+		Refunded:      topUp.Status == common.TopUpStatusRefunded,
+		RefundedAt:    formatInvoiceTime(topUp.RefundTime),
+		RefundReason:  topUp.RefundReason,
+	}, nil
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>收据 Receipt {{.Number}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; color: #222; max-width: 760px; margin: 40px auto; padding: 0 24px; }
+h1 { font-size: 24px; margin-bottom: 4px; }
+.muted { color: #777; font-size: 13px; }
+.parties { display: flex; justify-content: space-between; margin: 32px 0; }
+.parties div { width: 48%; }
+table { width: 100%; border-collapse: collapse; }
+th, td { text-align: left; padding: 10px 8px; border-bottom: 1px solid #ddd; }
+td.amount, th.amount { text-align: right; }
+.refunded { color: #c0392b; font-weight: bold; margin-top: 16px; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>收据 Receipt</h1>
+<div class="muted">编号 No. {{.Number}} · 开具时间 Issued {{.IssuedAt}}</div>
+<div class="parties">
+  <div>
+    <strong>收款方 Seller</strong><br>
+    {{.SellerName}}<br>
+    {{if .SellerWebsite}}{{.SellerWebsite}}<br>{{end}}
+  </div>
+  <div>
+    <strong>付款方 Bill to</strong><br>
+    {{.BuyerName}}<br>
+    {{if .BuyerTaxId}}税号 Tax ID: {{.BuyerTaxId}}<br>{{end}}
+    {{if .BuyerAddress}}{{.BuyerAddress}}<br>{{end}}
+    {{if .BuyerEmail}}{{.BuyerEmail}}<br>{{end}}
+  </div>
+</div>
+<table>
+  <tr><th>项目 Description</th><th>订单号 Order</th><th>支付方式 Method</th><th class="amount">金额 Amount</th></tr>
+  <tr><td>{{.Description}}</td><td>{{.TradeNo}}</td><td>{{.PaymentMethod}}</td><td class="amount">{{.Amount}} {{.Currency}}</td></tr>
+</table>
+<p>支付时间 Paid at: {{.PaidAt}}</p>
+{{if .Refunded}}<p class="refunded">已退款 Refunded{{if .RefundedAt}} · {{.RefundedAt}}{{end}}{{if .RefundReason}} · {{.RefundReason}}{{end}}</p>{{end}}
+</body>
+</html>
+`))
+
+// RenderTopUpInvoice 以可打印的 HTML 输出收据
+func RenderTopUpInvoice(invoice *TopUpInvoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := invoiceTemplate.Execute(&buf, invoice); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用量限流：按令牌 / 分组 / 模型三个维度，使用固定窗口计数器限制
+//   - TPM：每分钟 token 数（请求前按预估 prompt token 预占，结算后按实际总 token 校正）
+//   - RPD：每日请求数
+//   - 每小时消费额度：请求前按预扣额度预占，结算后按实际额度校正
+// 启用 Redis 时计数器保存在 Redis 中以支持多实例，否则使用进程内计数器。
+
+const (
+	usageRateLimitKeyPrefix = "usageRateLimit"
+
+	usageRateLimitKindTokens   = "tokens"
+	usageRateLimitKindRequests = "requests"
+	usageRateLimitKindQuota    = "quota"
+
+	usageRateLimitReservationKey = "usage_rate_limit_reservation"
+)
+
+// usageRateLimitNow 决定计数窗口的起点，测试中可替换以固定窗口
+var usageRateLimitNow = time.Now
+
+type usageRateLimitCounter struct {
+	scope  string
+	kind   string
+	limit  int
+	window time.Duration
+}
+
+type usageRateLimitReservedCounter struct {
+	key     string
+	kind    string
+	limit   int
+	amount  int64
+	current int64
+	resetAt time.Time
+}
+
+type usageRateLimitReservation struct {
+	counters []*usageRateLimitReservedCounter
+	done     bool
+}
+
+func usageRateLimitCounters(scope string, limit operation_setting.UsageRateLimit) []usageRateLimitCounter {
+	counters := make([]usageRateLimitCounter, 0, 3)
+	if limit.TPM > 0 {
+		counters = append(counters, usageRateLimitCounter{scope: scope, kind: usageRateLimitKindTokens, limit: limit.TPM, window: time.Minute})
+	}
+	if limit.RPD > 0 {
+		counters = append(counters, usageRateLimitCounter{scope: scope, kind: usageRateLimitKindRequests, limit: limit.RPD, window: 24 * time.Hour})
+	}
+	if limit.QuotaPerHour > 0 {
+		counters = append(counters, usageRateLimitCounter{scope: scope, kind: usageRateLimitKindQuota, limit: limit.QuotaPerHour, window: time.Hour})
+	}
+	return counters
+}
+
+func collectUsageRateLimitCounters(c *gin.Context, info *relaycommon.RelayInfo) []usageRateLimitCounter {
+	var counters []usageRateLimitCounter
+	if tokenLimit, ok := common.GetContextKeyType[operation_setting.UsageRateLimit](c, constant.ContextKeyTokenUsageRateLimit); ok && !tokenLimit.IsEmpty() {
+		counters = append(counters, usageRateLimitCounters(fmt.Sprintf("token:%d", info.TokenId), tokenLimit)...)
+	}
+	if groupLimit, ok := operation_setting.GetGroupUsageRateLimit(info.UsingGroup); ok {
+		counters = append(counters, usageRateLimitCounters(fmt.Sprintf("group:%s:user:%d", info.UsingGroup, info.UserId), groupLimit)...)
+	}
+	if modelLimit, ok := operation_setting.GetModelUsageRateLimit(info.OriginModelName); ok {
+		counters = append(counters, usageRateLimitCounters(fmt.Sprintf("model:%s:user:%d", info.OriginModelName, info.UserId), modelLimit)...)
+	}
+	return counters
+}
+
+// ReserveUsageRateLimit 在请求转发前预占用量限流额度，超限时返回 429 错误并设置 x-ratelimit-* 响应头
+func ReserveUsageRateLimit(c *gin.Context, info *relaycommon.RelayInfo, estimatedTokens int, estimatedQuota int) *types.NewAPIError {
+	now := usageRateLimitNow()
+	reservation, rejected, apiErr := reserveUsageRateLimit(c, info, estimatedTokens, estimatedQuota, now, nil)
+	if reservation == nil {
+		return nil
+	}
+	if apiErr != nil {
+		setUsageRateLimitHeaders(c, append(reservation.counters, rejected), now)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rejected.resetAt.Sub(now).Seconds()))))
+		return apiErr
+	}
+	setUsageRateLimitHeaders(c, reservation.counters, now)
+	c.Set(usageRateLimitReservationKey, reservation)
+	return nil
+}
+
+// ReserveFallbackUsageRateLimit 模型降级时返还已预占的计数，并按降级模型重新预占。
+// 令牌、分组维度的请求数已经计入，不会重复计数；降级模型超限时返回错误且不修改响应头，调用方应跳过该模型
+func ReserveFallbackUsageRateLimit(c *gin.Context, info *relaycommon.RelayInfo, estimatedTokens int, estimatedQuota int) *types.NewAPIError {
+	var previous *usageRateLimitReservation
+	if value, ok := c.Get(usageRateLimitReservationKey); ok {
+		previous, _ = value.(*usageRateLimitReservation)
+	}
+	ReleaseUsageRateLimit(c)
+
+	now := usageRateLimitNow()
+	reservation, _, apiErr := reserveUsageRateLimit(c, info, estimatedTokens, estimatedQuota, now, previous)
+	if reservation == nil || apiErr != nil {
+		return apiErr
+	}
+	setUsageRateLimitHeaders(c, reservation.counters, now)
+	c.Set(usageRateLimitReservationKey, reservation)
+	return nil
+}
+
+// CheckUsageRateLimit 检查用量限流是否已经用尽，只检查不占用计数
+func CheckUsageRateLimit(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	// 按 1 个 token、1 额度试占，已用量达到上限即视为用尽
+	reservation, _, apiErr := reserveUsageRateLimit(c, info, 1, 1, usageRateLimitNow(), nil)
+	if reservation != nil && apiErr == nil {
+		reservation.rollback(c)
+	}
+	return apiErr
+}
+
+// reserveUsageRateLimit 逐个预占计数器，超限时撤销本次已预占的计数并返回超限的计数器。
+// previous 中已经计入的请求数计数器不再重复计数
+func reserveUsageRateLimit(c *gin.Context, info *relaycommon.RelayInfo, estimatedTokens int, estimatedQuota int, now time.Time, previous *usageRateLimitReservation) (*usageRateLimitReservation, *usageRateLimitReservedCounter, *types.NewAPIError) {
+	counters := collectUsageRateLimitCounters(c, info)
+	if len(counters) == 0 {
+		return nil, nil, nil
+	}
+	reservation := &usageRateLimitReservation{}
+	for _, counter := range counters {
+		windowStart := now.Truncate(counter.window)
+		key := fmt.Sprintf("%s:%s:%s:%d", usageRateLimitKeyPrefix, counter.scope, counter.kind, windowStart.Unix())
+		var amount int64
+		switch counter.kind {
+		case usageRateLimitKindTokens:
+			amount = int64(estimatedTokens)
+		case usageRateLimitKindRequests:
+			if !previous.has(key) {
+				amount = 1
+			}
+		case usageRateLimitKindQuota:
+			amount = int64(estimatedQuota)
+		}
+		reserved := &usageRateLimitReservedCounter{
+			key:     key,
+			kind:    counter.kind,
+			limit:   counter.limit,
+			amount:  amount,
+			resetAt: windowStart.Add(counter.window),
+		}
+		current, err := usageRateLimitIncr(c, reserved.key, amount, counter.window)
+		if err != nil {
+			// 计数器不可用时放行，避免限流组件故障导致服务不可用
+			logger.LogError(c, fmt.Sprintf("usage rate limit counter error: %s", err.Error()))
+			continue
+		}
+		reserved.current = current
+		if current > int64(counter.limit) {
+			// 超限：撤销本次请求已预占的所有计数
+			_, _ = usageRateLimitIncr(c, reserved.key, -amount, counter.window)
+			reserved.current = current - amount
+			reservation.rollback(c)
+			return reservation, reserved, types.NewErrorWithStatusCode(
+				fmt.Errorf("rate limit reached for %s on %s per %s: limit %d, used %d, requested %d",
+					counter.scope, counter.kind, formatUsageRateLimitWindow(counter.window), counter.limit, reserved.current, amount),
+				types.ErrorCodeRateLimitExceeded,
+				http.StatusTooManyRequests,
+				types.ErrOptionWithSkipRetry(),
+				types.ErrOptionWithNoRecordErrorLog(),
+			)
+		}
+		reservation.counters = append(reservation.counters, reserved)
+	}
+	return reservation, nil, nil
+}
+
+// ReconcileUsageRateLimit 结算后按实际 token 数与实际额度校正预占的计数，actualTokens 为负数时保留 token 预估值
+func ReconcileUsageRateLimit(c *gin.Context, actualTokens int, actualQuota int) {
+	reservation := getUsageRateLimitReservation(c)
+	if reservation == nil {
+		return
+	}
+	reservation.done = true
+	for _, counter := range reservation.counters {
+		var delta int64
+		switch counter.kind {
+		case usageRateLimitKindTokens:
+			if actualTokens >= 0 {
+				delta = int64(actualTokens) - counter.amount
+			}
+		case usageRateLimitKindQuota:
+			delta = int64(actualQuota) - counter.amount
+		}
+		if delta == 0 {
+			continue
+		}
+		if _, err := usageRateLimitIncr(c, counter.key, delta, counter.resetAt.Sub(usageRateLimitNow())); err != nil {
+			logger.LogError(c, fmt.Sprintf("usage rate limit reconcile error: %s", err.Error()))
+		}
+	}
+}
+
+// ReleaseUsageRateLimit 请求失败时返还预占的 token 与额度计数，请求数仍然计入
+func ReleaseUsageRateLimit(c *gin.Context) {
+	reservation := getUsageRateLimitReservation(c)
+	if reservation == nil {
+		return
+	}
+	reservation.done = true
+	for _, counter := range reservation.counters {
+		if counter.kind == usageRateLimitKindRequests || counter.amount == 0 {
+			continue
+		}
+		if _, err := usageRateLimitIncr(c, counter.key, -counter.amount, counter.resetAt.Sub(usageRateLimitNow())); err != nil {
+			logger.LogError(c, fmt.Sprintf("usage rate limit release error: %s", err.Error()))
+		}
+	}
+}
+
+func getUsageRateLimitReservation(c *gin.Context) *usageRateLimitReservation {
+	if c == nil {
+		return nil
+	}
+	value, ok := c.Get(usageRateLimitReservationKey)
+	if !ok {
+		return nil
+	}
+	reservation, ok := value.(*usageRateLimitReservation)
+	if !ok || reservation.done {
+		return nil
+	}
+	return reservation
+}
+
+func (r *usageRateLimitReservation) has(key string) bool {
+	if r == nil {
+		return false
+	}
+	for _, counter := range r.counters {
+		if counter.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *usageRateLimitReservation) rollback(ctx context.Context) {
+	for _, counter := range r.counters {
+		if counter.amount == 0 {
+			continue
+		}
+		_, _ = usageRateLimitIncr(ctx, counter.key, -counter.amount, counter.resetAt.Sub(usageRateLimitNow()))
+		counter.current -= counter.amount
+	}
+}
+
+// setUsageRateLimitHeaders 按 OpenAI 风格设置 x-ratelimit-* 响应头，同类计数器取剩余最少的一个
+func setUsageRateLimitHeaders(c *gin.Context, counters []*usageRateLimitReservedCounter, now time.Time) {
+	tightest := make(map[string]*usageRateLimitReservedCounter)
+	for _, counter := range counters {
+		prev, ok := tightest[counter.kind]
+		if !ok || int64(counter.limit)-counter.current < int64(prev.limit)-prev.current {
+			tightest[counter.kind] = counter
+		}
+	}
+	for kind, counter := range tightest {
+		remaining := int64(counter.limit) - counter.current
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header("x-ratelimit-limit-"+kind, strconv.Itoa(counter.limit))
+		c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(remaining, 10))
+		c.Header("x-ratelimit-reset-"+kind, formatUsageRateLimitReset(counter.resetAt.Sub(now)))
+	}
+}
+
+func formatUsageRateLimitReset(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func formatUsageRateLimitWindow(window time.Duration) string {
+	switch window {
+	case time.Minute:
+		return "minute"
+	case time.Hour:
+		return "hour"
+	case 24 * time.Hour:
+		return "day"
+	}
+	return window.String()
+}
+
+func usageRateLimitIncr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.IncrBy(ctx, key, delta)
+		pipe.Expire(ctx, key, ttl+time.Minute)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+		return incr.Val(), nil
+	}
+	return usageRateLimitMemory.incr(key, delta, ttl), nil
+}
+
+type usageRateLimitMemoryEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+type usageRateLimitMemoryStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*usageRateLimitMemoryEntry
+	lastSweep time.Time
+}
+
+var usageRateLimitMemory = &usageRateLimitMemoryStore{
+	entries: make(map[string]*usageRateLimitMemoryEntry),
+}
+
+func (s *usageRateLimitMemoryStore) incr(key string, delta int64, ttl time.Duration) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := usageRateLimitNow()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, entry := range s.entries {
+			if now.After(entry.expireAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expireAt) {
+		entry = &usageRateLimitMemoryEntry{expireAt: now.Add(ttl)}
+		s.entries[key] = entry
+	}
+	entry.value += delta
+	return entry.value
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func buildUsageRateLimitContextForTest(limit operation_setting.UsageRateLimit) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(rec)
+	common.SetContextKey(ctx, constant.ContextKeyTokenUsageRateLimit, limit)
+	return ctx, rec
+}
+
+// pinUsageRateLimitClock 固定计数窗口并清空进程内计数，避免测试跨越分钟边界时落入新的窗口
+func pinUsageRateLimitClock(t *testing.T) {
+	t.Helper()
+	usageRateLimitMemory.mutex.Lock()
+	usageRateLimitMemory.entries = make(map[string]*usageRateLimitMemoryEntry)
+	usageRateLimitMemory.mutex.Unlock()
+	now := time.Date(2026, 1, 1, 12, 30, 30, 0, time.UTC)
+	usageRateLimitNow = func() time.Time { return now }
+	t.Cleanup(func() {
+		usageRateLimitNow = time.Now
+	})
+}
+
+func TestReserveUsageRateLimit_TokenTPM(t *testing.T) {
+	pinUsageRateLimitClock(t)
+	info := &relaycommon.RelayInfo{TokenId: 910001, UserId: 1, OriginModelName: "gpt-test"}
+	limit := operation_setting.UsageRateLimit{TPM: 100}
+
+	ctx, rec := buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 60, 0))
+	require.Equal(t, "100", rec.Header().Get("x-ratelimit-limit-tokens"))
+	require.Equal(t, "40", rec.Header().Get("x-ratelimit-remaining-tokens"))
+
+	// 实际只用了 30 个 token，校正后剩余 70
+	ReconcileUsageRateLimit(ctx, 30, 0)
+
+	ctx, rec = buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 70, 0))
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-tokens"))
+
+	ctx, rec = buildUsageRateLimitContextForTest(limit)
+	apiErr := ReserveUsageRateLimit(ctx, info, 1, 0)
+	require.NotNil(t, apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, types.ErrorCodeRateLimitExceeded, apiErr.GetErrorCode())
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestReleaseUsageRateLimit_KeepsRequestCount(t *testing.T) {
+	pinUsageRateLimitClock(t)
+	info := &relaycommon.RelayInfo{TokenId: 910002, UserId: 1, OriginModelName: "gpt-test"}
+	limit := operation_setting.UsageRateLimit{RPD: 2, QuotaPerHour: 1000}
+
+	ctx, _ := buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 0, 800))
+	ReleaseUsageRateLimit(ctx)
+
+	ctx, rec := buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 0, 800))
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-requests"))
+	require.Equal(t, "200", rec.Header().Get("x-ratelimit-remaining-quota"))
+
+	ctx, _ = buildUsageRateLimitContextForTest(limit)
+	require.NotNil(t, ReserveUsageRateLimit(ctx, info, 0, 0))
+}
+
+func TestReserveFallbackUsageRateLimit_SkipsExhaustedModel(t *testing.T) {
+	pinUsageRateLimitClock(t)
+	setting := operation_setting.GetUsageRateLimitSetting()
+	prev := *setting
+	setting.Enabled = true
+	setting.Models = map[string]operation_setting.UsageRateLimit{"fallback-limited": {RPD: 1}}
+	t.Cleanup(func() {
+		*setting = prev
+	})
+	info := &relaycommon.RelayInfo{TokenId: 910003, UserId: 910003, OriginModelName: "fallback-limited"}
+	tokenLimit := operation_setting.UsageRateLimit{RPD: 3}
+
+	// 直接请求降级模型，用完当日请求数
+	ctx, _ := buildUsageRateLimitContextForTest(tokenLimit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 10, 0))
+	ReconcileUsageRateLimit(ctx, 10, 0)
+
+	// 请求原模型失败后降级，降级模型已超限，应当跳过
+	info.OriginModelName = "fallback-origin"
+	ctx, rec := buildUsageRateLimitContextForTest(tokenLimit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 10, 0))
+	require.Equal(t, "1", rec.Header().Get("x-ratelimit-remaining-requests"))
+	require.NotNil(t, CheckUsageRateLimit(ctx, &relaycommon.RelayInfo{TokenId: 910003, UserId: 910003, OriginModelName: "fallback-limited"}))
+
+	info.OriginModelName = "fallback-limited"
+	apiErr := ReserveFallbackUsageRateLimit(ctx, info, 10, 0)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeRateLimitExceeded, apiErr.GetErrorCode())
+	require.Empty(t, rec.Header().Get("Retry-After"))
+
+	// 降级到未限流的模型时，令牌维度的请求数不重复计数
+	info.OriginModelName = "fallback-free"
+	require.Nil(t, ReserveFallbackUsageRateLimit(ctx, info, 10, 0))
+	require.Equal(t, "1", rec.Header().Get("x-ratelimit-remaining-requests"))
+}
+
+func TestSettleBillingReconcilesUsageRateLimit(t *testing.T) {
+	pinUsageRateLimitClock(t)
+	info := &relaycommon.RelayInfo{TokenId: 910004, UserId: 1, OriginModelName: "gpt-test"}
+	limit := operation_setting.UsageRateLimit{TPM: 100}
+
+	ctx, _ := buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 60, 0))
+	// 按次计费等路径同样经过 SettleBilling，结算后按实际 10 个 token 校正
+	require.NoError(t, SettleBilling(ctx, info, 0, 10))
+
+	ctx, rec := buildUsageRateLimitContextForTest(limit)
+	require.Nil(t, ReserveUsageRateLimit(ctx, info, 90, 0))
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-tokens"))
+}
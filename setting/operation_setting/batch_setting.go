@@ -0,0 +1,90 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BatchSetting Batch API（/v1/batches）与文件上传（/v1/files）配置
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxFileSizeMB 单个上传文件大小上限
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// MaxRequestsPerBatch 单个批处理任务的最大请求数
+	MaxRequestsPerBatch int `json:"max_requests_per_batch"`
+	// Concurrency 单个批处理任务的并发请求数
+	Concurrency int `json:"concurrency"`
+	// MaxRunningBatches 每个节点同时执行的批处理任务数
+	MaxRunningBatches int `json:"max_running_batches"`
+	// MaxUserFiles 每个用户保存的文件数上限（含批处理输出文件），0 表示不限制
+	MaxUserFiles int `json:"max_user_files"`
+	// MaxUserStorageMB 每个用户保存的文件总大小上限，0 表示不限制
+	MaxUserStorageMB int `json:"max_user_storage_mb"`
+	// FileRetentionHours 文件保存时长，超时后自动删除，0 表示永久保存
+	FileRetentionHours int `json:"file_retention_hours"`
+	// GroupDiscounts 分组 -> 批处理折扣倍率（0-1），在分组倍率基础上相乘，未配置的分组不打折
+	GroupDiscounts map[string]float64 `json:"group_discounts"`
+}
+
+var batchSetting = BatchSetting{
+	Enabled:             false,
+	MaxFileSizeMB:       100,
+	MaxRequestsPerBatch: 50000,
+	Concurrency:         4,
+	MaxRunningBatches:   2,
+	MaxUserFiles:        100,
+	MaxUserStorageMB:    1024,
+	FileRetentionHours:  7 * 24,
+	GroupDiscounts:      map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
+
+// GetBatchDiscountRatio 返回分组的批处理折扣倍率，未配置时为 1
+func GetBatchDiscountRatio(group string) float64 {
+	if ratio, ok := batchSetting.GroupDiscounts[group]; ok && ratio > 0 && ratio <= 1 {
+		return ratio
+	}
+	return 1
+}
+
+// ValidateBatchGroupDiscounts 校验批处理分组折扣 JSON
+func ValidateBatchGroupDiscounts(jsonStr string) error {
+	discounts := make(map[string]float64)
+	if err := common.Unmarshal([]byte(jsonStr), &discounts); err != nil {
+		return err
+	}
+	for group, ratio := range discounts {
+		if ratio <= 0 || ratio > 1 {
+			return fmt.Errorf("分组 %s 的批处理折扣必须在 (0, 1] 之间", group)
+		}
+	}
+	return nil
+}
+
+// ValidateBatchNonNegativeInt 校验文件数上限等 0 表示不限制的配置
+func ValidateBatchNonNegativeInt(name string, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s 必须为不小于 0 的整数", name)
+	}
+	return nil
+}
+
+// ValidateBatchPositiveInt 校验批处理并发数等必须为正整数的配置
+func ValidateBatchPositiveInt(name string, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("%s 必须为大于 0 的整数", name)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package operation_setting
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BudgetSetting 用户/令牌周期预算配置
+type BudgetSetting struct {
+	// NotifyPercents 预算使用达到这些百分比时通知用户，每个窗口每档只通知一次
+	NotifyPercents []int `json:"notify_percents"`
+}
+
+var budgetSetting = BudgetSetting{
+	NotifyPercents: []int{80, 100},
+}
+
+func init() {
+	config.GlobalConfig.Register("budget_setting", &budgetSetting)
+}
+
+func GetBudgetSetting() *BudgetSetting {
+	return &budgetSetting
+}
+
+// GetBudgetNotifyPercent 返回已用百分比达到的最高提醒档位，未达到任何档位时返回 0
+func GetBudgetNotifyPercent(usedPercent int) int {
+	reached := 0
+	for _, percent := range budgetSetting.NotifyPercents {
+		if percent > 0 && usedPercent >= percent && percent > reached {
+			reached = percent
+		}
+	}
+	return reached
+}
+
+// ValidateBudgetNotifyPercents 校验预算提醒百分比 JSON
+func ValidateBudgetNotifyPercents(jsonStr string) error {
+	var percents []int
+	if err := common.Unmarshal([]byte(jsonStr), &percents); err != nil {
+		return err
+	}
+	sort.Ints(percents)
+	for i, percent := range percents {
+		if percent <= 0 || percent > 100 {
+			return fmt.Errorf("预算提醒百分比必须在 1-100 之间：%d", percent)
+		}
+		if i > 0 && percents[i-1] == percent {
+			return fmt.Errorf("预算提醒百分比重复：%d", percent)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelBreakerSetting 渠道熔断器配置（按 渠道 + 模型 维度统计）
+type ChannelBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// WindowSeconds 滚动统计窗口（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// MinRequests 窗口内请求数达到该值后才会判断是否熔断
+	MinRequests int `json:"min_requests"`
+	// FailureRateThreshold 失败率阈值（0-1），达到后熔断，0 表示不按失败率熔断
+	FailureRateThreshold float64 `json:"failure_rate_threshold"`
+	// SlowThresholdSeconds 首字（非流式为总耗时）超过该值视为慢请求，0 表示不统计慢请求
+	SlowThresholdSeconds float64 `json:"slow_threshold_seconds"`
+	// SlowRateThreshold 慢请求比例阈值（0-1），达到后熔断，0 表示不按慢请求熔断
+	SlowRateThreshold float64 `json:"slow_rate_threshold"`
+	// OpenSeconds 熔断持续时间，结束后进入半开状态
+	OpenSeconds int `json:"open_seconds"`
+	// HalfOpenProbes 半开状态下允许通过的探测请求数，全部成功后恢复
+	HalfOpenProbes int `json:"half_open_probes"`
+}
+
+var channelBreakerSetting = ChannelBreakerSetting{
+	Enabled:              false,
+	WindowSeconds:        60,
+	MinRequests:          20,
+	FailureRateThreshold: 0.5,
+	SlowThresholdSeconds: 0,
+	SlowRateThreshold:    0.8,
+	OpenSeconds:          30,
+	HalfOpenProbes:       3,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_breaker_setting", &channelBreakerSetting)
+}
+
+func GetChannelBreakerSetting() *ChannelBreakerSetting {
+	return &channelBreakerSetting
+}
@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelHealthSetting 渠道健康统计配置（按 渠道 + 模型 + Key 维度统计）
+type ChannelHealthSetting struct {
+	Enabled bool `json:"enabled"`
+	// BucketSeconds 统计时间桶的时长（秒），查询窗口按时间桶对齐
+	BucketSeconds int `json:"bucket_seconds"`
+	// RetentionHours 统计数据保留时长（小时），也是查询窗口的上限
+	RetentionHours int `json:"retention_hours"`
+}
+
+var channelHealthSetting = ChannelHealthSetting{
+	Enabled:        true,
+	BucketSeconds:  300,
+	RetentionHours: 24,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_health_setting", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
@@ -0,0 +1,71 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	// ChannelSelectionStrategyWeight 按静态权重随机选择（默认）
+	ChannelSelectionStrategyWeight = "weight"
+	// ChannelSelectionStrategyAdaptive 以静态权重为先验，按实时延迟、首字时间、429/5xx 比例与多 Key 剩余容量调整有效权重
+	ChannelSelectionStrategyAdaptive = "adaptive"
+)
+
+// ChannelSelectionSetting 同优先级渠道的选择策略配置
+type ChannelSelectionSetting struct {
+	// GroupStrategies 分组 -> 策略
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// TagStrategies 渠道标签 -> 策略，对带有该标签的渠道生效
+	TagStrategies map[string]string `json:"tag_strategies"`
+	// EwmaAlpha 指数加权移动平均的平滑系数（0-1），越大越偏向最近的请求
+	EwmaAlpha float64 `json:"ewma_alpha"`
+	// StaleSeconds 统计数据超过该时间未更新时视为无数据，按静态权重处理
+	StaleSeconds int `json:"stale_seconds"`
+	// MinWeightFactor 每个调整因子的下限，保证表现差的渠道仍能获得少量流量用于恢复探测
+	MinWeightFactor float64 `json:"min_weight_factor"`
+	// ErrorPenalty 错误率惩罚指数，有效权重乘以 (1 - 错误率)^ErrorPenalty
+	ErrorPenalty float64 `json:"error_penalty"`
+}
+
+var channelSelectionSetting = ChannelSelectionSetting{
+	GroupStrategies: map[string]string{},
+	TagStrategies:   map[string]string{},
+	EwmaAlpha:       0.2,
+	StaleSeconds:    300,
+	MinWeightFactor: 0.05,
+	ErrorPenalty:    2,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_selection_setting", &channelSelectionSetting)
+}
+
+func GetChannelSelectionSetting() *ChannelSelectionSetting {
+	return &channelSelectionSetting
+}
+
+// IsAdaptiveChannelSelection 判断分组或渠道标签是否启用了自适应选择策略
+func IsAdaptiveChannelSelection(group string, tag string) bool {
+	if channelSelectionSetting.GroupStrategies[group] == ChannelSelectionStrategyAdaptive {
+		return true
+	}
+	return tag != "" && channelSelectionSetting.TagStrategies[tag] == ChannelSelectionStrategyAdaptive
+}
+
+// ValidateChannelSelectionStrategies 校验分组 / 标签选择策略 JSON
+func ValidateChannelSelectionStrategies(jsonStr string) error {
+	strategies := make(map[string]string)
+	if err := common.Unmarshal([]byte(jsonStr), &strategies); err != nil {
+		return err
+	}
+	for name, strategy := range strategies {
+		if strategy != ChannelSelectionStrategyWeight && strategy != ChannelSelectionStrategyAdaptive {
+			return fmt.Errorf("%s 的选择策略 %s 无效，仅支持 %s / %s", name, strategy,
+				ChannelSelectionStrategyWeight, ChannelSelectionStrategyAdaptive)
+		}
+	}
+	return nil
+}
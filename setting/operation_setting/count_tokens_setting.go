@@ -0,0 +1,24 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CountTokensSetting Claude /v1/messages/count_tokens 与 Gemini :countTokens 计数接口配置
+type CountTokensSetting struct {
+	// Price 每次计数请求的价格（美元），按分组倍率折算，0 表示免费
+	Price float64 `json:"price"`
+	// PreferUpstream 渠道支持原生计数时转发上游，关闭后始终在本地估算
+	PreferUpstream bool `json:"prefer_upstream"`
+}
+
+var countTokensSetting = CountTokensSetting{
+	Price:          0,
+	PreferUpstream: true,
+}
+
+func init() {
+	config.GlobalConfig.Register("count_tokens_setting", &countTokensSetting)
+}
+
+func GetCountTokensSetting() *CountTokensSetting {
+	return &countTokensSetting
+}
@@ -0,0 +1,201 @@
+package operation_setting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	GuardrailProviderKeyword    = "keyword"
+	GuardrailProviderRegex      = "regex"
+	GuardrailProviderPII        = "pii"
+	GuardrailProviderModeration = "moderation"
+
+	GuardrailActionBlock  = "block"
+	GuardrailActionRedact = "redact"
+	GuardrailActionFlag   = "flag"
+
+	GuardrailStagePrompt     = "prompt"
+	GuardrailStageCompletion = "completion"
+
+	GuardrailPIIEmail      = "email"
+	GuardrailPIIPhone      = "phone"
+	GuardrailPIIIdNumber   = "id_number"
+	GuardrailPIICreditCard = "credit_card"
+
+	// GuardrailAllGroups 对所有分组生效的策略配置键
+	GuardrailAllGroups = "*"
+)
+
+var guardrailPIITypes = []string{GuardrailPIIEmail, GuardrailPIIPhone, GuardrailPIIIdNumber, GuardrailPIICreditCard}
+
+// GuardrailRule 单条内容审核规则
+type GuardrailRule struct {
+	Name string `json:"name"`
+	// Provider keyword、regex、pii 在本地检测，moderation 通过网关自身的 /v1/moderations 调用审核模型
+	Provider string `json:"provider"`
+	// Stage prompt 或 completion，为空时两个阶段都检查
+	Stage string `json:"stage,omitempty"`
+	// Action block 拦截、redact 脱敏、flag 仅记录。moderation 不支持 redact
+	Action      string   `json:"action"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Patterns    []string `json:"patterns,omitempty"`
+	PIITypes    []string `json:"pii_types,omitempty"` // 为空时检测全部类型
+	Replacement string   `json:"replacement,omitempty"`
+	// Model moderation 使用的审核模型
+	Model string `json:"model,omitempty"`
+	// Categories 仅在命中这些分类时生效，为空时只要审核结果 flagged 即生效
+	Categories []string `json:"categories,omitempty"`
+}
+
+// GuardrailPolicy 一组按顺序执行的审核规则
+type GuardrailPolicy struct {
+	Rules []GuardrailRule `json:"rules"`
+	// StreamWindow 流式输出按滑动窗口检查，窗口保留最近的字符数
+	StreamWindow int `json:"stream_window,omitempty"`
+}
+
+// GuardrailSetting 内容审核流水线配置。策略按令牌指定，未指定时按分组选择
+type GuardrailSetting struct {
+	Enabled  bool                       `json:"enabled"`
+	Policies map[string]GuardrailPolicy `json:"policies"`
+	// GroupPolicies 分组 -> 策略名，分组为 "*" 时对所有分组生效
+	GroupPolicies map[string]string `json:"group_policies"`
+}
+
+var guardrailSetting = GuardrailSetting{
+	Enabled:       false,
+	Policies:      map[string]GuardrailPolicy{},
+	GroupPolicies: map[string]string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// GetGuardrailPolicy 返回生效的策略名与策略。令牌指定的策略优先，其次为分组与 "*" 的配置
+func GetGuardrailPolicy(tokenPolicy string, group string) (string, *GuardrailPolicy) {
+	if !guardrailSetting.Enabled {
+		return "", nil
+	}
+	name := tokenPolicy
+	if name == "" {
+		name = guardrailSetting.GroupPolicies[group]
+	}
+	if name == "" {
+		name = guardrailSetting.GroupPolicies[GuardrailAllGroups]
+	}
+	if name == "" {
+		return "", nil
+	}
+	policy, ok := guardrailSetting.Policies[name]
+	if !ok || len(policy.Rules) == 0 {
+		return "", nil
+	}
+	return name, &policy
+}
+
+func (p *GuardrailPolicy) GetStreamWindow() int {
+	if p.StreamWindow <= 0 {
+		return 512
+	}
+	return p.StreamWindow
+}
+
+// HasStage 策略中是否存在作用于该阶段的规则
+func (p *GuardrailPolicy) HasStage(stage string) bool {
+	for _, rule := range p.Rules {
+		if rule.AppliesTo(stage) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *GuardrailRule) AppliesTo(stage string) bool {
+	return r.Stage == "" || r.Stage == stage
+}
+
+func (r *GuardrailRule) GetPIITypes() []string {
+	if len(r.PIITypes) == 0 {
+		return guardrailPIITypes
+	}
+	return r.PIITypes
+}
+
+// ValidateGuardrailPolicies 校验审核策略 JSON
+func ValidateGuardrailPolicies(jsonStr string) error {
+	policies := make(map[string]GuardrailPolicy)
+	if err := common.Unmarshal([]byte(jsonStr), &policies); err != nil {
+		return err
+	}
+	for name, policy := range policies {
+		for i, rule := range policy.Rules {
+			label := rule.Name
+			if label == "" {
+				label = fmt.Sprintf("#%d", i+1)
+			}
+			if err := validateGuardrailRule(rule); err != nil {
+				return fmt.Errorf("策略 %s 的规则 %s 无效：%w", name, label, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateGuardrailRule(rule GuardrailRule) error {
+	switch rule.Action {
+	case GuardrailActionBlock, GuardrailActionRedact, GuardrailActionFlag:
+	default:
+		return fmt.Errorf("不支持的动作 %q", rule.Action)
+	}
+	switch rule.Stage {
+	case "", GuardrailStagePrompt, GuardrailStageCompletion:
+	default:
+		return fmt.Errorf("不支持的阶段 %q", rule.Stage)
+	}
+	switch rule.Provider {
+	case GuardrailProviderKeyword:
+		if len(rule.Keywords) == 0 {
+			return fmt.Errorf("keywords 不能为空")
+		}
+		for _, keyword := range rule.Keywords {
+			if strings.TrimSpace(keyword) == "" {
+				return fmt.Errorf("keywords 不能包含空字符串")
+			}
+		}
+	case GuardrailProviderRegex:
+		if len(rule.Patterns) == 0 {
+			return fmt.Errorf("patterns 不能为空")
+		}
+		for _, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("正则 %q 无法编译：%w", pattern, err)
+			}
+		}
+	case GuardrailProviderPII:
+		for _, piiType := range rule.PIITypes {
+			if !common.StringsContains(guardrailPIITypes, piiType) {
+				return fmt.Errorf("不支持的 PII 类型 %q", piiType)
+			}
+		}
+	case GuardrailProviderModeration:
+		if strings.TrimSpace(rule.Model) == "" {
+			return fmt.Errorf("model 不能为空")
+		}
+		if rule.Action == GuardrailActionRedact {
+			return fmt.Errorf("moderation 不支持 redact")
+		}
+	default:
+		return fmt.Errorf("不支持的检测方式 %q", rule.Provider)
+	}
+	return nil
+}
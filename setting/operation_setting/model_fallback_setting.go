@@ -0,0 +1,67 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelFallbackAllGroups 对所有分组生效的降级链配置键
+const ModelFallbackAllGroups = "*"
+
+// ModelFallbackSetting 跨模型降级配置。
+// 请求模型的所有渠道均以可重试错误失败后，按降级链依次改用下一个模型重新分发
+type ModelFallbackSetting struct {
+	Enabled bool `json:"enabled"`
+	// Chains 分组 -> 请求模型 -> 按顺序尝试的降级模型，分组为 "*" 时对所有分组生效
+	Chains map[string]map[string][]string `json:"chains"`
+}
+
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled: false,
+	Chains:  map[string]map[string][]string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetModelFallbacks 返回分组下模型的降级链，分组未配置时使用 "*" 的配置
+func GetModelFallbacks(group string, modelName string) []string {
+	if !modelFallbackSetting.Enabled || modelName == "" {
+		return nil
+	}
+	if chains, ok := modelFallbackSetting.Chains[group]; ok {
+		if fallbacks, ok := chains[modelName]; ok {
+			return fallbacks
+		}
+	}
+	return modelFallbackSetting.Chains[ModelFallbackAllGroups][modelName]
+}
+
+// ValidateModelFallbackChains 校验降级链 JSON
+func ValidateModelFallbackChains(jsonStr string) error {
+	chains := make(map[string]map[string][]string)
+	if err := common.Unmarshal([]byte(jsonStr), &chains); err != nil {
+		return err
+	}
+	for group, models := range chains {
+		for modelName, fallbacks := range models {
+			for _, fallback := range fallbacks {
+				if strings.TrimSpace(fallback) == "" {
+					return fmt.Errorf("分组 %s 下模型 %s 的降级链包含空模型名", group, modelName)
+				}
+				if fallback == modelName {
+					return fmt.Errorf("分组 %s 下模型 %s 的降级链不能包含自身", group, modelName)
+				}
+			}
+		}
+	}
+	return nil
+}
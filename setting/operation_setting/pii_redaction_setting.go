@@ -0,0 +1,63 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PIIRedactionSetting 对话请求的 PII 脱敏与还原，按令牌或分组开启
+type PIIRedactionSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 对这些分组下的所有令牌开启；令牌也可单独开启
+	Groups []string `json:"groups"`
+	// PIITypes 需要脱敏的类型，为空时处理全部类型
+	PIITypes []string `json:"pii_types"`
+}
+
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled:  false,
+	Groups:   []string{},
+	PIITypes: []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// IsPIIRedactionGroup 分组是否开启了 PII 脱敏
+func IsPIIRedactionGroup(group string) bool {
+	for _, g := range piiRedactionSetting.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPIIRedactionTypes 返回需要脱敏的 PII 类型
+func GetPIIRedactionTypes() []string {
+	if len(piiRedactionSetting.PIITypes) == 0 {
+		return guardrailPIITypes
+	}
+	return piiRedactionSetting.PIITypes
+}
+
+// ValidatePIIRedactionTypes 校验 PII 类型列表 JSON
+func ValidatePIIRedactionTypes(jsonStr string) error {
+	var piiTypes []string
+	if err := common.Unmarshal([]byte(jsonStr), &piiTypes); err != nil {
+		return err
+	}
+	for _, piiType := range piiTypes {
+		if !common.StringsContains(guardrailPIITypes, piiType) {
+			return fmt.Errorf("不支持的 PII 类型 %q", piiType)
+		}
+	}
+	return nil
+}
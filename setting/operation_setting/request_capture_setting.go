@@ -0,0 +1,58 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RequestCaptureSetting 请求/响应抓取配置，用于排查中转转换问题。
+// 抓取需由管理员按令牌或渠道开启一个有限时间窗口，数据落盘并在 TTL 后清理
+type RequestCaptureSetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLHours 抓取数据保留时长
+	TTLHours int `json:"ttl_hours"`
+	// MaxBodyKB 单个请求体/响应体最多保留的大小，超出部分截断
+	MaxBodyKB int `json:"max_body_kb"`
+	// MaxWindowMinutes 单次开启抓取窗口的最长时间
+	MaxWindowMinutes int `json:"max_window_minutes"`
+	// FailedOnly 仅保存最终失败或发生过上游错误的请求
+	FailedOnly bool `json:"failed_only"`
+}
+
+var requestCaptureSetting = RequestCaptureSetting{
+	Enabled:          false,
+	TTLHours:         24,
+	MaxBodyKB:        1024,
+	MaxWindowMinutes: 24 * 60,
+	FailedOnly:       false,
+}
+
+func init() {
+	config.GlobalConfig.Register("request_capture_setting", &requestCaptureSetting)
+}
+
+func GetRequestCaptureSetting() *RequestCaptureSetting {
+	return &requestCaptureSetting
+}
+
+func GetRequestCaptureTTL() time.Duration {
+	if requestCaptureSetting.TTLHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(requestCaptureSetting.TTLHours) * time.Hour
+}
+
+func GetRequestCaptureMaxBodyBytes() int {
+	if requestCaptureSetting.MaxBodyKB <= 0 {
+		return 1024 << 10
+	}
+	return requestCaptureSetting.MaxBodyKB << 10
+}
+
+func GetRequestCaptureMaxWindow() time.Duration {
+	if requestCaptureSetting.MaxWindowMinutes <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(requestCaptureSetting.MaxWindowMinutes) * time.Minute
+}
@@ -0,0 +1,88 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	// ResponseCacheModeExact 按规范化后的请求精确匹配
+	ResponseCacheModeExact = "exact"
+)
+
+// ResponseCacheSetting 响应缓存配置（chat / completions / embeddings / responses），按令牌或分组开启
+type ResponseCacheSetting struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode"`
+	// Groups 对这些分组下的所有令牌开启缓存；令牌也可单独开启
+	Groups []string `json:"groups"`
+	// TTLSeconds 缓存有效期
+	TTLSeconds int `json:"ttl_seconds"`
+	// BillingRatio 命中缓存时按原价的该倍率计费（0-1]
+	BillingRatio float64 `json:"billing_ratio"`
+	// MaxEntryKB 单条响应超过该大小时不缓存
+	MaxEntryKB int `json:"max_entry_kb"`
+	// SharedAcrossUsers 是否在用户之间共享缓存，默认仅同一用户的请求可命中
+	SharedAcrossUsers bool `json:"shared_across_users"`
+	// MemoryCapacity 未启用 Redis 时内存缓存的最大条目数
+	MemoryCapacity int `json:"memory_capacity"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:        false,
+	Mode:           ResponseCacheModeExact,
+	Groups:         []string{},
+	TTLSeconds:     3600,
+	BillingRatio:   0.1,
+	MaxEntryKB:     1024,
+	MemoryCapacity: 10000,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsResponseCacheGroup 分组是否开启了响应缓存
+func IsResponseCacheGroup(group string) bool {
+	for _, g := range responseCacheSetting.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// GetResponseCacheBillingRatio 返回命中缓存时的计费倍率
+func GetResponseCacheBillingRatio() float64 {
+	ratio := responseCacheSetting.BillingRatio
+	if ratio <= 0 || ratio > 1 {
+		return 1
+	}
+	return ratio
+}
+
+// ValidateResponseCacheMode 校验缓存模式
+func ValidateResponseCacheMode(mode string) error {
+	if mode != ResponseCacheModeExact {
+		return fmt.Errorf("不支持的缓存模式：%s，当前仅支持 %s", mode, ResponseCacheModeExact)
+	}
+	return nil
+}
+
+// ValidateResponseCacheBillingRatio 校验命中缓存的计费倍率
+func ValidateResponseCacheBillingRatio(value string) error {
+	var ratio float64
+	if err := common.UnmarshalJsonStr(value, &ratio); err != nil {
+		return err
+	}
+	if ratio <= 0 || ratio > 1 {
+		return fmt.Errorf("缓存命中计费倍率必须在 (0, 1] 之间")
+	}
+	return nil
+}
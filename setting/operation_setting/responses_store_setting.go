@@ -0,0 +1,45 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponsesStoreSetting 网关侧 Responses API 会话存储配置。
+// 开启后网关保存响应输出，为不支持 previous_response_id 的上游展开完整上下文
+type ResponsesStoreSetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLHours 响应保留时长
+	TTLHours int `json:"ttl_hours"`
+	// MaxChainDepth 展开 previous_response_id 时最多回溯的轮数
+	MaxChainDepth int `json:"max_chain_depth"`
+}
+
+var responsesStoreSetting = ResponsesStoreSetting{
+	Enabled:       false,
+	TTLHours:      30 * 24,
+	MaxChainDepth: 100,
+}
+
+func init() {
+	config.GlobalConfig.Register("responses_store_setting", &responsesStoreSetting)
+}
+
+func GetResponsesStoreSetting() *ResponsesStoreSetting {
+	return &responsesStoreSetting
+}
+
+func GetResponsesStoreTTL() time.Duration {
+	if responsesStoreSetting.TTLHours <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(responsesStoreSetting.TTLHours) * time.Hour
+}
+
+func GetResponsesStoreMaxChainDepth() int {
+	if responsesStoreSetting.MaxChainDepth <= 0 {
+		return 100
+	}
+	return responsesStoreSetting.MaxChainDepth
+}
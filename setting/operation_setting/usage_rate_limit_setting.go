@@ -0,0 +1,82 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// UsageRateLimit 描述一组按用量计算的限流阈值，0 表示不限制。
+type UsageRateLimit struct {
+	// TPM 每分钟 token 数（预扣估算的输入 token，结算后按实际总 token 校正）
+	TPM int `json:"tpm"`
+	// RPD 每日请求数
+	RPD int `json:"rpd"`
+	// QuotaPerHour 每小时消费额度（quota 单位，预扣估算额度，结算后按实际额度校正）
+	QuotaPerHour int `json:"quota_per_hour"`
+}
+
+func (l UsageRateLimit) IsEmpty() bool {
+	return l.TPM <= 0 && l.RPD <= 0 && l.QuotaPerHour <= 0
+}
+
+// UsageRateLimitSetting 分组 / 模型维度的用量限流配置。
+// 分组与模型限制都按用户独立计数；令牌级限制保存在令牌本身上，不受 Enabled 开关影响。
+type UsageRateLimitSetting struct {
+	Enabled bool                      `json:"enabled"`
+	Groups  map[string]UsageRateLimit `json:"groups"`
+	Models  map[string]UsageRateLimit `json:"models"`
+}
+
+var usageRateLimitSetting = UsageRateLimitSetting{
+	Enabled: false,
+	Groups:  map[string]UsageRateLimit{},
+	Models:  map[string]UsageRateLimit{},
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_rate_limit_setting", &usageRateLimitSetting)
+}
+
+func GetUsageRateLimitSetting() *UsageRateLimitSetting {
+	return &usageRateLimitSetting
+}
+
+// GetGroupUsageRateLimit 返回分组的用量限流配置
+func GetGroupUsageRateLimit(group string) (UsageRateLimit, bool) {
+	if !usageRateLimitSetting.Enabled || usageRateLimitSetting.Groups == nil {
+		return UsageRateLimit{}, false
+	}
+	limit, ok := usageRateLimitSetting.Groups[group]
+	if !ok || limit.IsEmpty() {
+		return UsageRateLimit{}, false
+	}
+	return limit, true
+}
+
+// GetModelUsageRateLimit 返回模型的用量限流配置
+func GetModelUsageRateLimit(modelName string) (UsageRateLimit, bool) {
+	if !usageRateLimitSetting.Enabled || usageRateLimitSetting.Models == nil {
+		return UsageRateLimit{}, false
+	}
+	limit, ok := usageRateLimitSetting.Models[modelName]
+	if !ok || limit.IsEmpty() {
+		return UsageRateLimit{}, false
+	}
+	return limit, true
+}
+
+// ValidateUsageRateLimitMap 校验分组 / 模型用量限流 JSON
+func ValidateUsageRateLimitMap(jsonStr string) error {
+	limits := make(map[string]UsageRateLimit)
+	if err := common.Unmarshal([]byte(jsonStr), &limits); err != nil {
+		return err
+	}
+	for name, limit := range limits {
+		if limit.TPM < 0 || limit.RPD < 0 || limit.QuotaPerHour < 0 {
+			return fmt.Errorf("%s 的限流值不能为负数", name)
+		}
+	}
+	return nil
+}
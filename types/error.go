@@ -38,27 +38,31 @@ const (
 type ErrorCode string
 
 const (
-	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
-	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
-	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeInvalidRequest          ErrorCode = "invalid_request"
+	ErrorCodeSensitiveWordsDetected  ErrorCode = "sensitive_words_detected"
+	ErrorCodeGuardrailBlocked        ErrorCode = "guardrail_blocked"
+	ErrorCodePIIRedactionUnsupported ErrorCode = "pii_redaction_unsupported"
+	ErrorCodeViolationFeeGrokCSAM    ErrorCode = "violation_fee.grok.csam"
 
 	// new api error
-	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
-	ErrorCodeModelPriceError    ErrorCode = "model_price_error"
-	ErrorCodeInvalidApiType     ErrorCode = "invalid_api_type"
-	ErrorCodeJsonMarshalFailed  ErrorCode = "json_marshal_failed"
-	ErrorCodeDoRequestFailed    ErrorCode = "do_request_failed"
-	ErrorCodeGetChannelFailed   ErrorCode = "get_channel_failed"
-	ErrorCodeGenRelayInfoFailed ErrorCode = "gen_relay_info_failed"
+	ErrorCodeCountTokenFailed    ErrorCode = "count_token_failed"
+	ErrorCodeModelPriceError     ErrorCode = "model_price_error"
+	ErrorCodeInvalidApiType      ErrorCode = "invalid_api_type"
+	ErrorCodeJsonMarshalFailed   ErrorCode = "json_marshal_failed"
+	ErrorCodeDoRequestFailed     ErrorCode = "do_request_failed"
+	ErrorCodeGetChannelFailed    ErrorCode = "get_channel_failed"
+	ErrorCodeGenRelayInfoFailed  ErrorCode = "gen_relay_info_failed"
+	ErrorCodeMultiKeyCoolingDown ErrorCode = "multi_key_cooling_down"
 
 	// channel error
-	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
-	ErrorCodeChannelParamOverrideInvalid  ErrorCode = "channel:param_override_invalid"
-	ErrorCodeChannelHeaderOverrideInvalid ErrorCode = "channel:header_override_invalid"
-	ErrorCodeChannelModelMappedError      ErrorCode = "channel:model_mapped_error"
-	ErrorCodeChannelAwsClientError        ErrorCode = "channel:aws_client_error"
-	ErrorCodeChannelInvalidKey            ErrorCode = "channel:invalid_key"
-	ErrorCodeChannelResponseTimeExceeded  ErrorCode = "channel:response_time_exceeded"
+	ErrorCodeChannelNoAvailableKey          ErrorCode = "channel:no_available_key"
+	ErrorCodeChannelParamOverrideInvalid    ErrorCode = "channel:param_override_invalid"
+	ErrorCodeChannelHeaderOverrideInvalid   ErrorCode = "channel:header_override_invalid"
+	ErrorCodeChannelResponseOverrideInvalid ErrorCode = "channel:response_override_invalid"
+	ErrorCodeChannelModelMappedError        ErrorCode = "channel:model_mapped_error"
+	ErrorCodeChannelAwsClientError          ErrorCode = "channel:aws_client_error"
+	ErrorCodeChannelInvalidKey              ErrorCode = "channel:invalid_key"
+	ErrorCodeChannelResponseTimeExceeded    ErrorCode = "channel:response_time_exceeded"
 
 	// client request error
 	ErrorCodeReadRequestBodyFailed ErrorCode = "read_request_body_failed"
@@ -85,6 +89,9 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+
+	// rate limit error
+	ErrorCodeRateLimitExceeded ErrorCode = "rate_limit_exceeded"
 )
 
 type NewAPIError struct {
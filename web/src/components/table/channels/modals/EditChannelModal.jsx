@@ -209,6 +209,10 @@ const EditChannelModal = (props) => {
     upstream_model_update_last_check_time: 0,
     upstream_model_update_last_detected_models: [],
     upstream_model_update_ignored_models: '',
+    // 多密钥：单个密钥的每日上限与限流冷却（存入 settings）
+    multi_key_daily_request_limit: 0,
+    multi_key_daily_quota_limit: 0,
+    multi_key_cooldown_seconds: 0,
   };
   const [batch, setBatch] = useState(false);
   const [multiToSingle, setMultiToSingle] = useState(false);
@@ -901,6 +905,12 @@ const EditChannelModal = (props) => {
           )
             ? parsedSettings.upstream_model_update_ignored_models.join(',')
             : '';
+          data.multi_key_daily_request_limit =
+            Number(parsedSettings.multi_key_daily_request_limit) || 0;
+          data.multi_key_daily_quota_limit =
+            Number(parsedSettings.multi_key_daily_quota_limit) || 0;
+          data.multi_key_cooldown_seconds =
+            Number(parsedSettings.multi_key_cooldown_seconds) || 0;
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
@@ -919,6 +929,9 @@ const EditChannelModal = (props) => {
           data.upstream_model_update_last_check_time = 0;
           data.upstream_model_update_last_detected_models = [];
           data.upstream_model_update_ignored_models = '';
+          data.multi_key_daily_request_limit = 0;
+          data.multi_key_daily_quota_limit = 0;
+          data.multi_key_cooldown_seconds = 0;
         }
       } else {
         // 兼容历史数据：老渠道没有 settings 时，默认按 json 展示
@@ -936,6 +949,9 @@ const EditChannelModal = (props) => {
         data.upstream_model_update_last_check_time = 0;
         data.upstream_model_update_last_detected_models = [];
         data.upstream_model_update_ignored_models = '';
+        data.multi_key_daily_request_limit = 0;
+        data.multi_key_daily_quota_limit = 0;
+        data.multi_key_cooldown_seconds = 0;
       }
 
       if (
@@ -1761,6 +1777,16 @@ const EditChannelModal = (props) => {
       settings.upstream_model_update_last_check_time = 0;
     }
 
+    // 多密钥：保存单个密钥的每日上限与限流冷却时长
+    if (batch && multiToSingle) {
+      settings.multi_key_daily_request_limit =
+        Number(localInputs.multi_key_daily_request_limit) || 0;
+      settings.multi_key_daily_quota_limit =
+        Number(localInputs.multi_key_daily_quota_limit) || 0;
+      settings.multi_key_cooldown_seconds =
+        Number(localInputs.multi_key_cooldown_seconds) || 0;
+    }
+
     localInputs.settings = JSON.stringify(settings);
 
     // 清理不需要发送到后端的字段
@@ -1787,6 +1813,9 @@ const EditChannelModal = (props) => {
     delete localInputs.upstream_model_update_last_check_time;
     delete localInputs.upstream_model_update_last_detected_models;
     delete localInputs.upstream_model_update_ignored_models;
+    delete localInputs.multi_key_daily_request_limit;
+    delete localInputs.multi_key_daily_quota_limit;
+    delete localInputs.multi_key_cooldown_seconds;
 
     let res;
     localInputs.auto_ban = localInputs.auto_ban ? 1 : 0;
@@ -2740,6 +2769,8 @@ const EditChannelModal = (props) => {
                           optionList={[
                             { label: t('随机'), value: 'random' },
                             { label: t('轮询'), value: 'polling' },
+                            { label: t('最久未使用'), value: 'least_used' },
+                            { label: t('限流感知'), value: 'rate_limit' },
                           ]}
                           style={{ width: '100%' }}
                           value={inputs.multi_key_mode || 'random'}
@@ -2757,6 +2788,62 @@ const EditChannelModal = (props) => {
                             className='!rounded-lg mt-2'
                           />
                         )}
+                        {inputs.multi_key_mode === 'rate_limit' && (
+                          <Banner
+                            type='info'
+                            description={t(
+                              '限流感知模式会根据上游返回的 retry-after 与 x-ratelimit-* 响应头让密钥冷却一段时间，冷却期间不参与选择，429 错误不会自动禁用密钥',
+                            )}
+                            className='!rounded-lg mt-2'
+                          />
+                        )}
+                        <Row gutter={12}>
+                          <Col span={8}>
+                            <Form.InputNumber
+                              field='multi_key_daily_request_limit'
+                              label={t('单密钥每日请求上限')}
+                              extraText={t('0 表示不限制')}
+                              min={0}
+                              onNumberChange={(value) =>
+                                handleInputChange(
+                                  'multi_key_daily_request_limit',
+                                  value,
+                                )
+                              }
+                              style={{ width: '100%' }}
+                            />
+                          </Col>
+                          <Col span={8}>
+                            <Form.InputNumber
+                              field='multi_key_daily_quota_limit'
+                              label={t('单密钥每日额度上限')}
+                              extraText={t('0 表示不限制')}
+                              min={0}
+                              onNumberChange={(value) =>
+                                handleInputChange(
+                                  'multi_key_daily_quota_limit',
+                                  value,
+                                )
+                              }
+                              style={{ width: '100%' }}
+                            />
+                          </Col>
+                          <Col span={8}>
+                            <Form.InputNumber
+                              field='multi_key_cooldown_seconds'
+                              label={t('默认冷却秒数')}
+                              extraText={t('上游未返回重置时间时使用，默认 60')}
+                              min={0}
+                              onNumberChange={(value) =>
+                                handleInputChange(
+                                  'multi_key_cooldown_seconds',
+                                  value,
+                                )
+                              }
+                              style={{ width: '100%' }}
+                            />
+                          </Col>
+                        </Row>
                       </>
                     )}
 
@@ -109,6 +109,18 @@ const renderGroupColumn = (text, record, t) => {
 
 // Render token key column with show/hide and copy functionality
 const renderTokenKey = (text, record, showKeys, setShowKeys, copyText) => {
+  // 完整密钥仅在创建时返回，列表只返回前缀，无法查看或复制完整密钥
+  if (!record.key) {
+    return (
+      <div className='w-[200px]'>
+        <Input
+          readOnly
+          value={'sk-' + (record.key_prefix || '') + '**********'}
+          size='small'
+        />
+      </div>
+    );
+  }
   const fullKey = 'sk-' + record.key;
   const maskedKey =
     'sk-' + record.key.slice(0, 4) + '**********' + record.key.slice(-4);
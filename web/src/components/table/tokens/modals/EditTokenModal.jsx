@@ -41,6 +41,7 @@ import {
   Form,
   Col,
   Row,
+  Modal,
 } from '@douyinfe/semi-ui';
 import {
   IconCreditCard,
@@ -74,6 +75,7 @@ const EditTokenModal = (props) => {
     allow_ips: '',
     group: '',
     cross_group_retry: false,
+    response_cache: false,
     tokenCount: 1,
   });
 
@@ -236,6 +238,7 @@ const EditTokenModal = (props) => {
     } else {
       const count = parseInt(values.tokenCount, 10) || 1;
       let successCount = 0;
+      const createdKeys = [];
       for (let i = 0; i < count; i++) {
         let { tokenCount: _tc, ...localInputs } = values;
         const baseName =
@@ -259,9 +262,12 @@ const EditTokenModal = (props) => {
         localInputs.model_limits = localInputs.model_limits.join(',');
         localInputs.model_limits_enabled = localInputs.model_limits.length > 0;
         let res = await API.post(`/api/token/`, localInputs);
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
         if (success) {
           successCount++;
+          if (data?.key) {
+            createdKeys.push(data.name + '    sk-' + data.key);
+          }
         } else {
           showError(t(message));
           break;
@@ -269,6 +275,18 @@ const EditTokenModal = (props) => {
       }
       if (successCount > 0) {
         showSuccess(t('令牌创建成功，请在列表页面点击复制获取令牌！'));
+        if (createdKeys.length > 0) {
+          // 令牌以哈希存储时完整密钥只在创建时返回一次
+          Modal.info({
+            title: t('请立即保存令牌，关闭后将无法再次查看完整密钥'),
+            content: (
+              <Typography.Paragraph copyable className='whitespace-pre-wrap'>
+                {createdKeys.join('\n')}
+              </Typography.Paragraph>
+            ),
+            size: 'large',
+          });
+        }
         props.refresh();
         props.handleClose();
       }
@@ -393,6 +411,16 @@ const EditTokenModal = (props) => {
                       )}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='response_cache'
+                      label={t('响应缓存')}
+                      size='default'
+                      extraText={t(
+                        '开启后，相同请求将直接返回缓存结果并按缓存倍率计费（需管理员启用响应缓存）',
+                      )}
+                    />
+                  </Col>
                   <Col xs={24} sm={24} md={24} lg={10} xl={10}>
                     <Form.DatePicker
                       field='expired_time'
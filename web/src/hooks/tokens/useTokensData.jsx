@@ -124,6 +124,10 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
 
   // Open link function for chat integrations
   const onOpenLink = async (type, url, record) => {
+    if (!record.key) {
+      showError(t('完整密钥仅在创建时显示，无法再次获取，请重新创建令牌'));
+      return;
+    }
     if (url && url.startsWith('ccswitch')) {
       openCCSwitchModal(record.key);
       return;
@@ -319,6 +323,10 @@ export const useTokensData = (openFluentNotification, openCCSwitchModal) => {
       showError(t('请至少选择一个令牌！'));
       return;
     }
+    if (selectedKeys.some((token) => !token.key)) {
+      showError(t('完整密钥仅在创建时显示，无法再次获取，请重新创建令牌'));
+      return;
+    }
 
     Modal.info({
       title: t('复制令牌'),